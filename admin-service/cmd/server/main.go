@@ -5,8 +5,10 @@ import (
 	"log"
 
 	"cybermind/admin-service/configs"
+	"cybermind/admin-service/internal/api/handler"
 	"cybermind/admin-service/internal/api/router"
 	"cybermind/admin-service/pkg/database"
+	"cybermind/common/keycrypt"
 )
 
 func main() {
@@ -16,6 +18,17 @@ func main() {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
+	// 加载上游API Key的主密钥，与model-service使用相同的配置
+	keyring, err := keycrypt.Load()
+	if err != nil {
+		log.Fatalf("Failed to load key encryption keys: %v", err)
+	}
+	if keyring == nil {
+		log.Println("Warning: KEY_ENCRYPTION_KEYS is not set, provider API keys will be stored in plaintext")
+	} else {
+		keycrypt.SetDefault(keyring)
+	}
+
 	// 初始化数据库连接
 	if err := database.InitDB(&config.Database); err != nil {
 		log.Fatalf("Failed to init database: %v", err)
@@ -26,6 +39,9 @@ func main() {
 		log.Fatalf("Failed to init redis: %v", err)
 	}
 
+	// 审核复核配置
+	handler.SetModerationConfig(&config.Moderation)
+
 	// 设置路由
 	r := router.SetupRouter()
 
@@ -6,9 +6,10 @@ import (
 )
 
 type Config struct {
-	Server   ServerConfig   `json:"server"`
-	Database DatabaseConfig `json:"database"`
-	Redis    RedisConfig    `json:"redis"`
+	Server     ServerConfig     `json:"server"`
+	Database   DatabaseConfig   `json:"database"`
+	Redis      RedisConfig      `json:"redis"`
+	Moderation ModerationConfig `json:"moderation"`
 }
 
 type ServerConfig struct {
@@ -31,6 +32,10 @@ type RedisConfig struct {
 	DB       int    `json:"db"`
 }
 
+type ModerationConfig struct {
+	ViolationThreshold int `json:"violation_threshold"` // 累计违规达到该次数时自动封禁，0表示不自动封禁
+}
+
 func LoadConfig(path string) (*Config, error) {
 	file, err := os.Open(path)
 	if err != nil {
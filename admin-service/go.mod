@@ -3,6 +3,7 @@ module cybermind/admin-service
 go 1.22.5
 
 require (
+	cybermind/common v0.0.0
 	github.com/gin-gonic/gin v1.10.0
 	github.com/golang-jwt/jwt/v5 v5.2.1
 	github.com/redis/go-redis/v9 v9.7.0
@@ -52,3 +53,5 @@ require (
 	google.golang.org/protobuf v1.34.1 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
+
+replace cybermind/common => ../common
@@ -1,12 +1,15 @@
 package handler
 
 import (
+	"encoding/json"
 	"net/http"
 	"strconv"
 	"time"
 
 	"cybermind/admin-service/internal/model"
 	"cybermind/admin-service/pkg/database"
+	"cybermind/common/keycrypt"
+	"cybermind/common/modelconfig"
 
 	"github.com/gin-gonic/gin"
 )
@@ -20,6 +23,35 @@ type CreateModelRequest struct {
 	APIKey           string `json:"api_key" binding:"required"`
 	ModelName        string `json:"model_name" binding:"required"`
 	PointsPerRequest int    `json:"points_per_request" binding:"required,min=1"`
+	Config           json.RawMessage `json:"config"` // 模型配置，按适配器的schema校验
+	Pricing          *ModelPricing   `json:"pricing"` // 不传时按次计费
+}
+
+// ModelPricing 模型计费方式：request按次扣除points_per_request；token按实际用量和单价(每1000个token的积分)计算，
+// 不足min_points时按min_points扣除
+type ModelPricing struct {
+	Mode             string  `json:"mode" binding:"required,oneof=request token"`
+	InputPrice       float64 `json:"input_price" binding:"gte=0"`
+	OutputPrice      float64 `json:"output_price" binding:"gte=0"`
+	CachedInputPrice float64 `json:"cached_input_price" binding:"gte=0"` // 为0时按input_price计算
+	MinPoints        int     `json:"min_points" binding:"gte=0"`
+}
+
+// validatePricing 按token计费时至少需要设置一个单价
+func validatePricing(p *ModelPricing) bool {
+	return p == nil || p.Mode != "token" || p.InputPrice > 0 || p.OutputPrice > 0 || p.MinPoints > 0
+}
+
+// setPricing 将计费方式写入模型字段
+func setPricing(modelData map[string]interface{}, p *ModelPricing) {
+	if p == nil {
+		return
+	}
+	modelData["pricing_mode"] = p.Mode
+	modelData["pricing_input_price"] = p.InputPrice
+	modelData["pricing_output_price"] = p.OutputPrice
+	modelData["pricing_cached_input_price"] = p.CachedInputPrice
+	modelData["pricing_min_points"] = p.MinPoints
 }
 
 // CreateModel 创建模型
@@ -33,6 +65,25 @@ func CreateModel(c *gin.Context) {
 		return
 	}
 
+	if !validatePricing(req.Pricing) {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Code:    model.ParamError,
+			Message: "按token计费时需要设置单价",
+		})
+		return
+	}
+
+	// 按模型使用的适配器校验配置
+	schema := modelconfig.SchemaFor(modelconfig.Adapter(req.Provider, req.APIType))
+	if errs := schema.Validate(req.Config); len(errs) > 0 {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Code:    model.ParamError,
+			Message: "模型配置错误",
+			Data:    errs,
+		})
+		return
+	}
+
 	// 检查模型名称是否已存在
 	var count int64
 	database.DB.Table("models").Where("name = ?", req.Name).Count(&count)
@@ -44,18 +95,31 @@ func CreateModel(c *gin.Context) {
 		return
 	}
 
+	apiKey, err := keycrypt.Encrypt(req.APIKey)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Code:    model.SystemError,
+			Message: "系统错误",
+		})
+		return
+	}
+
 	// 创建模型
 	modelData := map[string]interface{}{
 		"name":               req.Name,
 		"provider":           req.Provider,
 		"api_type":          req.APIType,
 		"base_url":          req.BaseURL,
-		"api_key":           req.APIKey,
+		"api_key":           apiKey,
 		"model_name":        req.ModelName,
 		"points_per_request": req.PointsPerRequest,
 		"status":            1,
 		"created_at":        time.Now(),
 	}
+	if len(req.Config) > 0 {
+		modelData["config"] = string(req.Config)
+	}
+	setPricing(modelData, req.Pricing)
 
 	if err := database.DB.Table("models").Create(modelData).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, model.Response{
@@ -65,6 +129,8 @@ func CreateModel(c *gin.Context) {
 		return
 	}
 
+	// 返回脱敏后的Key
+	modelData["api_key"] = keycrypt.Mask(req.APIKey)
 	c.JSON(http.StatusOK, model.Response{
 		Code:    model.Success,
 		Message: "创建成功",
@@ -88,9 +154,14 @@ func GetModelList(c *gin.Context) {
 		BaseURL           string    `json:"base_url"`
 		ModelName         string    `json:"model_name"`
 		PointsPerRequest  int       `json:"points_per_request"`
+		PricingMode       string    `json:"pricing_mode"`
+		PricingInputPrice float64   `json:"pricing_input_price"`
+		PricingOutputPrice float64  `json:"pricing_output_price"`
+		PricingCachedInputPrice float64 `json:"pricing_cached_input_price"`
+		PricingMinPoints  int       `json:"pricing_min_points"`
 		Status            int       `json:"status"`
 		CreatedAt         time.Time `json:"created_at"`
-		LastRequestTime   time.Time `json:"last_request_time"`
+		LastRequestTime   *time.Time `json:"last_request_time"`
 		TotalRequests     int64     `json:"total_requests"`
 		SuccessRequests   int64     `json:"success_requests"`
 		FailedRequests    int64     `json:"failed_requests"`
@@ -103,17 +174,38 @@ func GetModelList(c *gin.Context) {
 	query := database.DB.Table("models")
 
 	if name != "" {
-		query = query.Where("name LIKE ?", "%"+name+"%")
+		query = query.Where("models.name LIKE ?", "%"+name+"%")
 	}
 	if provider != "" {
-		query = query.Where("provider = ?", provider)
+		query = query.Where("models.provider = ?", provider)
 	}
 	if status != "" {
-		query = query.Where("status = ?", status)
+		query = query.Where("models.status = ?", status)
 	}
 
 	query.Count(&total)
-	if err := query.Offset((page - 1) * size).Limit(size).Find(&models).Error; err != nil {
+
+	// 调用统计来自model-service写入的上游调用记录，切换路由时按实际调用的模型统计
+	requestStats := database.DB.Table("model_requests").
+		Select(`model_id,
+			COUNT(*) AS total_requests,
+			COUNT(CASE WHEN status = 1 THEN 1 END) AS success_requests,
+			COUNT(CASE WHEN status = 0 THEN 1 END) AS failed_requests,
+			AVG(CASE WHEN status = 1 THEN latency END) AS average_latency,
+			SUM(total_tokens) AS total_tokens,
+			SUM(points) AS total_points,
+			MAX(created_at) AS last_request_time`).
+		Group("model_id")
+	query = query.Select(`models.*,
+			COALESCE(r.total_requests, 0) AS total_requests,
+			COALESCE(r.success_requests, 0) AS success_requests,
+			COALESCE(r.failed_requests, 0) AS failed_requests,
+			COALESCE(r.average_latency, 0) AS average_latency,
+			COALESCE(r.total_tokens, 0) AS total_tokens,
+			COALESCE(r.total_points, 0) AS total_points,
+			r.last_request_time`).
+		Joins("LEFT JOIN (?) r ON r.model_id = models.id", requestStats)
+	if err := query.Order("models.id ASC").Offset((page - 1) * size).Limit(size).Find(&models).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, model.Response{
 			Code:    model.SystemError,
 			Message: "系统错误",
@@ -138,6 +230,9 @@ type UpdateModelRequest struct {
 	APIKey           string `json:"api_key" binding:"required"`
 	PointsPerRequest int    `json:"points_per_request" binding:"required,min=1"`
 	Status           int    `json:"status" binding:"required,oneof=0 1"`
+	Config           json.RawMessage `json:"config"`  // 为空时保持原配置不变
+	Pricing          *ModelPricing   `json:"pricing"` // 为空时保持原计费方式不变
+	Reason           string          `json:"reason" binding:"max=255"` // 变更原因，记录在模型的历史版本中
 }
 
 // UpdateModel 更新模型
@@ -160,10 +255,21 @@ func UpdateModel(c *gin.Context) {
 		return
 	}
 
+	if !validatePricing(req.Pricing) {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Code:    model.ParamError,
+			Message: "按token计费时需要设置单价",
+		})
+		return
+	}
+
 	// 检查模型是否存在
-	var count int64
-	database.DB.Table("models").Where("id = ?", id).Count(&count)
-	if count == 0 {
+	var current struct {
+		Provider string
+		APIType  string
+	}
+	if err := database.DB.Table("models").Select("provider, api_type").
+		Where("id = ?", id).Take(&current).Error; err != nil {
 		c.JSON(http.StatusNotFound, model.Response{
 			Code:    model.NotFound,
 			Message: "模型不存在",
@@ -171,7 +277,19 @@ func UpdateModel(c *gin.Context) {
 		return
 	}
 
+	// 按模型使用的适配器校验配置
+	schema := modelconfig.SchemaFor(modelconfig.Adapter(current.Provider, current.APIType))
+	if errs := schema.Validate(req.Config); len(errs) > 0 {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Code:    model.ParamError,
+			Message: "模型配置错误",
+			Data:    errs,
+		})
+		return
+	}
+
 	// 检查名称是否重复
+	var count int64
 	database.DB.Table("models").Where("name = ? AND id != ?", req.Name, id).Count(&count)
 	if count > 0 {
 		c.JSON(http.StatusBadRequest, model.Response{
@@ -185,13 +303,48 @@ func UpdateModel(c *gin.Context) {
 	modelData := map[string]interface{}{
 		"name":               req.Name,
 		"base_url":          req.BaseURL,
-		"api_key":           req.APIKey,
 		"points_per_request": req.PointsPerRequest,
 		"status":            req.Status,
 		"updated_at":        time.Now(),
 	}
+	if len(req.Config) > 0 {
+		modelData["config"] = string(req.Config)
+	}
+	setPricing(modelData, req.Pricing)
+	// 提交脱敏后的Key时保持原Key不变
+	if !keycrypt.IsMasked(req.APIKey) {
+		apiKey, err := keycrypt.Encrypt(req.APIKey)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, model.Response{
+				Code:    model.SystemError,
+				Message: "系统错误",
+			})
+			return
+		}
+		modelData["api_key"] = apiKey
+	}
 
-	if err := database.DB.Table("models").Where("id = ?", id).Updates(modelData).Error; err != nil {
+	// 更新前保存当前配置的历史版本
+	adminID, _ := c.Get("admin_id")
+	tx := database.DB.Begin()
+	if _, err := saveModelRevision(tx, id, adminID.(int64), revisionActionUpdate, req.Reason); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Code:    model.SystemError,
+			Message: "系统错误",
+		})
+		return
+	}
+	if err := tx.Table("models").Where("id = ?", id).Updates(modelData).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Code:    model.SystemError,
+			Message: "系统错误",
+		})
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		tx.Rollback()
 		c.JSON(http.StatusInternalServerError, model.Response{
 			Code:    model.SystemError,
 			Message: "系统错误",
@@ -240,4 +393,24 @@ func DeleteModel(c *gin.Context) {
 		Code:    model.Success,
 		Message: "删除成功",
 	})
-} 
\ No newline at end of file
+} 
+
+// GetModelConfigSchemas 获取模型配置的schema，用于渲染配置表单；
+// 指定provider或api_type时只返回模型使用的适配器的schema
+func GetModelConfigSchemas(c *gin.Context) {
+	provider, apiType := c.Query("provider"), c.Query("api_type")
+	if provider == "" && apiType == "" {
+		c.JSON(http.StatusOK, model.Response{
+			Code:    model.Success,
+			Message: "获取成功",
+			Data:    modelconfig.Schemas(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Code:    model.Success,
+		Message: "获取成功",
+		Data:    modelconfig.SchemaFor(modelconfig.Adapter(provider, apiType)),
+	})
+}
@@ -0,0 +1,521 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"cybermind/admin-service/internal/model"
+	"cybermind/admin-service/pkg/database"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 模型别名由model-service在调用时解析：用户按别名调用，请求按权重分配到别名下的部署，修改后立即生效
+
+// AliasTargetRequest 别名下的部署及流量权重
+type AliasTargetRequest struct {
+	ModelID int64 `json:"model_id" binding:"required"`
+	Weight  int   `json:"weight" binding:"min=0,max=10000"`
+}
+
+// CreateModelAliasRequest 创建模型别名请求
+type CreateModelAliasRequest struct {
+	Name        string               `json:"name" binding:"required,max=100"`
+	DisplayName string               `json:"display_name" binding:"max=100"`
+	Description string               `json:"description"`
+	Sticky      bool                 `json:"sticky"`
+	Policy      string               `json:"policy" binding:"omitempty,oneof=weighted score"` // 路由策略，默认weighted
+	Targets     []AliasTargetRequest `json:"targets" binding:"required,min=1,max=10,dive"`
+}
+
+// UpdateModelAliasRequest 更新模型别名请求
+type UpdateModelAliasRequest struct {
+	DisplayName *string `json:"display_name" binding:"omitempty,max=100"`
+	Description *string `json:"description"`
+	Sticky      *bool   `json:"sticky"`
+	Policy      *string `json:"policy" binding:"omitempty,oneof=weighted score"`
+	Status      *int    `json:"status" binding:"omitempty,oneof=0 1"`
+}
+
+// UpdateAliasTargetsRequest 替换别名的部署和权重
+type UpdateAliasTargetsRequest struct {
+	Targets []AliasTargetRequest `json:"targets" binding:"required,min=1,max=10,dive"`
+}
+
+// ModelAliasItem 模型别名
+type ModelAliasItem struct {
+	ID          int64             `json:"id"`
+	Name        string            `json:"name"`
+	DisplayName string            `json:"display_name"`
+	Description string            `json:"description"`
+	Sticky      bool              `json:"sticky"`
+	Policy      string            `json:"policy"`
+	Status      int               `json:"status"`
+	CreatedAt   time.Time         `json:"created_at"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+	Targets     []AliasTargetItem `json:"targets" gorm:"-"`
+}
+
+// AliasTargetItem 别名下的部署，Percent为按权重计算的流量占比
+type AliasTargetItem struct {
+	AliasID   int64   `json:"-"`
+	ModelID   int64   `json:"model_id"`
+	Weight    int     `json:"weight"`
+	Percent   float64 `json:"percent" gorm:"-"`
+	Name      string  `json:"name"`
+	Provider  string  `json:"provider"`
+	ModelName string  `json:"model_name"`
+	Status    int     `json:"status"`
+}
+
+// GetModelAliasList 获取模型别名列表及各部署的流量占比
+func GetModelAliasList(c *gin.Context) {
+	var aliases []ModelAliasItem
+	if err := database.DB.Table("model_aliases").Order("id ASC").Scan(&aliases).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Code:    model.SystemError,
+			Message: "系统错误",
+		})
+		return
+	}
+
+	var targets []AliasTargetItem
+	if err := database.DB.Table("model_alias_targets t").
+		Select("t.alias_id, t.model_id, t.weight, m.name, m.provider, m.model_name, m.status").
+		Joins("JOIN models m ON m.id = t.model_id").
+		Order("t.weight DESC, t.id ASC").
+		Scan(&targets).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Code:    model.SystemError,
+			Message: "系统错误",
+		})
+		return
+	}
+
+	byAlias := make(map[int64][]AliasTargetItem, len(aliases))
+	for _, t := range targets {
+		byAlias[t.AliasID] = append(byAlias[t.AliasID], t)
+	}
+	for i := range aliases {
+		aliases[i].Targets = withPercent(byAlias[aliases[i].ID])
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Code:    model.Success,
+		Message: "获取成功",
+		Data:    aliases,
+	})
+}
+
+// withPercent 按权重计算流量占比，只计算已启用的部署
+func withPercent(targets []AliasTargetItem) []AliasTargetItem {
+	total := 0
+	for _, t := range targets {
+		if t.Status == 1 {
+			total += t.Weight
+		}
+	}
+	for i := range targets {
+		if targets[i].Status == 1 && total > 0 {
+			targets[i].Percent = float64(targets[i].Weight*10000/total) / 100
+		}
+	}
+	if targets == nil {
+		targets = []AliasTargetItem{}
+	}
+	return targets
+}
+
+// CreateModelAlias 创建模型别名
+func CreateModelAlias(c *gin.Context) {
+	var req CreateModelAliasRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Code:    model.ParamError,
+			Message: "参数错误",
+		})
+		return
+	}
+	if msg := checkAliasTargets(req.Targets); msg != "" {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Code:    model.ParamError,
+			Message: msg,
+		})
+		return
+	}
+
+	// 检查别名是否已存在
+	var count int64
+	database.DB.Table("model_aliases").Where("name = ?", req.Name).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Code:    model.ParamError,
+			Message: "别名已存在",
+		})
+		return
+	}
+
+	if req.Policy == "" {
+		req.Policy = "weighted"
+	}
+	adminID, _ := c.Get("admin_id")
+	now := time.Now()
+
+	// 开始事务
+	tx := database.DB.Begin()
+
+	var id int64
+	if err := tx.Raw(`INSERT INTO model_aliases (name, display_name, description, sticky, policy, status, created_at, updated_at)
+VALUES (?, ?, ?, ?, ?, 1, ?, ?) RETURNING id`, req.Name, req.DisplayName, req.Description, req.Sticky, req.Policy, now, now).Scan(&id).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Code:    model.SystemError,
+			Message: "系统错误",
+		})
+		return
+	}
+
+	if err := replaceAliasTargets(tx, id, req.Targets); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Code:    model.SystemError,
+			Message: "系统错误",
+		})
+		return
+	}
+
+	// 记录操作日志
+	if err := tx.Create(&model.AdminOperation{
+		AdminID:     adminID.(int64),
+		Module:      "model",
+		Action:      "create_alias",
+		Description: fmt.Sprintf("创建模型别名%s: %s", req.Name, describeAliasTargets(req.Targets)),
+		IP:          c.ClientIP(),
+	}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Code:    model.SystemError,
+			Message: "系统错误",
+		})
+		return
+	}
+
+	// 提交事务
+	if err := tx.Commit().Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Code:    model.SystemError,
+			Message: "系统错误",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Code:    model.Success,
+		Message: "创建成功",
+		Data: gin.H{
+			"id":           id,
+			"name":         req.Name,
+			"display_name": req.DisplayName,
+			"description":  req.Description,
+			"sticky":       req.Sticky,
+			"policy":       req.Policy,
+			"status":       1,
+			"created_at":   now,
+		},
+	})
+}
+
+// UpdateModelAlias 更新模型别名的展示名称、说明、Sticky、路由策略和状态
+func UpdateModelAlias(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Code:    model.ParamError,
+			Message: "参数错误",
+		})
+		return
+	}
+
+	var req UpdateModelAliasRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Code:    model.ParamError,
+			Message: "参数错误",
+		})
+		return
+	}
+
+	updates := map[string]interface{}{"updated_at": time.Now()}
+	if req.DisplayName != nil {
+		updates["display_name"] = *req.DisplayName
+	}
+	if req.Description != nil {
+		updates["description"] = *req.Description
+	}
+	if req.Sticky != nil {
+		updates["sticky"] = *req.Sticky
+	}
+	if req.Policy != nil {
+		updates["policy"] = *req.Policy
+	}
+	if req.Status != nil {
+		updates["status"] = *req.Status
+	}
+
+	result := database.DB.Table("model_aliases").Where("id = ?", id).Updates(updates)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Code:    model.SystemError,
+			Message: "系统错误",
+		})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, model.Response{
+			Code:    model.NotFound,
+			Message: "别名不存在",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Code:    model.Success,
+		Message: "更新成功",
+	})
+}
+
+// UpdateModelAliasTargets 替换别名的部署和权重，用于在部署之间调整流量占比
+func UpdateModelAliasTargets(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Code:    model.ParamError,
+			Message: "参数错误",
+		})
+		return
+	}
+
+	var req UpdateAliasTargetsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Code:    model.ParamError,
+			Message: "参数错误",
+		})
+		return
+	}
+	if msg := checkAliasTargets(req.Targets); msg != "" {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Code:    model.ParamError,
+			Message: msg,
+		})
+		return
+	}
+
+	var name string
+	if err := database.DB.Table("model_aliases").Select("name").Where("id = ?", id).Take(&name).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, model.Response{
+				Code:    model.NotFound,
+				Message: "别名不存在",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Code:    model.SystemError,
+			Message: "系统错误",
+		})
+		return
+	}
+
+	adminID, _ := c.Get("admin_id")
+
+	// 开始事务
+	tx := database.DB.Begin()
+
+	if err := replaceAliasTargets(tx, id, req.Targets); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Code:    model.SystemError,
+			Message: "系统错误",
+		})
+		return
+	}
+
+	if err := tx.Table("model_aliases").Where("id = ?", id).Update("updated_at", time.Now()).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Code:    model.SystemError,
+			Message: "系统错误",
+		})
+		return
+	}
+
+	// 记录操作日志
+	if err := tx.Create(&model.AdminOperation{
+		AdminID:     adminID.(int64),
+		Module:      "model",
+		Action:      "update_alias_targets",
+		Description: fmt.Sprintf("模型别名%s流量分配: %s", name, describeAliasTargets(req.Targets)),
+		IP:          c.ClientIP(),
+	}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Code:    model.SystemError,
+			Message: "系统错误",
+		})
+		return
+	}
+
+	// 提交事务
+	if err := tx.Commit().Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Code:    model.SystemError,
+			Message: "系统错误",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Code:    model.Success,
+		Message: "更新成功",
+	})
+}
+
+// DeleteModelAlias 删除模型别名
+func DeleteModelAlias(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Code:    model.ParamError,
+			Message: "参数错误",
+		})
+		return
+	}
+
+	adminID, _ := c.Get("admin_id")
+
+	// 开始事务
+	tx := database.DB.Begin()
+
+	result := tx.Table("model_aliases").Where("id = ?", id).Delete(nil)
+	if result.Error != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Code:    model.SystemError,
+			Message: "系统错误",
+		})
+		return
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		c.JSON(http.StatusNotFound, model.Response{
+			Code:    model.NotFound,
+			Message: "别名不存在",
+		})
+		return
+	}
+
+	if err := tx.Table("model_alias_targets").Where("alias_id = ?", id).Delete(nil).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Code:    model.SystemError,
+			Message: "系统错误",
+		})
+		return
+	}
+
+	// 记录操作日志
+	if err := tx.Create(&model.AdminOperation{
+		AdminID:     adminID.(int64),
+		Module:      "model",
+		Action:      "delete_alias",
+		Description: fmt.Sprintf("删除模型别名%d", id),
+		IP:          c.ClientIP(),
+	}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Code:    model.SystemError,
+			Message: "系统错误",
+		})
+		return
+	}
+
+	// 提交事务
+	if err := tx.Commit().Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Code:    model.SystemError,
+			Message: "系统错误",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Code:    model.Success,
+		Message: "删除成功",
+	})
+}
+
+// checkAliasTargets 部署不能重复且必须存在，至少一个部署的权重大于0，返回错误信息
+func checkAliasTargets(targets []AliasTargetRequest) string {
+	seen := make(map[int64]bool, len(targets))
+	ids := make([]int64, 0, len(targets))
+	total := 0
+	for _, t := range targets {
+		if seen[t.ModelID] {
+			return "部署模型重复"
+		}
+		seen[t.ModelID] = true
+		ids = append(ids, t.ModelID)
+		total += t.Weight
+	}
+	if total == 0 {
+		return "至少一个部署的权重大于0"
+	}
+
+	var count int64
+	database.DB.Table("models").Where("id IN ?", ids).Count(&count)
+	if int(count) != len(ids) {
+		return "部署模型不存在"
+	}
+	return ""
+}
+
+// replaceAliasTargets 替换别名的部署
+func replaceAliasTargets(tx *gorm.DB, aliasID int64, targets []AliasTargetRequest) error {
+	if err := tx.Table("model_alias_targets").Where("alias_id = ?", aliasID).Delete(nil).Error; err != nil {
+		return err
+	}
+	now := time.Now()
+	rows := make([]map[string]interface{}, len(targets))
+	for i, t := range targets {
+		rows[i] = map[string]interface{}{
+			"alias_id":   aliasID,
+			"model_id":   t.ModelID,
+			"weight":     t.Weight,
+			"created_at": now,
+			"updated_at": now,
+		}
+	}
+	return tx.Table("model_alias_targets").Create(rows).Error
+}
+
+// describeAliasTargets 操作日志中的流量分配，如"模型3:80% 模型5:20%"
+func describeAliasTargets(targets []AliasTargetRequest) string {
+	total := 0
+	for _, t := range targets {
+		total += t.Weight
+	}
+	parts := make([]string, len(targets))
+	for i, t := range targets {
+		parts[i] = fmt.Sprintf("模型%d:%d%%", t.ModelID, t.Weight*100/total)
+	}
+	return strings.Join(parts, " ")
+}
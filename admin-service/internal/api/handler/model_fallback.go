@@ -0,0 +1,183 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"cybermind/admin-service/internal/model"
+	"cybermind/admin-service/pkg/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 备用路由由model-service在模型调用失败或熔断时按顺序尝试，修改后立即生效
+
+// UpdateFallbacksRequest 更新备用路由请求，按数组顺序作为优先级
+type UpdateFallbacksRequest struct {
+	FallbackModelIDs []int64 `json:"fallback_model_ids" binding:"max=10"`
+}
+
+// FallbackItem 备用路由
+type FallbackItem struct {
+	FallbackModelID int64  `json:"fallback_model_id"`
+	Priority        int    `json:"priority"`
+	Name            string `json:"name"`
+	Provider        string `json:"provider"`
+	ModelName       string `json:"model_name"`
+	Status          int    `json:"status"`
+}
+
+// GetModelFallbacks 获取模型的备用路由
+func GetModelFallbacks(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Code:    model.ParamError,
+			Message: "参数错误",
+		})
+		return
+	}
+
+	var fallbacks []FallbackItem
+	if err := database.DB.Table("model_fallbacks f").
+		Select("f.fallback_model_id, f.priority, m.name, m.provider, m.model_name, m.status").
+		Joins("JOIN models m ON m.id = f.fallback_model_id").
+		Where("f.model_id = ?", id).
+		Order("f.priority ASC, f.id ASC").
+		Scan(&fallbacks).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Code:    model.SystemError,
+			Message: "系统错误",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Code:    model.Success,
+		Message: "获取成功",
+		Data:    fallbacks,
+	})
+}
+
+// UpdateModelFallbacks 替换模型的备用路由
+func UpdateModelFallbacks(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Code:    model.ParamError,
+			Message: "参数错误",
+		})
+		return
+	}
+
+	var req UpdateFallbacksRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Code:    model.ParamError,
+			Message: "参数错误",
+		})
+		return
+	}
+
+	// 检查模型是否存在
+	var count int64
+	database.DB.Table("models").Where("id = ?", id).Count(&count)
+	if count == 0 {
+		c.JSON(http.StatusNotFound, model.Response{
+			Code:    model.NotFound,
+			Message: "模型不存在",
+		})
+		return
+	}
+
+	// 备用模型不能重复，也不能是模型自身
+	seen := make(map[int64]bool, len(req.FallbackModelIDs))
+	for _, fid := range req.FallbackModelIDs {
+		if fid == id || seen[fid] {
+			c.JSON(http.StatusBadRequest, model.Response{
+				Code:    model.ParamError,
+				Message: "备用模型重复或为模型自身",
+			})
+			return
+		}
+		seen[fid] = true
+	}
+	if len(req.FallbackModelIDs) > 0 {
+		database.DB.Table("models").Where("id IN ?", req.FallbackModelIDs).Count(&count)
+		if int(count) != len(req.FallbackModelIDs) {
+			c.JSON(http.StatusBadRequest, model.Response{
+				Code:    model.ParamError,
+				Message: "备用模型不存在",
+			})
+			return
+		}
+	}
+
+	adminID, _ := c.Get("admin_id")
+	now := time.Now()
+
+	// 开始事务
+	tx := database.DB.Begin()
+
+	if err := tx.Table("model_fallbacks").Where("model_id = ?", id).Delete(nil).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Code:    model.SystemError,
+			Message: "系统错误",
+		})
+		return
+	}
+
+	if len(req.FallbackModelIDs) > 0 {
+		rows := make([]map[string]interface{}, len(req.FallbackModelIDs))
+		for i, fid := range req.FallbackModelIDs {
+			rows[i] = map[string]interface{}{
+				"model_id":          id,
+				"fallback_model_id": fid,
+				"priority":          i + 1,
+				"created_at":        now,
+			}
+		}
+		if err := tx.Table("model_fallbacks").Create(rows).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, model.Response{
+				Code:    model.SystemError,
+				Message: "系统错误",
+			})
+			return
+		}
+	}
+
+	// 记录操作日志
+	if err := tx.Create(&model.AdminOperation{
+		AdminID:     adminID.(int64),
+		Module:      "model",
+		Action:      "update_fallbacks",
+		Description: fmt.Sprintf("模型%d备用路由: %v", id, req.FallbackModelIDs),
+		IP:          c.ClientIP(),
+	}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Code:    model.SystemError,
+			Message: "系统错误",
+		})
+		return
+	}
+
+	// 提交事务
+	if err := tx.Commit().Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Code:    model.SystemError,
+			Message: "系统错误",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Code:    model.Success,
+		Message: "更新成功",
+	})
+}
@@ -0,0 +1,406 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"cybermind/admin-service/internal/model"
+	"cybermind/admin-service/pkg/database"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 模型配置变更类型，与model-service一致
+const (
+	revisionActionUpdate   = "update"
+	revisionActionRollback = "rollback"
+)
+
+// modelSnapshot 模型配置快照，键为models表的列名
+type modelSnapshot map[string]json.RawMessage
+
+// snapshotSkipFields 快照中不包含、回滚时不恢复的列：不属于模型配置的列，以及api_key。
+// api_key按主密钥加密，轮换主密钥后历史版本中的Key无法解密，回滚也不应恢复管理员已经替换的Key
+var snapshotSkipFields = map[string]bool{"id": true, "created_at": true, "updated_at": true, "deleted_at": true, "api_key": true}
+
+// saveModelRevision 锁定模型并保存当前的完整配置作为新版本，返回保存的快照。需在同一事务中更新模型之前调用，
+// 模型不存在时返回gorm.ErrRecordNotFound
+func saveModelRevision(tx *gorm.DB, modelID, adminID int64, action, reason string) (modelSnapshot, error) {
+	var rows []struct {
+		Snapshot string
+	}
+	if err := tx.Raw(`SELECT to_jsonb(m) - 'id' - 'created_at' - 'updated_at' - 'deleted_at' - 'api_key' AS snapshot
+FROM models m WHERE id = ? AND deleted_at IS NULL FOR UPDATE`, modelID).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	var version int
+	if err := tx.Table("model_revisions").Where("model_id = ?", modelID).
+		Select("COALESCE(MAX(version), 0)").Scan(&version).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Table("model_revisions").Create(map[string]interface{}{
+		"model_id":   modelID,
+		"version":    version + 1,
+		"snapshot":   rows[0].Snapshot,
+		"action":     action,
+		"admin_id":   adminID,
+		"reason":     reason,
+		"created_at": time.Now(),
+	}).Error; err != nil {
+		return nil, err
+	}
+
+	var snapshot modelSnapshot
+	if err := json.Unmarshal([]byte(rows[0].Snapshot), &snapshot); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// modelRevision 模型的历史版本
+type modelRevision struct {
+	ID            int64     `json:"id"`
+	ModelID       int64     `json:"model_id"`
+	Version       int       `json:"version"`
+	Snapshot      string    `json:"-"`
+	Action        string    `json:"action"`
+	AdminID       int64     `json:"admin_id"`
+	AdminUsername string    `json:"admin_username"`
+	Reason        string    `json:"reason"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// GetModelRevisions 获取模型的历史版本，按版本从新到旧排序。第N个版本为第N次变更之前的配置，
+// 变更内容通过GetModelRevisionDiff查看
+func GetModelRevisions(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Code:    model.ParamError,
+			Message: "参数错误",
+		})
+		return
+	}
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	size, _ := strconv.Atoi(c.DefaultQuery("size", "10"))
+
+	var total int64
+	var revisions []modelRevision
+	query := database.DB.Table("model_revisions r").Where("r.model_id = ?", id)
+	query.Count(&total)
+	if err := query.Select("r.id, r.model_id, r.version, r.action, r.admin_id, admins.username AS admin_username, r.reason, r.created_at").
+		Joins("LEFT JOIN admins ON admins.id = r.admin_id").
+		Order("r.version DESC").Offset((page - 1) * size).Limit(size).
+		Scan(&revisions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Code:    model.SystemError,
+			Message: "系统错误",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Code:    model.Success,
+		Message: "获取成功",
+		Data: model.PageResponse{
+			Total: total,
+			List:  revisions,
+		},
+	})
+}
+
+// fieldChange 配置项的变更
+type fieldChange struct {
+	Field string          `json:"field"`
+	Old   json.RawMessage `json:"old"`
+	New   json.RawMessage `json:"new"`
+}
+
+// GetModelRevisionDiff 查看历史版本与另一个版本的差异。查询参数to为对比的版本号或current(当前配置)，
+// 不传时与该版本之后的配置对比，即第N次变更的内容
+func GetModelRevisionDiff(c *gin.Context) {
+	id, err1 := strconv.ParseInt(c.Param("id"), 10, 64)
+	version, err2 := strconv.Atoi(c.Param("version"))
+	if err1 != nil || err2 != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Code:    model.ParamError,
+			Message: "参数错误",
+		})
+		return
+	}
+
+	from, err := findModelRevision(id, version)
+	if err != nil {
+		c.JSON(http.StatusNotFound, model.Response{
+			Code:    model.NotFound,
+			Message: "版本不存在",
+		})
+		return
+	}
+
+	// 确定对比的版本：指定的版本、当前配置或下一个版本(最新版本的下一个为当前配置)
+	to := c.Query("to")
+	if to == "" {
+		to = "current"
+		var next int64
+		database.DB.Table("model_revisions").Where("model_id = ? AND version = ?", id, version+1).Count(&next)
+		if next > 0 {
+			to = strconv.Itoa(version + 1)
+		}
+	}
+	var target string
+	if to == "current" {
+		var rows []struct {
+			Snapshot string
+		}
+		database.DB.Raw(`SELECT to_jsonb(m) - 'id' - 'created_at' - 'updated_at' - 'deleted_at' - 'api_key' AS snapshot
+FROM models m WHERE id = ? AND deleted_at IS NULL`, id).Scan(&rows)
+		if len(rows) == 0 {
+			c.JSON(http.StatusNotFound, model.Response{
+				Code:    model.NotFound,
+				Message: "模型不存在",
+			})
+			return
+		}
+		target = rows[0].Snapshot
+	} else {
+		toVersion, err := strconv.Atoi(to)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, model.Response{
+				Code:    model.ParamError,
+				Message: "参数错误",
+			})
+			return
+		}
+		rev, err := findModelRevision(id, toVersion)
+		if err != nil {
+			c.JSON(http.StatusNotFound, model.Response{
+				Code:    model.NotFound,
+				Message: "版本不存在",
+			})
+			return
+		}
+		target = rev.Snapshot
+	}
+
+	var oldSnapshot, newSnapshot modelSnapshot
+	if err := json.Unmarshal([]byte(from.Snapshot), &oldSnapshot); err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Code:    model.SystemError,
+			Message: "系统错误",
+		})
+		return
+	}
+	if err := json.Unmarshal([]byte(target), &newSnapshot); err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Code:    model.SystemError,
+			Message: "系统错误",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Code:    model.Success,
+		Message: "获取成功",
+		Data: gin.H{
+			"revision": from,
+			"to":       to,
+			"changes":  diffModelSnapshots(oldSnapshot, newSnapshot),
+		},
+	})
+}
+
+// diffModelSnapshots 比较两个快照，按字段名排序返回有变化的字段
+func diffModelSnapshots(old, new modelSnapshot) []fieldChange {
+	fields := make(map[string]bool, len(old)+len(new))
+	for k := range old {
+		fields[k] = true
+	}
+	for k := range new {
+		fields[k] = true
+	}
+
+	changes := make([]fieldChange, 0)
+	for field := range fields {
+		if snapshotSkipFields[field] || jsonEqual(old[field], new[field]) {
+			continue
+		}
+		changes = append(changes, fieldChange{Field: field, Old: old[field], New: new[field]})
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Field < changes[j].Field
+	})
+	return changes
+}
+
+// jsonEqual 按JSON值比较，忽略格式和对象键的顺序
+func jsonEqual(a, b json.RawMessage) bool {
+	if bytes.Equal(a, b) {
+		return true
+	}
+	var va, vb interface{}
+	if json.Unmarshal(a, &va) != nil || json.Unmarshal(b, &vb) != nil {
+		return false
+	}
+	ca, _ := json.Marshal(va)
+	cb, _ := json.Marshal(vb)
+	return bytes.Equal(ca, cb)
+}
+
+func findModelRevision(modelID int64, version int) (*modelRevision, error) {
+	var rev modelRevision
+	err := database.DB.Table("model_revisions r").
+		Select("r.id, r.model_id, r.version, r.snapshot, r.action, r.admin_id, admins.username AS admin_username, r.reason, r.created_at").
+		Joins("LEFT JOIN admins ON admins.id = r.admin_id").
+		Where("r.model_id = ? AND r.version = ?", modelID, version).
+		Take(&rev).Error
+	return &rev, err
+}
+
+// RollbackModelRequest 回滚模型请求
+type RollbackModelRequest struct {
+	Reason string `json:"reason" binding:"max=255"`
+}
+
+// RollbackModel 将模型配置回滚到历史版本，回滚前的配置同样保存为新版本，可以再次回滚。
+// 快照之后新增的列保持当前值
+func RollbackModel(c *gin.Context) {
+	id, err1 := strconv.ParseInt(c.Param("id"), 10, 64)
+	version, err2 := strconv.Atoi(c.Param("version"))
+	// 请求体可以为空
+	var req RollbackModelRequest
+	if err1 != nil || err2 != nil || (c.Request.ContentLength != 0 && c.ShouldBindJSON(&req) != nil) {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Code:    model.ParamError,
+			Message: "参数错误",
+		})
+		return
+	}
+
+	rev, err := findModelRevision(id, version)
+	if err != nil {
+		c.JSON(http.StatusNotFound, model.Response{
+			Code:    model.NotFound,
+			Message: "版本不存在",
+		})
+		return
+	}
+	var target modelSnapshot
+	if err := json.Unmarshal([]byte(rev.Snapshot), &target); err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Code:    model.SystemError,
+			Message: "系统错误",
+		})
+		return
+	}
+
+	if req.Reason == "" {
+		req.Reason = fmt.Sprintf("回滚到版本%d", version)
+	}
+	adminID, _ := c.Get("admin_id")
+
+	// 开始事务
+	tx := database.DB.Begin()
+
+	current, err := saveModelRevision(tx, id, adminID.(int64), revisionActionRollback, req.Reason)
+	if err != nil {
+		tx.Rollback()
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, model.Response{
+				Code:    model.NotFound,
+				Message: "模型不存在",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Code:    model.SystemError,
+			Message: "系统错误",
+		})
+		return
+	}
+
+	// 在事务中锁定模型后检查名称是否已被其他模型使用
+	var name string
+	json.Unmarshal(target["name"], &name)
+	var count int64
+	if err := tx.Table("models").Where("name = ? AND id != ? AND deleted_at IS NULL", name, id).Count(&count).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Code:    model.SystemError,
+			Message: "系统错误",
+		})
+		return
+	}
+	if count > 0 {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, model.Response{
+			Code:    model.ParamError,
+			Message: "模型名称已被其他模型使用",
+		})
+		return
+	}
+
+	// 只恢复快照和当前表结构中都存在的列，列名来自to_jsonb的结果
+	columns := make([]string, 0, len(target))
+	for col := range target {
+		if _, ok := current[col]; ok && !snapshotSkipFields[col] {
+			columns = append(columns, col)
+		}
+	}
+	sort.Strings(columns)
+	sets := ""
+	for _, col := range columns {
+		sets += fmt.Sprintf("%q = r.%q, ", col, col)
+	}
+	if err := tx.Exec(`UPDATE models SET `+sets+`updated_at = ?
+FROM jsonb_populate_record(NULL::models, ?::jsonb) r WHERE models.id = ?`, time.Now(), rev.Snapshot, id).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Code:    model.SystemError,
+			Message: "系统错误",
+		})
+		return
+	}
+
+	// 记录操作日志
+	if err := tx.Create(&model.AdminOperation{
+		AdminID:     adminID.(int64),
+		Module:      "model",
+		Action:      "rollback_model",
+		Description: fmt.Sprintf("模型%d回滚到版本%d: %s", id, version, req.Reason),
+		IP:          c.ClientIP(),
+	}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Code:    model.SystemError,
+			Message: "系统错误",
+		})
+		return
+	}
+
+	// 提交事务
+	if err := tx.Commit().Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Code:    model.SystemError,
+			Message: "系统错误",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Code:    model.Success,
+		Message: "回滚成功",
+	})
+}
@@ -0,0 +1,416 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"cybermind/admin-service/internal/model"
+	"cybermind/admin-service/pkg/database"
+	"cybermind/common/moderation"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 审核词库和规则由chat-service定期重新加载，修改后约1分钟内生效
+
+// KeywordRequest 敏感词请求
+type KeywordRequest struct {
+	Word     string `json:"word" binding:"required,max=100"`
+	Category string `json:"category" binding:"max=50"`
+	Action   int    `json:"action" binding:"required,oneof=1 2"`
+	Status   *int   `json:"status" binding:"omitempty,oneof=0 1"`
+}
+
+// RuleRequest 正则规则请求
+type RuleRequest struct {
+	Name     string `json:"name" binding:"required,max=100"`
+	Pattern  string `json:"pattern" binding:"required,max=500"`
+	MaxLen   int    `json:"max_len" binding:"omitempty,min=1,max=500"` // 最长匹配的字符数，正则的匹配长度不固定时必填
+	Category string `json:"category" binding:"max=50"`
+	Action   int    `json:"action" binding:"required,oneof=1 2"`
+	Status   *int   `json:"status" binding:"omitempty,oneof=0 1"`
+}
+
+// checkRulePattern 校验正则规则，返回错误提示：流式输出按最长匹配长度暂缓下发尾部文本，
+// 匹配长度不固定(含*、+或没有上限的重复)的正则需要设置max_len
+func checkRulePattern(req *RuleRequest) string {
+	n, err := moderation.PatternMaxLen(req.Pattern)
+	if err != nil {
+		return "正则表达式无效"
+	}
+	if n < 0 && req.MaxLen <= 0 {
+		return "正则的匹配长度不固定，需要设置max_len"
+	}
+	return ""
+}
+
+// GetKeywordList 获取敏感词列表
+func GetKeywordList(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	size, _ := strconv.Atoi(c.DefaultQuery("size", "10"))
+	word := c.Query("word")
+	category := c.Query("category")
+	status := c.Query("status")
+
+	var keywords []struct {
+		ID        int64     `json:"id"`
+		Word      string    `json:"word"`
+		Category  string    `json:"category"`
+		Action    int       `json:"action"`
+		Status    int       `json:"status"`
+		CreatedAt time.Time `json:"created_at"`
+		UpdatedAt time.Time `json:"updated_at"`
+	}
+
+	var total int64
+	query := database.DB.Table("moderation_keywords")
+
+	if word != "" {
+		query = query.Where("word LIKE ?", "%"+word+"%")
+	}
+	if category != "" {
+		query = query.Where("category = ?", category)
+	}
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	query.Count(&total)
+	if err := query.Order("id DESC").Offset((page - 1) * size).Limit(size).Find(&keywords).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Code:    model.SystemError,
+			Message: "系统错误",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Code:    model.Success,
+		Message: "获取成功",
+		Data: model.PageResponse{
+			Total: total,
+			List:  keywords,
+		},
+	})
+}
+
+// CreateKeyword 添加敏感词
+func CreateKeyword(c *gin.Context) {
+	var req KeywordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Code:    model.ParamError,
+			Message: "参数错误",
+		})
+		return
+	}
+
+	var count int64
+	database.DB.Table("moderation_keywords").Where("word = ?", req.Word).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Code:    model.ParamError,
+			Message: "敏感词已存在",
+		})
+		return
+	}
+
+	status := 1
+	if req.Status != nil {
+		status = *req.Status
+	}
+	keywordData := map[string]interface{}{
+		"word":       req.Word,
+		"category":   req.Category,
+		"action":     req.Action,
+		"status":     status,
+		"created_at": time.Now(),
+		"updated_at": time.Now(),
+	}
+
+	if err := database.DB.Table("moderation_keywords").Create(keywordData).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Code:    model.SystemError,
+			Message: "系统错误",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Code:    model.Success,
+		Message: "创建成功",
+		Data:    keywordData,
+	})
+}
+
+// UpdateKeyword 更新敏感词
+func UpdateKeyword(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Code:    model.ParamError,
+			Message: "参数错误",
+		})
+		return
+	}
+
+	var req KeywordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Code:    model.ParamError,
+			Message: "参数错误",
+		})
+		return
+	}
+
+	var count int64
+	database.DB.Table("moderation_keywords").Where("id = ?", id).Count(&count)
+	if count == 0 {
+		c.JSON(http.StatusNotFound, model.Response{
+			Code:    model.NotFound,
+			Message: "敏感词不存在",
+		})
+		return
+	}
+
+	database.DB.Table("moderation_keywords").Where("word = ? AND id != ?", req.Word, id).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Code:    model.ParamError,
+			Message: "敏感词已存在",
+		})
+		return
+	}
+
+	keywordData := map[string]interface{}{
+		"word":       req.Word,
+		"category":   req.Category,
+		"action":     req.Action,
+		"updated_at": time.Now(),
+	}
+	if req.Status != nil {
+		keywordData["status"] = *req.Status
+	}
+
+	if err := database.DB.Table("moderation_keywords").Where("id = ?", id).Updates(keywordData).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Code:    model.SystemError,
+			Message: "系统错误",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Code:    model.Success,
+		Message: "更新成功",
+	})
+}
+
+// DeleteKeyword 删除敏感词
+func DeleteKeyword(c *gin.Context) {
+	deleteModerationEntry(c, "moderation_keywords", "敏感词不存在")
+}
+
+// GetRuleList 获取正则规则列表
+func GetRuleList(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	size, _ := strconv.Atoi(c.DefaultQuery("size", "10"))
+	name := c.Query("name")
+	category := c.Query("category")
+	status := c.Query("status")
+
+	var rules []struct {
+		ID        int64     `json:"id"`
+		Name      string    `json:"name"`
+		Pattern   string    `json:"pattern"`
+		MaxLen    int       `json:"max_len"`
+		Category  string    `json:"category"`
+		Action    int       `json:"action"`
+		Status    int       `json:"status"`
+		CreatedAt time.Time `json:"created_at"`
+		UpdatedAt time.Time `json:"updated_at"`
+	}
+
+	var total int64
+	query := database.DB.Table("moderation_rules")
+
+	if name != "" {
+		query = query.Where("name LIKE ?", "%"+name+"%")
+	}
+	if category != "" {
+		query = query.Where("category = ?", category)
+	}
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	query.Count(&total)
+	if err := query.Order("id DESC").Offset((page - 1) * size).Limit(size).Find(&rules).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Code:    model.SystemError,
+			Message: "系统错误",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Code:    model.Success,
+		Message: "获取成功",
+		Data: model.PageResponse{
+			Total: total,
+			List:  rules,
+		},
+	})
+}
+
+// CreateRule 添加正则规则
+func CreateRule(c *gin.Context) {
+	var req RuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Code:    model.ParamError,
+			Message: "参数错误",
+		})
+		return
+	}
+
+	if message := checkRulePattern(&req); message != "" {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Code:    model.ParamError,
+			Message: message,
+		})
+		return
+	}
+
+	status := 1
+	if req.Status != nil {
+		status = *req.Status
+	}
+	ruleData := map[string]interface{}{
+		"name":       req.Name,
+		"pattern":    req.Pattern,
+		"max_len":    req.MaxLen,
+		"category":   req.Category,
+		"action":     req.Action,
+		"status":     status,
+		"created_at": time.Now(),
+		"updated_at": time.Now(),
+	}
+
+	if err := database.DB.Table("moderation_rules").Create(ruleData).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Code:    model.SystemError,
+			Message: "系统错误",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Code:    model.Success,
+		Message: "创建成功",
+		Data:    ruleData,
+	})
+}
+
+// UpdateRule 更新正则规则
+func UpdateRule(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Code:    model.ParamError,
+			Message: "参数错误",
+		})
+		return
+	}
+
+	var req RuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Code:    model.ParamError,
+			Message: "参数错误",
+		})
+		return
+	}
+
+	if message := checkRulePattern(&req); message != "" {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Code:    model.ParamError,
+			Message: message,
+		})
+		return
+	}
+
+	var count int64
+	database.DB.Table("moderation_rules").Where("id = ?", id).Count(&count)
+	if count == 0 {
+		c.JSON(http.StatusNotFound, model.Response{
+			Code:    model.NotFound,
+			Message: "规则不存在",
+		})
+		return
+	}
+
+	ruleData := map[string]interface{}{
+		"name":       req.Name,
+		"pattern":    req.Pattern,
+		"max_len":    req.MaxLen,
+		"category":   req.Category,
+		"action":     req.Action,
+		"updated_at": time.Now(),
+	}
+	if req.Status != nil {
+		ruleData["status"] = *req.Status
+	}
+
+	if err := database.DB.Table("moderation_rules").Where("id = ?", id).Updates(ruleData).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Code:    model.SystemError,
+			Message: "系统错误",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Code:    model.Success,
+		Message: "更新成功",
+	})
+}
+
+// DeleteRule 删除正则规则
+func DeleteRule(c *gin.Context) {
+	deleteModerationEntry(c, "moderation_rules", "规则不存在")
+}
+
+// deleteModerationEntry 按ID删除敏感词或正则规则
+func deleteModerationEntry(c *gin.Context, table, notFound string) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Code:    model.ParamError,
+			Message: "参数错误",
+		})
+		return
+	}
+
+	result := database.DB.Table(table).Where("id = ?", id).Delete(nil)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Code:    model.SystemError,
+			Message: "系统错误",
+		})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, model.Response{
+			Code:    model.NotFound,
+			Message: notFound,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Code:    model.Success,
+		Message: "删除成功",
+	})
+}
@@ -0,0 +1,449 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"cybermind/admin-service/configs"
+	"cybermind/admin-service/internal/model"
+	"cybermind/admin-service/pkg/database"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var moderationConfig = &configs.ModerationConfig{}
+
+// SetModerationConfig 设置审核复核配置
+func SetModerationConfig(config *configs.ModerationConfig) {
+	moderationConfig = config
+}
+
+// reviewStatus 复核动作对应的记录状态
+var reviewStatus = map[string]int{
+	"approve": model.ModerationApproved,
+	"confirm": model.ModerationConfirmed,
+	"ban":     model.ModerationBanned,
+}
+
+// ModerationEventItem 审核记录
+type ModerationEventItem struct {
+	ID             int64           `json:"id"`
+	UserID         int64           `json:"user_id"`
+	Username       string          `json:"username"`
+	ConversationID int64           `json:"conversation_id"`
+	ModelID        int64           `json:"model_id"`
+	Source         string          `json:"source"`
+	Content        string          `json:"content"`
+	Hits           json.RawMessage `json:"hits"`
+	Action         int             `json:"action"`
+	Status         int             `json:"status"`
+	ReviewedBy     int64           `json:"reviewed_by"`
+	ReviewNote     string          `json:"review_note"`
+	ReviewedAt     *time.Time      `json:"reviewed_at"`
+	CreatedAt      time.Time       `json:"created_at"`
+}
+
+// GetModerationEventList 获取审核记录列表
+func GetModerationEventList(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	size, _ := strconv.Atoi(c.DefaultQuery("size", "10"))
+	status := c.Query("status")
+	source := c.Query("source")
+	action := c.Query("action")
+	userID := c.Query("user_id")
+	modelID := c.Query("model_id")
+	category := c.Query("category")
+	startDate := c.Query("start_date")
+	endDate := c.Query("end_date")
+
+	var events []ModerationEventItem
+	var total int64
+	query := database.DB.Table("moderation_events e").
+		Joins("LEFT JOIN users u ON u.id = e.user_id")
+
+	if status != "" {
+		query = query.Where("e.status = ?", status)
+	}
+	if source != "" {
+		query = query.Where("e.source = ?", source)
+	}
+	if action != "" {
+		query = query.Where("e.action = ?", action)
+	}
+	if userID != "" {
+		query = query.Where("e.user_id = ?", userID)
+	}
+	if modelID != "" {
+		query = query.Where("e.model_id = ?", modelID)
+	}
+	if category != "" {
+		filter, _ := json.Marshal([]map[string]string{{"category": category}})
+		query = query.Where("e.hits @> ?::jsonb", string(filter))
+	}
+	if startDate != "" {
+		query = query.Where("e.created_at >= ?", startDate)
+	}
+	if endDate != "" {
+		query = query.Where("e.created_at < (?::date + 1)", endDate)
+	}
+
+	query.Count(&total)
+	if err := query.Select("e.*, u.username").
+		Order("e.id DESC").
+		Offset((page - 1) * size).Limit(size).
+		Find(&events).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Code:    model.SystemError,
+			Message: "系统错误",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Code:    model.Success,
+		Message: "获取成功",
+		Data: model.PageResponse{
+			Total: total,
+			List:  events,
+		},
+	})
+}
+
+// GetModerationEventDetail 获取审核记录详情及用户违规次数
+func GetModerationEventDetail(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Code:    model.ParamError,
+			Message: "参数错误",
+		})
+		return
+	}
+
+	var event ModerationEventItem
+	if err := database.DB.Table("moderation_events e").
+		Joins("LEFT JOIN users u ON u.id = e.user_id").
+		Select("e.*, u.username").
+		Where("e.id = ?", id).
+		Take(&event).Error; err != nil {
+		c.JSON(http.StatusNotFound, model.Response{
+			Code:    model.NotFound,
+			Message: "审核记录不存在",
+		})
+		return
+	}
+
+	var violation model.UserViolation
+	database.DB.Where("user_id = ?", event.UserID).Take(&violation)
+
+	c.JSON(http.StatusOK, model.Response{
+		Code:    model.Success,
+		Message: "获取成功",
+		Data: gin.H{
+			"event":           event,
+			"violation_count": violation.Count,
+		},
+	})
+}
+
+// ResolveModerationEventRequest 复核审核记录请求
+type ResolveModerationEventRequest struct {
+	Action string `json:"action" binding:"required,oneof=approve confirm ban"`
+	Points int    `json:"points"` // 积分调整，负数为扣除
+	Note   string `json:"note" binding:"max=255"`
+}
+
+// ResolveModerationEvent 复核审核记录：误判放行、确认违规或封禁用户，可同时调整用户积分。
+// 确认违规时累计用户违规次数，达到阈值时自动封禁
+func ResolveModerationEvent(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Code:    model.ParamError,
+			Message: "参数错误",
+		})
+		return
+	}
+
+	var req ResolveModerationEventRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Code:    model.ParamError,
+			Message: "参数错误",
+		})
+		return
+	}
+
+	adminID, _ := c.Get("admin_id")
+	status := reviewStatus[req.Action]
+	now := time.Now()
+
+	// 开始事务
+	tx := database.DB.Begin()
+
+	// 锁定审核记录，避免重复复核
+	var event struct {
+		ID     int64
+		UserID int64
+		Status int
+	}
+	if err := tx.Table("moderation_events").
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ?", id).
+		Take(&event).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusNotFound, model.Response{
+			Code:    model.NotFound,
+			Message: "审核记录不存在",
+		})
+		return
+	}
+	if event.Status != model.ModerationPending {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, model.Response{
+			Code:    model.ParamError,
+			Message: "该记录已复核",
+		})
+		return
+	}
+
+	// 更新复核结果
+	if err := tx.Table("moderation_events").Where("id = ?", id).Updates(map[string]interface{}{
+		"status":      status,
+		"reviewed_by": adminID,
+		"review_note": req.Note,
+		"reviewed_at": now,
+	}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Code:    model.SystemError,
+			Message: "系统错误",
+		})
+		return
+	}
+
+	operations := []model.AdminOperation{{
+		AdminID:     adminID.(int64),
+		Module:      "moderation",
+		Action:      "review_" + req.Action,
+		Description: fmt.Sprintf("复核审核记录%d: %s", id, req.Note),
+		IP:          c.ClientIP(),
+	}}
+
+	// 调整积分，扣除时积分不低于0，并写入积分流水
+	if req.Points != 0 {
+		if err := adjustUserPoints(tx, event.UserID, req.Points, fmt.Sprintf("审核记录%d复核", id)); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, model.Response{
+				Code:    model.SystemError,
+				Message: "系统错误",
+			})
+			return
+		}
+		operations = append(operations, model.AdminOperation{
+			AdminID:     adminID.(int64),
+			Module:      "user",
+			Action:      "adjust_points",
+			Description: fmt.Sprintf("用户%d积分调整%+d(审核记录%d)", event.UserID, req.Points, id),
+			IP:          c.ClientIP(),
+		})
+	}
+
+	// 累计违规次数，封禁或达到阈值时禁用用户
+	violationCount := 0
+	suspended := false
+	if status != model.ModerationApproved {
+		violationCount, err = incrViolation(tx, event.UserID, now)
+		if err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, model.Response{
+				Code:    model.SystemError,
+				Message: "系统错误",
+			})
+			return
+		}
+
+		reason := ""
+		if status == model.ModerationBanned {
+			reason = fmt.Sprintf("审核记录%d确认违规，封禁用户", id)
+		} else if moderationConfig.ViolationThreshold > 0 && violationCount >= moderationConfig.ViolationThreshold {
+			reason = fmt.Sprintf("累计违规%d次，达到阈值%d，自动封禁", violationCount, moderationConfig.ViolationThreshold)
+		}
+		if reason != "" {
+			result := tx.Table("users").Where("id = ? AND status != 0", event.UserID).Update("status", 0)
+			if result.Error != nil {
+				tx.Rollback()
+				c.JSON(http.StatusInternalServerError, model.Response{
+					Code:    model.SystemError,
+					Message: "系统错误",
+				})
+				return
+			}
+			suspended = true
+			if result.RowsAffected > 0 {
+				operations = append(operations, model.AdminOperation{
+					AdminID:     adminID.(int64),
+					Module:      "user",
+					Action:      "update_status",
+					Description: fmt.Sprintf("用户%d: %s", event.UserID, reason),
+					IP:          c.ClientIP(),
+				})
+			}
+		}
+	}
+
+	// 记录操作日志
+	if err := tx.Create(&operations).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Code:    model.SystemError,
+			Message: "系统错误",
+		})
+		return
+	}
+
+	// 提交事务
+	if err := tx.Commit().Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Code:    model.SystemError,
+			Message: "系统错误",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Code:    model.Success,
+		Message: "复核成功",
+		Data: gin.H{
+			"status":          status,
+			"violation_count": violationCount,
+			"suspended":       suspended,
+		},
+	})
+}
+
+// incrViolation 用户违规次数加一，返回累计次数
+func incrViolation(tx *gorm.DB, userID int64, now time.Time) (int, error) {
+	violation := model.UserViolation{UserID: userID, Count: 1, LastViolationAt: now}
+	if err := tx.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"count":             gorm.Expr("user_violations.count + 1"),
+			"last_violation_at": now,
+			"updated_at":        now,
+		}),
+	}).Create(&violation).Error; err != nil {
+		return 0, err
+	}
+	if err := tx.Where("user_id = ?", userID).Take(&violation).Error; err != nil {
+		return 0, err
+	}
+	return violation.Count, nil
+}
+
+// GetViolationList 获取用户违规计数列表
+func GetViolationList(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	size, _ := strconv.Atoi(c.DefaultQuery("size", "10"))
+
+	var violations []struct {
+		UserID          int64     `json:"user_id"`
+		Username        string    `json:"username"`
+		Status          int       `json:"status"`
+		Count           int       `json:"count"`
+		LastViolationAt time.Time `json:"last_violation_at"`
+	}
+	var total int64
+	query := database.DB.Table("user_violations v").
+		Joins("LEFT JOIN users u ON u.id = v.user_id").
+		Where("v.count > 0")
+
+	query.Count(&total)
+	if err := query.Select("v.user_id, u.username, u.status, v.count, v.last_violation_at").
+		Order("v.count DESC, v.last_violation_at DESC").
+		Offset((page - 1) * size).Limit(size).
+		Find(&violations).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Code:    model.SystemError,
+			Message: "系统错误",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Code:    model.Success,
+		Message: "获取成功",
+		Data: model.PageResponse{
+			Total: total,
+			List:  violations,
+		},
+	})
+}
+
+// ResetViolation 清零用户违规次数(解封用户后使用)
+func ResetViolation(c *gin.Context) {
+	userID, err := strconv.ParseInt(c.Param("user_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Code:    model.ParamError,
+			Message: "参数错误",
+		})
+		return
+	}
+
+	if err := database.DB.Model(&model.UserViolation{}).Where("user_id = ?", userID).
+		Updates(map[string]interface{}{"count": 0, "updated_at": time.Now()}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Code:    model.SystemError,
+			Message: "系统错误",
+		})
+		return
+	}
+
+	// 记录操作日志
+	adminID, _ := c.Get("admin_id")
+	operation := &model.AdminOperation{
+		AdminID:     adminID.(int64),
+		Module:      "moderation",
+		Action:      "reset_violation",
+		Description: fmt.Sprintf("清零用户%d违规次数", userID),
+		IP:          c.ClientIP(),
+	}
+	database.DB.Create(operation)
+
+	c.JSON(http.StatusOK, model.Response{
+		Code:    model.Success,
+		Message: "更新成功",
+	})
+}
+
+// adjustUserPoints 调整用户积分并写入积分流水(type为admin)，扣除时积分不低于0，流水按实际变动记录
+func adjustUserPoints(tx *gorm.DB, userID int64, delta int, remark string) error {
+	var points int
+	if err := tx.Table("users").Where("id = ?", userID).Clauses(clause.Locking{Strength: "UPDATE"}).
+		Select("points").Scan(&points).Error; err != nil {
+		return err
+	}
+	balance := max(points+delta, 0)
+	if balance == points {
+		return nil
+	}
+	if err := tx.Table("users").Where("id = ?", userID).Update("points", balance).Error; err != nil {
+		return err
+	}
+	return tx.Table("points_ledger").Create(map[string]interface{}{
+		"user_id":    userID,
+		"change":     balance - points,
+		"balance":    balance,
+		"type":       "admin",
+		"source":     "moderation",
+		"remark":     remark,
+		"created_at": time.Now(),
+	}).Error
+}
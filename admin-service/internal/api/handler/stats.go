@@ -2,6 +2,7 @@ package handler
 
 import (
 	"net/http"
+	"strconv"
 	"time"
 
 	"cybermind/admin-service/internal/model"
@@ -20,6 +21,8 @@ func GetStatsOverview(c *gin.Context) {
 		TotalRequests  int64   `json:"total_requests"`
 		SuccessRate    float64 `json:"success_rate"`
 		AverageLatency float64 `json:"average_latency"`
+		FeedbackCount  int64   `json:"feedback_count"`
+		Satisfaction   float64 `json:"satisfaction_rate"`
 	}
 
 	// 获取用户统计
@@ -30,16 +33,22 @@ func GetStatsOverview(c *gin.Context) {
 	database.DB.Table("orders").Count(&stats.TotalOrders)
 	database.DB.Table("orders").Select("COALESCE(SUM(amount), 0)").Row().Scan(&stats.TotalAmount)
 
-	// 获取请求统计
+	// 获取请求统计，成功率不计调用方取消(status = 2)的请求，与模型列表的failed_requests一致
 	database.DB.Table("model_requests").Count(&stats.TotalRequests)
 	database.DB.Table("model_requests").
-		Select("COALESCE(AVG(CASE WHEN status = 1 THEN 1 ELSE 0 END), 0)").
+		Select("COALESCE(AVG(CASE WHEN status = 1 THEN 1 WHEN status = 0 THEN 0 END), 0)").
 		Row().Scan(&stats.SuccessRate)
 	database.DB.Table("model_requests").
 		Select("COALESCE(AVG(latency), 0)").
 		Where("status = 1").
 		Row().Scan(&stats.AverageLatency)
 
+	// 获取回复满意度统计
+	database.DB.Table("message_feedback").Count(&stats.FeedbackCount)
+	database.DB.Table("message_feedback").
+		Select("COALESCE(AVG(CASE WHEN rating > 0 THEN 1 ELSE 0 END), 0)").
+		Row().Scan(&stats.Satisfaction)
+
 	c.JSON(http.StatusOK, model.Response{
 		Code:    model.Success,
 		Message: "获取成功",
@@ -60,6 +69,7 @@ func GetDailyStats(c *gin.Context) {
 		AverageLatency float64 `json:"average_latency"`
 	}
 
+	// 各表先按天聚合再关联，避免多表直接连接导致行数相乘
 	database.DB.Raw(`
 		WITH dates AS (
 			SELECT generate_series(
@@ -67,21 +77,43 @@ func GetDailyStats(c *gin.Context) {
 				date_trunc('day', now()),
 				interval '1 day'
 			)::date AS date
+		),
+		new_users AS (
+			SELECT created_at::date AS date, COUNT(*) AS count
+			FROM users WHERE created_at >= now() - interval '30 days'
+			GROUP BY 1
+		),
+		active_users AS (
+			SELECT last_active_at::date AS date, COUNT(*) AS count
+			FROM users WHERE last_active_at >= now() - interval '30 days'
+			GROUP BY 1
+		),
+		order_stats AS (
+			SELECT created_at::date AS date, COUNT(*) AS count, COALESCE(SUM(amount), 0) AS amount
+			FROM orders WHERE created_at >= now() - interval '30 days'
+			GROUP BY 1
+		),
+		request_stats AS (
+			SELECT created_at::date AS date, COUNT(*) AS count,
+				AVG(CASE WHEN status = 1 THEN 1 WHEN status = 0 THEN 0 END) AS success_rate,
+				AVG(CASE WHEN status = 1 THEN latency END) AS average_latency
+			FROM model_requests WHERE created_at >= now() - interval '30 days'
+			GROUP BY 1
 		)
 		SELECT 
 			d.date::text,
-			COUNT(DISTINCT CASE WHEN u.created_at::date = d.date THEN u.id END) as new_users,
-			COUNT(DISTINCT CASE WHEN u.last_active_at::date = d.date THEN u.id END) as active_users,
-			COUNT(DISTINCT CASE WHEN o.created_at::date = d.date THEN o.id END) as order_count,
-			COALESCE(SUM(CASE WHEN o.created_at::date = d.date THEN o.amount ELSE 0 END), 0) as order_amount,
-			COUNT(DISTINCT CASE WHEN r.created_at::date = d.date THEN r.id END) as request_count,
-			COALESCE(AVG(CASE WHEN r.created_at::date = d.date THEN CASE WHEN r.status = 1 THEN 1 ELSE 0 END END), 0) as success_rate,
-			COALESCE(AVG(CASE WHEN r.created_at::date = d.date AND r.status = 1 THEN r.latency END), 0) as average_latency
+			COALESCE(nu.count, 0) as new_users,
+			COALESCE(au.count, 0) as active_users,
+			COALESCE(o.count, 0) as order_count,
+			COALESCE(o.amount, 0) as order_amount,
+			COALESCE(r.count, 0) as request_count,
+			COALESCE(r.success_rate, 0) as success_rate,
+			COALESCE(r.average_latency, 0) as average_latency
 		FROM dates d
-		LEFT JOIN users u ON TRUE
-		LEFT JOIN orders o ON TRUE
-		LEFT JOIN model_requests r ON TRUE
-		GROUP BY d.date
+		LEFT JOIN new_users nu ON nu.date = d.date
+		LEFT JOIN active_users au ON au.date = d.date
+		LEFT JOIN order_stats o ON o.date = d.date
+		LEFT JOIN request_stats r ON r.date = d.date
 		ORDER BY d.date DESC
 	`).Scan(&stats)
 
@@ -243,4 +275,137 @@ func GetOrderStats(c *gin.Context) {
 		Message: "获取成功",
 		Data:    stats,
 	})
-} 
\ No newline at end of file
+} 
+
+// GetModelSatisfaction 获取各模型的回复满意度
+func GetModelSatisfaction(c *gin.Context) {
+	startTime := c.Query("start_time")
+	endTime := c.Query("end_time")
+
+	var stats []struct {
+		ModelID      int64   `json:"model_id"`
+		ModelName    string  `json:"model_name"`
+		Provider     string  `json:"provider"`
+		TotalCount   int64   `json:"total_count"`
+		UpCount      int64   `json:"up_count"`
+		DownCount    int64   `json:"down_count"`
+		Satisfaction float64 `json:"satisfaction_rate"`
+	}
+
+	query := database.DB.Table("message_feedback f").
+		Select(`f.model_id, models.name as model_name, models.provider,
+			COUNT(*) as total_count,
+			COUNT(CASE WHEN f.rating > 0 THEN 1 END) as up_count,
+			COUNT(CASE WHEN f.rating < 0 THEN 1 END) as down_count,
+			COALESCE(AVG(CASE WHEN f.rating > 0 THEN 1 ELSE 0 END), 0) as satisfaction`).
+		Joins("left join models on models.id = f.model_id")
+
+	if startTime != "" {
+		query = query.Where("f.created_at >= ?", startTime)
+	}
+	if endTime != "" {
+		query = query.Where("f.created_at <= ?", endTime)
+	}
+
+	if err := query.Group("f.model_id, models.name, models.provider").
+		Order("total_count DESC").
+		Scan(&stats).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Code:    model.SystemError,
+			Message: "系统错误",
+		})
+		return
+	}
+
+	// 差评原因分布
+	var reasons []struct {
+		ModelID int64  `json:"model_id"`
+		Reason  string `json:"reason"`
+		Count   int64  `json:"count"`
+	}
+	reasonQuery := database.DB.Table("message_feedback f, unnest(f.reasons) AS reason").
+		Select("f.model_id, reason, COUNT(*) as count").
+		Where("f.rating < 0")
+	if startTime != "" {
+		reasonQuery = reasonQuery.Where("f.created_at >= ?", startTime)
+	}
+	if endTime != "" {
+		reasonQuery = reasonQuery.Where("f.created_at <= ?", endTime)
+	}
+	reasonQuery.Group("f.model_id, reason").Order("count DESC").Scan(&reasons)
+
+	c.JSON(http.StatusOK, model.Response{
+		Code:    model.Success,
+		Message: "获取成功",
+		Data: gin.H{
+			"models":  stats,
+			"reasons": reasons,
+		},
+	})
+}
+
+// GetModelFeedbackList 获取模型的评价明细(可定位到具体对话)
+func GetModelFeedbackList(c *gin.Context) {
+	modelID, err := strconv.ParseInt(c.Param("model_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Code:    model.ParamError,
+			Message: "参数错误",
+		})
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	size, _ := strconv.Atoi(c.DefaultQuery("size", "10"))
+	rating := c.Query("rating")
+	reason := c.Query("reason")
+
+	var feedback []struct {
+		ID                int64     `json:"id"`
+		UserID            int64     `json:"user_id"`
+		Username          string    `json:"username"`
+		ConversationID    int64     `json:"conversation_id"`
+		ConversationTitle string    `json:"conversation_title"`
+		MessageID         int64     `json:"message_id"`
+		MessageContent    string    `json:"message_content"`
+		Rating            int       `json:"rating"`
+		Reasons           string    `json:"reasons"`
+		Comment           string    `json:"comment"`
+		CreatedAt         time.Time `json:"created_at"`
+	}
+
+	var total int64
+	query := database.DB.Table("message_feedback f").
+		Select(`f.id, f.user_id, users.username, f.conversation_id, conversations.title as conversation_title,
+			f.message_id, LEFT(messages.content, 200) as message_content, f.rating,
+			array_to_string(f.reasons, ',') as reasons, f.comment, f.created_at`).
+		Joins("left join users on users.id = f.user_id").
+		Joins("left join conversations on conversations.id = f.conversation_id").
+		Joins("left join messages on messages.id = f.message_id").
+		Where("f.model_id = ?", modelID)
+
+	if rating != "" {
+		query = query.Where("f.rating = ?", rating)
+	}
+	if reason != "" {
+		query = query.Where("? = ANY(f.reasons)", reason)
+	}
+
+	query.Count(&total)
+	if err := query.Order("f.created_at DESC").Offset((page - 1) * size).Limit(size).Scan(&feedback).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Code:    model.SystemError,
+			Message: "系统错误",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Code:    model.Success,
+		Message: "获取成功",
+		Data: model.PageResponse{
+			Total: total,
+			List:  feedback,
+		},
+	})
+}
@@ -3,7 +3,6 @@ package middleware
 import (
 	"bytes"
 	"io"
-	"time"
 
 	"cybermind/admin-service/internal/model"
 	"cybermind/admin-service/pkg/database"
@@ -14,9 +13,6 @@ import (
 // Logger 日志中间件
 func Logger() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// 开始时间
-		start := time.Now()
-
 		// 读取请求体
 		var requestBody []byte
 		if c.Request.Body != nil {
@@ -41,9 +41,20 @@ func SetupRouter() *gin.Engine {
 
 			// 模型管理
 			admin.GET("/models", handler.GetModelList)
+			admin.GET("/model-config-schemas", handler.GetModelConfigSchemas)
 			admin.POST("/models", middleware.RequireRole(2), handler.CreateModel)
 			admin.PUT("/models/:id", middleware.RequireRole(2), handler.UpdateModel)
 			admin.DELETE("/models/:id", middleware.RequireRole(2), handler.DeleteModel)
+			admin.GET("/models/:id/revisions", handler.GetModelRevisions)
+			admin.GET("/models/:id/revisions/:version/diff", handler.GetModelRevisionDiff)
+			admin.POST("/models/:id/revisions/:version/rollback", middleware.RequireRole(2), handler.RollbackModel)
+			admin.GET("/models/:id/fallbacks", handler.GetModelFallbacks)
+			admin.PUT("/models/:id/fallbacks", middleware.RequireRole(2), handler.UpdateModelFallbacks)
+			admin.GET("/model-aliases", handler.GetModelAliasList)
+			admin.POST("/model-aliases", middleware.RequireRole(2), handler.CreateModelAlias)
+			admin.PUT("/model-aliases/:id", middleware.RequireRole(2), handler.UpdateModelAlias)
+			admin.PUT("/model-aliases/:id/targets", middleware.RequireRole(2), handler.UpdateModelAliasTargets)
+			admin.DELETE("/model-aliases/:id", middleware.RequireRole(2), handler.DeleteModelAlias)
 
 			// 订单管理
 			admin.GET("/orders", handler.GetOrderList)
@@ -60,6 +71,23 @@ func SetupRouter() *gin.Engine {
 			admin.GET("/stats/daily", handler.GetDailyStats)
 			admin.GET("/stats/user", handler.GetUserStats)
 			admin.GET("/stats/order", handler.GetOrderStats)
+			admin.GET("/stats/satisfaction", handler.GetModelSatisfaction)
+			admin.GET("/stats/satisfaction/:model_id", handler.GetModelFeedbackList)
+
+			// 内容审核
+			admin.GET("/moderation/keywords", handler.GetKeywordList)
+			admin.POST("/moderation/keywords", middleware.RequireRole(2), handler.CreateKeyword)
+			admin.PUT("/moderation/keywords/:id", middleware.RequireRole(2), handler.UpdateKeyword)
+			admin.DELETE("/moderation/keywords/:id", middleware.RequireRole(2), handler.DeleteKeyword)
+			admin.GET("/moderation/rules", handler.GetRuleList)
+			admin.POST("/moderation/rules", middleware.RequireRole(2), handler.CreateRule)
+			admin.PUT("/moderation/rules/:id", middleware.RequireRole(2), handler.UpdateRule)
+			admin.DELETE("/moderation/rules/:id", middleware.RequireRole(2), handler.DeleteRule)
+			admin.GET("/moderation/events", handler.GetModerationEventList)
+			admin.GET("/moderation/events/:id", handler.GetModerationEventDetail)
+			admin.POST("/moderation/events/:id/resolve", middleware.RequireRole(2), handler.ResolveModerationEvent)
+			admin.GET("/moderation/violations", handler.GetViolationList)
+			admin.DELETE("/moderation/violations/:user_id", middleware.RequireRole(2), handler.ResetViolation)
 		}
 	}
 
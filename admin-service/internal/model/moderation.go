@@ -0,0 +1,21 @@
+package model
+
+import (
+	"time"
+)
+
+// 审核记录复核状态
+const (
+	ModerationPending   = 0 // 待复核
+	ModerationApproved  = 1 // 误判，放行
+	ModerationConfirmed = 2 // 确认违规
+	ModerationBanned    = 3 // 确认违规并封禁用户
+)
+
+// UserViolation 用户违规计数，累计达到阈值时自动封禁
+type UserViolation struct {
+	UserID          int64     `gorm:"primaryKey" json:"user_id"`
+	Count           int       `gorm:"not null;default:0" json:"count"`
+	LastViolationAt time.Time `json:"last_violation_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
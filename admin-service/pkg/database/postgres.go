@@ -57,6 +57,7 @@ func autoMigrate() error {
 		&model.Payment{},
 		&model.PaymentCallback{},
 		&model.PaymentRefund{},
+		&model.UserViolation{},
 	)
 }
 
@@ -4,9 +4,13 @@ import (
     "cybermind/auth-service/configs"
     "cybermind/auth-service/internal/api/handler"
     "cybermind/auth-service/internal/api/middleware"
+    "cybermind/auth-service/internal/model"
     "cybermind/auth-service/internal/service"
     "cybermind/auth-service/pkg/database"
+    "cybermind/common/internalauth"
+    "cybermind/common/ratelimit"
     "log"
+    "time"
 
     "github.com/gin-gonic/gin"
 )
@@ -19,9 +23,34 @@ func main() {
         log.Fatalf("Failed to connect to database: %v", err)
     }
 
+    // 迁移平台API令牌表
+    if err := db.AutoMigrate(&model.APIToken{}); err != nil {
+        log.Fatalf("Failed to migrate database: %v", err)
+    }
+
+    // 初始化Redis连接
+    rdb, err := database.NewRedisClient(configs.GetRedisConfig())
+    if err != nil {
+        log.Fatalf("Failed to connect to redis: %v", err)
+    }
+
+    // 初始化限流器：登录注册按IP滑动窗口防暴力破解，用户接口按套餐等级限流
+    limiter := ratelimit.NewLimiter(rdb, "auth")
+    tiers := ratelimit.NewTierResolver(db, rdb)
+    loginLimit := ratelimit.Limit{Rate: 10, Period: time.Minute, Algorithm: ratelimit.SlidingWindow}
+    registerLimit := ratelimit.Limit{Rate: 5, Period: time.Hour, Algorithm: ratelimit.SlidingWindow}
+    userLimits := ratelimit.TierLimits{
+        ratelimit.TierFree:    ratelimit.PerMinute(60),
+        ratelimit.TierTrial:   ratelimit.PerMinute(60),
+        ratelimit.TierDaily:   ratelimit.PerMinute(90),
+        ratelimit.TierWeekly:  ratelimit.PerMinute(90),
+        ratelimit.TierMonthly: ratelimit.PerMinute(120),
+    }
+
     // 初始化用户服务
     userService := service.NewUserService(db)
     userHandler := handler.NewUserHandler(userService)
+    tokenHandler := handler.NewTokenHandler(service.NewTokenService(db))
 
     // 设置路由
     router := gin.Default()
@@ -29,19 +58,36 @@ func main() {
     {
         auth := v1.Group("/auth")
         {
-            auth.POST("/register", userHandler.Register)
-            auth.POST("/login", userHandler.Login)
+            auth.POST("/register", limiter.Middleware("register", ratelimit.ByIP, ratelimit.Fixed(registerLimit)), userHandler.Register)
+            auth.POST("/login", limiter.Middleware("login", ratelimit.ByIP, ratelimit.Fixed(loginLimit)), userHandler.Login)
         }
 
         users := v1.Group("/users")
         users.Use(middleware.AuthMiddleware())
+        users.Use(limiter.Middleware("users", ratelimit.ByUser("userID"), tiers.Limits("userID", userLimits)))
         {
             users.GET("/info", userHandler.GetUserInfo)
         }
+
+        // 平台API令牌管理
+        tokens := v1.Group("/tokens")
+        tokens.Use(middleware.AuthMiddleware())
+        tokens.Use(limiter.Middleware("users", ratelimit.ByUser("userID"), tiers.Limits("userID", userLimits)))
+        {
+            tokens.POST("", tokenHandler.CreateToken)
+            tokens.GET("", tokenHandler.ListTokens)
+            tokens.DELETE("/:id", tokenHandler.RevokeToken)
+        }
+    }
+
+    // 服务间调用接口(不对外暴露)
+    internal := router.Group("/internal/v1", internalauth.Middleware())
+    {
+        internal.POST("/tokens/verify", tokenHandler.VerifyToken)
     }
 
     // 启动服务器
     if err := router.Run(":8081"); err != nil {
         log.Fatalf("Failed to start server: %v", err)
     }
-} 
\ No newline at end of file
+} 
\ No newline at end of file
@@ -0,0 +1,17 @@
+package configs
+
+type RedisConfig struct {
+    Host     string
+    Port     int
+    Password string
+    DB       int
+}
+
+func GetRedisConfig() *RedisConfig {
+    return &RedisConfig{
+        Host:     "dbconn.sealosbja.site",
+        Port:     30193,
+        Password: "mqjfcd8x",
+        DB:       0,
+    }
+}
@@ -0,0 +1,142 @@
+package handler
+
+import (
+    "errors"
+    "net/http"
+    "strconv"
+
+    "cybermind/auth-service/internal/service"
+    "github.com/gin-gonic/gin"
+)
+
+type TokenHandler struct {
+    tokenService *service.TokenService
+}
+
+func NewTokenHandler(tokenService *service.TokenService) *TokenHandler {
+    return &TokenHandler{tokenService: tokenService}
+}
+
+// CreateToken 创建平台API令牌，明文令牌只在创建时返回一次
+func (h *TokenHandler) CreateToken(c *gin.Context) {
+    var req service.CreateTokenRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{
+            "code":    1001,
+            "message": "invalid request parameters",
+        })
+        return
+    }
+
+    userID, _ := c.Get("userID")
+    token, plain, err := h.tokenService.CreateToken(userID.(int64), &req)
+    if err != nil {
+        if errors.Is(err, service.ErrTokenLimitExceeded) || errors.Is(err, service.ErrInvalidTokenParams) {
+            c.JSON(http.StatusBadRequest, gin.H{
+                "code":    1001,
+                "message": err.Error(),
+            })
+            return
+        }
+        c.JSON(http.StatusInternalServerError, gin.H{
+            "code":    1005,
+            "message": "failed to create token",
+        })
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "code":    0,
+        "message": "success",
+        "data": gin.H{
+            "token":     plain,
+            "api_token": token,
+        },
+    })
+}
+
+// ListTokens 获取当前用户的令牌列表
+func (h *TokenHandler) ListTokens(c *gin.Context) {
+    userID, _ := c.Get("userID")
+    tokens, err := h.tokenService.ListTokens(userID.(int64))
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{
+            "code":    1005,
+            "message": "failed to list tokens",
+        })
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "code":    0,
+        "message": "success",
+        "data":    tokens,
+    })
+}
+
+// RevokeToken 吊销令牌
+func (h *TokenHandler) RevokeToken(c *gin.Context) {
+    id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{
+            "code":    1001,
+            "message": "invalid token id",
+        })
+        return
+    }
+
+    userID, _ := c.Get("userID")
+    if err := h.tokenService.RevokeToken(userID.(int64), id); err != nil {
+        if errors.Is(err, service.ErrTokenNotFound) {
+            c.JSON(http.StatusNotFound, gin.H{
+                "code":    1004,
+                "message": err.Error(),
+            })
+            return
+        }
+        c.JSON(http.StatusInternalServerError, gin.H{
+            "code":    1005,
+            "message": "failed to revoke token",
+        })
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "code":    0,
+        "message": "success",
+    })
+}
+
+// VerifyToken 供其他服务校验令牌，返回令牌的权限范围、模型和积分额度
+func (h *TokenHandler) VerifyToken(c *gin.Context) {
+    var req struct {
+        Token string `json:"token" binding:"required"`
+        IP    string `json:"ip"`
+    }
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{
+            "code":    1001,
+            "message": "invalid request parameters",
+        })
+        return
+    }
+
+    token, err := h.tokenService.VerifyToken(c.Request.Context(), req.Token, req.IP)
+    if err != nil {
+        switch {
+        case errors.Is(err, service.ErrInvalidToken), errors.Is(err, service.ErrTokenExpired):
+            c.JSON(http.StatusUnauthorized, gin.H{"code": 1002, "message": err.Error()})
+        case errors.Is(err, service.ErrIPNotAllowed), errors.Is(err, service.ErrUserDisabled):
+            c.JSON(http.StatusForbidden, gin.H{"code": 1003, "message": err.Error()})
+        default:
+            c.JSON(http.StatusInternalServerError, gin.H{"code": 1005, "message": "failed to verify token"})
+        }
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "code":    0,
+        "message": "success",
+        "data":    token,
+    })
+}
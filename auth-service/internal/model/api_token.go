@@ -0,0 +1,52 @@
+package model
+
+import (
+    "time"
+
+    "github.com/lib/pq"
+
+    "cybermind/common/apitoken"
+)
+
+// APITokenPrefix 平台API令牌的前缀
+const APITokenPrefix = apitoken.Prefix
+
+// 令牌权限范围，Scopes为空时拥有全部权限
+const (
+    ScopeModels     = "models"     // GET /v1/models
+    ScopeChat       = "chat"       // POST /v1/chat/completions
+    ScopeEmbeddings = "embeddings" // POST /v1/embeddings
+)
+
+// Scopes 全部可用的权限范围
+var Scopes = []string{ScopeModels, ScopeChat, ScopeEmbeddings}
+
+// APIToken 用户调用平台API(/v1)使用的令牌，只保存令牌的SHA-256摘要
+type APIToken struct {
+    ID          int64          `gorm:"primaryKey" json:"id"`
+    UserID      int64          `gorm:"not null;index" json:"user_id"`
+    Name        string         `gorm:"size:50;not null" json:"name"`
+    TokenHash   string         `gorm:"size:64;not null;uniqueIndex" json:"-"`
+    Prefix      string         `gorm:"size:16" json:"prefix"`              // 令牌前几位，用于展示
+    Scopes      pq.StringArray `gorm:"type:text[]" json:"scopes"`          // 权限范围，为空时不限制
+    ModelIDs    pq.Int64Array  `gorm:"type:bigint[]" json:"model_ids"`     // 允许调用的模型，为空时不限制
+    PointsQuota int            `gorm:"default:0" json:"points_quota"`      // 积分额度，为0时不限制
+    PointsUsed  int            `gorm:"default:0" json:"points_used"`       // 已消耗积分
+    AllowedIPs  pq.StringArray `gorm:"type:text[];column:allowed_ips" json:"allowed_ips"` // IP或CIDR白名单，为空时不限制
+    Status      int            `gorm:"default:1" json:"status"`            // 状态：1-启用，0-已吊销
+    ExpiresAt   *time.Time     `json:"expires_at,omitempty"`
+    LastUsedAt  *time.Time     `json:"last_used_at,omitempty"`
+    LastUsedIP  string         `gorm:"size:64" json:"last_used_ip,omitempty"`
+    RevokedAt   *time.Time     `json:"revoked_at,omitempty"`
+    CreatedAt   time.Time      `json:"created_at"`
+    UpdatedAt   time.Time      `json:"updated_at"`
+}
+
+func (APIToken) TableName() string {
+    return "api_tokens"
+}
+
+// TokenState 校验用到的令牌字段
+func (t *APIToken) TokenState() apitoken.State {
+    return apitoken.State{ID: t.ID, UserID: t.UserID, AllowedIPs: t.AllowedIPs, ExpiresAt: t.ExpiresAt, LastUsedAt: t.LastUsedAt}
+}
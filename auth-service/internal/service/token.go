@@ -0,0 +1,128 @@
+package service
+
+import (
+    "context"
+    "crypto/rand"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "time"
+
+    "github.com/lib/pq"
+    "gorm.io/gorm"
+
+    "cybermind/auth-service/internal/model"
+    "cybermind/common/apitoken"
+)
+
+// maxTokensPerUser 每个用户最多持有的有效令牌数
+const maxTokensPerUser = 20
+
+var (
+    ErrTokenNotFound      = errors.New("token not found")
+    ErrTokenLimitExceeded = errors.New("too many api tokens")
+    ErrInvalidTokenParams = errors.New("invalid token parameters")
+    ErrInvalidToken       = apitoken.ErrInvalid
+    ErrTokenExpired       = apitoken.ErrExpired
+    ErrIPNotAllowed       = apitoken.ErrIPNotAllowed
+    ErrUserDisabled       = apitoken.ErrUserDisabled
+)
+
+type TokenService struct {
+    db *gorm.DB
+}
+
+func NewTokenService(db *gorm.DB) *TokenService {
+    return &TokenService{db: db}
+}
+
+type CreateTokenRequest struct {
+    Name        string     `json:"name" binding:"required,max=50"`
+    Scopes      []string   `json:"scopes" binding:"omitempty,dive,oneof=models chat embeddings"`
+    ModelIDs    []int64    `json:"model_ids"`
+    PointsQuota int        `json:"points_quota" binding:"min=0"`
+    AllowedIPs  []string   `json:"allowed_ips"`
+    ExpiresAt   *time.Time `json:"expires_at"`
+}
+
+// generateToken 生成sk-开头的随机令牌
+func generateToken() (string, error) {
+    b := make([]byte, 24)
+    if _, err := rand.Read(b); err != nil {
+        return "", err
+    }
+    return model.APITokenPrefix + hex.EncodeToString(b), nil
+}
+
+// CreateToken 创建令牌，返回的明文令牌只在创建时返回一次
+func (s *TokenService) CreateToken(userID int64, req *CreateTokenRequest) (*model.APIToken, string, error) {
+    for _, ip := range req.AllowedIPs {
+        if !apitoken.ValidIPRule(ip) {
+            return nil, "", fmt.Errorf("%w: invalid ip or cidr %s", ErrInvalidTokenParams, ip)
+        }
+    }
+    if req.ExpiresAt != nil && req.ExpiresAt.Before(time.Now()) {
+        return nil, "", fmt.Errorf("%w: expires_at must be in the future", ErrInvalidTokenParams)
+    }
+
+    var count int64
+    if err := s.db.Model(&model.APIToken{}).Where("user_id = ? AND status = 1", userID).Count(&count).Error; err != nil {
+        return nil, "", err
+    }
+    if count >= maxTokensPerUser {
+        return nil, "", ErrTokenLimitExceeded
+    }
+
+    plain, err := generateToken()
+    if err != nil {
+        return nil, "", err
+    }
+    token := &model.APIToken{
+        UserID:      userID,
+        Name:        req.Name,
+        TokenHash:   apitoken.Hash(plain),
+        Prefix:      plain[:10],
+        Scopes:      pq.StringArray(req.Scopes),
+        ModelIDs:    pq.Int64Array(req.ModelIDs),
+        PointsQuota: req.PointsQuota,
+        AllowedIPs:  pq.StringArray(req.AllowedIPs),
+        Status:      1,
+        ExpiresAt:   req.ExpiresAt,
+    }
+    if err := s.db.Create(token).Error; err != nil {
+        return nil, "", err
+    }
+    return token, plain, nil
+}
+
+// ListTokens 获取用户的令牌列表，包含已吊销的令牌
+func (s *TokenService) ListTokens(userID int64) ([]model.APIToken, error) {
+    var tokens []model.APIToken
+    err := s.db.Where("user_id = ?", userID).Order("id DESC").Find(&tokens).Error
+    return tokens, err
+}
+
+// RevokeToken 吊销令牌，吊销后立即失效且不可恢复
+func (s *TokenService) RevokeToken(userID, id int64) error {
+    now := time.Now()
+    result := s.db.Model(&model.APIToken{}).
+        Where("id = ? AND user_id = ? AND status = 1", id, userID).
+        Updates(map[string]interface{}{"status": 0, "revoked_at": now})
+    if result.Error != nil {
+        return result.Error
+    }
+    if result.RowsAffected == 0 {
+        return ErrTokenNotFound
+    }
+    return nil
+}
+
+// VerifyToken 校验令牌：令牌需启用、未过期，来源IP在白名单内，所属用户为正常状态。
+// 权限范围、模型和积分额度由调用方按具体请求检查
+func (s *TokenService) VerifyToken(ctx context.Context, plain, ip string) (*model.APIToken, error) {
+    var token model.APIToken
+    if err := apitoken.Verify(ctx, s.db, plain, ip, &token); err != nil {
+        return nil, err
+    }
+    return &token, nil
+}
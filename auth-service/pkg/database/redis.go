@@ -0,0 +1,22 @@
+package database
+
+import (
+    "context"
+    "fmt"
+    "cybermind/auth-service/configs"
+    "github.com/redis/go-redis/v9"
+)
+
+func NewRedisClient(config *configs.RedisConfig) (*redis.Client, error) {
+    rdb := redis.NewClient(&redis.Options{
+        Addr:     fmt.Sprintf("%s:%d", config.Host, config.Port),
+        Password: config.Password,
+        DB:       config.DB,
+    })
+
+    if err := rdb.Ping(context.Background()).Err(); err != nil {
+        return nil, fmt.Errorf("failed to connect to redis: %w", err)
+    }
+
+    return rdb, nil
+}
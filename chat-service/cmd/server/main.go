@@ -1,10 +1,18 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
+	"net/http"
+	"os/signal"
+	"syscall"
+	"time"
 	"github.com/gin-gonic/gin"
 	"cybermind/chat-service/internal/api/router"
+	"cybermind/chat-service/internal/service"
 	"cybermind/chat-service/pkg/database"
+	"cybermind/common/moderation"
 )
 
 func main() {
@@ -17,16 +25,61 @@ func main() {
 	}
 	log.Println("数据库连接成功")
 
+	// 初始化Redis连接
+	if err := database.InitRedis(); err != nil {
+		log.Fatalf("Redis初始化失败: %v", err)
+	}
+	log.Println("Redis连接成功")
+
+	// 后台任务，服务退出时取消并等待剩余数据写入
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+
+	// 启动消息异步持久化队列(启动时恢复未持久化的消息)
+	queue := service.NewMessageQueue()
+	if err := queue.Start(workerCtx); err != nil {
+		log.Fatalf("消息队列启动失败: %v", err)
+	}
+	log.Println("消息队列启动完成")
+
+	// 加载内容审核词库，配置了审核模型时额外调用审核模型
+	var checkers []moderation.Checker
+	if checker := moderation.NewModelCheckerFromEnv(); checker != nil {
+		checkers = append(checkers, checker)
+	}
+	moderator := moderation.NewModerator(database.DB, checkers...)
+	if err := moderator.Reload(context.Background()); err != nil {
+		log.Fatalf("审核词库加载失败: %v", err)
+	}
+	moderator.StartAutoReload(context.Background(), time.Minute)
+	log.Println("审核词库加载完成")
+
 	// 创建gin引擎
 	engine := gin.Default()
 
 	// 注册路由
-	router.RegisterRoutes(engine)
+	router.RegisterRoutes(engine, queue, moderator)
 	log.Println("路由注册完成")
 
-	// 启动服务器
-	log.Println("服务器启动在 :8081")
-	if err := engine.Run(":8081"); err != nil {
-		log.Fatalf("服务器启动失败: %v", err)
+	// 启动服务器，收到SIGINT/SIGTERM时等待处理中的请求结束，再刷写已读取的消息后退出
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	srv := &http.Server{Addr: ":8081", Handler: engine}
+	go func() {
+		log.Println("服务器启动在 :8081")
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("服务器启动失败: %v", err)
+		}
+	}()
+
+	<-ctx.Done()
+	log.Println("正在关闭服务器...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("关闭服务器超时: %v", err)
 	}
+
+	stopWorkers()
+	queue.Wait()
 } 
\ No newline at end of file
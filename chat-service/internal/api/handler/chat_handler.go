@@ -1,19 +1,23 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 	"github.com/gin-gonic/gin"
 	"cybermind/chat-service/internal/service"
+	"cybermind/common/moderation"
 )
 
 type ChatHandler struct {
 	chatService *service.ChatService
+	store       *service.GenerationStore
 }
 
-func NewChatHandler() *ChatHandler {
+func NewChatHandler(queue *service.MessageQueue, moderator *moderation.Moderator, client *service.ModelClient, store *service.GenerationStore) *ChatHandler {
 	return &ChatHandler{
-		chatService: &service.ChatService{},
+		chatService: service.NewChatService(queue, moderator, client, store),
+		store:       store,
 	}
 }
 
@@ -59,14 +63,28 @@ func (h *ChatHandler) GetConversation(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "success", "data": conversation})
 }
 
-// ListConversations 获取对话列表
+// ListConversations 获取对话列表，传入before/after/limit时使用游标分页，否则使用page/size分页
 func (h *ChatHandler) ListConversations(c *gin.Context) {
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	size, _ := strconv.Atoi(c.DefaultQuery("size", "20"))
-
 	userID, _ := c.Get("user_id")
 	userIDInt := userID.(int64)
 
+	if cq, ok := cursorQuery(c); ok {
+		result, err := h.chatService.ListConversationsByCursor(userIDInt, cq)
+		if err != nil {
+			if errors.Is(err, service.ErrInvalidCursor) {
+				c.JSON(http.StatusBadRequest, gin.H{"code": 1001, "message": "参数错误", "error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 1005, "message": "获取对话列表失败", "error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "success", "data": result})
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	size, _ := strconv.Atoi(c.DefaultQuery("size", "20"))
+
 	conversations, total, err := h.chatService.ListConversations(userIDInt, page, size)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"code": 1005, "message": "获取对话列表失败", "error": err.Error()})
@@ -87,6 +105,7 @@ func (h *ChatHandler) ListConversations(c *gin.Context) {
 func (h *ChatHandler) AddMessage(c *gin.Context) {
 	var req struct {
 		ConversationID int64  `json:"conversation_id" binding:"required"`
+		ClientMsgID    string `json:"client_msg_id" binding:"max=64"`
 		Role           string `json:"role" binding:"required"`
 		Content        string `json:"content" binding:"required"`
 	}
@@ -96,8 +115,12 @@ func (h *ChatHandler) AddMessage(c *gin.Context) {
 		return
 	}
 
-	message, err := h.chatService.AddMessage(req.ConversationID, req.Role, req.Content)
+	message, err := h.chatService.AddMessage(c.Request.Context(), req.ConversationID, req.ClientMsgID, req.Role, req.Content)
 	if err != nil {
+		if errors.Is(err, moderation.ErrBlocked) {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 1007, "message": "内容包含违规信息"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"code": 1005, "message": "添加消息失败", "error": err.Error()})
 		return
 	}
@@ -105,7 +128,64 @@ func (h *ChatHandler) AddMessage(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "success", "data": message})
 }
 
-// GetMessages 获取消息列表
+// Chat 发送消息并以SSE推送助手回复。回复在后台生成，客户端断开后可以通过生成ID断线重连，
+// 或在生成结束后获取完整消息
+func (h *ChatHandler) Chat(c *gin.Context) {
+	var req struct {
+		ConversationID int64  `json:"conversation_id" binding:"required"`
+		ClientMsgID    string `json:"client_msg_id" binding:"max=64"`
+		Content        string `json:"content" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1001, "message": "参数错误", "error": err.Error()})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	start, err := h.chatService.Reply(c.Request.Context(), userID.(int64), req.ConversationID, req.ClientMsgID, req.Content)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrConversationNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"code": 1004, "message": "对话不存在"})
+		case errors.Is(err, moderation.ErrBlocked):
+			c.JSON(http.StatusBadRequest, gin.H{"code": 1007, "message": "内容包含违规信息"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 1005, "message": "发送消息失败", "error": err.Error()})
+		}
+		return
+	}
+
+	streamGeneration(c, h.store, start.GenerationID, "")
+}
+
+// EstimateChat 发送消息前预估扣除的积分
+func (h *ChatHandler) EstimateChat(c *gin.Context) {
+	var req struct {
+		ConversationID int64  `json:"conversation_id" binding:"required"`
+		Content        string `json:"content" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1001, "message": "参数错误", "error": err.Error()})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	estimate, err := h.chatService.EstimateReply(c.Request.Context(), userID.(int64), req.ConversationID, req.Content)
+	if err != nil {
+		if errors.Is(err, service.ErrConversationNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"code": 1004, "message": "对话不存在"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1005, "message": "预估积分失败", "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "success", "data": estimate})
+}
+
+// GetMessages 获取消息列表，传入before/after/limit时使用游标分页，否则返回全部消息
 func (h *ChatHandler) GetMessages(c *gin.Context) {
 	conversationID, err := strconv.ParseInt(c.Param("conversation_id"), 10, 64)
 	if err != nil {
@@ -113,11 +193,37 @@ func (h *ChatHandler) GetMessages(c *gin.Context) {
 		return
 	}
 
-	messages, err := h.chatService.GetMessages(conversationID)
+	if cq, ok := cursorQuery(c); ok {
+		result, err := h.chatService.GetMessagesByCursor(c.Request.Context(), conversationID, cq)
+		if err != nil {
+			if errors.Is(err, service.ErrInvalidCursor) {
+				c.JSON(http.StatusBadRequest, gin.H{"code": 1001, "message": "参数错误", "error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 1005, "message": "获取消息列表失败", "error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "success", "data": result})
+		return
+	}
+
+	messages, err := h.chatService.GetMessages(c.Request.Context(), conversationID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"code": 1005, "message": "获取消息列表失败", "error": err.Error()})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "success", "data": messages})
-} 
\ No newline at end of file
+}
+
+// cursorQuery 解析游标分页参数，未传入任何游标参数时返回false
+func cursorQuery(c *gin.Context) (*service.CursorQuery, bool) {
+	before, hasBefore := c.GetQuery("before")
+	after, hasAfter := c.GetQuery("after")
+	limitStr, hasLimit := c.GetQuery("limit")
+	if !hasBefore && !hasAfter && !hasLimit {
+		return nil, false
+	}
+	limit, _ := strconv.Atoi(limitStr)
+	return &service.CursorQuery{Before: before, After: after, Limit: limit}, true
+}
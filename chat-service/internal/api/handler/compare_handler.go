@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"cybermind/chat-service/internal/service"
+	"cybermind/common/moderation"
+)
+
+type CompareHandler struct {
+	compareService *service.CompareService
+	store          *service.GenerationStore
+}
+
+func NewCompareHandler(client *service.ModelClient, moderator *moderation.Moderator, store *service.GenerationStore) *CompareHandler {
+	return &CompareHandler{
+		compareService: service.NewCompareService(client, moderator),
+		store:          store,
+	}
+}
+
+// Compare 将同一提示词并发发送给多个模型，通过SSE推送各模型的输出，每个模型使用独立的通道ID。
+// 对比在后台进行，客户端断开后可以通过生成ID断线重连
+func (h *CompareHandler) Compare(c *gin.Context) {
+	var req struct {
+		ModelIDs []int64 `json:"model_ids" binding:"required,min=2,max=4,unique"`
+		Content  string  `json:"content" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1001, "message": "参数错误", "error": err.Error()})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	userIDInt := userID.(int64)
+
+	comparison, channels, err := h.compareService.Create(c.Request.Context(), userIDInt, req.ModelIDs, req.Content)
+	if err != nil {
+		switch {
+		case errors.Is(err, moderation.ErrBlocked):
+			c.JSON(http.StatusBadRequest, gin.H{"code": 1007, "message": "内容包含违规信息"})
+		case errors.Is(err, service.ErrModelUnavailable):
+			c.JSON(http.StatusBadRequest, gin.H{"code": 1001, "message": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 1005, "message": "创建对比失败", "error": err.Error()})
+		}
+		return
+	}
+
+	generationID := service.NewGenerationID()
+	if err := h.store.Create(c.Request.Context(), generationID, userIDInt, map[string]interface{}{
+		"type":          "compare",
+		"comparison_id": comparison.ID,
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1005, "message": "创建对比失败", "error": err.Error()})
+		return
+	}
+
+	h.store.Run(generationID, func(ctx context.Context, emit func(string, interface{})) (string, map[string]interface{}) {
+		emit("start", gin.H{"generation_id": generationID, "comparison_id": comparison.ID, "channels": channels})
+		h.compareService.Run(ctx, comparison, emit)
+		return service.GenerationDone, nil
+	})
+	streamGeneration(c, h.store, generationID, "")
+}
+
+// GetComparison 获取对比记录及各模型回答
+func (h *CompareHandler) GetComparison(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1001, "message": "参数错误", "error": err.Error()})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	comparison, err := h.compareService.GetComparison(userID.(int64), id)
+	if err != nil {
+		if errors.Is(err, service.ErrComparisonNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"code": 1004, "message": "对比记录不存在"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1005, "message": "获取对比记录失败", "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "success", "data": comparison})
+}
+
+// PreferAnswer 选择最佳回答，记录为偏好数据
+func (h *CompareHandler) PreferAnswer(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1001, "message": "参数错误", "error": err.Error()})
+		return
+	}
+
+	var req struct {
+		ModelID int64 `json:"model_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1001, "message": "参数错误", "error": err.Error()})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	if err := h.compareService.Prefer(userID.(int64), id, req.ModelID); err != nil {
+		switch {
+		case errors.Is(err, service.ErrComparisonNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"code": 1004, "message": "对比记录不存在"})
+		case errors.Is(err, service.ErrInvalidPreference):
+			c.JSON(http.StatusBadRequest, gin.H{"code": 1001, "message": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 1005, "message": "记录偏好失败", "error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "success"})
+}
@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"github.com/gin-gonic/gin"
+	"cybermind/chat-service/internal/service"
+)
+
+type FeedbackHandler struct {
+	feedbackService *service.FeedbackService
+}
+
+func NewFeedbackHandler() *FeedbackHandler {
+	return &FeedbackHandler{
+		feedbackService: &service.FeedbackService{},
+	}
+}
+
+// SubmitFeedback 提交消息反馈
+func (h *FeedbackHandler) SubmitFeedback(c *gin.Context) {
+	var req struct {
+		MessageID   int64    `json:"message_id"`
+		ClientMsgID string   `json:"client_msg_id" binding:"max=64"`
+		Rating      int      `json:"rating" binding:"required,oneof=1 -1"`
+		Reasons     []string `json:"reasons" binding:"max=5"`
+		Comment     string   `json:"comment" binding:"max=1000"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1001, "message": "参数错误", "error": err.Error()})
+		return
+	}
+	if req.MessageID == 0 && req.ClientMsgID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1001, "message": "参数错误", "error": "message_id或client_msg_id必填"})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	userIDInt := userID.(int64)
+
+	feedback, err := h.feedbackService.SubmitFeedback(userIDInt, &service.FeedbackInput{
+		MessageID:   req.MessageID,
+		ClientMsgID: req.ClientMsgID,
+		Rating:      req.Rating,
+		Reasons:     req.Reasons,
+		Comment:     req.Comment,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrMessageNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"code": 1004, "message": "消息不存在", "error": err.Error()})
+		case errors.Is(err, service.ErrNotRatable), errors.Is(err, service.ErrInvalidReason):
+			c.JSON(http.StatusBadRequest, gin.H{"code": 1001, "message": "参数错误", "error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 1005, "message": "提交反馈失败", "error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "success", "data": feedback})
+}
+
+// DeleteFeedback 撤销消息反馈
+func (h *FeedbackHandler) DeleteFeedback(c *gin.Context) {
+	messageID, err := strconv.ParseInt(c.Param("message_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1001, "message": "参数错误", "error": err.Error()})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	userIDInt := userID.(int64)
+
+	if err := h.feedbackService.DeleteFeedback(userIDInt, messageID); err != nil {
+		if errors.Is(err, service.ErrFeedbackNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"code": 1004, "message": "反馈不存在", "error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1005, "message": "撤销反馈失败", "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "success"})
+}
+
+// ListFeedback 获取对话中的消息反馈
+func (h *FeedbackHandler) ListFeedback(c *gin.Context) {
+	conversationID, err := strconv.ParseInt(c.Param("conversation_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1001, "message": "参数错误", "error": err.Error()})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	userIDInt := userID.(int64)
+
+	feedback, err := h.feedbackService.ListFeedback(userIDInt, conversationID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1005, "message": "获取反馈失败", "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "success", "data": feedback})
+}
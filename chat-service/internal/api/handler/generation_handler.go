@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+
+	"cybermind/chat-service/internal/service"
+)
+
+type GenerationHandler struct {
+	store *service.GenerationStore
+}
+
+func NewGenerationHandler(store *service.GenerationStore) *GenerationHandler {
+	return &GenerationHandler{store: store}
+}
+
+// GetGeneration 获取生成任务的状态，生成结束后包含完整内容
+func (h *GenerationHandler) GetGeneration(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	generation, err := h.store.Get(c.Request.Context(), c.Param("id"), userID.(int64))
+	if err != nil {
+		if errors.Is(err, service.ErrGenerationNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"code": 1004, "message": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1005, "message": "获取生成任务失败", "error": err.Error()})
+		return
+	}
+	delete(generation, "user_id")
+
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "success", "data": generation})
+}
+
+// ResumeGeneration 断线重连，从请求头Last-Event-ID(或查询参数last_event_id)之后继续推送事件
+func (h *GenerationHandler) ResumeGeneration(c *gin.Context) {
+	id := c.Param("id")
+	userID, _ := c.Get("user_id")
+	if _, err := h.store.Get(c.Request.Context(), id, userID.(int64)); err != nil {
+		if errors.Is(err, service.ErrGenerationNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"code": 1004, "message": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1005, "message": "获取生成任务失败", "error": err.Error()})
+		return
+	}
+
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("last_event_id")
+	}
+	streamGeneration(c, h.store, id, lastEventID)
+}
+
+// streamGeneration 以SSE推送生成任务的事件，事件ID为缓冲区中的消息ID
+func streamGeneration(c *gin.Context, store *service.GenerationStore, id, lastEventID string) {
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	events := store.Subscribe(c.Request.Context(), id, lastEventID)
+	c.Stream(func(w io.Writer) bool {
+		event, ok := <-events
+		if !ok {
+			return false
+		}
+		c.Render(-1, sse.Event{Id: event.ID, Event: event.Event, Data: event.Data})
+		return true
+	})
+}
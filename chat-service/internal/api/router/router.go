@@ -3,24 +3,61 @@ package router
 import (
 	"github.com/gin-gonic/gin"
 	"cybermind/chat-service/internal/api/handler"
+	"cybermind/chat-service/internal/service"
+	"cybermind/chat-service/pkg/database"
 	"cybermind/chat-service/pkg/middleware"
+	"cybermind/common/moderation"
+	"cybermind/common/ratelimit"
 )
 
-func RegisterRoutes(r *gin.Engine) {
+// conversationLimits 对话接口按用户套餐等级限流
+var conversationLimits = ratelimit.TierLimits{
+	ratelimit.TierFree:    ratelimit.PerMinute(30),
+	ratelimit.TierTrial:   ratelimit.PerMinute(60),
+	ratelimit.TierDaily:   ratelimit.PerMinute(120),
+	ratelimit.TierWeekly:  ratelimit.PerMinute(120),
+	ratelimit.TierMonthly: ratelimit.PerMinute(240),
+}
+
+func RegisterRoutes(r *gin.Engine, queue *service.MessageQueue, moderator *moderation.Moderator) {
 	// 创建处理器实例
-	chatHandler := handler.NewChatHandler()
+	modelClient := service.NewModelClient()
+	store := service.NewGenerationStore()
+	chatHandler := handler.NewChatHandler(queue, moderator, modelClient, store)
+	feedbackHandler := handler.NewFeedbackHandler()
+	compareHandler := handler.NewCompareHandler(modelClient, moderator, store)
+	generationHandler := handler.NewGenerationHandler(store)
+
+	limiter := ratelimit.NewLimiter(database.RDB, "chat")
+	tiers := ratelimit.NewTierResolver(database.DB, database.RDB)
 
 	// API路由组
 	api := r.Group("/api/v1")
 	{
 		// 对话相关路由(需要认证)
-		conversations := api.Group("/conversations", middleware.AuthMiddleware())
+		conversations := api.Group("/conversations",
+			middleware.AuthMiddleware(),
+			limiter.Middleware("conversations", ratelimit.ByUser("user_id"), tiers.Limits("user_id", conversationLimits)),
+		)
 		{
 			conversations.POST("", chatHandler.CreateConversation)           // 创建对话
 			conversations.GET("", chatHandler.ListConversations)            // 获取对话列表
 			conversations.GET("/detail/:id", chatHandler.GetConversation)   // 获取对话详情
 			conversations.GET("/messages/:conversation_id", chatHandler.GetMessages)  // 获取消息列表
 			conversations.POST("/messages", chatHandler.AddMessage)         // 添加消息
+			conversations.POST("/chat", chatHandler.Chat)                   // 发送消息并生成回复(SSE)
+			conversations.POST("/chat/estimate", chatHandler.EstimateChat)  // 发送前预估积分
+
+			conversations.GET("/generations/:id", generationHandler.GetGeneration)           // 获取生成状态
+			conversations.GET("/generations/:id/stream", generationHandler.ResumeGeneration) // 断线重连(SSE)
+
+			conversations.POST("/feedback", feedbackHandler.SubmitFeedback)                    // 提交消息反馈
+			conversations.DELETE("/feedback/:message_id", feedbackHandler.DeleteFeedback)     // 撤销消息反馈
+			conversations.GET("/feedback/:conversation_id", feedbackHandler.ListFeedback)     // 获取对话反馈
+
+			conversations.POST("/compare", compareHandler.Compare)                        // 多模型对比(SSE)
+			conversations.GET("/compare/:id", compareHandler.GetComparison)               // 获取对比结果
+			conversations.POST("/compare/:id/prefer", compareHandler.PreferAnswer)        // 选择最佳回答
 		}
 	}
 } 
\ No newline at end of file
@@ -0,0 +1,45 @@
+package model
+
+import (
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// 对比回答状态
+const (
+	AnswerStreaming = 0 // 生成中
+	AnswerCompleted = 1 // 已完成
+	AnswerFailed    = 2 // 调用失败
+	AnswerBlocked   = 3 // 命中审核拦截
+)
+
+// Comparison 多模型对比记录，PreferredModelID为用户选出的最佳回答，作为偏好数据
+type Comparison struct {
+	ID               int64              `gorm:"primaryKey" json:"id"`
+	UserID           int64              `gorm:"not null;index" json:"user_id"`
+	Prompt           string             `gorm:"type:text;not null" json:"prompt"`
+	ModelIDs         pq.Int64Array      `gorm:"type:bigint[];not null" json:"model_ids"`
+	PreferredModelID *int64             `gorm:"index" json:"preferred_model_id"`
+	PreferredAt      *time.Time         `json:"preferred_at"`
+	CreatedAt        time.Time          `gorm:"index" json:"created_at"`
+	Answers          []ComparisonAnswer `gorm:"foreignKey:ComparisonID" json:"answers,omitempty"`
+}
+
+// ComparisonAnswer 对比中单个模型的回答，Channel为SSE流中的通道ID
+type ComparisonAnswer struct {
+	ID               int64     `gorm:"primaryKey" json:"id"`
+	ComparisonID     int64     `gorm:"not null;index" json:"comparison_id"`
+	ModelID          int64     `gorm:"not null;index" json:"model_id"`
+	Channel          string    `gorm:"size:20;not null" json:"channel"`
+	Content          string    `gorm:"type:text" json:"content"`
+	Status           int       `gorm:"type:smallint;not null;default:0" json:"status"`
+	ErrorCode        int       `json:"error_code,omitempty"`
+	ErrorMessage     string    `gorm:"size:500" json:"error_message,omitempty"`
+	FinishReason     string    `gorm:"size:20" json:"finish_reason,omitempty"`
+	PointsCharged    int       `gorm:"not null;default:0" json:"points_charged"`
+	PromptTokens     int       `json:"prompt_tokens"`
+	CompletionTokens int       `json:"completion_tokens"`
+	LatencyMs        int64     `json:"latency_ms"`
+	CreatedAt        time.Time `json:"created_at"`
+}
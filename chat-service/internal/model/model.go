@@ -2,17 +2,18 @@ package model
 
 import (
 	"time"
+	"github.com/lib/pq"
 	"gorm.io/gorm"
 )
 
 // Conversation 对话模型
 type Conversation struct {
 	ID             int64          `gorm:"primaryKey" json:"id"`
-	UserID         int64          `gorm:"not null;index" json:"user_id"`
+	UserID         int64          `gorm:"not null;index;index:idx_conversations_user_created,priority:1" json:"user_id"`
 	ModelID        int64          `gorm:"not null" json:"model_id"`
 	Title          string         `gorm:"size:255" json:"title"`
 	PointsConsumed int            `gorm:"not null;default:0" json:"points_consumed"`
-	CreatedAt      time.Time      `json:"created_at"`
+	CreatedAt      time.Time      `gorm:"index:idx_conversations_user_created,priority:2" json:"created_at"`
 	UpdatedAt      time.Time      `json:"updated_at"`
 	DeletedAt      gorm.DeletedAt `gorm:"index" json:"-"`
 	Messages       []Message      `gorm:"foreignKey:ConversationID" json:"messages,omitempty"`
@@ -21,10 +22,49 @@ type Conversation struct {
 // Message 消息模型
 type Message struct {
 	ID             int64          `gorm:"primaryKey" json:"id"`
-	ConversationID int64          `gorm:"not null;index" json:"conversation_id"`
+	ConversationID int64          `gorm:"not null;index;index:idx_messages_conversation_created,priority:1" json:"conversation_id"`
+	ClientMsgID    string         `gorm:"size:64;uniqueIndex;default:null" json:"client_msg_id,omitempty"` // 客户端消息ID，用于幂等写入
 	Role           string         `gorm:"size:20;not null" json:"role"` // system/user/assistant
 	Content        string         `gorm:"type:text;not null" json:"content"`
 	TokensCount    int            `json:"tokens_count,omitempty"`
-	CreatedAt      time.Time      `json:"created_at"`
+	CreatedAt      time.Time      `gorm:"index:idx_messages_conversation_created,priority:2" json:"created_at"`
 	DeletedAt      gorm.DeletedAt `gorm:"index" json:"-"`
-} 
\ No newline at end of file
+}
+
+// MessageFeedback 消息反馈模型(用户对助手回复的评价)
+type MessageFeedback struct {
+	ID             int64          `gorm:"primaryKey" json:"id"`
+	UserID         int64          `gorm:"not null;uniqueIndex:idx_message_feedback_user_message" json:"user_id"`
+	MessageID      int64          `gorm:"not null;uniqueIndex:idx_message_feedback_user_message" json:"message_id"`
+	ConversationID int64          `gorm:"not null;index" json:"conversation_id"`
+	ModelID        int64          `gorm:"not null;index" json:"model_id"`
+	Rating         int            `gorm:"type:smallint;not null" json:"rating"` // 1: 赞, -1: 踩
+	Reasons        pq.StringArray `gorm:"type:text[]" json:"reasons"`
+	Comment        string         `gorm:"size:1000" json:"comment,omitempty"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (MessageFeedback) TableName() string {
+	return "message_feedback"
+}
+
+// 反馈评分
+const (
+	RatingUp   = 1
+	RatingDown = -1
+)
+
+// FeedbackReasons 允许的反馈原因标签
+var FeedbackReasons = map[string]bool{
+	"accurate":   true, // 准确
+	"helpful":    true, // 有帮助
+	"creative":   true, // 有创意
+	"inaccurate": true, // 不准确
+	"irrelevant": true, // 答非所问
+	"incomplete": true, // 不完整
+	"harmful":    true, // 有害内容
+	"formatting": true, // 格式问题
+	"too_slow":   true, // 响应太慢
+}
@@ -1,12 +1,25 @@
 package service
 
 import (
+	"context"
 	"errors"
+	"sort"
+	"time"
 	"cybermind/chat-service/internal/model"
 	"cybermind/chat-service/pkg/database"
+	"cybermind/common/moderation"
 )
 
-type ChatService struct{}
+type ChatService struct {
+	queue     *MessageQueue
+	moderator *moderation.Moderator
+	client    *ModelClient
+	store     *GenerationStore
+}
+
+func NewChatService(queue *MessageQueue, moderator *moderation.Moderator, client *ModelClient, store *GenerationStore) *ChatService {
+	return &ChatService{queue: queue, moderator: moderator, client: client, store: store}
+}
 
 // CreateConversation 创建新对话
 func (s *ChatService) CreateConversation(userID, modelID int64, title string) (*model.Conversation, error) {
@@ -50,35 +63,190 @@ func (s *ChatService) ListConversations(userID int64, page, size int) ([]model.C
 	return conversations, total, nil
 }
 
-// AddMessage 添加消息
-func (s *ChatService) AddMessage(conversationID int64, role, content string) (*model.Message, error) {
+// AddMessage 添加消息，消息经内容审核后写入队列即返回，由后台异步持久化；
+// 命中拦截规则时返回moderation.ErrBlocked，命中打码规则时保存打码后的内容
+func (s *ChatService) AddMessage(ctx context.Context, conversationID int64, clientMsgID, role, content string) (*model.Message, error) {
 	// 检查对话是否存在
 	var conversation model.Conversation
 	if err := database.DB.First(&conversation, conversationID).Error; err != nil {
 		return nil, errors.New("对话不存在")
 	}
 
+	source := moderation.SourceOf(role)
+	if source != "" {
+		decision, err := s.moderator.Review(ctx, &moderation.Input{
+			UserID:         conversation.UserID,
+			ConversationID: conversationID,
+			ModelID:        conversation.ModelID,
+			Source:         source,
+			Text:           content,
+		})
+		if err != nil {
+			return nil, err
+		}
+		content = decision.Text
+	}
+
+	if clientMsgID == "" {
+		clientMsgID = NewClientMsgID()
+	}
+
 	message := &model.Message{
 		ConversationID: conversationID,
-		Role:          role,
-		Content:       content,
+		ClientMsgID:    clientMsgID,
+		Role:           role,
+		Content:        content,
+		CreatedAt:      time.Now(),
 	}
 
-	if err := database.DB.Create(message).Error; err != nil {
+	if err := s.queue.Enqueue(ctx, message); err != nil {
 		return nil, err
 	}
 	return message, nil
 }
 
-// GetMessages 获取对话消息列表
-func (s *ChatService) GetMessages(conversationID int64) ([]model.Message, error) {
+// GetMessages 获取对话消息列表，合并缓存中尚未持久化的消息
+func (s *ChatService) GetMessages(ctx context.Context, conversationID int64) ([]model.Message, error) {
 	var messages []model.Message
 	if err := database.DB.Where("conversation_id = ?", conversationID).Order("created_at ASC").Find(&messages).Error; err != nil {
 		return nil, err
 	}
+
+	cached, err := s.queue.CachedMessages(ctx, conversationID)
+	if err != nil || len(cached) == 0 {
+		return messages, nil
+	}
+
+	persisted := make(map[string]bool, len(messages))
+	for _, m := range messages {
+		if m.ClientMsgID != "" {
+			persisted[m.ClientMsgID] = true
+		}
+	}
+	merged := false
+	for _, m := range cached {
+		if persisted[m.ClientMsgID] {
+			continue
+		}
+		persisted[m.ClientMsgID] = true
+		messages = append(messages, m)
+		merged = true
+	}
+	if merged {
+		sort.SliceStable(messages, func(i, j int) bool {
+			return messages[i].CreatedAt.Before(messages[j].CreatedAt)
+		})
+	}
+
 	return messages, nil
 }
 
+// ListConversationsByCursor 按游标获取用户的对话列表(按创建时间倒序)
+func (s *ChatService) ListConversationsByCursor(userID int64, cq *CursorQuery) (*CursorPage, error) {
+	query, ascending, limit, err := cq.apply(database.DB.Model(&model.Conversation{}).Where("user_id = ?", userID), "conversations")
+	if err != nil {
+		return nil, err
+	}
+
+	var conversations []model.Conversation
+	if err := query.Find(&conversations).Error; err != nil {
+		return nil, err
+	}
+
+	hasMore := len(conversations) > limit
+	if hasMore {
+		conversations = conversations[:limit]
+	}
+	if ascending {
+		for i, j := 0, len(conversations)-1; i < j; i, j = i+1, j-1 {
+			conversations[i], conversations[j] = conversations[j], conversations[i]
+		}
+	}
+
+	page := &CursorPage{List: conversations, HasMore: hasMore}
+	if n := len(conversations); n > 0 {
+		page.AfterCursor = Cursor{CreatedAt: conversations[0].CreatedAt, ID: conversations[0].ID}.Encode()
+		page.BeforeCursor = Cursor{CreatedAt: conversations[n-1].CreatedAt, ID: conversations[n-1].ID}.Encode()
+	}
+	return page, nil
+}
+
+// GetMessagesByCursor 按游标获取对话消息(按创建时间正序返回)，
+// 不带before游标时从最新的消息开始，向上滚动时用before_cursor加载更早的消息
+func (s *ChatService) GetMessagesByCursor(ctx context.Context, conversationID int64, cq *CursorQuery) (*CursorPage, error) {
+	query, ascending, limit, err := cq.apply(database.DB.Model(&model.Message{}).Where("conversation_id = ?", conversationID), "messages")
+	if err != nil {
+		return nil, err
+	}
+
+	var messages []model.Message
+	if err := query.Find(&messages).Error; err != nil {
+		return nil, err
+	}
+
+	hasMore := len(messages) > limit
+	if hasMore {
+		messages = messages[:limit]
+	}
+	if !ascending {
+		for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+			messages[i], messages[j] = messages[j], messages[i]
+		}
+	}
+
+	page := &CursorPage{HasMore: hasMore}
+	if n := len(messages); n > 0 {
+		page.BeforeCursor = Cursor{CreatedAt: messages[0].CreatedAt, ID: messages[0].ID}.Encode()
+		page.AfterCursor = Cursor{CreatedAt: messages[n-1].CreatedAt, ID: messages[n-1].ID}.Encode()
+	} else if cq.After != "" {
+		page.AfterCursor = cq.After
+	}
+
+	// 已到达最新一页时附加尚未持久化的消息，游标只基于已持久化的消息，
+	// 这些消息持久化后会在after查询中再次返回，客户端按client_msg_id去重
+	if cq.Before == "" && (!ascending || !hasMore) {
+		pending, err := s.pendingMessages(ctx, conversationID)
+		if err == nil {
+			messages = append(messages, pending...)
+		}
+	}
+
+	page.List = messages
+	return page, nil
+}
+
+// pendingMessages 获取缓存中尚未持久化的消息
+func (s *ChatService) pendingMessages(ctx context.Context, conversationID int64) ([]model.Message, error) {
+	cached, err := s.queue.CachedMessages(ctx, conversationID)
+	if err != nil || len(cached) == 0 {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(cached))
+	for _, m := range cached {
+		ids = append(ids, m.ClientMsgID)
+	}
+	var persistedIDs []string
+	if err := database.DB.Model(&model.Message{}).Where("client_msg_id IN ?", ids).
+		Pluck("client_msg_id", &persistedIDs).Error; err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool, len(persistedIDs))
+	for _, id := range persistedIDs {
+		seen[id] = true
+	}
+	pending := make([]model.Message, 0, len(cached)-len(persistedIDs))
+	for _, m := range cached {
+		if seen[m.ClientMsgID] {
+			continue
+		}
+		seen[m.ClientMsgID] = true
+		pending = append(pending, m)
+	}
+	return pending, nil
+}
+
 // UpdateConversationPoints 更新对话消耗的积分
 func (s *ChatService) UpdateConversationPoints(conversationID int64, points int) error {
 	return database.DB.Model(&model.Conversation{}).Where("id = ?", conversationID).
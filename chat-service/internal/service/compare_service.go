@@ -0,0 +1,211 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"cybermind/chat-service/internal/model"
+	"cybermind/chat-service/pkg/database"
+	"cybermind/common/moderation"
+)
+
+// compareConcurrency 每个用户同时进行的模型调用数，超出的模型排队等待
+const compareConcurrency = 3
+
+var (
+	ErrModelUnavailable   = errors.New("模型不存在或已停用")
+	ErrComparisonNotFound = errors.New("对比记录不存在")
+	ErrInvalidPreference  = errors.New("只能选择已完成的回答")
+)
+
+// CompareChannel 对比中的一个模型通道
+type CompareChannel struct {
+	Channel   string `json:"channel"`
+	ModelID   int64  `json:"model_id"`
+	ModelName string `json:"model_name"`
+}
+
+type CompareService struct {
+	client    *ModelClient
+	moderator *moderation.Moderator
+	limiter   *ConcurrencyLimiter
+}
+
+func NewCompareService(client *ModelClient, moderator *moderation.Moderator) *CompareService {
+	return &CompareService{
+		client:    client,
+		moderator: moderator,
+		limiter:   NewConcurrencyLimiter("model_call", compareConcurrency),
+	}
+}
+
+// Create 审核提示词并创建对比记录，每个模型分配一个通道
+func (s *CompareService) Create(ctx context.Context, userID int64, modelIDs []int64, prompt string) (*model.Comparison, []CompareChannel, error) {
+	var models []struct {
+		ID   int64
+		Name string
+	}
+	if err := database.DB.Table("models").Select("id, name").
+		Where("id IN ? AND status = 1 AND deleted_at IS NULL", modelIDs).
+		Find(&models).Error; err != nil {
+		return nil, nil, err
+	}
+	names := make(map[int64]string, len(models))
+	for _, m := range models {
+		names[m.ID] = m.Name
+	}
+	for _, id := range modelIDs {
+		if _, ok := names[id]; !ok {
+			return nil, nil, ErrModelUnavailable
+		}
+	}
+
+	decision, err := s.moderator.Review(ctx, &moderation.Input{
+		UserID: userID,
+		Source: moderation.SourcePrompt,
+		Text:   prompt,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	comparison := &model.Comparison{
+		UserID:   userID,
+		Prompt:   decision.Text,
+		ModelIDs: modelIDs,
+	}
+	channels := make([]CompareChannel, len(modelIDs))
+	for i, id := range modelIDs {
+		channel := strconv.Itoa(i)
+		channels[i] = CompareChannel{Channel: channel, ModelID: id, ModelName: names[id]}
+		comparison.Answers = append(comparison.Answers, model.ComparisonAnswer{
+			ModelID: id,
+			Channel: channel,
+			Status:  model.AnswerStreaming,
+		})
+	}
+	if err := database.DB.Create(comparison).Error; err != nil {
+		return nil, nil, err
+	}
+	return comparison, channels, nil
+}
+
+// Run 并发调用各模型并通过emit推送各通道的事件，全部模型结束后返回
+func (s *CompareService) Run(ctx context.Context, comparison *model.Comparison, emit func(string, interface{})) {
+	var wg sync.WaitGroup
+	for i := range comparison.Answers {
+		wg.Add(1)
+		go func(answer *model.ComparisonAnswer) {
+			defer wg.Done()
+			s.runChannel(ctx, comparison, answer, emit)
+		}(&comparison.Answers[i])
+	}
+	wg.Wait()
+}
+
+// runChannel 调用单个模型，增量审核后推送输出，结束时保存回答
+func (s *CompareService) runChannel(ctx context.Context, comparison *model.Comparison, answer *model.ComparisonAnswer, emit func(string, interface{})) {
+	start := time.Now()
+	defer func() {
+		answer.LatencyMs = time.Since(start).Milliseconds()
+		database.DB.Save(answer)
+	}()
+
+	fail := func(code int, err error) {
+		answer.Status = model.AnswerFailed
+		answer.ErrorCode = code
+		answer.ErrorMessage = err.Error()
+		emit("error", map[string]interface{}{"channel": answer.Channel, "code": code, "message": err.Error()})
+	}
+
+	if err := s.limiter.Acquire(ctx, comparison.UserID); err != nil {
+		fail(1005, err)
+		return
+	}
+	defer s.limiter.Release(comparison.UserID)
+
+	result, err := streamCompletion(ctx, s.client, s.moderator, &RelayRequest{
+		ModelID:   answer.ModelID,
+		UserID:    comparison.UserID,
+		Source:    "compare",
+		RequestID: fmt.Sprintf("cmp-%d-%s", comparison.ID, answer.Channel),
+		Messages:  []ChatMessage{{Role: "user", Content: comparison.Prompt}},
+	}, moderation.Input{UserID: comparison.UserID, ModelID: answer.ModelID}, func(text string) {
+		emit("delta", map[string]interface{}{"channel": answer.Channel, "content": text})
+	})
+	answer.PointsCharged = result.Points
+	answer.FinishReason = result.FinishReason
+	if result.Usage != nil {
+		answer.PromptTokens = result.Usage.PromptTokens
+		answer.CompletionTokens = result.Usage.CompletionTokens
+	}
+
+	switch {
+	case errors.Is(err, moderation.ErrBlocked):
+		answer.Status = model.AnswerBlocked
+		answer.ErrorCode = 1007
+		emit("error", map[string]interface{}{"channel": answer.Channel, "code": 1007, "message": err.Error()})
+	case err != nil:
+		answer.Content = result.Content
+		fail(modelErrorCode(err), err)
+	default:
+		answer.Content = result.Content
+		answer.Status = model.AnswerCompleted
+		emit("done", map[string]interface{}{
+			"channel":        answer.Channel,
+			"finish_reason":  result.FinishReason,
+			"points_charged": result.Points,
+			"usage":          result.Usage,
+			"latency_ms":     time.Since(start).Milliseconds(),
+		})
+	}
+}
+
+// GetComparison 获取对比记录及各模型回答
+func (s *CompareService) GetComparison(userID, id int64) (*model.Comparison, error) {
+	var comparison model.Comparison
+	err := database.DB.Preload("Answers", func(db *gorm.DB) *gorm.DB {
+		return db.Order("channel ASC")
+	}).Where("id = ? AND user_id = ?", id, userID).First(&comparison).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrComparisonNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &comparison, nil
+}
+
+// Prefer 记录用户选出的最佳回答，可以重新选择
+func (s *CompareService) Prefer(userID, comparisonID, modelID int64) error {
+	var comparison model.Comparison
+	err := database.DB.Where("id = ? AND user_id = ?", comparisonID, userID).First(&comparison).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrComparisonNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	var count int64
+	if err := database.DB.Model(&model.ComparisonAnswer{}).
+		Where("comparison_id = ? AND model_id = ? AND status = ?", comparisonID, modelID, model.AnswerCompleted).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrInvalidPreference
+	}
+
+	now := time.Now()
+	return database.DB.Model(&comparison).Updates(map[string]interface{}{
+		"preferred_model_id": modelID,
+		"preferred_at":       now,
+	}).Error
+}
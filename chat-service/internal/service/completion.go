@@ -0,0 +1,229 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"strings"
+	"time"
+
+	"cybermind/chat-service/internal/model"
+	"cybermind/chat-service/pkg/database"
+	"cybermind/common/moderation"
+)
+
+// CompletionResult 一次流式补全的结果
+type CompletionResult struct {
+	Content      string // 经审核后实际下发的内容
+	FinishReason string
+	Usage        *Usage
+	Points       int // 扣除的积分
+}
+
+// streamCompletion 调用模型流式补全，输出经增量审核后通过onDelta下发。
+// 命中拦截时返回moderation.ErrBlocked；出错时result中仍包含已下发的内容和已扣除的积分
+func streamCompletion(ctx context.Context, client *ModelClient, moderator *moderation.Moderator, req *RelayRequest, input moderation.Input, onDelta func(string)) (*CompletionResult, error) {
+	result := &CompletionResult{}
+	stream, err := client.StreamChat(ctx, req)
+	if err != nil {
+		return result, err
+	}
+	defer stream.Close()
+	result.Points = stream.Points
+
+	filter := moderator.NewStreamFilter(ctx)
+	defer func() {
+		if decision := filter.Decision(); len(decision.Hits) > 0 {
+			input.Source = moderation.SourceCompletion
+			input.Text = filter.Text()
+			moderator.Record(context.Background(), &input, decision)
+		}
+	}()
+
+	var content strings.Builder
+	write := func(text string) {
+		if text == "" {
+			return
+		}
+		content.WriteString(text)
+		onDelta(text)
+	}
+
+	for {
+		delta, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			result.Points = stream.Points
+			break
+		}
+		if err != nil {
+			result.Content = content.String()
+			result.Points = stream.Points
+			return result, err
+		}
+		if delta.Usage != nil {
+			result.Usage = delta.Usage
+		}
+		if delta.FinishReason != "" {
+			result.FinishReason = delta.FinishReason
+		}
+
+		safe, err := filter.Write(delta.Content)
+		if err != nil {
+			result.Content = content.String()
+			return result, err
+		}
+		write(safe)
+	}
+
+	tail, err := filter.Flush()
+	if err == nil {
+		write(tail)
+	}
+	result.Content = content.String()
+	return result, err
+}
+
+// historyLimit 生成回复时携带的历史消息条数
+const historyLimit = 20
+
+var ErrConversationNotFound = errors.New("对话不存在")
+
+// ReplyStart 发起回复生成的结果
+type ReplyStart struct {
+	GenerationID string         `json:"generation_id"`
+	UserMessage  *model.Message `json:"user_message"`
+	MessageID    string         `json:"message_id"` // 助手回复的client_msg_id
+}
+
+// EstimateReply 预估在对话中发送content扣除的积分，携带的历史消息与生成回复时相同
+func (s *ChatService) EstimateReply(ctx context.Context, userID, conversationID int64, content string) (*PriceEstimate, error) {
+	var conversation model.Conversation
+	if err := database.DB.Where("id = ? AND user_id = ?", conversationID, userID).First(&conversation).Error; err != nil {
+		return nil, ErrConversationNotFound
+	}
+
+	history, err := s.GetMessages(ctx, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	if len(history) >= historyLimit {
+		history = history[len(history)-historyLimit+1:]
+	}
+	messages := make([]ChatMessage, 0, len(history)+1)
+	for _, m := range history {
+		messages = append(messages, ChatMessage{Role: m.Role, Content: m.Content})
+	}
+	messages = append(messages, ChatMessage{Role: "user", Content: content})
+
+	return s.client.Estimate(ctx, &RelayRequest{
+		ModelID:  conversation.ModelID,
+		UserID:   userID,
+		Messages: messages,
+	})
+}
+
+// Reply 保存用户消息并在后台生成助手回复。生成事件写入缓冲区，客户端断开后生成继续进行，
+// 可以通过生成ID断线重连，生成结束后回复写入消息队列
+func (s *ChatService) Reply(ctx context.Context, userID, conversationID int64, clientMsgID, content string) (*ReplyStart, error) {
+	var conversation model.Conversation
+	if err := database.DB.Where("id = ? AND user_id = ?", conversationID, userID).First(&conversation).Error; err != nil {
+		return nil, ErrConversationNotFound
+	}
+
+	userMessage, err := s.AddMessage(ctx, conversationID, clientMsgID, "user", content)
+	if err != nil {
+		return nil, err
+	}
+
+	history, err := s.GetMessages(ctx, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	if len(history) > historyLimit {
+		history = history[len(history)-historyLimit:]
+	}
+	messages := make([]ChatMessage, 0, len(history))
+	for _, m := range history {
+		messages = append(messages, ChatMessage{Role: m.Role, Content: m.Content})
+	}
+
+	start := &ReplyStart{
+		GenerationID: NewGenerationID(),
+		UserMessage:  userMessage,
+		MessageID:    NewClientMsgID(),
+	}
+	if err := s.store.Create(ctx, start.GenerationID, userID, map[string]interface{}{
+		"type":            "chat",
+		"conversation_id": conversationID,
+		"message_id":      start.MessageID,
+	}); err != nil {
+		return nil, err
+	}
+
+	s.store.Run(start.GenerationID, func(ctx context.Context, emit func(string, interface{})) (string, map[string]interface{}) {
+		emit("start", start)
+
+		result, err := streamCompletion(ctx, s.client, s.moderator, &RelayRequest{
+			ModelID:   conversation.ModelID,
+			UserID:    userID,
+			Source:    "chat",
+			RequestID: start.GenerationID,
+			Messages:  messages,
+		}, moderation.Input{
+			UserID:         userID,
+			ConversationID: conversationID,
+			ModelID:        conversation.ModelID,
+		}, func(text string) {
+			emit("delta", map[string]interface{}{"content": text})
+		})
+		if result.Points > 0 {
+			if err := s.UpdateConversationPoints(conversationID, result.Points); err != nil {
+				log.Printf("更新对话积分失败: conversation=%d err=%v", conversationID, err)
+			}
+		}
+
+		if errors.Is(err, moderation.ErrBlocked) {
+			emit("error", map[string]interface{}{"code": 1007, "message": err.Error()})
+			return GenerationFailed, map[string]interface{}{"error_code": 1007}
+		}
+
+		// 出错或被取消时同样保存已生成的部分
+		if result.Content != "" {
+			message := &model.Message{
+				ConversationID: conversationID,
+				ClientMsgID:    start.MessageID,
+				Role:           "assistant",
+				Content:        result.Content,
+				CreatedAt:      time.Now(),
+			}
+			if result.Usage != nil {
+				message.TokensCount = result.Usage.CompletionTokens
+			}
+			if err := s.queue.Enqueue(context.Background(), message); err != nil {
+				log.Printf("保存助手回复失败: conversation=%d err=%v", conversationID, err)
+			}
+		}
+
+		fields := map[string]interface{}{
+			"content":        result.Content,
+			"finish_reason":  result.FinishReason,
+			"points_charged": result.Points,
+		}
+		if err != nil {
+			code := modelErrorCode(err)
+			emit("error", map[string]interface{}{"code": code, "message": err.Error()})
+			fields["error_code"] = code
+			return GenerationFailed, fields
+		}
+
+		emit("done", map[string]interface{}{
+			"message_id":     start.MessageID,
+			"finish_reason":  result.FinishReason,
+			"points_charged": result.Points,
+			"usage":          result.Usage,
+		})
+		return GenerationDone, fields
+	})
+	return start, nil
+}
@@ -0,0 +1,73 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"cybermind/chat-service/pkg/database"
+)
+
+// acquireScript 计数未达到上限时加一并刷新过期时间，返回是否获取成功
+var acquireScript = redis.NewScript(`
+local n = tonumber(redis.call('GET', KEYS[1]) or '0')
+if n >= tonumber(ARGV[1]) then
+	return 0
+end
+redis.call('INCR', KEYS[1])
+redis.call('EXPIRE', KEYS[1], ARGV[2])
+return 1
+`)
+
+// ConcurrencyLimiter 基于Redis计数的用户级并发限制，多个实例共享同一计数
+type ConcurrencyLimiter struct {
+	name     string
+	limit    int
+	ttl      time.Duration // 计数过期时间，防止实例崩溃后计数无法释放
+	interval time.Duration // 等待空闲名额的轮询间隔
+}
+
+// NewConcurrencyLimiter 创建并发限制器，每个用户同时最多占用limit个名额
+func NewConcurrencyLimiter(name string, limit int) *ConcurrencyLimiter {
+	return &ConcurrencyLimiter{
+		name:     name,
+		limit:    limit,
+		ttl:      5 * time.Minute,
+		interval: 200 * time.Millisecond,
+	}
+}
+
+func (l *ConcurrencyLimiter) key(userID int64) string {
+	return fmt.Sprintf("concurrency:%s:user:%d", l.name, userID)
+}
+
+// Acquire 获取一个名额，名额已满时等待直到有空闲名额或ctx结束
+func (l *ConcurrencyLimiter) Acquire(ctx context.Context, userID int64) error {
+	key := l.key(userID)
+	for {
+		ok, err := acquireScript.Run(ctx, database.RDB, []string{key}, l.limit, int(l.ttl.Seconds())).Int()
+		if err != nil {
+			return err
+		}
+		if ok == 1 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(l.interval):
+		}
+	}
+}
+
+// Release 释放一个名额
+func (l *ConcurrencyLimiter) Release(userID int64) {
+	key := l.key(userID)
+	ctx := context.Background()
+	if n, err := database.RDB.Decr(ctx, key).Result(); err == nil && n <= 0 {
+		database.RDB.Del(ctx, key)
+	}
+}
@@ -0,0 +1,94 @@
+package service
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var ErrInvalidCursor = errors.New("无效的游标")
+
+const (
+	defaultCursorLimit = 20
+	maxCursorLimit     = 100
+)
+
+// Cursor 基于(created_at, id)的键集分页游标
+type Cursor struct {
+	CreatedAt time.Time
+	ID        int64
+}
+
+// Encode 将游标编码为不透明字符串
+func (c Cursor) Encode() string {
+	raw := fmt.Sprintf("%d:%d", c.CreatedAt.UnixMicro(), c.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeCursor 解析不透明游标字符串
+func DecodeCursor(s string) (*Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var micros, id int64
+	if _, err := fmt.Sscanf(string(raw), "%d:%d", &micros, &id); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &Cursor{CreatedAt: time.UnixMicro(micros), ID: id}, nil
+}
+
+// CursorQuery 游标分页参数，Before与After最多指定一个，都为空时从最新的记录开始
+type CursorQuery struct {
+	Before string
+	After  string
+	Limit  int
+}
+
+// CursorPage 游标分页结果
+type CursorPage struct {
+	List         interface{} `json:"list"`
+	HasMore      bool        `json:"has_more"`                // 请求方向上是否还有更多记录
+	BeforeCursor string      `json:"before_cursor,omitempty"` // 本页最旧一条记录的游标，用于加载更早的记录
+	AfterCursor  string      `json:"after_cursor,omitempty"`  // 本页最新一条记录的游标，用于加载更新的记录
+}
+
+// apply 在查询上追加键集条件与排序，返回是否为向新记录方向的查询及实际limit
+func (q *CursorQuery) apply(query *gorm.DB, table string) (*gorm.DB, bool, int, error) {
+	limit := q.Limit
+	if limit <= 0 {
+		limit = defaultCursorLimit
+	}
+	if limit > maxCursorLimit {
+		limit = maxCursorLimit
+	}
+	if q.Before != "" && q.After != "" {
+		return nil, false, 0, ErrInvalidCursor
+	}
+
+	createdAt := table + ".created_at"
+	id := table + ".id"
+
+	if q.After != "" {
+		cursor, err := DecodeCursor(q.After)
+		if err != nil {
+			return nil, false, 0, err
+		}
+		query = query.Where(fmt.Sprintf("(%s, %s) > (?, ?)", createdAt, id), cursor.CreatedAt, cursor.ID).
+			Order(createdAt + " ASC").Order(id + " ASC")
+		return query.Limit(limit + 1), true, limit, nil
+	}
+
+	if q.Before != "" {
+		cursor, err := DecodeCursor(q.Before)
+		if err != nil {
+			return nil, false, 0, err
+		}
+		query = query.Where(fmt.Sprintf("(%s, %s) < (?, ?)", createdAt, id), cursor.CreatedAt, cursor.ID)
+	}
+	query = query.Order(createdAt + " DESC").Order(id + " DESC")
+	return query.Limit(limit + 1), false, limit, nil
+}
@@ -0,0 +1,115 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"cybermind/chat-service/internal/model"
+	"cybermind/chat-service/pkg/database"
+)
+
+var (
+	ErrMessageNotFound  = errors.New("消息不存在")
+	ErrNotRatable       = errors.New("只能评价助手回复")
+	ErrInvalidReason    = errors.New("无效的反馈原因")
+	ErrFeedbackNotFound = errors.New("反馈不存在")
+)
+
+type FeedbackService struct{}
+
+// FeedbackInput 提交反馈参数，MessageID与ClientMsgID二选一
+type FeedbackInput struct {
+	MessageID   int64
+	ClientMsgID string
+	Rating      int
+	Reasons     []string
+	Comment     string
+}
+
+// SubmitFeedback 提交或更新用户对助手消息的反馈
+func (s *FeedbackService) SubmitFeedback(userID int64, input *FeedbackInput) (*model.MessageFeedback, error) {
+	for _, reason := range input.Reasons {
+		if !model.FeedbackReasons[reason] {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidReason, reason)
+		}
+	}
+
+	message, conversation, err := s.findOwnedMessage(userID, input.MessageID, input.ClientMsgID)
+	if err != nil {
+		return nil, err
+	}
+	if message.Role != "assistant" {
+		return nil, ErrNotRatable
+	}
+
+	feedback := &model.MessageFeedback{
+		UserID:         userID,
+		MessageID:      message.ID,
+		ConversationID: conversation.ID,
+		ModelID:        conversation.ModelID,
+		Rating:         input.Rating,
+		Reasons:        input.Reasons,
+		Comment:        input.Comment,
+	}
+
+	// 同一用户对同一消息只保留一条反馈，重复提交视为修改
+	err = database.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "message_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"rating", "reasons", "comment", "updated_at"}),
+	}).Create(feedback).Error
+	if err != nil {
+		return nil, err
+	}
+	return feedback, nil
+}
+
+// DeleteFeedback 撤销反馈
+func (s *FeedbackService) DeleteFeedback(userID, messageID int64) error {
+	result := database.DB.Where("user_id = ? AND message_id = ?", userID, messageID).Delete(&model.MessageFeedback{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrFeedbackNotFound
+	}
+	return nil
+}
+
+// ListFeedback 获取用户在对话中提交的反馈
+func (s *FeedbackService) ListFeedback(userID, conversationID int64) ([]model.MessageFeedback, error) {
+	var feedback []model.MessageFeedback
+	if err := database.DB.Where("user_id = ? AND conversation_id = ?", userID, conversationID).
+		Order("created_at ASC").Find(&feedback).Error; err != nil {
+		return nil, err
+	}
+	return feedback, nil
+}
+
+// findOwnedMessage 查找属于该用户对话的已持久化消息
+func (s *FeedbackService) findOwnedMessage(userID, messageID int64, clientMsgID string) (*model.Message, *model.Conversation, error) {
+	var message model.Message
+	query := database.DB.Model(&model.Message{})
+	if messageID > 0 {
+		query = query.Where("id = ?", messageID)
+	} else {
+		query = query.Where("client_msg_id = ?", clientMsgID)
+	}
+	if err := query.First(&message).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrMessageNotFound
+		}
+		return nil, nil, err
+	}
+
+	var conversation model.Conversation
+	if err := database.DB.Where("id = ? AND user_id = ?", message.ConversationID, userID).First(&conversation).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrMessageNotFound
+		}
+		return nil, nil, err
+	}
+	return &message, &conversation, nil
+}
@@ -0,0 +1,259 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"cybermind/chat-service/pkg/database"
+)
+
+const (
+	generationTTL     = 30 * time.Minute // 生成过程中缓冲区的过期时间
+	generationKeep    = 10 * time.Minute // 生成结束后保留缓冲区，供断线重连和查询结果
+	generationGrace   = 2 * time.Minute  // 客户端全部断开后继续生成的宽限期
+	generationTimeout = 10 * time.Minute // 单次生成的最长时间
+	attachTTL         = 15 * time.Second // 客户端连接标记的过期时间
+	subscribeBlock    = 5 * time.Second  // 读取缓冲区的阻塞时间，同时是连接标记的刷新间隔
+)
+
+// 生成状态
+const (
+	GenerationRunning  = "running"
+	GenerationDone     = "done"
+	GenerationFailed   = "failed"
+	GenerationCanceled = "canceled" // 客户端断开超过宽限期
+)
+
+var ErrGenerationNotFound = errors.New("生成任务不存在或已过期")
+
+// BufferedEvent 缓冲区中的事件，ID为Redis Stream的消息ID，用作SSE的事件ID
+type BufferedEvent struct {
+	ID    string
+	Event string
+	Data  json.RawMessage
+}
+
+// GenerationTask 生成任务，通过emit推送事件，返回最终状态和需要保存的结果字段
+type GenerationTask func(ctx context.Context, emit func(event string, data interface{})) (status string, result map[string]interface{})
+
+// GenerationStore 基于Redis的生成事件缓冲区：生成任务在后台独立运行，事件写入Redis Stream，
+// 客户端断线后可以携带Last-Event-ID从断点继续读取，其他实例同样可以读取
+type GenerationStore struct{}
+
+func NewGenerationStore() *GenerationStore {
+	return &GenerationStore{}
+}
+
+// NewGenerationID 生成任务ID
+func NewGenerationID() string {
+	b := make([]byte, 12)
+	_, _ = rand.Read(b)
+	return "gen_" + hex.EncodeToString(b)
+}
+
+func generationKey(id string) string {
+	return fmt.Sprintf("generation:%s", id)
+}
+
+func generationEventsKey(id string) string {
+	return fmt.Sprintf("generation:%s:events", id)
+}
+
+func generationAttachedKey(id string) string {
+	return fmt.Sprintf("generation:%s:attached", id)
+}
+
+// Create 创建生成任务，fields为任务的附加信息
+func (s *GenerationStore) Create(ctx context.Context, id string, userID int64, fields map[string]interface{}) error {
+	values := map[string]interface{}{
+		"user_id":    userID,
+		"status":     GenerationRunning,
+		"created_at": time.Now().Unix(),
+	}
+	for k, v := range fields {
+		values[k] = v
+	}
+
+	key := generationKey(id)
+	_, err := database.RDB.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, key, values)
+		pipe.Expire(ctx, key, generationTTL)
+		// 创建时即标记为已连接，宽限期从客户端断开时开始计算
+		pipe.Set(ctx, generationAttachedKey(id), 1, attachTTL)
+		return nil
+	})
+	return err
+}
+
+// Get 获取生成任务信息，user_id不匹配时视为不存在
+func (s *GenerationStore) Get(ctx context.Context, id string, userID int64) (map[string]string, error) {
+	values, err := database.RDB.HGetAll(ctx, generationKey(id)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(values) == 0 || values["user_id"] != strconv.FormatInt(userID, 10) {
+		return nil, ErrGenerationNotFound
+	}
+	return values, nil
+}
+
+// Append 追加事件到缓冲区
+func (s *GenerationStore) Append(ctx context.Context, id, event string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	key := generationEventsKey(id)
+	_, err = database.RDB.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.XAdd(ctx, &redis.XAddArgs{
+			Stream: key,
+			Values: map[string]interface{}{"event": event, "data": payload},
+		})
+		pipe.Expire(ctx, key, generationTTL)
+		return nil
+	})
+	return err
+}
+
+// finish 记录最终状态和结果，缓冲区保留一段时间后过期
+func (s *GenerationStore) finish(ctx context.Context, id, status string, result map[string]interface{}) error {
+	values := map[string]interface{}{"status": status, "finished_at": time.Now().Unix()}
+	for k, v := range result {
+		values[k] = v
+	}
+
+	_, err := database.RDB.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, generationKey(id), values)
+		pipe.Expire(ctx, generationKey(id), generationKeep)
+		pipe.Expire(ctx, generationEventsKey(id), generationKeep)
+		return nil
+	})
+	return err
+}
+
+// Run 在后台执行生成任务，不受发起请求的连接影响；客户端全部断开超过宽限期时取消任务。
+// 任务结束后追加end事件
+func (s *GenerationStore) Run(id string, task GenerationTask) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), generationTimeout)
+		defer cancel()
+
+		detached := make(chan struct{})
+		go s.watch(ctx, id, func() {
+			close(detached)
+			cancel()
+		})
+
+		// 事件写入失败时记录日志，不中断生成
+		emit := func(event string, data interface{}) {
+			if err := s.Append(context.Background(), id, event, data); err != nil {
+				log.Printf("写入生成事件失败: generation=%s event=%s err=%v", id, event, err)
+			}
+		}
+
+		status, result := task(ctx, emit)
+		select {
+		case <-detached:
+			status = GenerationCanceled
+		default:
+		}
+
+		emit("end", map[string]interface{}{"generation_id": id, "status": status})
+		if err := s.finish(context.Background(), id, status, result); err != nil {
+			log.Printf("保存生成结果失败: generation=%s err=%v", id, err)
+		}
+	}()
+}
+
+// watch 检查是否还有客户端连接，断开超过宽限期时调用onDetached
+func (s *GenerationStore) watch(ctx context.Context, id string, onDetached func()) {
+	ticker := time.NewTicker(subscribeBlock)
+	defer ticker.Stop()
+
+	var detachedAt time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		n, err := database.RDB.Exists(ctx, generationAttachedKey(id)).Result()
+		if err != nil || n > 0 {
+			detachedAt = time.Time{}
+			continue
+		}
+		if detachedAt.IsZero() {
+			detachedAt = time.Now()
+			continue
+		}
+		if time.Since(detachedAt) > generationGrace {
+			log.Printf("客户端断开超过宽限期，取消生成: generation=%s", id)
+			onDetached()
+			return
+		}
+	}
+}
+
+// Subscribe 从lastEventID之后读取事件(为空时从头读取)，读到end事件或ctx结束时关闭channel。
+// 订阅期间持续标记客户端已连接
+func (s *GenerationStore) Subscribe(ctx context.Context, id, lastEventID string) <-chan BufferedEvent {
+	events := make(chan BufferedEvent, 16)
+	if lastEventID == "" {
+		lastEventID = "0"
+	}
+
+	go func() {
+		defer close(events)
+		key := generationEventsKey(id)
+		for {
+			database.RDB.Set(ctx, generationAttachedKey(id), 1, attachTTL)
+
+			streams, err := database.RDB.XRead(ctx, &redis.XReadArgs{
+				Streams: []string{key, lastEventID},
+				Count:   100,
+				Block:   subscribeBlock,
+			}).Result()
+			if errors.Is(err, redis.Nil) {
+				// 缓冲区已过期且任务不存在时结束订阅
+				if n, _ := database.RDB.Exists(ctx, generationKey(id)).Result(); n == 0 {
+					return
+				}
+				continue
+			}
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("读取生成事件失败: generation=%s err=%v", id, err)
+				}
+				return
+			}
+
+			for _, stream := range streams {
+				for _, msg := range stream.Messages {
+					lastEventID = msg.ID
+					event, _ := msg.Values["event"].(string)
+					data, _ := msg.Values["data"].(string)
+					select {
+					case events <- BufferedEvent{ID: msg.ID, Event: event, Data: json.RawMessage(data)}:
+					case <-ctx.Done():
+						return
+					}
+					if event == "end" {
+						return
+					}
+				}
+			}
+		}
+	}()
+	return events
+}
@@ -0,0 +1,278 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm/clause"
+
+	"cybermind/chat-service/internal/model"
+	"cybermind/chat-service/pkg/database"
+)
+
+const (
+	messageStreamKey     = "chat:messages:stream"
+	messageStreamGroup   = "message-persister"
+	messageStreamMaxLen  = 100000
+	conversationCacheKey = "conversation:%d:messages"
+	conversationCacheTTL = 24 * time.Hour
+	conversationCacheMax = 500
+	shutdownFlushTimeout = 10 * time.Second // 退出时刷写剩余消息的超时时间
+)
+
+// MessageQueue 消息写入队列：消息先写入Redis Stream即视为确认，
+// 由后台worker批量持久化到PostgreSQL（至少一次投递，按client_msg_id幂等）
+type MessageQueue struct {
+	consumer      string
+	batchSize     int64
+	flushInterval time.Duration
+	claimIdle     time.Duration
+	done          chan struct{}
+}
+
+// NewMessageQueue 创建消息写入队列
+func NewMessageQueue() *MessageQueue {
+	consumer, err := os.Hostname()
+	if err != nil || consumer == "" {
+		consumer = fmt.Sprintf("chat-service-%d", os.Getpid())
+	}
+	return &MessageQueue{
+		consumer:      consumer,
+		batchSize:     100,
+		flushInterval: time.Second,
+		claimIdle:     time.Minute,
+		done:          make(chan struct{}),
+	}
+}
+
+// NewClientMsgID 生成客户端消息ID，用于客户端未提供时
+func NewClientMsgID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// Enqueue 将消息写入Redis Stream和对话消息缓存
+func (q *MessageQueue) Enqueue(ctx context.Context, message *model.Message) error {
+	payload, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	cacheKey := fmt.Sprintf(conversationCacheKey, message.ConversationID)
+	_, err = database.RDB.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.XAdd(ctx, &redis.XAddArgs{
+			Stream: messageStreamKey,
+			MaxLen: messageStreamMaxLen,
+			Approx: true,
+			Values: map[string]interface{}{"payload": payload},
+		})
+		pipe.RPush(ctx, cacheKey, payload)
+		pipe.LTrim(ctx, cacheKey, -conversationCacheMax, -1)
+		pipe.Expire(ctx, cacheKey, conversationCacheTTL)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("写入消息队列失败: %w", err)
+	}
+	return nil
+}
+
+// CachedMessages 获取对话消息缓存中的消息（包含尚未持久化的消息）
+func (q *MessageQueue) CachedMessages(ctx context.Context, conversationID int64) ([]model.Message, error) {
+	items, err := database.RDB.LRange(ctx, fmt.Sprintf(conversationCacheKey, conversationID), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]model.Message, 0, len(items))
+	for _, item := range items {
+		var message model.Message
+		if err := json.Unmarshal([]byte(item), &message); err != nil {
+			continue
+		}
+		messages = append(messages, message)
+	}
+	return messages, nil
+}
+
+// Start 启动后台持久化worker，启动前先恢复并刷写未确认的消息。ctx取消时刷写已读取的消息后退出
+func (q *MessageQueue) Start(ctx context.Context) error {
+	err := database.RDB.XGroupCreateMkStream(ctx, messageStreamKey, messageStreamGroup, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return fmt.Errorf("创建消息消费组失败: %w", err)
+	}
+
+	if err := q.Recover(ctx); err != nil {
+		return err
+	}
+
+	go func() {
+		defer close(q.done)
+		q.run(ctx)
+	}()
+	return nil
+}
+
+// Wait 等待Start的ctx取消后已读取的消息刷写完成
+func (q *MessageQueue) Wait() {
+	<-q.done
+}
+
+// Recover 刷写本消费者及其他失联消费者遗留的待确认消息
+func (q *MessageQueue) Recover(ctx context.Context) error {
+	recovered := 0
+
+	// 本消费者上次退出前已读取但未确认的消息
+	for {
+		streams, err := database.RDB.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    messageStreamGroup,
+			Consumer: q.consumer,
+			Streams:  []string{messageStreamKey, "0"},
+			Count:    q.batchSize,
+		}).Result()
+		if err != nil && err != redis.Nil {
+			return fmt.Errorf("读取待确认消息失败: %w", err)
+		}
+		if len(streams) == 0 || len(streams[0].Messages) == 0 {
+			break
+		}
+		if err := q.flush(ctx, streams[0].Messages); err != nil {
+			return fmt.Errorf("恢复待确认消息失败: %w", err)
+		}
+		recovered += len(streams[0].Messages)
+	}
+
+	// 其他消费者遗留的超时消息
+	claimed, err := q.reclaim(ctx)
+	if err != nil {
+		return fmt.Errorf("恢复待确认消息失败: %w", err)
+	}
+	recovered += claimed
+
+	if recovered > 0 {
+		log.Printf("已恢复 %d 条待持久化消息", recovered)
+	}
+	return nil
+}
+
+// reclaim 认领空闲超过claimIdle的待确认消息并刷写
+func (q *MessageQueue) reclaim(ctx context.Context) (int, error) {
+	claimed := 0
+	start := "0-0"
+	for {
+		messages, next, err := database.RDB.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+			Stream:   messageStreamKey,
+			Group:    messageStreamGroup,
+			Consumer: q.consumer,
+			MinIdle:  q.claimIdle,
+			Start:    start,
+			Count:    q.batchSize,
+		}).Result()
+		if err != nil {
+			return claimed, err
+		}
+		if len(messages) > 0 {
+			if err := q.flush(ctx, messages); err != nil {
+				return claimed, err
+			}
+			claimed += len(messages)
+		}
+		if next == "0-0" || len(messages) == 0 {
+			return claimed, nil
+		}
+		start = next
+	}
+}
+
+// run 持续读取新消息，达到批量大小或刷写间隔后写入数据库
+func (q *MessageQueue) run(ctx context.Context) {
+	var pending []redis.XMessage
+	lastFlush := time.Now()
+	lastClaim := time.Now()
+
+	for ctx.Err() == nil {
+		streams, err := database.RDB.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    messageStreamGroup,
+			Consumer: q.consumer,
+			Streams:  []string{messageStreamKey, ">"},
+			Count:    q.batchSize - int64(len(pending)),
+			Block:    q.flushInterval,
+		}).Result()
+		if ctx.Err() != nil {
+			break
+		}
+		if err != nil && err != redis.Nil {
+			log.Printf("读取消息队列失败: %v", err)
+			time.Sleep(q.flushInterval)
+			continue
+		}
+		for _, stream := range streams {
+			pending = append(pending, stream.Messages...)
+		}
+
+		if len(pending) > 0 && (int64(len(pending)) >= q.batchSize || time.Since(lastFlush) >= q.flushInterval) {
+			// 刷写失败的消息保留在待确认列表中，由reclaim重试
+			if err := q.flush(ctx, pending); err != nil {
+				log.Printf("持久化消息失败: %v", err)
+			}
+			pending = nil
+			lastFlush = time.Now()
+		}
+
+		if time.Since(lastClaim) >= q.claimIdle {
+			if _, err := q.reclaim(ctx); err != nil {
+				log.Printf("重试待持久化消息失败: %v", err)
+			}
+			lastClaim = time.Now()
+		}
+	}
+
+	// 已读取未刷写的消息在退出前写入，ctx已取消，使用新的超时上下文；失败时保留在待确认列表中，由reclaim重试
+	if len(pending) > 0 {
+		flushCtx, cancel := context.WithTimeout(context.Background(), shutdownFlushTimeout)
+		defer cancel()
+		if err := q.flush(flushCtx, pending); err != nil {
+			log.Printf("退出前持久化消息失败: %v", err)
+		}
+	}
+}
+
+// flush 批量写入数据库并确认消息，client_msg_id冲突的消息视为已写入
+func (q *MessageQueue) flush(ctx context.Context, entries []redis.XMessage) error {
+	ids := make([]string, 0, len(entries))
+	messages := make([]model.Message, 0, len(entries))
+	for _, entry := range entries {
+		ids = append(ids, entry.ID)
+
+		payload, _ := entry.Values["payload"].(string)
+		var message model.Message
+		if err := json.Unmarshal([]byte(payload), &message); err != nil || message.ClientMsgID == "" {
+			log.Printf("丢弃无效的队列消息 %s: %v", entry.ID, err)
+			continue
+		}
+		message.ID = 0
+		messages = append(messages, message)
+	}
+
+	if len(messages) > 0 {
+		err := database.DB.WithContext(ctx).
+			Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "client_msg_id"}}, DoNothing: true}).
+			CreateInBatches(&messages, int(q.batchSize)).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	return database.RDB.XAck(ctx, messageStreamKey, messageStreamGroup, ids...).Err()
+}
@@ -0,0 +1,246 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ChatMessage 发送给模型的对话消息
+type ChatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// Usage token用量
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// RelayRequest 调用model-service转发接口的请求
+type RelayRequest struct {
+	ModelID   int64         `json:"model_id"`
+	UserID    int64         `json:"user_id"`
+	Source    string        `json:"source"`
+	RequestID string        `json:"request_id,omitempty"`
+	Messages  []ChatMessage `json:"messages"`
+	Stream    bool          `json:"stream"`
+}
+
+// ModelError model-service返回的错误
+type ModelError struct {
+	Code    int
+	Message string
+}
+
+func (e *ModelError) Error() string {
+	return fmt.Sprintf("model service error %d: %s", e.Code, e.Message)
+}
+
+// ModelClient model-service服务间调用客户端
+type ModelClient struct {
+	baseURL    string
+	token      string
+	httpClient *http.Client
+}
+
+// NewModelClient 根据环境变量MODEL_SERVICE_URL和INTERNAL_API_TOKEN创建客户端
+func NewModelClient() *ModelClient {
+	baseURL := os.Getenv("MODEL_SERVICE_URL")
+	if baseURL == "" {
+		baseURL = "http://model-service:8081"
+	}
+	return &ModelClient{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		token:      os.Getenv("INTERNAL_API_TOKEN"),
+		httpClient: &http.Client{},
+	}
+}
+
+// StreamChat 发起流式对话补全，调用方需要关闭返回的ChatStream
+func (c *ModelClient) StreamChat(ctx context.Context, req *RelayRequest) (*ChatStream, error) {
+	req.Stream = true
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/internal/v1/chat/completions", bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Accept", "text/event-stream")
+	if c.token != "" {
+		httpReq.Header.Set("X-Internal-Token", c.token)
+	}
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		var body struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		}
+		if err := json.NewDecoder(io.LimitReader(resp.Body, 4096)).Decode(&body); err != nil || body.Code == 0 {
+			return nil, &ModelError{Code: 1009, Message: fmt.Sprintf("模型服务返回状态码%d", resp.StatusCode)}
+		}
+		return nil, &ModelError{Code: body.Code, Message: body.Message}
+	}
+
+	points, _ := strconv.Atoi(resp.Header.Get("X-Points-Charged"))
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	return &ChatStream{
+		RequestID: resp.Header.Get("X-Request-ID"),
+		Points:    points,
+		body:      resp.Body,
+		scanner:   scanner,
+	}, nil
+}
+
+// PriceEstimate 发送前的价格预估，MinPoints为输出为空时的积分，MaxPoints为输出达到MaxTokens时的积分，即发送时预扣的积分
+type PriceEstimate struct {
+	Mode         string `json:"mode"` // request按次计费，token按token计费
+	PromptTokens int    `json:"prompt_tokens"`
+	MaxTokens    int    `json:"max_tokens"`
+	MinPoints    int    `json:"min_points"`
+	MaxPoints    int    `json:"max_points"`
+}
+
+// Estimate 预估请求扣除的积分
+func (c *ModelClient) Estimate(ctx context.Context, req *RelayRequest) (*PriceEstimate, error) {
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/internal/v1/chat/estimate", bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if c.token != "" {
+		httpReq.Header.Set("X-Internal-Token", c.token)
+	}
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Code    int            `json:"code"`
+		Message string         `json:"message"`
+		Data    *PriceEstimate `json:"data"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&body); err != nil {
+		return nil, &ModelError{Code: 1009, Message: fmt.Sprintf("模型服务返回状态码%d", resp.StatusCode)}
+	}
+	if resp.StatusCode != http.StatusOK || body.Data == nil {
+		return nil, &ModelError{Code: body.Code, Message: body.Message}
+	}
+	return body.Data, nil
+}
+
+// StreamDelta 流式输出的一个增量
+type StreamDelta struct {
+	Content      string
+	FinishReason string
+	Usage        *Usage
+}
+
+// ChatStream 模型流式输出
+type ChatStream struct {
+	RequestID string
+	Points    int // 本次调用扣除的积分，按token计费时输出结束或出错时更新为结算后的积分
+
+	body    io.ReadCloser
+	scanner *bufio.Scanner
+}
+
+// Recv 读取下一个增量，输出结束时返回io.EOF
+func (s *ChatStream) Recv() (*StreamDelta, error) {
+	for s.scanner.Scan() {
+		line := bytes.TrimSpace(s.scanner.Bytes())
+		if !bytes.HasPrefix(line, []byte("data:")) {
+			continue
+		}
+		data := bytes.TrimSpace(line[len("data:"):])
+		if string(data) == "[DONE]" {
+			return nil, io.EOF
+		}
+
+		var chunk struct {
+			Choices []struct {
+				Delta struct {
+					Content string `json:"content"`
+				} `json:"delta"`
+				FinishReason *string `json:"finish_reason"`
+			} `json:"choices"`
+			Usage         *Usage `json:"usage"`
+			PointsCharged *int   `json:"points_charged"`
+			Error         *struct {
+				Code    int    `json:"code"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal(data, &chunk); err != nil {
+			return nil, err
+		}
+		if chunk.PointsCharged != nil {
+			// 按token计费时在[DONE]或error分片之前返回结算后的积分
+			s.Points = *chunk.PointsCharged
+			continue
+		}
+		if chunk.Error != nil {
+			// 上游安全策略拦截时为1007，其他错误没有code
+			code := chunk.Error.Code
+			if code == 0 {
+				code = 1009
+			}
+			return nil, &ModelError{Code: code, Message: chunk.Error.Message}
+		}
+
+		delta := &StreamDelta{Usage: chunk.Usage}
+		for _, choice := range chunk.Choices {
+			delta.Content += choice.Delta.Content
+			if choice.FinishReason != nil {
+				delta.FinishReason = *choice.FinishReason
+			}
+		}
+		return delta, nil
+	}
+	if err := s.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.ErrUnexpectedEOF
+}
+
+// Close 关闭连接
+func (s *ChatStream) Close() error {
+	return s.body.Close()
+}
+
+// modelErrorCode 返回错误对应的错误码
+func modelErrorCode(err error) int {
+	var modelErr *ModelError
+	if errors.As(err, &modelErr) {
+		return modelErr.Code
+	}
+	return 1009
+}
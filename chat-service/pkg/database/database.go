@@ -5,6 +5,7 @@ import (
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"cybermind/chat-service/internal/model"
+	"cybermind/common/moderation"
 )
 
 var DB *gorm.DB
@@ -27,6 +28,12 @@ func InitDB() error {
 	if err := db.AutoMigrate(
 		&model.Conversation{},
 		&model.Message{},
+		&model.MessageFeedback{},
+		&moderation.Keyword{},
+		&moderation.Rule{},
+		&moderation.Event{},
+		&model.Comparison{},
+		&model.ComparisonAnswer{},
 	); err != nil {
 		return fmt.Errorf("数据库迁移失败: %v", err)
 	}
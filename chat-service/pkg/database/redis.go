@@ -0,0 +1,24 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+)
+
+var RDB *redis.Client
+
+func InitRedis() error {
+	rdb := redis.NewClient(&redis.Options{
+		Addr:     fmt.Sprintf("%s:%d", "dbconn.sealosbja.site", 30193),
+		Password: "mqjfcd8x",
+		DB:       0,
+	})
+
+	if err := rdb.Ping(context.Background()).Err(); err != nil {
+		return fmt.Errorf("连接Redis失败: %v", err)
+	}
+
+	RDB = rdb
+	return nil
+}
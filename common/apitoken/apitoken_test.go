@@ -0,0 +1,59 @@
+package apitoken
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestHash(t *testing.T) {
+	got := Hash("sk-test")
+	if len(got) != 64 || got != Hash("sk-test") || got == Hash("sk-other") {
+		t.Fatalf("Hash() = %q，应为稳定的64位十六进制摘要", got)
+	}
+}
+
+func TestValidIPRule(t *testing.T) {
+	for rule, want := range map[string]bool{
+		"10.0.0.1":      true,
+		"10.0.0.0/8":    true,
+		"2001:db8::/32": true,
+		"10.0.0.0/33":   false,
+		"example.com":   false,
+		"":              false,
+	} {
+		if got := ValidIPRule(rule); got != want {
+			t.Errorf("ValidIPRule(%q) = %v, want %v", rule, got, want)
+		}
+	}
+}
+
+func TestIPAllowed(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []string
+		ip    string
+		want  bool
+	}{
+		{name: "empty rules", rules: nil, ip: "1.2.3.4", want: true},
+		{name: "exact ip", rules: []string{"1.2.3.4"}, ip: "1.2.3.4", want: true},
+		{name: "cidr", rules: []string{"10.0.0.0/8"}, ip: "10.1.2.3", want: true},
+		{name: "ipv4 mapped", rules: []string{"1.2.3.4"}, ip: "::ffff:1.2.3.4", want: true},
+		{name: "not listed", rules: []string{"1.2.3.4", "10.0.0.0/8"}, ip: "192.168.0.1", want: false},
+		{name: "invalid ip", rules: []string{"1.2.3.4"}, ip: "unknown", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IPAllowed(tt.rules, tt.ip); got != tt.want {
+				t.Errorf("IPAllowed(%v, %q) = %v, want %v", tt.rules, tt.ip, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyPrefix(t *testing.T) {
+	// 前缀不符时不查询数据库
+	if err := Verify(context.Background(), nil, "bad-token", "1.2.3.4", nil); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("Verify() error = %v, want ErrInvalid", err)
+	}
+}
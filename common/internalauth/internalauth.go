@@ -0,0 +1,41 @@
+// Package internalauth 服务间调用认证，各服务的/internal接口共用
+package internalauth
+
+import (
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Header 服务间调用携带令牌的请求头
+const Header = "X-Internal-Token"
+
+// Middleware 校验请求头X-Internal-Token与环境变量INTERNAL_API_TOKEN一致。
+// 未配置INTERNAL_API_TOKEN时拒绝所有服务间调用，避免漏配环境变量时接口对外开放
+func Middleware() gin.HandlerFunc {
+	token := os.Getenv("INTERNAL_API_TOKEN")
+	if token == "" {
+		log.Println("警告: 未配置INTERNAL_API_TOKEN，服务间调用接口将拒绝所有请求")
+	}
+	return func(c *gin.Context) {
+		if !valid(token, c.GetHeader(Header)) {
+			c.JSON(http.StatusUnauthorized, gin.H{"code": 1002, "message": "未授权的服务调用"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// Verify 请求是否携带有效的X-Internal-Token，用于同时对外开放的接口判断调用方是否为内部服务。
+// 未配置INTERNAL_API_TOKEN时始终返回false
+func Verify(c *gin.Context) bool {
+	return valid(os.Getenv("INTERNAL_API_TOKEN"), c.GetHeader(Header))
+}
+
+func valid(token, header string) bool {
+	return token != "" && subtle.ConstantTimeCompare([]byte(header), []byte(token)) == 1
+}
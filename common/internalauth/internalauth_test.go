@@ -0,0 +1,63 @@
+package internalauth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func serve(t *testing.T, header string) int {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/internal", Middleware(), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	req := httptest.NewRequest(http.MethodGet, "/internal", nil)
+	if header != "" {
+		req.Header.Set(Header, header)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestMiddleware(t *testing.T) {
+	t.Setenv("INTERNAL_API_TOKEN", "secret")
+	if code := serve(t, "secret"); code != http.StatusOK {
+		t.Fatalf("正确令牌应放行，得到 %d", code)
+	}
+	if code := serve(t, "wrong"); code != http.StatusUnauthorized {
+		t.Fatalf("错误令牌应拒绝，得到 %d", code)
+	}
+	if code := serve(t, ""); code != http.StatusUnauthorized {
+		t.Fatalf("缺少令牌应拒绝，得到 %d", code)
+	}
+}
+
+func TestMiddlewareWithoutToken(t *testing.T) {
+	t.Setenv("INTERNAL_API_TOKEN", "")
+	if code := serve(t, ""); code != http.StatusUnauthorized {
+		t.Fatalf("未配置INTERNAL_API_TOKEN时应拒绝，得到 %d", code)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	verify := func(header string) bool {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+		c.Request.Header.Set(Header, header)
+		return Verify(c)
+	}
+
+	t.Setenv("INTERNAL_API_TOKEN", "secret")
+	if !verify("secret") || verify("wrong") || verify("") {
+		t.Fatal("只有正确令牌应通过校验")
+	}
+	t.Setenv("INTERNAL_API_TOKEN", "")
+	if verify("") {
+		t.Fatal("未配置INTERNAL_API_TOKEN时不应通过校验")
+	}
+}
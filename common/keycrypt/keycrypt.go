@@ -0,0 +1,257 @@
+// Package keycrypt 上游API Key的信封加密：每个值使用随机生成的数据密钥(AES-256-GCM)加密，
+// 数据密钥再由主密钥加密后与密文一起保存。主密钥带有ID，轮换时旧主密钥只用于解密。
+package keycrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync/atomic"
+)
+
+// 主密钥配置：KEY_ENCRYPTION_KEYS为逗号分隔的"ID:base64密钥"，
+// 或由KEY_ENCRYPTION_KEYS_FILE指定的文件每行一个，第一个为当前主密钥，其余只用于解密
+const (
+	envKeys     = "KEY_ENCRYPTION_KEYS"
+	envKeysFile = "KEY_ENCRYPTION_KEYS_FILE"
+)
+
+// prefix 加密值的前缀，格式为enc:v1:{主密钥ID}:{加密的数据密钥}:{密文}
+const prefix = "enc:v1:"
+
+var keyIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+// ErrNoKeyring 数据库中有加密的值，但没有配置主密钥
+var ErrNoKeyring = errors.New("keycrypt: no master key configured")
+
+// Keyring 主密钥集合
+type Keyring struct {
+	primary string
+	keys    map[string]cipher.AEAD
+}
+
+// NewKeyring 解析"ID:base64密钥"列表，以逗号或换行分隔，第一个为当前主密钥。主密钥为32字节
+func NewKeyring(spec string) (*Keyring, error) {
+	ring := &Keyring{keys: make(map[string]cipher.AEAD)}
+	for _, item := range strings.FieldsFunc(spec, func(r rune) bool { return r == ',' || r == '\n' }) {
+		item = strings.TrimSpace(item)
+		if item == "" || strings.HasPrefix(item, "#") {
+			continue
+		}
+		id, encoded, ok := strings.Cut(item, ":")
+		if !ok || !keyIDPattern.MatchString(id) {
+			return nil, fmt.Errorf("keycrypt: invalid master key entry, want ID:base64")
+		}
+		if _, dup := ring.keys[id]; dup {
+			return nil, fmt.Errorf("keycrypt: duplicate master key id %q", id)
+		}
+		secret, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(secret) != 32 {
+			return nil, fmt.Errorf("keycrypt: master key %q must be 32 bytes in base64", id)
+		}
+		aead, err := newAEAD(secret)
+		if err != nil {
+			return nil, err
+		}
+		ring.keys[id] = aead
+		if ring.primary == "" {
+			ring.primary = id
+		}
+	}
+	if ring.primary == "" {
+		return nil, errors.New("keycrypt: no master key")
+	}
+	return ring, nil
+}
+
+// Load 从环境变量或文件加载主密钥，都没有配置时返回nil
+func Load() (*Keyring, error) {
+	if spec := os.Getenv(envKeys); spec != "" {
+		return NewKeyring(spec)
+	}
+	if path := os.Getenv(envKeysFile); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("keycrypt: read master key file: %w", err)
+		}
+		return NewKeyring(string(data))
+	}
+	return nil, nil
+}
+
+// Generate 生成一个新的base64编码的主密钥
+func Generate() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(secret), nil
+}
+
+// PrimaryID 当前主密钥的ID
+func (k *Keyring) PrimaryID() string {
+	return k.primary
+}
+
+// Encrypt 使用当前主密钥加密，空字符串不加密
+func (k *Keyring) Encrypt(plain string) (string, error) {
+	if plain == "" {
+		return "", nil
+	}
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+	data, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+	ciphertext, err := seal(data, []byte(plain), nil)
+	if err != nil {
+		return "", err
+	}
+	// 主密钥ID作为附加数据，防止加密的数据密钥被挪到其他主密钥下
+	wrapped, err := seal(k.keys[k.primary], dataKey, []byte(k.primary))
+	if err != nil {
+		return "", err
+	}
+	return prefix + k.primary + ":" + base64.RawURLEncoding.EncodeToString(wrapped) + ":" +
+		base64.RawURLEncoding.EncodeToString(ciphertext), nil
+}
+
+// Decrypt 解密Encrypt的结果，未加密的值原样返回
+func (k *Keyring) Decrypt(value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+	parts := strings.Split(strings.TrimPrefix(value, prefix), ":")
+	if len(parts) != 3 {
+		return "", errors.New("keycrypt: malformed encrypted value")
+	}
+	master, ok := k.keys[parts[0]]
+	if !ok {
+		return "", fmt.Errorf("keycrypt: unknown master key id %q", parts[0])
+	}
+	wrapped, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", errors.New("keycrypt: malformed encrypted value")
+	}
+	ciphertext, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", errors.New("keycrypt: malformed encrypted value")
+	}
+	dataKey, err := open(master, wrapped, []byte(parts[0]))
+	if err != nil {
+		return "", fmt.Errorf("keycrypt: decrypt data key: %w", err)
+	}
+	data, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+	plain, err := open(data, ciphertext, nil)
+	if err != nil {
+		return "", fmt.Errorf("keycrypt: decrypt value: %w", err)
+	}
+	return string(plain), nil
+}
+
+// IsEncrypted 值是否为Encrypt的结果
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+// KeyID 加密值使用的主密钥ID，未加密时返回空字符串
+func KeyID(value string) string {
+	if !IsEncrypted(value) {
+		return ""
+	}
+	id, _, _ := strings.Cut(strings.TrimPrefix(value, prefix), ":")
+	return id
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal 加密并把随机nonce放在密文前面
+func seal(aead cipher.AEAD, plain, additional []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plain, additional), nil
+}
+
+func open(aead cipher.AEAD, sealed, additional []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, additional)
+}
+
+// defaultKeyring 写入和读取数据库时使用的主密钥，为nil时不加密
+var defaultKeyring atomic.Pointer[Keyring]
+
+// SetDefault 设置写入和读取数据库时使用的主密钥，服务启动时调用
+func SetDefault(k *Keyring) {
+	defaultKeyring.Store(k)
+}
+
+// Encrypt 使用默认主密钥加密，没有配置主密钥时原样返回
+func Encrypt(plain string) (string, error) {
+	k := defaultKeyring.Load()
+	if k == nil {
+		return plain, nil
+	}
+	return k.Encrypt(plain)
+}
+
+// Decrypt 使用默认主密钥解密，未加密的值原样返回
+func Decrypt(value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+	k := defaultKeyring.Load()
+	if k == nil {
+		return "", ErrNoKeyring
+	}
+	return k.Decrypt(value)
+}
+
+// maskMarker 脱敏后的Key中间部分
+const maskMarker = "..."
+
+// Mask 脱敏显示Key：保留前缀(前5个字符内的第一个"-"之前，没有时为前3个字符)和最后4个字符，如sk-...d04e。
+// 较短的Key只显示前缀
+func Mask(key string) string {
+	if key == "" {
+		return ""
+	}
+	head := 3
+	if i := strings.Index(key, "-"); i >= 0 && i <= 4 {
+		head = i + 1
+	}
+	if len(key) < head+8 {
+		if len(key) <= head {
+			return maskMarker
+		}
+		return key[:head] + maskMarker
+	}
+	return key[:head] + maskMarker + key[len(key)-4:]
+}
+
+// IsMasked 值是否为Mask的结果，更新时提交脱敏后的Key表示保持不变
+func IsMasked(value string) bool {
+	return strings.Contains(value, maskMarker)
+}
@@ -0,0 +1,120 @@
+package keycrypt
+
+import (
+	"strings"
+	"testing"
+)
+
+func newTestKeyring(t *testing.T, ids ...string) (*Keyring, string) {
+	t.Helper()
+	entries := make([]string, len(ids))
+	for i, id := range ids {
+		secret, err := Generate()
+		if err != nil {
+			t.Fatalf("Generate() error = %v", err)
+		}
+		entries[i] = id + ":" + secret
+	}
+	spec := strings.Join(entries, ",")
+	ring, err := NewKeyring(spec)
+	if err != nil {
+		t.Fatalf("NewKeyring() error = %v", err)
+	}
+	return ring, spec
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	ring, spec := newTestKeyring(t, "k1")
+	plain := "sk-0123456789abcdefghijklmnopqrstuvwxyzd04e"
+
+	encrypted, err := ring.Encrypt(plain)
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	if !IsEncrypted(encrypted) || KeyID(encrypted) != "k1" || strings.Contains(encrypted, plain) {
+		t.Fatalf("Encrypt() = %q, want value encrypted with k1", encrypted)
+	}
+	if got, err := ring.Decrypt(encrypted); err != nil || got != plain {
+		t.Fatalf("Decrypt() = %q, %v, want %q", got, err, plain)
+	}
+	if got, err := ring.Decrypt(plain); err != nil || got != plain {
+		t.Errorf("Decrypt(plaintext) = %q, %v, want unchanged", got, err)
+	}
+
+	// 轮换后旧主密钥仍可解密，新值使用新主密钥
+	rotated, err := NewKeyring("k2:" + mustGenerate(t) + "," + spec)
+	if err != nil {
+		t.Fatalf("NewKeyring() error = %v", err)
+	}
+	if got, err := rotated.Decrypt(encrypted); err != nil || got != plain {
+		t.Errorf("Decrypt() with rotated keyring = %q, %v, want %q", got, err, plain)
+	}
+	if reencrypted, _ := rotated.Encrypt(plain); KeyID(reencrypted) != "k2" {
+		t.Errorf("Encrypt() with rotated keyring used key %q, want k2", KeyID(reencrypted))
+	}
+
+	// 密文被篡改或主密钥不匹配时解密失败
+	other, _ := newTestKeyring(t, "k1")
+	if _, err := other.Decrypt(encrypted); err == nil {
+		t.Error("Decrypt() with wrong master key succeeded")
+	}
+	tampered := encrypted[:len(encrypted)-2] + "AA"
+	if _, err := ring.Decrypt(tampered); err == nil {
+		t.Error("Decrypt() of tampered value succeeded")
+	}
+}
+
+func mustGenerate(t *testing.T) string {
+	t.Helper()
+	secret, err := Generate()
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	return secret
+}
+
+func TestNewKeyringInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		spec string
+	}{
+		{name: "empty", spec: ""},
+		{name: "missing id", spec: mustGenerateSpec("")},
+		{name: "short key", spec: "k1:c2hvcnQ="},
+		{name: "duplicate id", spec: mustGenerateSpec("k1") + "," + mustGenerateSpec("k1")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewKeyring(tt.spec); err == nil {
+				t.Errorf("NewKeyring(%q) succeeded, want error", tt.spec)
+			}
+		})
+	}
+}
+
+func mustGenerateSpec(id string) string {
+	secret, _ := Generate()
+	return id + ":" + secret
+}
+
+func TestMask(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{key: "sk-0123456789abcdefghijklmnopqrstuvwxyzd04e", want: "sk-...d04e"},
+		{key: "AIzaSyD-1234567890abcdef", want: "AIz...cdef"},
+		{key: "xai-abcdefghijklmnop", want: "xai-...mnop"},
+		{key: "sk-short", want: "sk-..."},
+		{key: "abc", want: "..."},
+		{key: "", want: ""},
+	}
+	for _, tt := range tests {
+		if got := Mask(tt.key); got != tt.want {
+			t.Errorf("Mask(%q) = %q, want %q", tt.key, got, tt.want)
+		}
+		if tt.key != "" && !IsMasked(Mask(tt.key)) {
+			t.Errorf("IsMasked(Mask(%q)) = false", tt.key)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package modelconfig
+
+import "strings"
+
+// 适配器名称
+const (
+	AdapterOpenAI    = "openai"
+	AdapterAnthropic = "anthropic"
+	AdapterGemini    = "gemini"
+	AdapterGrok      = "grok"
+)
+
+// apiTypeAdapters APIType对应的适配器，APIType为接口协议名或接口路径
+var apiTypeAdapters = map[string]string{
+	"openai":           AdapterOpenAI,
+	"chat/completions": AdapterOpenAI,
+	"anthropic":        AdapterAnthropic,
+	"messages":         AdapterAnthropic,
+	"gemini":           AdapterGemini,
+	"generatecontent":  AdapterGemini,
+	"grok":             AdapterGrok,
+	"xai":              AdapterGrok,
+}
+
+// providerAdapters 供应商代码对应的适配器，APIType无法识别时使用
+var providerAdapters = map[string]string{
+	"anthropic": AdapterAnthropic,
+	"claude":    AdapterAnthropic,
+	"google":    AdapterGemini,
+	"gemini":    AdapterGemini,
+	"xai":       AdapterGrok,
+	"grok":      AdapterGrok,
+}
+
+// openAICompatible 使用OpenAI chat/completions协议的适配器，APIType为OpenAI协议时仍按供应商代码选择这些适配器
+var openAICompatible = map[string]bool{
+	AdapterGrok: true,
+}
+
+// Adapter 选择模型使用的适配器：优先按APIType，其次按供应商代码，都无法识别时按OpenAI兼容接口处理
+func Adapter(provider, apiType string) string {
+	byProvider, providerOK := providerAdapters[strings.ToLower(provider)]
+	if name, ok := apiTypeAdapters[strings.ToLower(strings.Trim(apiType, "/"))]; ok {
+		if name == AdapterOpenAI && providerOK && openAICompatible[byProvider] {
+			return byProvider
+		}
+		return name
+	}
+	if providerOK {
+		return byProvider
+	}
+	return AdapterOpenAI
+}
+
+// TransportDefaults 适配器的默认连接配置
+type TransportDefaults struct {
+	ConnectTimeout        int // 建立连接(含代理握手)的超时(秒)
+	ResponseHeaderTimeout int // 发送请求后等待响应头的超时(秒)
+	MaxIdleConnsPerHost   int // 每个上游保持的空闲连接数
+}
+
+// transportDefaults 各适配器的默认连接配置。非流式请求要等上游生成完毕才返回响应头，
+// 推理模型耗时较长，等待响应头的超时按供应商放宽
+var transportDefaults = map[string]TransportDefaults{
+	AdapterOpenAI:    {ConnectTimeout: 10, ResponseHeaderTimeout: 300, MaxIdleConnsPerHost: 32},
+	AdapterAnthropic: {ConnectTimeout: 10, ResponseHeaderTimeout: 600, MaxIdleConnsPerHost: 32},
+	AdapterGemini:    {ConnectTimeout: 10, ResponseHeaderTimeout: 300, MaxIdleConnsPerHost: 32},
+	AdapterGrok:      {ConnectTimeout: 10, ResponseHeaderTimeout: 600, MaxIdleConnsPerHost: 32},
+}
+
+// DefaultTransport 适配器的默认连接配置，未知的适配器按OpenAI兼容接口处理
+func DefaultTransport(adapter string) TransportDefaults {
+	if d, ok := transportDefaults[adapter]; ok {
+		return d
+	}
+	return transportDefaults[AdapterOpenAI]
+}
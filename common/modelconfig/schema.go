@@ -0,0 +1,254 @@
+// Package modelconfig 模型配置(Model.Config)的schema：按模型的api_type和供应商代码选择适配器，
+// Config只能包含该适配器支持的字段。model-service和admin-service使用同一份schema校验和渲染配置表单
+package modelconfig
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// SchemaVersion 模型配置的schema版本，字段有不兼容的变更时递增，Config中的version不能超过该值
+const SchemaVersion = 1
+
+// 配置字段类型
+const (
+	FieldNumber  = "number"
+	FieldInteger = "integer"
+	FieldBoolean = "boolean"
+	FieldString  = "string"
+	FieldObject  = "object"
+)
+
+// Field 模型配置字段，管理后台按字段类型和取值范围渲染表单
+type Field struct {
+	Name        string      `json:"name"`
+	Type        string      `json:"type"`
+	Description string      `json:"description"`
+	Minimum     *float64    `json:"minimum,omitempty"`
+	Maximum     *float64    `json:"maximum,omitempty"`
+	Enum        []string    `json:"enum,omitempty"`
+	Default     interface{} `json:"default,omitempty"`
+	Fields      []Field     `json:"fields,omitempty"` // object类型的子字段
+}
+
+// Schema 适配器支持的模型配置字段，Config中出现schema以外的字段时校验失败
+type Schema struct {
+	Adapter string  `json:"adapter"`
+	Version int     `json:"version"`
+	Fields  []Field `json:"fields"`
+}
+
+// FieldError 配置字段的校验错误，Field为字段路径，如config.transport.connect_timeout
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e FieldError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+func rangeField(name, typ, description string, min, max float64) Field {
+	return Field{Name: name, Type: typ, Description: description, Minimum: &min, Maximum: &max}
+}
+
+// samplingFields 各适配器都支持的采样参数，temperature上限按供应商不同
+func samplingFields(maxTemperature float64) []Field {
+	return []Field{
+		rangeField("version", FieldInteger, "配置的schema版本，省略时为当前版本", 1, SchemaVersion),
+		rangeField("temperature", FieldNumber, "采样温度，请求未指定时使用", 0, maxTemperature),
+		rangeField("max_tokens", FieldInteger, "最大输出token数，请求未指定时使用", 1, 1000000),
+		rangeField("top_p", FieldNumber, "核采样概率，请求未指定时使用", 0, 1),
+	}
+}
+
+// penaltyFields 频率和存在惩罚，Anthropic不支持
+var penaltyFields = []Field{
+	rangeField("frequency_penalty", FieldNumber, "频率惩罚，请求未指定时使用", -2, 2),
+	rangeField("presence_penalty", FieldNumber, "存在惩罚，请求未指定时使用", -2, 2),
+}
+
+// transportField 上游连接配置，默认值为适配器的默认连接配置
+func transportField(adapter string) Field {
+	defaults := DefaultTransport(adapter)
+	fields := []Field{
+		rangeField("connect_timeout", FieldInteger, "建立连接(含代理和TLS握手)的超时(秒)", 1, 300),
+		rangeField("response_header_timeout", FieldInteger, "发送请求后等待响应头的超时(秒)", 1, 3600),
+		rangeField("max_idle_conns_per_host", FieldInteger, "每个上游保持的空闲连接数", 1, 1000),
+		rangeField("max_conns_per_host", FieldInteger, "每个上游的最大连接数，0不限制", 0, 10000),
+		{Name: "tls_min_version", Type: FieldString, Description: "TLS最低版本", Enum: []string{"1.2", "1.3"}},
+		{Name: "insecure_skip_verify", Type: FieldBoolean, Description: "跳过证书校验，仅用于自签名证书的内网网关"},
+	}
+	fields[0].Default = defaults.ConnectTimeout
+	fields[1].Default = defaults.ResponseHeaderTimeout
+	fields[2].Default = defaults.MaxIdleConnsPerHost
+	fields[4].Default = "1.2"
+	return Field{Name: "transport", Type: FieldObject, Description: "上游连接配置", Fields: fields}
+}
+
+// adapterSchemas 各适配器的模型配置schema
+var adapterSchemas = map[string]*Schema{
+	AdapterOpenAI:    newSchema(AdapterOpenAI, samplingFields(2), penaltyFields),
+	AdapterAnthropic: newSchema(AdapterAnthropic, samplingFields(1)),
+	AdapterGemini:    newSchema(AdapterGemini, samplingFields(2), penaltyFields),
+	AdapterGrok:      newSchema(AdapterGrok, samplingFields(2), penaltyFields),
+}
+
+func newSchema(adapter string, groups ...[]Field) *Schema {
+	schema := &Schema{Adapter: adapter, Version: SchemaVersion}
+	for _, fields := range groups {
+		schema.Fields = append(schema.Fields, fields...)
+	}
+	schema.Fields = append(schema.Fields, transportField(adapter))
+	return schema
+}
+
+// SchemaFor 适配器的模型配置schema
+func SchemaFor(adapter string) *Schema {
+	if schema, ok := adapterSchemas[adapter]; ok {
+		return schema
+	}
+	return adapterSchemas[AdapterOpenAI]
+}
+
+// Schemas 所有适配器的模型配置schema，按适配器名称排序
+func Schemas() []*Schema {
+	schemas := make([]*Schema, 0, len(adapterSchemas))
+	for _, schema := range adapterSchemas {
+		schemas = append(schemas, schema)
+	}
+	sort.Slice(schemas, func(i, j int) bool { return schemas[i].Adapter < schemas[j].Adapter })
+	return schemas
+}
+
+// Validate 校验配置，空配置有效
+func (s *Schema) Validate(config json.RawMessage) []FieldError {
+	config = bytes.TrimSpace(config)
+	if len(config) == 0 || string(config) == "null" {
+		return nil
+	}
+	return validateObject("config", s.Fields, config)
+}
+
+func validateObject(path string, fields []Field, raw json.RawMessage) []FieldError {
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &values); err != nil {
+		return []FieldError{{Field: path, Message: "必须是对象"}}
+	}
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs []FieldError
+	for _, name := range names {
+		fieldPath := path + "." + name
+		field := findField(fields, name)
+		if field == nil {
+			message := "未知字段"
+			if suggestion := suggestField(fields, name); suggestion != "" {
+				message += "，是否为" + suggestion + "？"
+			}
+			errs = append(errs, FieldError{Field: fieldPath, Message: message})
+			continue
+		}
+		errs = append(errs, field.validate(fieldPath, values[name])...)
+	}
+	return errs
+}
+
+func (f *Field) validate(path string, raw json.RawMessage) []FieldError {
+	if string(raw) == "null" {
+		return nil
+	}
+	fail := func(format string, args ...interface{}) []FieldError {
+		return []FieldError{{Field: path, Message: fmt.Sprintf(format, args...)}}
+	}
+
+	switch f.Type {
+	case FieldNumber, FieldInteger:
+		var v float64
+		if err := json.Unmarshal(raw, &v); err != nil {
+			return fail("必须是数字")
+		}
+		if f.Type == FieldInteger && v != math.Trunc(v) {
+			return fail("必须是整数")
+		}
+		if f.Minimum != nil && v < *f.Minimum {
+			return fail("不能小于%v", *f.Minimum)
+		}
+		if f.Maximum != nil && v > *f.Maximum {
+			return fail("不能大于%v", *f.Maximum)
+		}
+	case FieldBoolean:
+		var v bool
+		if err := json.Unmarshal(raw, &v); err != nil {
+			return fail("必须是布尔值")
+		}
+	case FieldString:
+		var v string
+		if err := json.Unmarshal(raw, &v); err != nil {
+			return fail("必须是字符串")
+		}
+		if len(f.Enum) > 0 && !containsString(f.Enum, v) {
+			return fail("必须是%s之一", strings.Join(f.Enum, "、"))
+		}
+	case FieldObject:
+		return validateObject(path, f.Fields, raw)
+	}
+	return nil
+}
+
+func findField(fields []Field, name string) *Field {
+	for i := range fields {
+		if fields[i].Name == name {
+			return &fields[i]
+		}
+	}
+	return nil
+}
+
+func containsString(values []string, v string) bool {
+	for _, s := range values {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+// suggestField 编辑距离不超过2的最接近的字段名，用于提示拼写错误
+func suggestField(fields []Field, name string) string {
+	best, bestDistance := "", 3
+	for _, f := range fields {
+		if d := editDistance(strings.ToLower(name), f.Name); d < bestDistance {
+			best, bestDistance = f.Name, d
+		}
+	}
+	return best
+}
+
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
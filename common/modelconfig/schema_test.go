@@ -0,0 +1,73 @@
+package modelconfig
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestSchemaValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		adapter string
+		config  string
+		want    []FieldError
+	}{
+		{name: "empty", adapter: AdapterOpenAI, config: ``},
+		{name: "null", adapter: AdapterOpenAI, config: `null`},
+		{
+			name:    "valid",
+			adapter: AdapterOpenAI,
+			config:  `{"version":1,"temperature":0.7,"max_tokens":2000,"top_p":1,"frequency_penalty":0,"presence_penalty":0,"transport":{"connect_timeout":5,"tls_min_version":"1.3","insecure_skip_verify":false}}`,
+		},
+		{
+			name:    "typo",
+			adapter: AdapterOpenAI,
+			config:  `{"temprature":0.7}`,
+			want:    []FieldError{{Field: "config.temprature", Message: "未知字段，是否为temperature？"}},
+		},
+		{
+			name:    "unsupported by adapter",
+			adapter: AdapterAnthropic,
+			config:  `{"temperature":1.5,"presence_penalty":0.5}`,
+			want: []FieldError{
+				{Field: "config.presence_penalty", Message: "未知字段"},
+				{Field: "config.temperature", Message: "不能大于1"},
+			},
+		},
+		{
+			name:    "wrong types",
+			adapter: AdapterGemini,
+			config:  `{"max_tokens":10.5,"top_p":"1","version":2}`,
+			want: []FieldError{
+				{Field: "config.max_tokens", Message: "必须是整数"},
+				{Field: "config.top_p", Message: "必须是数字"},
+				{Field: "config.version", Message: "不能大于1"},
+			},
+		},
+		{
+			name:    "nested",
+			adapter: AdapterGrok,
+			config:  `{"transport":{"tls_min_version":"1.1","connect_timeout":0,"proxy":"x"}}`,
+			want: []FieldError{
+				{Field: "config.transport.connect_timeout", Message: "不能小于1"},
+				{Field: "config.transport.proxy", Message: "未知字段"},
+				{Field: "config.transport.tls_min_version", Message: "必须是1.2、1.3之一"},
+			},
+		},
+		{
+			name:    "not an object",
+			adapter: AdapterOpenAI,
+			config:  `[1]`,
+			want:    []FieldError{{Field: "config", Message: "必须是对象"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := SchemaFor(tt.adapter).Validate(json.RawMessage(tt.config))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Validate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package moderation
+
+import "unicode"
+
+// Matcher Aho-Corasick多模式匹配自动机，按rune匹配并忽略大小写
+type Matcher struct {
+	nodes    []acNode
+	patterns [][]rune
+	maxLen   int
+}
+
+type acNode struct {
+	next   map[rune]int
+	fail   int
+	output []int // 以该节点结尾的模式下标(含fail链上的模式)
+}
+
+// Match 一次匹配结果，Start/End为rune下标，区间左闭右开
+type Match struct {
+	Pattern int
+	Start   int
+	End     int
+}
+
+// NewMatcher 根据模式串构建自动机，空串会被忽略
+func NewMatcher(patterns []string) *Matcher {
+	m := &Matcher{nodes: []acNode{{next: map[rune]int{}}}}
+
+	for i, p := range patterns {
+		runes := []rune(p)
+		for j, r := range runes {
+			runes[j] = unicode.ToLower(r)
+		}
+		m.patterns = append(m.patterns, runes)
+		if len(runes) == 0 {
+			continue
+		}
+		if len(runes) > m.maxLen {
+			m.maxLen = len(runes)
+		}
+
+		cur := 0
+		for _, r := range runes {
+			nxt, ok := m.nodes[cur].next[r]
+			if !ok {
+				m.nodes = append(m.nodes, acNode{next: map[rune]int{}})
+				nxt = len(m.nodes) - 1
+				m.nodes[cur].next[r] = nxt
+			}
+			cur = nxt
+		}
+		m.nodes[cur].output = append(m.nodes[cur].output, i)
+	}
+
+	// 广度优先构建fail指针
+	queue := make([]int, 0, len(m.nodes))
+	for _, child := range m.nodes[0].next {
+		queue = append(queue, child)
+	}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for r, child := range m.nodes[cur].next {
+			fail := m.nodes[cur].fail
+			for fail != 0 {
+				if _, ok := m.nodes[fail].next[r]; ok {
+					break
+				}
+				fail = m.nodes[fail].fail
+			}
+			if nxt, ok := m.nodes[fail].next[r]; ok && nxt != child {
+				m.nodes[child].fail = nxt
+			}
+			m.nodes[child].output = append(m.nodes[child].output, m.nodes[m.nodes[child].fail].output...)
+			queue = append(queue, child)
+		}
+	}
+
+	return m
+}
+
+// MaxLen 最长模式的rune长度
+func (m *Matcher) MaxLen() int {
+	return m.maxLen
+}
+
+// FindAll 查找文本中所有模式的出现位置
+func (m *Matcher) FindAll(text []rune) []Match {
+	var matches []Match
+	cur := 0
+	for i, r := range text {
+		r = unicode.ToLower(r)
+		for cur != 0 {
+			if _, ok := m.nodes[cur].next[r]; ok {
+				break
+			}
+			cur = m.nodes[cur].fail
+		}
+		if nxt, ok := m.nodes[cur].next[r]; ok {
+			cur = nxt
+		}
+		for _, p := range m.nodes[cur].output {
+			matches = append(matches, Match{Pattern: p, Start: i + 1 - len(m.patterns[p]), End: i + 1})
+		}
+	}
+	return matches
+}
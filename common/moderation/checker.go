@@ -0,0 +1,256 @@
+package moderation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"regexp/syntax"
+	"time"
+	"unicode/utf8"
+)
+
+// KeywordChecker 基于Aho-Corasick自动机的敏感词检查器
+type KeywordChecker struct {
+	matcher  *Matcher
+	keywords []Keyword
+}
+
+// NewKeywordChecker 根据词库构建敏感词检查器
+func NewKeywordChecker(keywords []Keyword) *KeywordChecker {
+	words := make([]string, len(keywords))
+	for i, k := range keywords {
+		words[i] = k.Word
+	}
+	return &KeywordChecker{matcher: NewMatcher(words), keywords: keywords}
+}
+
+func (k *KeywordChecker) Name() string {
+	return "keyword"
+}
+
+// MaxLen 最长敏感词的rune长度，流式检查时据此保留尾部文本
+func (k *KeywordChecker) MaxLen() int {
+	return k.matcher.MaxLen()
+}
+
+func (k *KeywordChecker) Check(ctx context.Context, text []rune) ([]Hit, error) {
+	var hits []Hit
+	for _, m := range k.matcher.FindAll(text) {
+		keyword := k.keywords[m.Pattern]
+		hits = append(hits, Hit{
+			Checker:  k.Name(),
+			Rule:     keyword.Word,
+			Category: keyword.Category,
+			Action:   keyword.Action,
+			Start:    m.Start,
+			End:      m.End,
+		})
+	}
+	return hits, nil
+}
+
+// RegexChecker 正则规则检查器
+type RegexChecker struct {
+	rules    []Rule
+	patterns []*regexp.Regexp
+	maxLen   int // 各规则最长匹配的rune长度，流式检查时据此保留尾部文本
+}
+
+// NewRegexChecker 编译正则规则，无法编译的规则会被跳过
+func NewRegexChecker(rules []Rule) *RegexChecker {
+	c := &RegexChecker{}
+	for _, rule := range rules {
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			log.Printf("跳过无效的审核正则 %d: %v", rule.ID, err)
+			continue
+		}
+		n, _ := PatternMaxLen(rule.Pattern)
+		if n < 0 {
+			n = rule.MaxLen
+		}
+		if n <= 0 {
+			log.Printf("审核正则 %d 的匹配长度不固定且未设置max_len，流式输出时只对全文检查", rule.ID)
+		}
+		c.rules = append(c.rules, rule)
+		c.patterns = append(c.patterns, re)
+		c.maxLen = max(c.maxLen, n)
+	}
+	return c
+}
+
+// MaxLen 各规则最长匹配的rune长度：匹配长度固定的正则按正则计算，不固定的使用规则的MaxLen
+func (r *RegexChecker) MaxLen() int {
+	return r.maxLen
+}
+
+// PatternMaxLen 正则最长匹配的rune长度，匹配长度不固定(含*、+或没有上限的重复)时返回-1
+func PatternMaxLen(pattern string) (int, error) {
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return 0, err
+	}
+	return syntaxMaxLen(re.Simplify()), nil
+}
+
+func syntaxMaxLen(re *syntax.Regexp) int {
+	switch re.Op {
+	case syntax.OpLiteral:
+		return len(re.Rune)
+	case syntax.OpCharClass, syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		return 1
+	case syntax.OpCapture, syntax.OpQuest:
+		return syntaxMaxLen(re.Sub[0])
+	case syntax.OpStar, syntax.OpPlus:
+		return -1
+	case syntax.OpRepeat:
+		n := syntaxMaxLen(re.Sub[0])
+		if re.Max < 0 || n < 0 {
+			return -1
+		}
+		return re.Max * n
+	case syntax.OpConcat:
+		total := 0
+		for _, sub := range re.Sub {
+			n := syntaxMaxLen(sub)
+			if n < 0 {
+				return -1
+			}
+			total += n
+		}
+		return total
+	case syntax.OpAlternate:
+		longest := 0
+		for _, sub := range re.Sub {
+			n := syntaxMaxLen(sub)
+			if n < 0 {
+				return -1
+			}
+			longest = max(longest, n)
+		}
+		return longest
+	}
+	// 空匹配和行首、行尾、单词边界等零宽断言
+	return 0
+}
+
+func (r *RegexChecker) Name() string {
+	return "regex"
+}
+
+func (r *RegexChecker) Check(ctx context.Context, text []rune) ([]Hit, error) {
+	if len(r.patterns) == 0 {
+		return nil, nil
+	}
+
+	s := string(text)
+	var hits []Hit
+	for i, re := range r.patterns {
+		for _, loc := range re.FindAllStringIndex(s, -1) {
+			// 字节偏移转换为rune下标
+			start := utf8.RuneCountInString(s[:loc[0]])
+			hits = append(hits, Hit{
+				Checker:  r.Name(),
+				Rule:     r.rules[i].Name,
+				Category: r.rules[i].Category,
+				Action:   r.rules[i].Action,
+				Start:    start,
+				End:      start + utf8.RuneCountInString(s[loc[0]:loc[1]]),
+			})
+		}
+	}
+	return hits, nil
+}
+
+// ModelChecker 调用OpenAI兼容的/v1/moderations接口进行审核
+type ModelChecker struct {
+	baseURL string
+	apiKey  string
+	model   string
+	action  int
+	client  *http.Client
+}
+
+// NewModelCheckerFromEnv 根据环境变量MODERATION_API_URL/MODERATION_API_KEY/MODERATION_MODEL
+// 创建审核模型检查器，未配置时返回nil
+func NewModelCheckerFromEnv() *ModelChecker {
+	baseURL := os.Getenv("MODERATION_API_URL")
+	if baseURL == "" {
+		return nil
+	}
+	return &ModelChecker{
+		baseURL: baseURL,
+		apiKey:  os.Getenv("MODERATION_API_KEY"),
+		model:   os.Getenv("MODERATION_MODEL"),
+		action:  ActionBlock,
+		client:  &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+func (m *ModelChecker) Name() string {
+	return "model"
+}
+
+func (m *ModelChecker) Check(ctx context.Context, text []rune) ([]Hit, error) {
+	body := map[string]interface{}{"input": string(text)}
+	if m.model != "" {
+		body["model"] = m.model
+	}
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.baseURL+"/v1/moderations", bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if m.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+m.apiKey)
+	}
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("moderation api returned status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Results []struct {
+			Flagged    bool            `json:"flagged"`
+			Categories map[string]bool `json:"categories"`
+		} `json:"results"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+
+	var hits []Hit
+	for _, r := range result.Results {
+		if !r.Flagged {
+			continue
+		}
+		for category, flagged := range r.Categories {
+			if flagged {
+				hits = append(hits, Hit{
+					Checker:  m.Name(),
+					Rule:     m.model,
+					Category: category,
+					Action:   m.action,
+					Start:    0,
+					End:      len(text),
+				})
+			}
+		}
+	}
+	return hits, nil
+}
@@ -0,0 +1,75 @@
+package moderation
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// 审核处置动作
+const (
+	ActionPass  = 0 // 放行
+	ActionMask  = 1 // 打码后放行
+	ActionBlock = 2 // 拦截
+)
+
+// 审核内容来源
+const (
+	SourcePrompt     = "prompt"
+	SourceCompletion = "completion"
+)
+
+// Keyword 敏感词词库(由管理后台维护)
+type Keyword struct {
+	ID        int64     `gorm:"primaryKey" json:"id"`
+	Word      string    `gorm:"size:100;not null;uniqueIndex" json:"word"`
+	Category  string    `gorm:"size:50" json:"category"`
+	Action    int       `gorm:"type:smallint;not null;default:1" json:"action"` // 1: 打码, 2: 拦截
+	Status    int       `gorm:"default:1" json:"status"`                        // 1: 启用, 0: 禁用
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Rule 正则审核规则(由管理后台维护)
+type Rule struct {
+	ID        int64     `gorm:"primaryKey" json:"id"`
+	Name      string    `gorm:"size:100;not null" json:"name"`
+	Pattern   string    `gorm:"size:500;not null" json:"pattern"`
+	MaxLen    int       `gorm:"not null;default:0" json:"max_len"` // 最长匹配的字符数，正则的匹配长度不固定时由管理后台设置
+	Category  string    `gorm:"size:50" json:"category"`
+	Action    int       `gorm:"type:smallint;not null;default:1" json:"action"` // 1: 打码, 2: 拦截
+	Status    int       `gorm:"default:1" json:"status"`                        // 1: 启用, 0: 禁用
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Event 审核命中记录，供管理后台复核
+type Event struct {
+	ID             int64           `gorm:"primaryKey" json:"id"`
+	UserID         int64           `gorm:"not null;index" json:"user_id"`
+	ConversationID int64           `gorm:"index" json:"conversation_id"`
+	ModelID        int64           `json:"model_id"`
+	Source         string          `gorm:"size:20;not null" json:"source"` // prompt/completion
+	Content        string          `gorm:"type:text" json:"content"`
+	Hits           json.RawMessage `gorm:"type:jsonb" json:"hits"`
+	Action         int             `gorm:"type:smallint;not null" json:"action"`
+	Status         int             `gorm:"type:smallint;not null;default:0;index" json:"status"` // 0: 待复核, 1: 误判放行, 2: 确认违规, 3: 封禁用户
+	ReviewedBy     int64           `json:"reviewed_by"`                                          // 复核管理员ID
+	ReviewNote     string          `gorm:"size:255" json:"review_note"`
+	ReviewedAt     *time.Time      `json:"reviewed_at"`
+	CreatedAt      time.Time       `gorm:"index" json:"created_at"`
+}
+
+// TableName 指定表名，类型名去掉Moderation前缀后表名保持不变
+func (Keyword) TableName() string {
+	return "moderation_keywords"
+}
+
+// TableName 指定表名
+func (Rule) TableName() string {
+	return "moderation_rules"
+}
+
+// TableName 指定表名
+func (Event) TableName() string {
+	return "moderation_events"
+}
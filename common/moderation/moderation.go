@@ -0,0 +1,193 @@
+// Package moderation 内容审核：敏感词、正则规则和审核模型，chat-service和model-service(平台API)共用
+package moderation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrBlocked 内容命中拦截规则
+var ErrBlocked = errors.New("内容包含违规信息")
+
+// Hit 一次规则命中，Start/End为rune下标，模型审核命中时覆盖全文
+type Hit struct {
+	Checker  string `json:"checker"`
+	Rule     string `json:"rule"`
+	Category string `json:"category,omitempty"`
+	Action   int    `json:"action"`
+	Start    int    `json:"start"`
+	End      int    `json:"end"`
+}
+
+// Decision 审核结论
+type Decision struct {
+	Action int    // 命中规则中最严格的动作
+	Text   string // 打码后的文本
+	Hits   []Hit
+}
+
+// Checker 审核检查器
+type Checker interface {
+	Name() string
+	Check(ctx context.Context, text []rune) ([]Hit, error)
+}
+
+// Input 待审核内容
+type Input struct {
+	UserID         int64
+	ConversationID int64
+	ModelID        int64
+	Source         string
+	Text           string
+}
+
+// SourceOf 根据消息角色返回审核来源，不需要审核的角色返回空串
+func SourceOf(role string) string {
+	switch role {
+	case "user":
+		return SourcePrompt
+	case "assistant":
+		return SourceCompletion
+	}
+	return ""
+}
+
+// Moderator 审核管道：依次运行各检查器，汇总命中结果并记录审核事件
+type Moderator struct {
+	db *gorm.DB
+
+	mu       sync.RWMutex
+	keywords *KeywordChecker
+	rules    *RegexChecker
+	extra    []Checker
+}
+
+// NewModerator 创建审核管道，extra为额外的检查器(如审核模型)
+func NewModerator(db *gorm.DB, extra ...Checker) *Moderator {
+	return &Moderator{
+		db:       db,
+		keywords: NewKeywordChecker(nil),
+		rules:    NewRegexChecker(nil),
+		extra:    extra,
+	}
+}
+
+// Reload 从数据库重新加载启用的敏感词和正则规则
+func (m *Moderator) Reload(ctx context.Context) error {
+	var keywords []Keyword
+	if err := m.db.WithContext(ctx).Where("status = 1").Find(&keywords).Error; err != nil {
+		return err
+	}
+	var rules []Rule
+	if err := m.db.WithContext(ctx).Where("status = 1").Find(&rules).Error; err != nil {
+		return err
+	}
+
+	keywordChecker := NewKeywordChecker(keywords)
+	regexChecker := NewRegexChecker(rules)
+
+	m.mu.Lock()
+	m.keywords = keywordChecker
+	m.rules = regexChecker
+	m.mu.Unlock()
+	return nil
+}
+
+// StartAutoReload 定期重新加载词库，使管理后台的修改无需重启即可生效
+func (m *Moderator) StartAutoReload(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := m.Reload(ctx); err != nil {
+					log.Printf("重新加载审核词库失败: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// localCheckers 词库和正则检查器，可用于流式输出的增量检查
+func (m *Moderator) localCheckers() []Checker {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return []Checker{m.keywords, m.rules}
+}
+
+// Check 运行全部检查器，检查器出错时记录日志并跳过(审核服务故障不影响对话)
+func (m *Moderator) Check(ctx context.Context, text string) *Decision {
+	return runCheckers(ctx, []rune(text), append(m.localCheckers(), m.extra...))
+}
+
+func runCheckers(ctx context.Context, text []rune, checkers []Checker) *Decision {
+	var hits []Hit
+	for _, checker := range checkers {
+		h, err := checker.Check(ctx, text)
+		if err != nil {
+			log.Printf("审核检查器 %s 执行失败: %v", checker.Name(), err)
+			continue
+		}
+		hits = append(hits, h...)
+	}
+	return decide(text, hits)
+}
+
+// Review 审核内容，命中规则时记录审核事件，拦截时返回ErrBlocked
+func (m *Moderator) Review(ctx context.Context, input *Input) (*Decision, error) {
+	decision := m.Check(ctx, input.Text)
+	if len(decision.Hits) > 0 {
+		m.Record(ctx, input, decision)
+	}
+	if decision.Action == ActionBlock {
+		return decision, ErrBlocked
+	}
+	return decision, nil
+}
+
+// Record 记录审核事件
+func (m *Moderator) Record(ctx context.Context, input *Input, decision *Decision) {
+	hits, _ := json.Marshal(decision.Hits)
+	event := &Event{
+		UserID:         input.UserID,
+		ConversationID: input.ConversationID,
+		ModelID:        input.ModelID,
+		Source:         input.Source,
+		Content:        input.Text,
+		Hits:           hits,
+		Action:         decision.Action,
+	}
+	if err := m.db.WithContext(ctx).Create(event).Error; err != nil {
+		log.Printf("记录审核事件失败: %v", err)
+	}
+}
+
+// decide 汇总命中结果：取最严格的动作，并对打码命中的区间替换为*
+func decide(text []rune, hits []Hit) *Decision {
+	decision := &Decision{Action: ActionPass, Hits: hits}
+	masked := make([]rune, len(text))
+	copy(masked, text)
+
+	for _, hit := range hits {
+		if hit.Action > decision.Action {
+			decision.Action = hit.Action
+		}
+		if hit.Action == ActionMask {
+			for i := max(hit.Start, 0); i < hit.End && i < len(masked); i++ {
+				masked[i] = '*'
+			}
+		}
+	}
+
+	decision.Text = string(masked)
+	return decision
+}
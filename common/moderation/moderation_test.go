@@ -0,0 +1,180 @@
+package moderation
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestMatcherFindAll(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		text     string
+		want     []Match
+	}{
+		{
+			name:     "overlapping patterns",
+			patterns: []string{"he", "she", "his", "hers"},
+			text:     "ushers",
+			want: []Match{
+				{Pattern: 1, Start: 1, End: 4},
+				{Pattern: 0, Start: 2, End: 4},
+				{Pattern: 3, Start: 2, End: 6},
+			},
+		},
+		{
+			name:     "chinese text",
+			patterns: []string{"敏感", "敏感词"},
+			text:     "这是敏感词测试",
+			want: []Match{
+				{Pattern: 0, Start: 2, End: 4},
+				{Pattern: 1, Start: 2, End: 5},
+			},
+		},
+		{
+			name:     "case insensitive",
+			patterns: []string{"badword"},
+			text:     "a BadWord here",
+			want:     []Match{{Pattern: 0, Start: 2, End: 9}},
+		},
+		{
+			name:     "no match",
+			patterns: []string{"abc"},
+			text:     "abxabyc",
+			want:     nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NewMatcher(tt.patterns).FindAll([]rune(tt.text))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FindAll() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func newTestModerator(keywords ...Keyword) *Moderator {
+	m := NewModerator(nil)
+	m.keywords = NewKeywordChecker(keywords)
+	return m
+}
+
+func TestModeratorCheck(t *testing.T) {
+	m := newTestModerator(
+		Keyword{Word: "赌博", Action: ActionMask},
+		Keyword{Word: "违禁品", Action: ActionBlock},
+	)
+
+	decision := m.Check(context.Background(), "不要赌博")
+	if decision.Action != ActionMask || decision.Text != "不要**" {
+		t.Errorf("Check() = %d %q, want mask %q", decision.Action, decision.Text, "不要**")
+	}
+
+	decision = m.Check(context.Background(), "购买违禁品")
+	if decision.Action != ActionBlock {
+		t.Errorf("Check() action = %d, want block", decision.Action)
+	}
+}
+
+func TestStreamFilter(t *testing.T) {
+	m := newTestModerator(
+		Keyword{Word: "赌博网站", Action: ActionMask},
+		Keyword{Word: "违禁品", Action: ActionBlock},
+	)
+
+	t.Run("mask across chunks", func(t *testing.T) {
+		f := m.NewStreamFilter(context.Background())
+		var out string
+		for _, delta := range []string{"这是一个赌", "博网", "站的介绍"} {
+			s, err := f.Write(delta)
+			if err != nil {
+				t.Fatalf("Write(%q) error = %v", delta, err)
+			}
+			out += s
+		}
+		s, err := f.Flush()
+		if err != nil {
+			t.Fatalf("Flush() error = %v", err)
+		}
+		out += s
+
+		if want := "这是一个****的介绍"; out != want {
+			t.Errorf("output = %q, want %q", out, want)
+		}
+		if hits := f.Decision().Hits; len(hits) != 1 || hits[0].Start != 4 || hits[0].End != 8 {
+			t.Errorf("hits = %+v, want one hit at [4,8)", hits)
+		}
+	})
+
+	t.Run("block across chunks", func(t *testing.T) {
+		f := m.NewStreamFilter(context.Background())
+		if _, err := f.Write("如何购买违"); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+		if _, err := f.Write("禁品"); !errors.Is(err, ErrBlocked) {
+			t.Errorf("Write() error = %v, want ErrBlocked", err)
+		}
+	})
+	t.Run("regex mask one rune per delta", func(t *testing.T) {
+		rm := newTestModerator()
+		rm.rules = NewRegexChecker([]Rule{{Name: "phone", Pattern: `1\d{10}`, Action: ActionMask}})
+
+		f := rm.NewStreamFilter(context.Background())
+		var out string
+		for _, r := range "电话13800138000。" {
+			s, err := f.Write(string(r))
+			if err != nil {
+				t.Fatalf("Write(%q) error = %v", r, err)
+			}
+			out += s
+		}
+		s, err := f.Flush()
+		if err != nil {
+			t.Fatalf("Flush() error = %v", err)
+		}
+		out += s
+		if want := "电话***********。"; out != want {
+			t.Errorf("output = %q, want %q", out, want)
+		}
+	})
+
+	t.Run("unbounded regex at flush", func(t *testing.T) {
+		rm := newTestModerator(Keyword{Word: "赌博网站", Action: ActionMask})
+		rm.rules = NewRegexChecker([]Rule{{Name: "card", Pattern: `\d{12,}`, Action: ActionBlock}})
+
+		// 匹配长度不固定的正则没有设置MaxLen，卡号的前半部分已经下发，Flush时按全文拦截
+		f := rm.NewStreamFilter(context.Background())
+		for _, delta := range []string{"卡号12345678", "87654321。"} {
+			if _, err := f.Write(delta); err != nil {
+				t.Fatalf("Write(%q) error = %v", delta, err)
+			}
+		}
+		if _, err := f.Flush(); !errors.Is(err, ErrBlocked) {
+			t.Errorf("Flush() error = %v, want ErrBlocked", err)
+		}
+	})
+}
+
+func TestPatternMaxLen(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    int
+	}{
+		{`1\d{10}`, 11},
+		{`\d{17}[\dXx]`, 18},
+		{`(?i)qq[:：]?\d{5,11}`, 14},
+		{`^a|bcd$`, 3},
+		{`\d+`, -1},
+		{`\d{12,}`, -1},
+	}
+	for _, tt := range tests {
+		got, err := PatternMaxLen(tt.pattern)
+		if err != nil || got != tt.want {
+			t.Errorf("PatternMaxLen(%q) = %d, %v, want %d", tt.pattern, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package moderation
+
+import (
+	"context"
+	"strings"
+)
+
+// StreamFilter 流式输出审核：增量检查词库和正则，保留可能跨分片的尾部文本，
+// 已输出的文本不会再被修改。
+//
+// 保留的尾部长度按最长敏感词和正则的最长匹配长度计算，因此这些命中一定在下发前被打码或拦截。
+// 匹配长度不固定且没有设置MaxLen的正则只能在Flush时对全文检查：命中拦截规则时返回ErrBlocked
+// (由调用方撤回已输出的内容)，命中打码规则时只能替换尚未下发的部分，并记录在审核事件中
+type StreamFilter struct {
+	moderator *Moderator
+	ctx       context.Context
+	checkers  []Checker
+	rules     *RegexChecker
+	holdback  int
+
+	pending []rune          // 尚未输出的文本
+	offset  int             // pending[0]在全文中的位置
+	checked int             // 已检查到的全文位置，用于命中去重
+	full    strings.Builder // 模型输出的原文
+	hits    []Hit
+}
+
+// NewStreamFilter 创建流式输出审核过滤器
+func (m *Moderator) NewStreamFilter(ctx context.Context) *StreamFilter {
+	checkers := m.localCheckers()
+	f := &StreamFilter{moderator: m, ctx: ctx, checkers: checkers}
+	for _, checker := range checkers {
+		switch c := checker.(type) {
+		case *KeywordChecker:
+			f.holdback = max(f.holdback, c.MaxLen()-1)
+		case *RegexChecker:
+			f.rules = c
+			f.holdback = max(f.holdback, c.MaxLen()-1)
+		}
+	}
+	return f
+}
+
+// Write 输入模型输出的增量文本，返回可以安全下发的文本，命中拦截规则时返回ErrBlocked
+func (f *StreamFilter) Write(delta string) (string, error) {
+	f.full.WriteString(delta)
+	f.pending = append(f.pending, []rune(delta)...)
+	if err := f.scan(); err != nil {
+		return "", err
+	}
+
+	n := len(f.pending) - f.holdback
+	if n <= 0 {
+		return "", nil
+	}
+	out := string(f.pending[:n])
+	f.pending = append([]rune(nil), f.pending[n:]...)
+	f.offset += n
+	return out, nil
+}
+
+// Flush 输出结束时下发剩余文本，并对全文运行正则规则和审核模型
+func (f *StreamFilter) Flush() (string, error) {
+	if err := f.scan(); err != nil {
+		return "", err
+	}
+	if err := f.scanRules(); err != nil {
+		return "", err
+	}
+	out := string(f.pending)
+	f.offset += len(f.pending)
+	f.pending = nil
+
+	// 审核模型只对全文检查一次，命中拦截时由调用方撤回已输出的内容
+	for _, checker := range f.moderator.extra {
+		hits, err := checker.Check(f.ctx, []rune(f.full.String()))
+		if err != nil {
+			continue
+		}
+		f.hits = append(f.hits, hits...)
+		for _, hit := range hits {
+			if hit.Action == ActionBlock {
+				return out, ErrBlocked
+			}
+		}
+	}
+	return out, nil
+}
+
+// Text 返回模型输出的原文
+func (f *StreamFilter) Text() string {
+	return f.full.String()
+}
+
+// Decision 返回全文的审核结论
+func (f *StreamFilter) Decision() *Decision {
+	return decide([]rune(f.full.String()), f.hits)
+}
+
+// scan 检查待输出文本，记录新命中并对打码区间替换为*
+func (f *StreamFilter) scan() error {
+	decision := runCheckers(f.ctx, f.pending, f.checkers)
+	end := f.offset + len(f.pending)
+
+	blocked := false
+	for _, hit := range decision.Hits {
+		hit.Start += f.offset
+		hit.End += f.offset
+		if hit.End <= f.checked {
+			continue
+		}
+		f.hits = append(f.hits, hit)
+		if hit.Action == ActionBlock {
+			blocked = true
+		}
+	}
+	f.checked = end
+	f.pending = []rune(decision.Text)
+
+	if blocked {
+		return ErrBlocked
+	}
+	return nil
+}
+
+// scanRules 对完整输出运行正则规则，补充增量检查时因匹配跨越已下发文本而漏掉的命中。
+// 打码只作用于尚未下发的文本，命中拦截规则时返回ErrBlocked
+func (f *StreamFilter) scanRules() error {
+	if f.rules == nil {
+		return nil
+	}
+	hits, err := f.rules.Check(f.ctx, []rune(f.full.String()))
+	if err != nil {
+		return nil
+	}
+
+	blocked := false
+	for _, hit := range hits {
+		if f.seen(hit) {
+			continue
+		}
+		f.hits = append(f.hits, hit)
+		switch hit.Action {
+		case ActionBlock:
+			blocked = true
+		case ActionMask:
+			for i := max(hit.Start, f.offset); i < hit.End && i-f.offset < len(f.pending); i++ {
+				f.pending[i-f.offset] = '*'
+			}
+		}
+	}
+	if blocked {
+		return ErrBlocked
+	}
+	return nil
+}
+
+// seen 增量检查时是否已记录过相同的命中
+func (f *StreamFilter) seen(hit Hit) bool {
+	for _, h := range f.hits {
+		if h.Checker == hit.Checker && h.Rule == hit.Rule && h.Start == hit.Start && h.End == hit.End {
+			return true
+		}
+	}
+	return false
+}
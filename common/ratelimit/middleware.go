@@ -0,0 +1,80 @@
+package ratelimit
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// KeyFunc 从请求中提取限流主体，返回空字符串时不限流
+type KeyFunc func(c *gin.Context) string
+
+// LimitFunc 根据请求确定限流规则，可按用户套餐等级返回不同规则
+type LimitFunc func(c *gin.Context) Limit
+
+// ByIP 按客户端IP限流
+func ByIP(c *gin.Context) string {
+	return "ip:" + c.ClientIP()
+}
+
+// ByUser 按认证中间件写入上下文的用户ID限流，未登录时退化为按IP
+func ByUser(userKey string) KeyFunc {
+	return func(c *gin.Context) string {
+		if userID, ok := c.Get(userKey); ok {
+			return fmt.Sprintf("user:%v", userID)
+		}
+		return ByIP(c)
+	}
+}
+
+// Fixed 固定限流规则
+func Fixed(limit Limit) LimitFunc {
+	return func(c *gin.Context) Limit {
+		return limit
+	}
+}
+
+// Middleware 返回限流中间件，name用于区分路由组的配额。
+// Redis不可用时放行请求，避免限流组件故障导致服务整体不可用
+func (l *Limiter) Middleware(name string, key KeyFunc, limit LimitFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		subject := key(c)
+		if subject == "" {
+			c.Next()
+			return
+		}
+
+		result, err := l.Allow(c.Request.Context(), name+":"+subject, limit(c))
+		if err != nil {
+			log.Printf("rate limit check failed: %v", err)
+			c.Next()
+			return
+		}
+		if result.Limit == 0 {
+			c.Next()
+			return
+		}
+
+		c.Header("X-RateLimit-Limit", strconv.Itoa(result.Limit))
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		c.Header("X-RateLimit-Reset", strconv.Itoa(CeilSeconds(result.ResetAfter.Seconds())))
+
+		if !result.Allowed {
+			c.Header("Retry-After", strconv.Itoa(CeilSeconds(result.RetryAfter.Seconds())))
+			c.JSON(http.StatusTooManyRequests, gin.H{"code": 1006, "message": "请求过于频繁，请稍后再试"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// CeilSeconds 秒数向上取整，最小为1，用于Retry-After等以秒为单位的响应头
+func CeilSeconds(seconds float64) int {
+	return int(math.Max(1, math.Ceil(seconds)))
+}
@@ -0,0 +1,154 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Algorithm 限流算法
+type Algorithm int
+
+const (
+	TokenBucket   Algorithm = iota // 令牌桶：允许突发，平均速率受限
+	SlidingWindow                  // 滑动窗口：窗口内请求数严格受限，适合登录等防暴力破解场景
+)
+
+// Limit 限流规则：每Period最多Rate次请求
+type Limit struct {
+	Rate      int
+	Period    time.Duration
+	Burst     int // 令牌桶容量，为0时等于Rate
+	Algorithm Algorithm
+}
+
+// PerMinute 每分钟n次的令牌桶规则
+func PerMinute(n int) Limit {
+	return Limit{Rate: n, Period: time.Minute}
+}
+
+// IsZero 规则为空时不限流
+func (l Limit) IsZero() bool {
+	return l.Rate <= 0 || l.Period <= 0
+}
+
+// Result 限流判定结果
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	RetryAfter time.Duration // 被拒绝时距离下次可请求的时间
+	ResetAfter time.Duration // 距离配额完全恢复的时间
+}
+
+// tokenBucketScript 令牌桶：按经过的时间补充令牌，时间取自Redis避免多实例时钟偏差
+var tokenBucketScript = redis.NewScript(`
+local key = KEYS[1]
+local rate = tonumber(ARGV[1])
+local capacity = tonumber(ARGV[2])
+local requested = tonumber(ARGV[3])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+local data = redis.call('HMGET', key, 'tokens', 'ts')
+local tokens = tonumber(data[1])
+local ts = tonumber(data[2])
+if tokens == nil or ts == nil then
+  tokens = capacity
+  ts = now
+end
+
+tokens = math.min(capacity, tokens + math.max(0, now - ts) * rate)
+local allowed = 0
+local retry_after = 0
+if tokens >= requested then
+  tokens = tokens - requested
+  allowed = 1
+else
+  retry_after = math.ceil((requested - tokens) / rate)
+end
+local reset_after = math.ceil((capacity - tokens) / rate)
+
+redis.call('HSET', key, 'tokens', tokens, 'ts', now)
+redis.call('PEXPIRE', key, math.max(reset_after, 1000))
+return {allowed, math.floor(tokens), retry_after, reset_after}
+`)
+
+// slidingWindowScript 滑动窗口日志：有序集合记录窗口内每次请求的时间
+var slidingWindowScript = redis.NewScript(`
+local key = KEYS[1]
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local member = ARGV[3]
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+redis.call('ZREMRANGEBYSCORE', key, 0, now - window)
+local count = redis.call('ZCARD', key)
+if count < limit then
+  redis.call('ZADD', key, now, member)
+  redis.call('PEXPIRE', key, window)
+  local oldest = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+  return {1, limit - count - 1, 0, tonumber(oldest[2]) + window - now}
+end
+
+local oldest = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+local retry = tonumber(oldest[2]) + window - now
+return {0, 0, retry, retry}
+`)
+
+// Limiter 基于Redis的分布式限流器
+type Limiter struct {
+	rdb    *redis.Client
+	prefix string
+}
+
+// NewLimiter 创建限流器，prefix用于区分不同服务的限流键
+func NewLimiter(rdb *redis.Client, prefix string) *Limiter {
+	return &Limiter{rdb: rdb, prefix: prefix}
+}
+
+// Allow 判定key的一次请求是否放行
+func (l *Limiter) Allow(ctx context.Context, key string, limit Limit) (*Result, error) {
+	if limit.IsZero() {
+		return &Result{Allowed: true}, nil
+	}
+
+	redisKey := fmt.Sprintf("ratelimit:%s:%s", l.prefix, key)
+
+	var values []int64
+	var err error
+	switch limit.Algorithm {
+	case SlidingWindow:
+		member := strconv.FormatInt(time.Now().UnixNano(), 10)
+		values, err = slidingWindowScript.Run(ctx, l.rdb, []string{redisKey},
+			limit.Rate, limit.Period.Milliseconds(), member).Int64Slice()
+	default:
+		burst := limit.Burst
+		if burst <= 0 {
+			burst = limit.Rate
+		}
+		// 每毫秒补充的令牌数
+		rate := float64(limit.Rate) / float64(limit.Period.Milliseconds())
+		values, err = tokenBucketScript.Run(ctx, l.rdb, []string{redisKey},
+			strconv.FormatFloat(rate, 'f', -1, 64), burst, 1).Int64Slice()
+		limit.Rate = burst
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to run rate limit script: %w", err)
+	}
+	if len(values) != 4 {
+		return nil, fmt.Errorf("unexpected rate limit script result: %v", values)
+	}
+
+	return &Result{
+		Allowed:    values[0] == 1,
+		Limit:      limit.Rate,
+		Remaining:  int(values[1]),
+		RetryAfter: time.Duration(values[2]) * time.Millisecond,
+		ResetAfter: time.Duration(values[3]) * time.Millisecond,
+	}, nil
+}
@@ -0,0 +1,163 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestLimiter(t *testing.T) (*Limiter, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	return NewLimiter(rdb, "test"), mr
+}
+
+func allow(t *testing.T, l *Limiter, limit Limit) *Result {
+	t.Helper()
+	result, err := l.Allow(context.Background(), "k", limit)
+	if err != nil {
+		t.Fatalf("Allow() error = %v", err)
+	}
+	return result
+}
+
+func TestTokenBucket(t *testing.T) {
+	l, mr := newTestLimiter(t)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	mr.SetTime(start)
+	limit := PerMinute(2)
+
+	// 桶满时可连续请求2次，之后每30秒补充1个令牌
+	for i, wantRemaining := range []int{1, 0} {
+		r := allow(t, l, limit)
+		if !r.Allowed || r.Limit != 2 || r.Remaining != wantRemaining {
+			t.Fatalf("第%d次请求 = %+v，应放行且剩余%d", i+1, r, wantRemaining)
+		}
+	}
+	r := allow(t, l, limit)
+	if r.Allowed || r.Remaining != 0 || r.RetryAfter != 30*time.Second || r.ResetAfter != time.Minute {
+		t.Fatalf("超出配额 = %+v，应拒绝且30秒后重试、60秒后恢复", r)
+	}
+
+	mr.SetTime(start.Add(15 * time.Second))
+	if r := allow(t, l, limit); r.Allowed || r.RetryAfter != 15*time.Second {
+		t.Fatalf("补充半个令牌后 = %+v，应拒绝且15秒后重试", r)
+	}
+
+	mr.SetTime(start.Add(30 * time.Second))
+	if r := allow(t, l, limit); !r.Allowed || r.Remaining != 0 {
+		t.Fatalf("补充1个令牌后 = %+v，应放行", r)
+	}
+}
+
+func TestTokenBucketBurst(t *testing.T) {
+	l, mr := newTestLimiter(t)
+	mr.SetTime(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	limit := Limit{Rate: 1, Period: time.Second, Burst: 3}
+
+	r := allow(t, l, limit)
+	if !r.Allowed || r.Limit != 3 || r.Remaining != 2 || r.ResetAfter != time.Second {
+		t.Fatalf("首次请求 = %+v，应放行且上限为桶容量3", r)
+	}
+}
+
+func TestSlidingWindow(t *testing.T) {
+	l, mr := newTestLimiter(t)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	limit := Limit{Rate: 2, Period: time.Minute, Algorithm: SlidingWindow}
+
+	mr.SetTime(start)
+	if r := allow(t, l, limit); !r.Allowed || r.Remaining != 1 || r.ResetAfter != time.Minute {
+		t.Fatalf("第1次请求 = %+v，应放行且剩余1", r)
+	}
+	mr.SetTime(start.Add(10 * time.Second))
+	if r := allow(t, l, limit); !r.Allowed || r.Remaining != 0 || r.ResetAfter != 50*time.Second {
+		t.Fatalf("第2次请求 = %+v，应放行且在最早的请求滑出窗口时恢复", r)
+	}
+
+	// 最早的请求在60秒时滑出窗口
+	mr.SetTime(start.Add(20 * time.Second))
+	if r := allow(t, l, limit); r.Allowed || r.RetryAfter != 40*time.Second || r.ResetAfter != 40*time.Second {
+		t.Fatalf("超出配额 = %+v，应拒绝且40秒后重试", r)
+	}
+
+	mr.SetTime(start.Add(time.Minute))
+	if r := allow(t, l, limit); !r.Allowed || r.Remaining != 0 {
+		t.Fatalf("最早的请求滑出窗口后 = %+v，应放行", r)
+	}
+}
+
+func TestAllowZeroLimit(t *testing.T) {
+	l, _ := newTestLimiter(t)
+	if r := allow(t, l, Limit{}); !r.Allowed || r.Limit != 0 {
+		t.Fatalf("空规则 = %+v，应不限流", r)
+	}
+}
+
+func TestCeilSeconds(t *testing.T) {
+	tests := []struct {
+		seconds float64
+		want    int
+	}{
+		{0, 1},
+		{0.001, 1},
+		{1, 1},
+		{1.001, 2},
+		{59.5, 60},
+	}
+	for _, tt := range tests {
+		if got := CeilSeconds(tt.seconds); got != tt.want {
+			t.Errorf("CeilSeconds(%v) = %d, want %d", tt.seconds, got, tt.want)
+		}
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	l, mr := newTestLimiter(t)
+	mr.SetTime(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/", l.Middleware("api", ByIP, Fixed(Limit{Rate: 1, Period: 90 * time.Second})), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	serve := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		return w
+	}
+
+	w := serve()
+	if w.Code != http.StatusOK {
+		t.Fatalf("首次请求应放行，得到 %d", w.Code)
+	}
+	for header, want := range map[string]string{"X-RateLimit-Limit": "1", "X-RateLimit-Remaining": "0", "X-RateLimit-Reset": "90"} {
+		if got := w.Header().Get(header); got != want {
+			t.Errorf("%s = %q, want %q", header, got, want)
+		}
+	}
+	if got := w.Header().Get("Retry-After"); got != "" {
+		t.Errorf("放行时不应返回Retry-After，得到 %q", got)
+	}
+
+	w = serve()
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("超出配额应返回429，得到 %d", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "90" {
+		t.Errorf("Retry-After = %q, want %q", got, "90")
+	}
+
+	// Redis不可用时放行
+	mr.Close()
+	if w := serve(); w.Code != http.StatusOK {
+		t.Fatalf("Redis不可用时应放行，得到 %d", w.Code)
+	}
+}
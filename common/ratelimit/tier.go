@@ -0,0 +1,83 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// 套餐等级，与packages.type一致，TierFree表示没有有效套餐
+const (
+	TierFree    = 0
+	TierTrial   = 1 // 体验
+	TierDaily   = 2 // 日卡
+	TierWeekly  = 3 // 周卡
+	TierMonthly = 4 // 月卡
+)
+
+const (
+	userTierCacheKey = "user:%d:tier"
+	userTierCacheTTL = 5 * time.Minute
+)
+
+// TierLimits 各套餐等级对应的限流规则，缺省等级使用TierFree的规则
+type TierLimits map[int]Limit
+
+// TierResolver 查询用户当前有效套餐的最高等级
+type TierResolver struct {
+	db  *gorm.DB
+	rdb *redis.Client
+}
+
+// NewTierResolver 创建套餐等级查询器
+func NewTierResolver(db *gorm.DB, rdb *redis.Client) *TierResolver {
+	return &TierResolver{db: db, rdb: rdb}
+}
+
+// Tier 获取用户套餐等级，结果缓存5分钟
+func (r *TierResolver) Tier(ctx context.Context, userID int64) int {
+	cacheKey := fmt.Sprintf(userTierCacheKey, userID)
+	if cached, err := r.rdb.Get(ctx, cacheKey).Result(); err == nil {
+		if tier, err := strconv.Atoi(cached); err == nil {
+			return tier
+		}
+	}
+
+	var tier int
+	err := r.db.WithContext(ctx).Table("user_packages").
+		Select("COALESCE(MAX(packages.type), 0)").
+		Joins("join packages on packages.id = user_packages.package_id").
+		Where("user_packages.user_id = ? AND user_packages.status = 1 AND user_packages.end_time > ?", userID, time.Now()).
+		Row().Scan(&tier)
+	if err != nil {
+		log.Printf("failed to query user tier: %v", err)
+		return TierFree
+	}
+
+	if err := r.rdb.Set(ctx, cacheKey, tier, userTierCacheTTL).Err(); err != nil {
+		log.Printf("failed to cache user tier: %v", err)
+	}
+	return tier
+}
+
+// Limits 按上下文中用户的套餐等级选择限流规则，未登录用户使用TierFree的规则
+func (r *TierResolver) Limits(userKey string, limits TierLimits) LimitFunc {
+	return func(c *gin.Context) Limit {
+		tier := TierFree
+		if value, ok := c.Get(userKey); ok {
+			if userID, ok := value.(int64); ok {
+				tier = r.Tier(c.Request.Context(), userID)
+			}
+		}
+		if limit, ok := limits[tier]; ok {
+			return limit
+		}
+		return limits[TierFree]
+	}
+}
@@ -0,0 +1,52 @@
+// rotatekeys 轮换上游API Key的主密钥：使用KEY_ENCRYPTION_KEYS中的第一个主密钥
+// 重新加密数据库中所有使用旧主密钥加密或明文保存的Key。
+//
+// 轮换步骤:
+//
+//	go run ./cmd/rotatekeys -generate                              # 生成新的主密钥
+//	KEY_ENCRYPTION_KEYS="k2:<新密钥>,k1:<旧密钥>" go run ./cmd/rotatekeys
+//
+// 所有服务更新为同样的KEY_ENCRYPTION_KEYS后执行，完成后即可从配置中删除旧主密钥
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+
+	"cybermind/common/keycrypt"
+	"cybermind/model-service/pkg/database"
+)
+
+func main() {
+	generate := flag.Bool("generate", false, "生成一个新的主密钥并退出")
+	flag.Parse()
+
+	if *generate {
+		secret, err := keycrypt.Generate()
+		if err != nil {
+			log.Fatalf("生成主密钥失败: %v", err)
+		}
+		fmt.Println(secret)
+		return
+	}
+
+	keyring, err := keycrypt.Load()
+	if err != nil {
+		log.Fatalf("加载主密钥失败: %v", err)
+	}
+	if keyring == nil {
+		log.Fatal("未配置KEY_ENCRYPTION_KEYS或KEY_ENCRYPTION_KEYS_FILE")
+	}
+
+	db, err := database.InitDB()
+	if err != nil {
+		log.Fatalf("初始化数据库失败: %v", err)
+	}
+
+	n, err := database.EncryptAPIKeys(db, keyring, true)
+	if err != nil {
+		log.Fatalf("轮换失败，已更新 %d 个Key: %v", n, err)
+	}
+	log.Printf("轮换完成，使用主密钥 %s 重新加密了 %d 个Key", keyring.PrimaryID(), n)
+}
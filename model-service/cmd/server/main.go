@@ -1,13 +1,34 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
+	"net/http"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"cybermind/common/keycrypt"
+	"cybermind/common/moderation"
 	"cybermind/model-service/internal/api/router"
+	"cybermind/model-service/internal/relay"
+	"cybermind/model-service/internal/service"
 	"cybermind/model-service/pkg/database"
 )
 
 func main() {
+	// 加载上游API Key的主密钥，需要在读写模型数据之前设置
+	keyring, err := keycrypt.Load()
+	if err != nil {
+		log.Fatalf("加载主密钥失败: %v", err)
+	}
+	if keyring == nil {
+		log.Println("警告: 未配置KEY_ENCRYPTION_KEYS，上游API Key将以明文保存")
+	} else {
+		keycrypt.SetDefault(keyring)
+	}
+
 	// 初始化数据库连接
 	db, err := database.InitDB()
 	if err != nil {
@@ -18,12 +39,74 @@ func main() {
 	if err := database.AutoMigrate(db); err != nil {
 		log.Fatalf("数据库迁移失败: %v", err)
 	}
+	if keyring != nil {
+		n, err := database.EncryptAPIKeys(db, keyring, false)
+		if err != nil {
+			log.Fatalf("加密上游API Key失败: %v", err)
+		}
+		if n > 0 {
+			log.Printf("已加密 %d 个明文保存的上游API Key", n)
+		}
+	}
+
+	// 初始化Redis连接
+	rdb, err := database.InitRedis()
+	if err != nil {
+		log.Fatalf("初始化Redis失败: %v", err)
+	}
+
+	// 后台写入任务，服务退出时取消并等待剩余数据写入
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+
+	// 异步记录API Key的调用结果，定期探测自动停用的Key，恢复后重新启用
+	relayClient := relay.NewClient()
+	keyHealth := service.NewKeyHealthService(db, rdb, relayClient)
+	keyHealth.Start(workerCtx)
+	keyHealth.StartProbe(context.Background(), time.Minute)
+
+	// 上游调用记录异步批量写入model_requests
+	requestLog := service.NewRequestLogger(db)
+	requestLog.Start(workerCtx)
+
+	// 转发请求的观测结果异步写入部署得分
+	scorer := service.NewRouteScorer(rdb)
+	scorer.Start(workerCtx)
+
+	// 加载内容审核词库，平台API与chat-service使用相同的审核规则和审核表
+	var checkers []moderation.Checker
+	if checker := moderation.NewModelCheckerFromEnv(); checker != nil {
+		checkers = append(checkers, checker)
+	}
+	moderator := moderation.NewModerator(db, checkers...)
+	if err := moderator.Reload(context.Background()); err != nil {
+		log.Fatalf("审核词库加载失败: %v", err)
+	}
+	moderator.StartAutoReload(context.Background(), time.Minute)
 
 	// 设置路由
-	r := router.SetupRouter(db)
+	r := router.SetupRouter(db, rdb, relayClient, keyHealth, requestLog, scorer, moderator)
+
+	// 启动服务器，收到SIGINT/SIGTERM时等待处理中的请求结束，再写入剩余的调用记录、Key调用结果和部署观测结果后退出
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
-	// 启动服务器
-	if err := r.Run(":8081"); err != nil {
-		log.Fatalf("启动服务器失败: %v", err)
+	srv := &http.Server{Addr: ":8081", Handler: r}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("启动服务器失败: %v", err)
+		}
+	}()
+
+	<-ctx.Done()
+	log.Println("正在关闭服务器...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("关闭服务器超时: %v", err)
 	}
+
+	stopWorkers()
+	requestLog.Wait()
+	keyHealth.Wait()
+	scorer.Wait()
 }
@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"log"
 	"net/http"
 	"strconv"
 
@@ -8,17 +9,25 @@ import (
 	"gorm.io/gorm"
 
 	"cybermind/model-service/internal/model"
+	"cybermind/model-service/internal/service"
 )
 
 type APIKeyPoolHandler struct {
-	db *gorm.DB
+	db        *gorm.DB
+	keyHealth *service.KeyHealthService
 }
 
-func NewAPIKeyPoolHandler(db *gorm.DB) *APIKeyPoolHandler {
-	return &APIKeyPoolHandler{db: db}
+func NewAPIKeyPoolHandler(db *gorm.DB, keyHealth *service.KeyHealthService) *APIKeyPoolHandler {
+	return &APIKeyPoolHandler{db: db, keyHealth: keyHealth}
 }
 
-// ListAPIKeyPools 获取 API Key 池列表
+// apiKeyPoolItem API Key及其健康状态
+type apiKeyPoolItem struct {
+	model.APIKeyPool
+	Health service.KeyHealth `json:"health"`
+}
+
+// ListAPIKeyPools 获取 API Key 池列表，包含每个Key最近10分钟的调用统计和健康状态
 func (h *APIKeyPoolHandler) ListAPIKeyPools(c *gin.Context) {
 	var keyPools []model.APIKeyPool
 	if err := h.db.Find(&keyPools).Error; err != nil {
@@ -29,10 +38,28 @@ func (h *APIKeyPoolHandler) ListAPIKeyPools(c *gin.Context) {
 		return
 	}
 
+	ids := make([]int64, len(keyPools))
+	for i, k := range keyPools {
+		ids[i] = k.ID
+	}
+	// 统计数据读取失败时只返回状态
+	stats, err := h.keyHealth.StatsBatch(c.Request.Context(), ids)
+	if err != nil {
+		log.Printf("读取Key调用统计失败: %v", err)
+	}
+
+	items := make([]apiKeyPoolItem, len(keyPools))
+	for i := range keyPools {
+		items[i] = apiKeyPoolItem{
+			APIKeyPool: keyPools[i],
+			Health:     service.Health(&keyPools[i], stats[keyPools[i].ID]),
+		}
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"code":    0,
 		"message": "success",
-		"data":    keyPools,
+		"data":    items,
 	})
 }
 
@@ -87,7 +114,12 @@ func (h *APIKeyPoolHandler) UpdateAPIKeyPoolStatus(c *gin.Context) {
 		return
 	}
 
-	if err := h.db.Model(&model.APIKeyPool{}).Where("id = ?", id).Update("status", req.Status).Error; err != nil {
+	// 手动启用时清除冷却
+	updates := map[string]interface{}{"status": req.Status}
+	if req.Status == model.KeyStatusEnabled {
+		updates["cooldown_until"] = nil
+	}
+	if err := h.db.Model(&model.APIKeyPool{}).Where("id = ?", id).Updates(updates).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"code":    1005,
 			"message": "更新API Key状态失败",
@@ -101,6 +133,42 @@ func (h *APIKeyPoolHandler) UpdateAPIKeyPoolStatus(c *gin.Context) {
 	})
 }
 
+// UpdateAPIKeyPoolWeight 更新 API Key 权重，用于weighted选择策略
+func (h *APIKeyPoolHandler) UpdateAPIKeyPoolWeight(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    1001,
+			"message": "参数错误",
+		})
+		return
+	}
+
+	var req struct {
+		Weight int `json:"weight" binding:"required,min=1,max=100"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    1001,
+			"message": "参数错误",
+		})
+		return
+	}
+
+	if err := h.db.Model(&model.APIKeyPool{}).Where("id = ?", id).Update("weight", req.Weight).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    1005,
+			"message": "更新API Key权重失败",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "success",
+	})
+}
+
 // DeleteAPIKeyPool 删除 API Key
 func (h *APIKeyPoolHandler) DeleteAPIKeyPool(c *gin.Context) {
 	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
@@ -0,0 +1,478 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"cybermind/common/moderation"
+	"cybermind/common/ratelimit"
+	"cybermind/model-service/internal/model"
+	"cybermind/model-service/internal/relay"
+	"cybermind/model-service/internal/service"
+)
+
+// GatewayHandler 对外开放的OpenAI兼容接口(/v1)，使用用户的平台API令牌认证，
+// 请求和响应格式与OpenAI一致，按模型的计费方式扣除积分。按token计费时发送前按输入加max_tokens预扣最高价格，
+// 完成、输出中断或调用方断开时按用量结算，流式请求结算后的积分不通过响应返回，以积分流水为准。
+// 用户消息和模型输出按chat-service相同的审核规则审核
+type GatewayHandler struct {
+	modelService   *service.ModelService
+	aliasService   *service.AliasService
+	billingService *service.BillingService
+	tokenService   *service.TokenService
+	routeService   *service.RouteService
+	requestLog     *service.RequestLogger
+	moderator      *moderation.Moderator
+	client         *relay.Client
+	limiter        *ratelimit.Limiter
+	limit          ratelimit.LimitFunc
+}
+
+func NewGatewayHandler(modelService *service.ModelService, aliasService *service.AliasService, billingService *service.BillingService, tokenService *service.TokenService,
+	routeService *service.RouteService, requestLog *service.RequestLogger, moderator *moderation.Moderator, client *relay.Client, limiter *ratelimit.Limiter, limit ratelimit.LimitFunc) *GatewayHandler {
+	return &GatewayHandler{
+		modelService:   modelService,
+		aliasService:   aliasService,
+		billingService: billingService,
+		tokenService:   tokenService,
+		routeService:   routeService,
+		requestLog:     requestLog,
+		moderator:      moderator,
+		client:         client,
+		limiter:        limiter,
+		limit:          limit,
+	}
+}
+
+// openAIError 返回OpenAI格式的错误
+func openAIError(c *gin.Context, status int, typ, code, message string) {
+	errBody := gin.H{"message": message, "type": typ, "param": nil, "code": nil}
+	if code != "" {
+		errBody["code"] = code
+	}
+	c.AbortWithStatusJSON(status, gin.H{"error": errBody})
+}
+
+// Authenticate 校验Authorization: Bearer sk-...令牌，按令牌限流，并将user_id/token_id写入上下文
+func (h *GatewayHandler) Authenticate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := strings.TrimSpace(strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer "))
+		if token == "" {
+			openAIError(c, http.StatusUnauthorized, "invalid_request_error", "invalid_api_key",
+				"You didn't provide an API key. You need to provide your API key in an Authorization header using Bearer auth.")
+			return
+		}
+
+		t, err := h.tokenService.Verify(c.Request.Context(), token, c.ClientIP())
+		if err != nil {
+			switch {
+			case errors.Is(err, service.ErrInvalidToken), errors.Is(err, service.ErrTokenExpired), errors.Is(err, service.ErrUserDisabled):
+				openAIError(c, http.StatusUnauthorized, "invalid_request_error", "invalid_api_key", "Incorrect API key provided.")
+				return
+			case errors.Is(err, service.ErrIPNotAllowed):
+				openAIError(c, http.StatusForbidden, "permission_error", "ip_not_allowed", "Your IP address is not allowed to use this API key.")
+				return
+			}
+			log.Printf("校验API令牌失败: %v", err)
+			openAIError(c, http.StatusInternalServerError, "server_error", "", "The server had an error while processing your request.")
+			return
+		}
+		c.Set("user_id", t.UserID)
+		c.Set("token_id", t.ID)
+		c.Set("api_token", t)
+
+		// 按令牌限流，Redis不可用时放行
+		result, err := h.limiter.Allow(c.Request.Context(), fmt.Sprintf("gateway:token:%d", t.ID), h.limit(c))
+		if err != nil {
+			log.Printf("rate limit check failed: %v", err)
+		} else if result.Limit > 0 {
+			c.Header("X-RateLimit-Limit-Requests", strconv.Itoa(result.Limit))
+			c.Header("X-RateLimit-Remaining-Requests", strconv.Itoa(result.Remaining))
+			c.Header("X-RateLimit-Reset-Requests", fmt.Sprintf("%ds", ratelimit.CeilSeconds(result.ResetAfter.Seconds())))
+			if !result.Allowed {
+				c.Header("Retry-After", strconv.Itoa(ratelimit.CeilSeconds(result.RetryAfter.Seconds())))
+				openAIError(c, http.StatusTooManyRequests, "requests", "rate_limit_exceeded", "Rate limit reached for requests. Please try again later.")
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
+
+// RequireScope 检查令牌的权限范围
+func (h *GatewayHandler) RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !apiToken(c).HasScope(scope) {
+			openAIError(c, http.StatusForbidden, "permission_error", "insufficient_permissions",
+				fmt.Sprintf("You have insufficient permissions for this operation. Missing scopes: %s.", scope))
+			return
+		}
+		c.Next()
+	}
+}
+
+func apiToken(c *gin.Context) *model.APIToken {
+	t, _ := c.Get("api_token")
+	return t.(*model.APIToken)
+}
+
+// ListModels 令牌可调用的模型列表，模型ID为别名或上游模型名，与别名同名的模型不再单独列出
+func (h *GatewayHandler) ListModels(c *gin.Context) {
+	token := apiToken(c)
+	aliases, err := h.aliasService.ListAvailable()
+	if err != nil {
+		openAIError(c, http.StatusInternalServerError, "server_error", "", "The server had an error while processing your request.")
+		return
+	}
+	models, err := h.modelService.ListAvailableModels()
+	if err != nil {
+		openAIError(c, http.StatusInternalServerError, "server_error", "", "The server had an error while processing your request.")
+		return
+	}
+
+	seen := make(map[string]bool, len(aliases)+len(models))
+	data := make([]gin.H, 0, len(aliases)+len(models))
+	for _, a := range aliases {
+		if len(a.Filter(token.AllowsModel).Deployments) == 0 {
+			continue
+		}
+		seen[a.Alias.Name] = true
+		data = append(data, gin.H{
+			"id":       a.Alias.Name,
+			"object":   "model",
+			"created":  a.Alias.CreatedAt.Unix(),
+			"owned_by": "system",
+		})
+	}
+	for _, m := range models {
+		if seen[m.ModelName] || !token.AllowsModel(m.ID) {
+			continue
+		}
+		seen[m.ModelName] = true
+		data = append(data, gin.H{
+			"id":       m.ModelName,
+			"object":   "model",
+			"created":  m.CreatedAt.Unix(),
+			"owned_by": m.Provider,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"object": "list", "data": data})
+}
+
+// ChatCompletions 对话补全，响应原样转发上游。用户消息命中拦截规则时不调用上游，命中打码规则时发送打码后的内容；
+// 输出命中打码规则时改写对应的内容，命中拦截规则时非流式请求返回content_filter错误，流式请求以content_filter的error分片结束
+func (h *GatewayHandler) ChatCompletions(c *gin.Context) {
+	var req relay.ChatRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		openAIError(c, http.StatusBadRequest, "invalid_request_error", "", "We could not parse the JSON body of your request.")
+		return
+	}
+	if req.Model == "" {
+		openAIError(c, http.StatusBadRequest, "invalid_request_error", "", "you must provide a model parameter")
+		return
+	}
+	if len(req.Messages) == 0 {
+		openAIError(c, http.StatusBadRequest, "invalid_request_error", "", "'messages' is a required property")
+		return
+	}
+
+	// 上游始终返回用量用于统计，调用方未要求时不转发用量分片
+	includeUsage := req.StreamOptions != nil && req.StreamOptions.IncludeUsage
+
+	token := apiToken(c)
+	if err := moderatePrompt(c.Request.Context(), h.moderator, token.UserID, req.Messages); err != nil {
+		openAIError(c, http.StatusBadRequest, "invalid_request_error", "content_filter", promptBlockedMessage)
+		return
+	}
+
+	models, charge, ok := h.charge(c, req.Model, func(m *model.Model) int {
+		return service.InitialPoints(m, &req)
+	})
+	if !ok {
+		return
+	}
+
+	trace := h.trace(charge, "chat", req.Stream)
+	var body []byte
+	var usage *relay.Usage
+	var stream *relay.Stream
+	route, err := h.routeService.DoModels(c.Request.Context(), models, apiToken(c).AllowsModel, func(route *service.Route) error {
+		chatReq := req
+		var err error
+		trace.Begin()
+		if req.Stream {
+			stream, err = h.client.ChatCompletionStream(c.Request.Context(), route.Model, &chatReq)
+		} else {
+			body, usage, err = h.client.ChatCompletionRaw(c.Request.Context(), route.Model, &chatReq)
+		}
+		if err != nil {
+			trace.End(route, nil, 0, err)
+		}
+		return err
+	})
+	if err != nil {
+		h.fail(c, charge, err)
+		return
+	}
+	setRouteHeaders(c, route)
+
+	if !req.Stream {
+		output := 0
+		if usage == nil {
+			var resp relay.ChatResponse
+			if err := json.Unmarshal(body, &resp); err == nil {
+				output = service.ResponseTokens(&resp)
+			}
+		}
+		settle(h.billingService, charge, route.Model, service.SettleUsage(route.Model, &req, usage, output))
+		c.Header("X-Points-Charged", strconv.Itoa(charge.Points))
+		body, err = moderateResponse(c.Request.Context(), h.moderator, moderationInput(charge, route), body)
+		if err != nil {
+			// 上游已完成输出，按用量扣除的积分不退还
+			trace.End(route, usage, charge.Points, relay.ErrContentBlocked)
+			openAIError(c, http.StatusBadRequest, "invalid_request_error", "content_filter", outputBlockedMessage)
+			return
+		}
+		trace.End(route, usage, charge.Points, nil)
+		c.Data(http.StatusOK, "application/json", body)
+		return
+	}
+	defer stream.Close()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Status(http.StatusOK)
+
+	output := 0
+	filter := newStreamModeration(c.Request.Context(), h.moderator, moderationInput(charge, route))
+	defer filter.Close()
+	// blocked 输出命中拦截规则时停止读取上游，以content_filter的error分片结束，调用前已按用量结算
+	blocked := func() {
+		trace.End(route, usage, charge.Points, relay.ErrContentBlocked)
+		fmt.Fprintf(c.Writer, "data: %s\n\n", contentFilterBody(outputBlockedMessage))
+		c.Writer.Flush()
+	}
+	for {
+		data, chunk, err := stream.RecvRaw()
+		if err != nil {
+			// 正常结束、上游出错或调用方断开时都按用量结算，上游没有返回用量时按已输出的内容估算
+			settle(h.billingService, charge, route.Model, service.SettleUsage(route.Model, &req, usage, output))
+		}
+		if errors.Is(err, io.EOF) {
+			tail, err := filter.Flush()
+			if err != nil {
+				blocked()
+				return
+			}
+			if tail != nil {
+				fmt.Fprintf(c.Writer, "data: %s\n\n", tail)
+			}
+			trace.End(route, usage, charge.Points, nil)
+			fmt.Fprint(c.Writer, "data: [DONE]\n\n")
+			c.Writer.Flush()
+			return
+		}
+		if err != nil {
+			// 已开始输出后不再退还积分，已按输出的内容结算，通过error分片通知调用方
+			h.routeService.Report(route, err)
+			trace.End(route, usage, charge.Points, err)
+			log.Printf("读取上游流式响应失败: model=%d request=%s err=%v", route.Model.ID, charge.RequestID, err)
+			data, _ := json.Marshal(gin.H{"error": gin.H{"message": err.Error(), "type": "upstream_error", "param": nil, "code": nil}})
+			var apiErr *relay.APIError
+			if errors.Is(err, relay.ErrContentBlocked) && errors.As(err, &apiErr) {
+				data = []byte(apiErr.Body)
+			}
+			fmt.Fprintf(c.Writer, "data: %s\n\n", data)
+			c.Writer.Flush()
+			return
+		}
+		trace.FirstChunk()
+		if chunk.Usage != nil {
+			usage = chunk.Usage
+		}
+		output += service.ChunkTokens(chunk)
+		if chunk.Usage != nil && len(chunk.Choices) == 0 && !includeUsage {
+			continue
+		}
+		if data, err = filter.Chunk(data, chunk); err != nil {
+			settle(h.billingService, charge, route.Model, service.SettleUsage(route.Model, &req, usage, output))
+			blocked()
+			return
+		}
+
+		fmt.Fprintf(c.Writer, "data: %s\n\n", data)
+		c.Writer.Flush()
+	}
+}
+
+// Embeddings 文本向量化，响应原样转发上游
+func (h *GatewayHandler) Embeddings(c *gin.Context) {
+	var body map[string]json.RawMessage
+	if err := c.ShouldBindJSON(&body); err != nil {
+		openAIError(c, http.StatusBadRequest, "invalid_request_error", "", "We could not parse the JSON body of your request.")
+		return
+	}
+	var name string
+	if err := json.Unmarshal(body["model"], &name); err != nil || name == "" {
+		openAIError(c, http.StatusBadRequest, "invalid_request_error", "", "you must provide a model parameter")
+		return
+	}
+	if _, ok := body["input"]; !ok {
+		openAIError(c, http.StatusBadRequest, "invalid_request_error", "", "'input' is a required property")
+		return
+	}
+
+	models, charge, ok := h.charge(c, name, func(m *model.Model) int {
+		return service.InitialEmbeddingPoints(m, body["input"])
+	})
+	if !ok {
+		return
+	}
+
+	trace := h.trace(charge, "embeddings", false)
+	var data []byte
+	route, err := h.routeService.DoModels(c.Request.Context(), models, apiToken(c).AllowsModel, func(route *service.Route) error {
+		var err error
+		trace.Begin()
+		data, err = h.client.Embeddings(c.Request.Context(), route.Model, body)
+		if err != nil {
+			trace.End(route, nil, 0, err)
+		}
+		return err
+	})
+	if err != nil {
+		h.fail(c, charge, err)
+		return
+	}
+	setRouteHeaders(c, route)
+
+	var resp struct {
+		Usage *relay.Usage `json:"usage"`
+	}
+	if err := json.Unmarshal(data, &resp); err == nil {
+		settle(h.billingService, charge, route.Model, resp.Usage)
+		c.Header("X-Points-Charged", strconv.Itoa(charge.Points))
+	}
+	trace.End(route, resp.Usage, charge.Points, nil)
+	c.Data(http.StatusOK, "application/json", data)
+}
+
+// charge 查找请求的模型并按第一个部署扣除points返回的预扣积分，返回按顺序尝试的部署，失败时已返回错误。
+// 完成后按实际使用的路由的计费方式结算
+func (h *GatewayHandler) charge(c *gin.Context, name string, points func(m *model.Model) int) ([]model.Model, *service.Charge, bool) {
+	token := apiToken(c)
+	models, err := h.resolve(c, name)
+	if err != nil {
+		openAIError(c, http.StatusNotFound, "invalid_request_error", "model_not_found",
+			fmt.Sprintf("The model `%s` does not exist or you do not have access to it.", name))
+		return nil, nil, false
+	}
+	m := &models[0]
+
+	charge := &service.Charge{
+		UserID:    token.UserID,
+		ModelID:   m.ID,
+		Points:    points(m),
+		Source:    "api",
+		RequestID: newRequestID(),
+		TokenID:   token.ID,
+	}
+	if err := h.billingService.Consume(charge); err != nil {
+		switch {
+		case errors.Is(err, service.ErrInsufficientPoints):
+			openAIError(c, http.StatusTooManyRequests, "insufficient_quota", "insufficient_quota",
+				"You exceeded your current quota, please check your plan and billing details.")
+			return nil, nil, false
+		case errors.Is(err, service.ErrTokenQuotaExceeded):
+			openAIError(c, http.StatusTooManyRequests, "insufficient_quota", "insufficient_quota",
+				"You exceeded the points quota of this API key.")
+			return nil, nil, false
+		}
+		log.Printf("扣除积分失败: user=%d err=%v", charge.UserID, err)
+		openAIError(c, http.StatusInternalServerError, "server_error", "", "The server had an error while processing your request.")
+		return nil, nil, false
+	}
+
+	c.Header("X-Request-ID", charge.RequestID)
+	c.Header("X-Points-Charged", strconv.Itoa(charge.Points))
+	return models, charge, true
+}
+
+// moderationInput 记录输出审核事件使用的信息
+func moderationInput(charge *service.Charge, route *service.Route) moderation.Input {
+	return moderation.Input{UserID: charge.UserID, ModelID: route.Model.ID, Source: moderation.SourceCompletion}
+}
+
+// trace 开始记录请求的上游调用
+func (h *GatewayHandler) trace(charge *service.Charge, endpoint string, stream bool) *service.RequestTrace {
+	return h.requestLog.Trace(model.ModelRequest{
+		RequestID:        charge.RequestID,
+		UserID:           charge.UserID,
+		TokenID:          charge.TokenID,
+		Source:           charge.Source,
+		Endpoint:         endpoint,
+		RequestedModelID: charge.ModelID,
+		Stream:           stream,
+	})
+}
+
+// resolve 查找请求的模型：优先按别名选择部署，同一会话(X-Conversation-ID)在开启Sticky的别名下固定使用同一个部署；
+// 不是别名时按模型名查找
+func (h *GatewayHandler) resolve(c *gin.Context, name string) ([]model.Model, error) {
+	token := apiToken(c)
+	alias, err := h.aliasService.Resolve(name)
+	if err == nil {
+		alias = alias.Filter(token.AllowsModel)
+		if len(alias.Deployments) == 0 {
+			return nil, service.ErrAliasNotFound
+		}
+		session := ""
+		if conversation := c.GetHeader("X-Conversation-ID"); conversation != "" {
+			// 会话ID由调用方生成，加上用户ID避免不同用户的会话落到同一个键
+			session = strconv.FormatInt(token.UserID, 10) + ":" + conversation
+		}
+		return h.aliasService.Route(c.Request.Context(), alias, session), nil
+	}
+	if !errors.Is(err, service.ErrAliasNotFound) {
+		return nil, err
+	}
+
+	m, err := h.modelService.FindAvailableModel(name)
+	if err != nil {
+		return nil, err
+	}
+	if !token.AllowsModel(m.ID) {
+		return nil, errors.New("model not allowed")
+	}
+	return []model.Model{*m}, nil
+}
+
+// fail 上游调用失败时退还积分。上游的参数错误(400)原样返回，其余错误不暴露上游细节
+func (h *GatewayHandler) fail(c *gin.Context, charge *service.Charge, err error) {
+	if refundErr := h.billingService.Refund(charge); refundErr != nil {
+		log.Printf("退还积分失败: user=%d request=%s err=%v", charge.UserID, charge.RequestID, refundErr)
+	}
+	c.Header("X-Points-Charged", "0")
+	log.Printf("上游调用失败: request=%s err=%v", charge.RequestID, err)
+
+	var apiErr *relay.APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusBadRequest && json.Valid([]byte(apiErr.Body)) {
+		c.Data(http.StatusBadRequest, "application/json", []byte(apiErr.Body))
+		return
+	}
+	if errors.Is(err, service.ErrCircuitOpen) {
+		openAIError(c, http.StatusServiceUnavailable, "server_error", "", "The model is temporarily unavailable. Please try again later.")
+		return
+	}
+	openAIError(c, http.StatusBadGateway, "upstream_error", "", "The upstream model service is unavailable. Please try again later.")
+}
@@ -0,0 +1,220 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+
+	"cybermind/common/moderation"
+	"cybermind/model-service/internal/relay"
+)
+
+const (
+	promptBlockedMessage = "Your request was rejected as a result of our safety system."
+	outputBlockedMessage = "The response was blocked as a result of our safety system."
+)
+
+// contentFilterBody 内容被审核拦截时的OpenAI格式错误，用于流式输出的error分片
+func contentFilterBody(message string) []byte {
+	data, _ := json.Marshal(map[string]interface{}{
+		"error": map[string]interface{}{"message": message, "type": "invalid_request_error", "param": nil, "code": "content_filter"},
+	})
+	return data
+}
+
+// moderatePrompt 按chat-service相同的规则审核用户消息，命中打码规则时就地替换为打码后的文本，
+// 命中拦截规则时返回moderation.ErrBlocked。多模态消息逐个审核文本片段
+func moderatePrompt(ctx context.Context, moderator *moderation.Moderator, userID int64, messages []relay.ChatMessage) error {
+	review := func(text string) (string, error) {
+		if text == "" {
+			return text, nil
+		}
+		decision, err := moderator.Review(ctx, &moderation.Input{UserID: userID, Source: moderation.SourcePrompt, Text: text})
+		if err != nil {
+			return "", err
+		}
+		return decision.Text, nil
+	}
+
+	for i := range messages {
+		msg := &messages[i]
+		if moderation.SourceOf(msg.Role) != moderation.SourcePrompt {
+			continue
+		}
+		if msg.Content.Parts == nil {
+			text, err := review(msg.Content.Text)
+			if err != nil {
+				return err
+			}
+			msg.Content.Text = text
+			continue
+		}
+		for j := range msg.Content.Parts {
+			part := &msg.Content.Parts[j]
+			if part.Type != "text" {
+				continue
+			}
+			text, err := review(part.Text)
+			if err != nil {
+				return err
+			}
+			part.Text = text
+		}
+	}
+	return nil
+}
+
+// moderateResponse 审核非流式响应各候选结果的内容，命中打码规则时改写响应体，命中拦截规则时返回moderation.ErrBlocked
+func moderateResponse(ctx context.Context, moderator *moderation.Moderator, input moderation.Input, body []byte) ([]byte, error) {
+	var resp relay.ChatResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return body, nil
+	}
+
+	masked := make(map[int]string)
+	for _, choice := range resp.Choices {
+		input.Text = choice.Message.Content.String()
+		if input.Text == "" {
+			continue
+		}
+		decision, err := moderator.Review(ctx, &input)
+		if err != nil {
+			return nil, err
+		}
+		if decision.Text != input.Text {
+			masked[choice.Index] = decision.Text
+		}
+	}
+	if len(masked) == 0 {
+		return body, nil
+	}
+	return rewriteChoices(body, "message", masked)
+}
+
+// streamModeration 流式输出审核：每个候选结果使用一个StreamFilter，增量检查词库和正则并保留可能跨分片的尾部文本，
+// 候选结果结束时对全文运行审核模型，与chat-service的流式审核相同
+type streamModeration struct {
+	moderator *moderation.Moderator
+	ctx       context.Context
+	input     moderation.Input
+	filters   map[int]*moderation.StreamFilter
+	last      relay.ChatChunk // 最后一个分片，用于补发保留的尾部文本
+}
+
+func newStreamModeration(ctx context.Context, moderator *moderation.Moderator, input moderation.Input) *streamModeration {
+	input.Source = moderation.SourceCompletion
+	return &streamModeration{moderator: moderator, ctx: ctx, input: input, filters: make(map[int]*moderation.StreamFilter)}
+}
+
+// Chunk 审核分片中的输出内容，返回可以下发的分片；内容被保留或打码时改写分片，命中拦截规则时返回moderation.ErrBlocked
+func (m *streamModeration) Chunk(data []byte, chunk *relay.ChatChunk) ([]byte, error) {
+	m.last = *chunk
+	changed := make(map[int]string)
+	for _, choice := range chunk.Choices {
+		text := choice.Delta.Content.String()
+		filter, ok := m.filters[choice.Index]
+		if !ok {
+			if text == "" && choice.FinishReason == nil {
+				continue
+			}
+			filter = m.moderator.NewStreamFilter(m.ctx)
+			m.filters[choice.Index] = filter
+		}
+
+		safe, err := filter.Write(text)
+		if err != nil {
+			return nil, err
+		}
+		if choice.FinishReason != nil {
+			tail, err := filter.Flush()
+			if err != nil {
+				return nil, err
+			}
+			safe += tail
+			m.close(choice.Index)
+		}
+		if safe != text {
+			changed[choice.Index] = safe
+		}
+	}
+	if len(changed) == 0 {
+		return data, nil
+	}
+	return rewriteChoices(data, "delta", changed)
+}
+
+// Flush 输出结束时下发还没有结束的候选结果保留的尾部文本，没有需要下发的内容时返回nil
+func (m *streamModeration) Flush() ([]byte, error) {
+	indexes := make([]int, 0, len(m.filters))
+	for index := range m.filters {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+
+	var choices []relay.ChunkChoice
+	for _, index := range indexes {
+		tail, err := m.filters[index].Flush()
+		if err != nil {
+			return nil, err
+		}
+		m.close(index)
+		if tail != "" {
+			choices = append(choices, relay.ChunkChoice{Index: index, Delta: relay.ChatMessage{Content: relay.TextContent(tail)}})
+		}
+	}
+	if len(choices) == 0 {
+		return nil, nil
+	}
+	chunk := m.last
+	chunk.Choices, chunk.Usage = choices, nil
+	return json.Marshal(&chunk)
+}
+
+// Close 记录尚未记录的审核事件，输出中断或被拦截时调用
+func (m *streamModeration) Close() {
+	for index := range m.filters {
+		m.close(index)
+	}
+}
+
+// close 记录候选结果的审核事件
+func (m *streamModeration) close(index int) {
+	filter := m.filters[index]
+	if filter == nil {
+		return
+	}
+	delete(m.filters, index)
+	if decision := filter.Decision(); len(decision.Hits) > 0 {
+		input := m.input
+		input.Text = filter.Text()
+		m.moderator.Record(context.Background(), &input, decision)
+	}
+}
+
+// rewriteChoices 替换响应中候选结果的内容，field为message(非流式)或delta(流式)，其余字段原样保留
+func rewriteChoices(data []byte, field string, contents map[int]string) ([]byte, error) {
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(data, &body); err != nil {
+		return nil, err
+	}
+	var choices []map[string]json.RawMessage
+	if err := json.Unmarshal(body["choices"], &choices); err != nil {
+		return nil, err
+	}
+	for _, choice := range choices {
+		var index int
+		_ = json.Unmarshal(choice["index"], &index)
+		content, ok := contents[index]
+		if !ok {
+			continue
+		}
+		var msg map[string]json.RawMessage
+		if err := json.Unmarshal(choice[field], &msg); err != nil || msg == nil {
+			msg = make(map[string]json.RawMessage)
+		}
+		msg["content"], _ = json.Marshal(content)
+		choice[field], _ = json.Marshal(msg)
+	}
+	body["choices"], _ = json.Marshal(choices)
+	return json.Marshal(body)
+}
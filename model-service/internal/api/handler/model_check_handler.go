@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"cybermind/model-service/internal/service"
+)
+
+type ModelCheckHandler struct {
+	checkService *service.ModelCheckService
+}
+
+func NewModelCheckHandler(checkService *service.ModelCheckService) *ModelCheckHandler {
+	return &ModelCheckHandler{checkService: checkService}
+}
+
+// modelCheckRequest 连接测试选项，请求体可省略
+type modelCheckRequest struct {
+	Capabilities *bool `json:"capabilities"` // 是否检测流式输出、工具调用和视觉能力，默认检测
+	Save         bool  `json:"save"`         // 是否保存为最近一次的健康检查结果
+}
+
+// TestModel 使用模型自身的配置和Key测试连接
+func (h *ModelCheckHandler) TestModel(c *gin.Context) {
+	h.test(c, h.checkService.CheckModel, "模型不存在")
+}
+
+// TestAPIKey 使用Key池中的Key测试其所属模型的连接
+func (h *ModelCheckHandler) TestAPIKey(c *gin.Context) {
+	h.test(c, h.checkService.CheckAPIKey, "API Key不存在")
+}
+
+func (h *ModelCheckHandler) test(c *gin.Context, check func(ctx context.Context, id int64, capabilities bool) (*service.ModelCheckResult, error), notFound string) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    1001,
+			"message": "参数错误",
+		})
+		return
+	}
+
+	var req modelCheckRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    1001,
+				"message": "参数错误",
+			})
+			return
+		}
+	}
+	capabilities := req.Capabilities == nil || *req.Capabilities
+
+	result, err := check(c.Request.Context(), id, capabilities)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"code":    1004,
+			"message": notFound,
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    1005,
+			"message": "连接测试失败",
+		})
+		return
+	}
+
+	// 保存失败不影响返回测试结果
+	if req.Save {
+		if err := h.checkService.Save(result); err != nil {
+			log.Printf("保存健康检查结果失败: model=%d key=%d err=%v", result.ModelID, result.APIKeyID, err)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "success",
+		"data":    result,
+	})
+}
+
+// ListHealthChecks 获取模型及其Key最近一次保存的健康检查结果
+func (h *ModelCheckHandler) ListHealthChecks(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    1001,
+			"message": "参数错误",
+		})
+		return
+	}
+
+	checks, err := h.checkService.ListHealthChecks(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    1005,
+			"message": "获取健康检查结果失败",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "success",
+		"data":    checks,
+	})
+}
@@ -5,7 +5,10 @@ import (
 	"strconv"
 	"github.com/gin-gonic/gin"
 	"cybermind/model-service/internal/model"
+	"cybermind/model-service/internal/relay"
 	"cybermind/model-service/internal/service"
+	"cybermind/common/internalauth"
+	"cybermind/common/modelconfig"
 )
 
 type ModelHandler struct {
@@ -23,6 +26,16 @@ func (h *ModelHandler) CreateModel(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"code": 1001, "message": "Invalid parameters", "error": err.Error()})
 		return
 	}
+	if m.ProxyURL != "" {
+		if _, err := relay.ParseProxyURL(m.ProxyURL); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 1001, "message": "Invalid proxy_url", "error": err.Error()})
+			return
+		}
+	}
+	if errs := relay.ValidateConfig(&m); len(errs) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1001, "message": "Invalid config", "errors": errs})
+		return
+	}
 
 	if err := h.modelService.CreateModel(&m); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"code": 1005, "message": "Failed to create model", "error": err.Error()})
@@ -49,8 +62,9 @@ func (h *ModelHandler) GetModel(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "success", "data": m})
 }
 
-// UpdateModel 更新模型配置
+// UpdateModel 更新模型配置，请求头X-Admin-ID为操作的管理员，查询参数reason为变更原因，记录在模型的历史版本中
 func (h *ModelHandler) UpdateModel(c *gin.Context) {
+	change := modelChange(c)
 	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"code": 1001, "message": "Invalid ID", "error": err.Error()})
@@ -62,9 +76,19 @@ func (h *ModelHandler) UpdateModel(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"code": 1001, "message": "Invalid parameters", "error": err.Error()})
 		return
 	}
+	if m.ProxyURL != "" {
+		if _, err := relay.ParseProxyURL(m.ProxyURL); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 1001, "message": "Invalid proxy_url", "error": err.Error()})
+			return
+		}
+	}
+	if errs := relay.ValidateConfig(&m); len(errs) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1001, "message": "Invalid config", "errors": errs})
+		return
+	}
 	m.ID = id
 
-	if err := h.modelService.UpdateModel(&m); err != nil {
+	if err := h.modelService.UpdateModel(&m, change); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"code": 1005, "message": "Failed to update model", "error": err.Error()})
 		return
 	}
@@ -99,8 +123,9 @@ func (h *ModelHandler) DeleteModel(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "success"})
 }
 
-// UpdateModelStatus 更新模型状态
+// UpdateModelStatus 更新模型状态，请求头X-Admin-ID为操作的管理员，查询参数reason为变更原因
 func (h *ModelHandler) UpdateModelStatus(c *gin.Context) {
+	change := modelChange(c)
 	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"code": 1001, "message": "Invalid ID", "error": err.Error()})
@@ -115,10 +140,34 @@ func (h *ModelHandler) UpdateModelStatus(c *gin.Context) {
 		return
 	}
 
-	if err := h.modelService.UpdateModelStatus(id, req.Status); err != nil {
+	if err := h.modelService.UpdateModelStatus(id, req.Status, change); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"code": 1005, "message": "Failed to update model status", "error": err.Error()})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "success"})
-} 
\ No newline at end of file
+} 
+
+// modelChange 读取变更原因(查询参数reason)和操作的管理员。请求头X-Admin-ID只在同时携带有效的X-Internal-Token
+// (由内部服务代管理员调用)时采信，其他调用方无法证明身份，admin_id记为0
+func modelChange(c *gin.Context) service.ModelChange {
+	change := service.ModelChange{Reason: c.Query("reason")}
+	if internalauth.Verify(c) {
+		if adminID, err := strconv.ParseInt(c.GetHeader("X-Admin-ID"), 10, 64); err == nil && adminID > 0 {
+			change.AdminID = adminID
+		}
+	}
+	return change
+}
+
+// GetConfigSchemas 获取模型配置的schema，指定provider或api_type时只返回模型使用的适配器的schema
+func (h *ModelHandler) GetConfigSchemas(c *gin.Context) {
+	provider, apiType := c.Query("provider"), c.Query("api_type")
+	if provider == "" && apiType == "" {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "success", "data": modelconfig.Schemas()})
+		return
+	}
+
+	schema := modelconfig.SchemaFor(modelconfig.Adapter(provider, apiType))
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "success", "data": schema})
+}
@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -8,14 +9,17 @@ import (
 	"gorm.io/gorm"
 
 	"cybermind/model-service/internal/model"
+	"cybermind/model-service/internal/relay"
+	"cybermind/model-service/internal/service"
 )
 
 type ProviderHandler struct {
-	db *gorm.DB
+	db      *gorm.DB
+	catalog *service.CatalogService
 }
 
-func NewProviderHandler(db *gorm.DB) *ProviderHandler {
-	return &ProviderHandler{db: db}
+func NewProviderHandler(db *gorm.DB, catalog *service.CatalogService) *ProviderHandler {
+	return &ProviderHandler{db: db, catalog: catalog}
 }
 
 // ListProviders 获取供应商列表
@@ -208,3 +212,113 @@ func (h *ProviderHandler) DeleteProvider(c *gin.Context) {
 		"message": "success",
 	})
 }
+
+// SyncCatalog 获取供应商的上游模型列表，返回与已有模型的差异，请求体可省略
+func (h *ProviderHandler) SyncCatalog(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    1001,
+			"message": "参数错误",
+		})
+		return
+	}
+
+	var src service.CatalogSource
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&src); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    1001,
+				"message": "参数错误",
+			})
+			return
+		}
+	}
+
+	diff, err := h.catalog.Diff(c.Request.Context(), id, src)
+	if err != nil {
+		catalogError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "success",
+		"data":    diff,
+	})
+}
+
+// ImportCatalog 批量创建选中的上游模型，并更新供应商的模型数量
+func (h *ProviderHandler) ImportCatalog(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    1001,
+			"message": "参数错误",
+		})
+		return
+	}
+
+	var req service.CatalogImportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    1001,
+			"message": "参数错误",
+		})
+		return
+	}
+
+	result, fieldErrs, err := h.catalog.Import(c.Request.Context(), id, &req)
+	if err != nil {
+		catalogError(c, err)
+		return
+	}
+	if len(fieldErrs) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    1001,
+			"message": "模型配置错误",
+			"errors":  fieldErrs,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "success",
+		"data":    result,
+	})
+}
+
+// catalogError 同步模型目录失败的响应，上游返回错误时附带上游的错误响应体
+func catalogError(c *gin.Context, err error) {
+	var apiErr *relay.APIError
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"code":    1004,
+			"message": "供应商或模板模型不存在",
+		})
+	case errors.Is(err, service.ErrNoCatalogSource):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    1001,
+			"message": "供应商下还没有模型，请提供base_url和api_key",
+		})
+	case errors.As(err, &apiErr):
+		c.JSON(http.StatusBadGateway, gin.H{
+			"code":    1009,
+			"message": "获取上游模型列表失败",
+			"error":   apiErr.Body,
+		})
+	case errors.Is(err, service.ErrCatalogUpstream):
+		c.JSON(http.StatusBadGateway, gin.H{
+			"code":    1009,
+			"message": "获取上游模型列表失败",
+			"error":   err.Error(),
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    1005,
+			"message": "同步模型目录失败",
+		})
+	}
+}
@@ -0,0 +1,309 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"cybermind/model-service/internal/model"
+	"cybermind/model-service/internal/relay"
+	"cybermind/model-service/internal/service"
+)
+
+// RelayHandler 服务间调用的模型转发接口，负责扣费并调用上游模型
+type RelayHandler struct {
+	modelService   *service.ModelService
+	aliasService   *service.AliasService
+	billingService *service.BillingService
+	routeService   *service.RouteService
+	requestLog     *service.RequestLogger
+	client         *relay.Client
+}
+
+func NewRelayHandler(modelService *service.ModelService, aliasService *service.AliasService, billingService *service.BillingService, routeService *service.RouteService,
+	requestLog *service.RequestLogger, client *relay.Client) *RelayHandler {
+	return &RelayHandler{
+		modelService:   modelService,
+		aliasService:   aliasService,
+		billingService: billingService,
+		routeService:   routeService,
+		requestLog:     requestLog,
+		client:         client,
+	}
+}
+
+// relayRequest 转发请求：model_id/alias/conversation_id/user_id/source/request_id之外的字段为OpenAI格式的请求体。
+// model_id和alias二选一，使用alias时按别名的权重选择部署，conversation_id用于开启Sticky的别名固定会话的部署
+type relayRequest struct {
+	ModelID        int64  `json:"model_id" binding:"required_without=Alias"`
+	Alias          string `json:"alias"`
+	ConversationID string `json:"conversation_id"`
+	UserID         int64  `json:"user_id" binding:"required"`
+	Source         string `json:"source"`
+	RequestID      string `json:"request_id"`
+	relay.ChatRequest
+}
+
+// UnmarshalJSON ChatRequest自定义了JSON解析，需要单独解析转发参数，并避免转发参数作为未知字段发往上游
+func (r *relayRequest) UnmarshalJSON(data []byte) error {
+	var params struct {
+		ModelID        int64  `json:"model_id"`
+		Alias          string `json:"alias"`
+		ConversationID string `json:"conversation_id"`
+		UserID         int64  `json:"user_id"`
+		Source         string `json:"source"`
+		RequestID      string `json:"request_id"`
+	}
+	if err := json.Unmarshal(data, &params); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, &r.ChatRequest); err != nil {
+		return err
+	}
+	r.ModelID, r.Alias, r.ConversationID = params.ModelID, params.Alias, params.ConversationID
+	r.UserID, r.Source, r.RequestID = params.UserID, params.Source, params.RequestID
+	for _, name := range []string{"model_id", "alias", "conversation_id", "user_id", "source", "request_id"} {
+		delete(r.Extra, name)
+	}
+	return nil
+}
+
+// ChatCompletions 对话补全，按模型的计费方式扣费，上游调用失败时依次尝试备用路由，全部失败时退还积分。
+// 扣除的积分通过响应头X-Points-Charged返回，实际使用的路由通过X-Route-*响应头返回。
+// 按token计费时发送前按输入加max_tokens预扣最高价格，完成后按实际用量多退少补，输出中断或调用方断开时按已输出的内容结算；
+// 预扣按请求的模型计算，切换到备用路由时按备用路由的计费方式结算。
+// 流式输出在[DONE]或error分片之前通过{"points_charged":N}返回结算后的积分(按次计费且积分未变化时不返回)
+func (h *RelayHandler) ChatCompletions(c *gin.Context) {
+	var req relayRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1001, "message": "参数错误", "error": err.Error()})
+		return
+	}
+	if len(req.Messages) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1001, "message": "参数错误", "error": "messages is required"})
+		return
+	}
+
+	models, err := h.resolve(c.Request.Context(), &req)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 1004, "message": "模型不存在或已停用"})
+		return
+	}
+	m := &models[0]
+
+	if req.RequestID == "" {
+		req.RequestID = newRequestID()
+	}
+	charge := &service.Charge{
+		UserID:    req.UserID,
+		ModelID:   m.ID,
+		Points:    service.InitialPoints(m, &req.ChatRequest),
+		Source:    req.Source,
+		RequestID: req.RequestID,
+	}
+	if err := h.billingService.Consume(charge); err != nil {
+		if errors.Is(err, service.ErrInsufficientPoints) {
+			c.JSON(http.StatusPaymentRequired, gin.H{"code": 1008, "message": "积分不足"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 1005, "message": "扣费失败", "error": err.Error()})
+		return
+	}
+
+	c.Header("X-Request-ID", req.RequestID)
+	c.Header("X-Points-Charged", strconv.Itoa(charge.Points))
+
+	trace := h.requestLog.Trace(model.ModelRequest{
+		RequestID:        req.RequestID,
+		UserID:           req.UserID,
+		Source:           req.Source,
+		Endpoint:         "chat",
+		RequestedModelID: m.ID,
+		Stream:           req.Stream,
+	})
+	var resp *relay.ChatResponse
+	var stream *relay.Stream
+	route, err := h.routeService.DoModels(c.Request.Context(), models, nil, func(route *service.Route) error {
+		// 每条路由使用请求的副本，避免上一条路由的模型配置影响下一条
+		chatReq := req.ChatRequest
+		var err error
+		trace.Begin()
+		if req.Stream {
+			stream, err = h.client.ChatCompletionStream(c.Request.Context(), route.Model, &chatReq)
+		} else {
+			resp, err = h.client.ChatCompletion(c.Request.Context(), route.Model, &chatReq)
+		}
+		if err != nil {
+			trace.End(route, nil, 0, err)
+		}
+		return err
+	})
+	if err != nil {
+		h.fail(c, charge, err)
+		return
+	}
+	setRouteHeaders(c, route)
+
+	if !req.Stream {
+		settle(h.billingService, charge, route.Model, service.SettleUsage(route.Model, &req.ChatRequest, resp.Usage, service.ResponseTokens(resp)))
+		trace.End(route, resp.Usage, charge.Points, nil)
+		c.Header("X-Points-Charged", strconv.Itoa(charge.Points))
+		c.JSON(http.StatusOK, resp)
+		return
+	}
+	defer stream.Close()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Status(http.StatusOK)
+
+	var usage *relay.Usage
+	output := 0
+	// finish 按实际用量结算，上游没有返回用量时按已输出的内容估算
+	finish := func() {
+		precharged := charge.Points
+		settle(h.billingService, charge, route.Model, service.SettleUsage(route.Model, &req.ChatRequest, usage, output))
+		if route.Model.Pricing.TokenBased() || charge.Points != precharged {
+			fmt.Fprintf(c.Writer, "data: {\"points_charged\":%d}\n\n", charge.Points)
+		}
+	}
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			finish()
+			trace.End(route, usage, charge.Points, nil)
+			fmt.Fprint(c.Writer, "data: [DONE]\n\n")
+			c.Writer.Flush()
+			return
+		}
+		if err != nil {
+			// 已开始输出后不再退还积分，按已输出的内容结算后通过error分片通知调用方
+			h.routeService.Report(route, err)
+			finish()
+			trace.End(route, usage, charge.Points, err)
+			log.Printf("读取上游流式响应失败: model=%d request=%s err=%v", route.Model.ID, req.RequestID, err)
+			errBody := gin.H{"message": err.Error(), "type": "upstream_error"}
+			if errors.Is(err, relay.ErrContentBlocked) {
+				errBody = gin.H{"code": 1007, "message": "内容被模型安全策略拦截", "type": "content_filter"}
+			}
+			data, _ := json.Marshal(gin.H{"error": errBody})
+			fmt.Fprintf(c.Writer, "data: %s\n\n", data)
+			c.Writer.Flush()
+			return
+		}
+
+		trace.FirstChunk()
+		if chunk.Usage != nil {
+			usage = chunk.Usage
+		}
+		output += service.ChunkTokens(chunk)
+		data, _ := json.Marshal(chunk)
+		fmt.Fprintf(c.Writer, "data: %s\n\n", data)
+		c.Writer.Flush()
+	}
+}
+
+// Estimate 发送前预估请求扣除的积分，请求体与对话补全相同。按token计费时输入token数按消息长度估算，
+// min_points为输出为空时的积分，max_points为输出达到max_tokens时的积分，即发送时预扣的积分
+func (h *RelayHandler) Estimate(c *gin.Context) {
+	var req relayRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1001, "message": "参数错误", "error": err.Error()})
+		return
+	}
+
+	models, err := h.resolve(c.Request.Context(), &req)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 1004, "message": "模型不存在或已停用"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "success",
+		"data":    service.EstimatePrice(&models[0], &req.ChatRequest),
+	})
+}
+
+// resolve 查找请求的模型，返回按顺序尝试的部署
+func (h *RelayHandler) resolve(ctx context.Context, req *relayRequest) ([]model.Model, error) {
+	if req.Alias != "" {
+		alias, err := h.aliasService.Resolve(req.Alias)
+		if err != nil {
+			return nil, err
+		}
+		session := ""
+		if req.ConversationID != "" {
+			session = strconv.FormatInt(req.UserID, 10) + ":" + req.ConversationID
+		}
+		return h.aliasService.Route(ctx, alias, session), nil
+	}
+
+	m, err := h.modelService.GetModel(req.ModelID)
+	if err != nil {
+		return nil, err
+	}
+	if m.Status != 1 {
+		return nil, errors.New("model disabled")
+	}
+	return []model.Model{*m}, nil
+}
+
+// fail 上游调用失败时退还积分并返回错误，上游安全策略拦截时返回1007
+func (h *RelayHandler) fail(c *gin.Context, charge *service.Charge, err error) {
+	if refundErr := h.billingService.Refund(charge); refundErr != nil {
+		log.Printf("退还积分失败: user=%d request=%s err=%v", charge.UserID, charge.RequestID, refundErr)
+	}
+	c.Header("X-Points-Charged", "0")
+
+	if errors.Is(err, relay.ErrContentBlocked) {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1007, "message": "内容被模型安全策略拦截", "error": err.Error()})
+		return
+	}
+
+	resp := gin.H{"code": 1009, "message": "模型服务调用失败", "error": err.Error()}
+	var apiErr *relay.APIError
+	if errors.As(err, &apiErr) {
+		resp["upstream_status"] = apiErr.StatusCode
+	}
+	if errors.Is(err, service.ErrCircuitOpen) {
+		c.JSON(http.StatusServiceUnavailable, resp)
+		return
+	}
+	c.JSON(http.StatusBadGateway, resp)
+}
+
+// settle 按实际使用的路由m的计费方式结算积分：按次计费时为m的points_per_request，按token计费时按用量计算，
+// 没有用量或结算失败时保持预扣的积分
+func settle(billing *service.BillingService, charge *service.Charge, m *model.Model, usage *relay.Usage) {
+	points, ok := service.RoutePoints(m, usage)
+	if !ok {
+		return
+	}
+	if err := billing.Settle(charge, points); err != nil {
+		log.Printf("按用量结算积分失败: user=%d request=%s err=%v", charge.UserID, charge.RequestID, err)
+	}
+}
+
+// setRouteHeaders 通过响应头返回实际使用的路由
+func setRouteHeaders(c *gin.Context, route *service.Route) {
+	c.Header("X-Route-Model-ID", strconv.FormatInt(route.Model.ID, 10))
+	c.Header("X-Route-Provider", route.Model.Provider)
+	c.Header("X-Route-Fallback", strconv.FormatBool(route.Fallback))
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+
+	"cybermind/model-service/internal/model"
+	"cybermind/model-service/internal/service"
+)
+
+// RouteScoreHandler 部署得分查询，用于排查按得分路由的选择结果
+type RouteScoreHandler struct {
+	modelService *service.ModelService
+	aliasService *service.AliasService
+	scorer       *service.RouteScorer
+	breaker      *service.CircuitBreaker
+}
+
+func NewRouteScoreHandler(modelService *service.ModelService, aliasService *service.AliasService, scorer *service.RouteScorer, breaker *service.CircuitBreaker) *RouteScoreHandler {
+	return &RouteScoreHandler{modelService: modelService, aliasService: aliasService, scorer: scorer, breaker: breaker}
+}
+
+// routeScoreItem 部署的得分、统计和熔断状态，Weight为部署在别名下的权重，未指定别名时为空
+type routeScoreItem struct {
+	Name      string `json:"name"`
+	Provider  string `json:"provider"`
+	ModelName string `json:"model_name"`
+	Weight    *int   `json:"weight,omitempty"`
+	Circuit   string `json:"circuit"`
+	service.RouteStats
+}
+
+// ListRouteScores 获取部署的得分，指定alias时返回别名下的部署，否则返回所有可调用的模型，按得分从高到低排序
+func (h *RouteScoreHandler) ListRouteScores(c *gin.Context) {
+	var models []model.Model
+	weights := make(map[int64]int)
+	if name := c.Query("alias"); name != "" {
+		alias, err := h.aliasService.Resolve(name)
+		if errors.Is(err, service.ErrAliasNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"code":    1004,
+				"message": "别名不存在或没有可调用的部署",
+			})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code":    1005,
+				"message": "系统错误",
+			})
+			return
+		}
+		for _, d := range alias.Deployments {
+			models = append(models, d.Model)
+			weights[d.Model.ID] = d.Weight
+		}
+	} else {
+		var err error
+		if models, err = h.modelService.ListAvailableModels(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code":    1005,
+				"message": "系统错误",
+			})
+			return
+		}
+	}
+
+	ids := make([]int64, len(models))
+	for i, m := range models {
+		ids[i] = m.ID
+	}
+	// 统计数据读取失败时按未知部署返回
+	stats, err := h.scorer.Stats(c.Request.Context(), ids)
+	if err != nil {
+		log.Printf("读取部署得分失败: %v", err)
+	}
+
+	items := make([]routeScoreItem, len(models))
+	for i, m := range models {
+		items[i] = routeScoreItem{
+			Name:       m.Name,
+			Provider:   m.Provider,
+			ModelName:  m.ModelName,
+			Circuit:    h.breaker.State(c.Request.Context(), m.ID),
+			RouteStats: stats[m.ID],
+		}
+		if w, ok := weights[m.ID]; ok {
+			items[i].Weight = &w
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].Score > items[j].Score
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "success",
+		"data":    items,
+	})
+}
@@ -2,21 +2,48 @@ package router
 
 import (
 	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
 	"gorm.io/gorm"
 
+	"cybermind/common/internalauth"
+	"cybermind/common/moderation"
+	"cybermind/common/ratelimit"
 	"cybermind/model-service/internal/api/handler"
+	"cybermind/model-service/internal/model"
+	"cybermind/model-service/internal/relay"
 	"cybermind/model-service/internal/service"
 )
 
+// apiLimit 管理接口按IP限流
+var apiLimit = ratelimit.PerMinute(300)
+
+// gatewayLimits 平台API按令牌限流，按令牌所属用户的套餐等级区分
+var gatewayLimits = ratelimit.TierLimits{
+	ratelimit.TierFree:    ratelimit.PerMinute(20),
+	ratelimit.TierTrial:   ratelimit.PerMinute(30),
+	ratelimit.TierDaily:   ratelimit.PerMinute(60),
+	ratelimit.TierWeekly:  ratelimit.PerMinute(60),
+	ratelimit.TierMonthly: ratelimit.PerMinute(120),
+}
+
 // SetupRouter 设置路由
-func SetupRouter(db *gorm.DB) *gin.Engine {
+func SetupRouter(db *gorm.DB, rdb *redis.Client, relayClient *relay.Client, keyHealth *service.KeyHealthService, requestLog *service.RequestLogger, scorer *service.RouteScorer, moderator *moderation.Moderator) *gin.Engine {
 	r := gin.Default()
 
 	// 创建服务
 	modelService := service.NewModelService(db)
+	billingService := service.NewBillingService(db)
+	tokenService := service.NewTokenService(db)
+	breaker := service.NewCircuitBreaker(rdb, service.BreakerConfigFromEnv())
+	routeService := service.NewRouteService(db, modelService, service.NewKeySelector(db, rdb), keyHealth, breaker)
+	// 转发请求的调用结果计入部署得分，连接测试和Key探测不计入
+	observedClient := relayClient.WithObserver(scorer.Observe)
+	aliasService := service.NewAliasService(db, modelService, scorer)
+	limiter := ratelimit.NewLimiter(rdb, "model")
+	tiers := ratelimit.NewTierResolver(db, rdb)
 
 	// API v1
-	v1 := r.Group("/api/v1")
+	v1 := r.Group("/api/v1", limiter.Middleware("api", ratelimit.ByIP, ratelimit.Fixed(apiLimit)))
 	{
 		// 模型相关路由
 		modelHandler := handler.NewModelHandler(modelService)
@@ -25,21 +52,53 @@ func SetupRouter(db *gorm.DB) *gin.Engine {
 		v1.PUT("/models/:id", modelHandler.UpdateModel)
 		v1.PUT("/models/:id/status", modelHandler.UpdateModelStatus)
 		v1.DELETE("/models/:id", modelHandler.DeleteModel)
+		v1.GET("/config-schemas", modelHandler.GetConfigSchemas)
+
+		// 连接测试相关路由
+		modelCheckHandler := handler.NewModelCheckHandler(service.NewModelCheckService(db, relayClient))
+		v1.POST("/models/:id/test", modelCheckHandler.TestModel)
+		v1.GET("/models/:id/health-checks", modelCheckHandler.ListHealthChecks)
+		v1.POST("/api-keys/:id/test", modelCheckHandler.TestAPIKey)
 
 		// 供应商相关路由
-		providerHandler := handler.NewProviderHandler(db)
+		providerHandler := handler.NewProviderHandler(db, service.NewCatalogService(db, relayClient))
 		v1.GET("/providers", providerHandler.ListProviders)
 		v1.POST("/providers", providerHandler.CreateProvider)
 		v1.PUT("/providers/:id", providerHandler.UpdateProvider)
 		v1.PUT("/providers/:id/status", providerHandler.UpdateProviderStatus)
 		v1.DELETE("/providers/:id", providerHandler.DeleteProvider)
+		v1.POST("/providers/:id/catalog/sync", providerHandler.SyncCatalog)
+		v1.POST("/providers/:id/catalog/import", providerHandler.ImportCatalog)
 
 		// API Key 池相关路由
-		apiKeyPoolHandler := handler.NewAPIKeyPoolHandler(db)
+		apiKeyPoolHandler := handler.NewAPIKeyPoolHandler(db, keyHealth)
 		v1.GET("/api-keys", apiKeyPoolHandler.ListAPIKeyPools)
 		v1.POST("/api-keys", apiKeyPoolHandler.CreateAPIKeyPool)
 		v1.PUT("/api-keys/:id/status", apiKeyPoolHandler.UpdateAPIKeyPoolStatus)
+		v1.PUT("/api-keys/:id/weight", apiKeyPoolHandler.UpdateAPIKeyPoolWeight)
 		v1.DELETE("/api-keys/:id", apiKeyPoolHandler.DeleteAPIKeyPool)
+
+		// 部署得分
+		routeScoreHandler := handler.NewRouteScoreHandler(modelService, aliasService, scorer, breaker)
+		v1.GET("/route-scores", routeScoreHandler.ListRouteScores)
+	}
+
+	// 服务间调用接口(不对外暴露)
+	internal := r.Group("/internal/v1", internalauth.Middleware())
+	{
+		relayHandler := handler.NewRelayHandler(modelService, aliasService, billingService, routeService, requestLog, observedClient)
+		internal.POST("/chat/completions", relayHandler.ChatCompletions)
+		internal.POST("/chat/estimate", relayHandler.Estimate)
+	}
+
+	// 对外开放的OpenAI兼容接口，使用平台API令牌认证
+	gatewayHandler := handler.NewGatewayHandler(modelService, aliasService, billingService, tokenService,
+		routeService, requestLog, moderator, observedClient, limiter, tiers.Limits("user_id", gatewayLimits))
+	gateway := r.Group("/v1", gatewayHandler.Authenticate())
+	{
+		gateway.GET("/models", gatewayHandler.RequireScope(model.ScopeModels), gatewayHandler.ListModels)
+		gateway.POST("/chat/completions", gatewayHandler.RequireScope(model.ScopeChat), gatewayHandler.ChatCompletions)
+		gateway.POST("/embeddings", gatewayHandler.RequireScope(model.ScopeEmbeddings), gatewayHandler.Embeddings)
 	}
 
 	return r
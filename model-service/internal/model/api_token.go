@@ -0,0 +1,73 @@
+package model
+
+import (
+	"time"
+
+	"github.com/lib/pq"
+
+	"cybermind/common/apitoken"
+)
+
+// APITokenPrefix 平台API令牌的前缀
+const APITokenPrefix = apitoken.Prefix
+
+// 令牌权限范围，与auth-service一致，Scopes为空时拥有全部权限
+const (
+	ScopeModels     = "models"     // GET /v1/models
+	ScopeChat       = "chat"       // POST /v1/chat/completions
+	ScopeEmbeddings = "embeddings" // POST /v1/embeddings
+)
+
+// APIToken 用户调用平台API(/v1)使用的令牌，由auth-service创建和维护，这里只读取校验
+type APIToken struct {
+	ID          int64          `gorm:"primaryKey" json:"id"`
+	UserID      int64          `json:"user_id"`
+	Name        string         `json:"name"`
+	TokenHash   string         `json:"-"`
+	Prefix      string         `json:"prefix"`
+	Scopes      pq.StringArray `gorm:"type:text[]" json:"scopes"`
+	ModelIDs    pq.Int64Array  `gorm:"type:bigint[]" json:"model_ids"`
+	PointsQuota int            `json:"points_quota"` // 积分额度，为0时不限制
+	PointsUsed  int            `json:"points_used"`
+	AllowedIPs  pq.StringArray `gorm:"type:text[];column:allowed_ips" json:"allowed_ips"`
+	Status      int            `json:"status"` // 状态：1-启用，0-已吊销
+	ExpiresAt   *time.Time     `json:"expires_at,omitempty"`
+	LastUsedAt  *time.Time     `json:"last_used_at,omitempty"`
+	LastUsedIP  string         `json:"last_used_ip,omitempty"`
+}
+
+// TableName 指定表名
+func (APIToken) TableName() string {
+	return "api_tokens"
+}
+
+// TokenState 校验用到的令牌字段
+func (t *APIToken) TokenState() apitoken.State {
+	return apitoken.State{ID: t.ID, UserID: t.UserID, AllowedIPs: t.AllowedIPs, ExpiresAt: t.ExpiresAt, LastUsedAt: t.LastUsedAt}
+}
+
+// HasScope 令牌是否拥有权限范围
+func (t *APIToken) HasScope(scope string) bool {
+	if len(t.Scopes) == 0 {
+		return true
+	}
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsModel 令牌是否可以调用模型
+func (t *APIToken) AllowsModel(modelID int64) bool {
+	if len(t.ModelIDs) == 0 {
+		return true
+	}
+	for _, id := range t.ModelIDs {
+		if id == modelID {
+			return true
+		}
+	}
+	return false
+}
@@ -5,6 +5,14 @@ const (
 	ProviderOpenAI = "OpenAI"
 )
 
+// API Key池选择策略
+const (
+	KeyStrategyRoundRobin = "round_robin" // 轮询
+	KeyStrategyLeastUsed  = "least_used"  // 使用次数最少
+	KeyStrategyWeighted   = "weighted"    // 按权重随机
+	KeyStrategyRandom     = "random"      // 随机
+)
+
 // API基础URL
 const (
 	OpenAIBaseURL = "https://api.fast-tunnel.one"
@@ -20,8 +28,3 @@ var DefaultModelConfigs = map[string]ModelConfig{
 		PresencePenalty:  0.0,
 	},
 }
-
-// API密钥
-const (
-	OpenAIKey = "sk-kUNLgEMdDBf1LHWLB7C90674A2A54b99BeF5D5E8D39fD04e"
-) 
\ No newline at end of file
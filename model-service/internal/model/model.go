@@ -1,11 +1,16 @@
 package model
 
 import (
+	"database/sql/driver"
 	"encoding/json"
+	"fmt"
+	"os"
 	"time"
 
 	"github.com/lib/pq"
 	"gorm.io/gorm"
+
+	"cybermind/common/keycrypt"
 )
 
 // Model 表示AI模型配置
@@ -16,25 +21,100 @@ type Model struct {
 	APIType          string          `gorm:"size:20;not null;column:api_type" json:"api_type"`
 	BaseURL          string          `gorm:"size:255;not null" json:"base_url"`
 	ProxyURL         string          `gorm:"size:255" json:"proxy_url"`
-	APIKey           string          `gorm:"size:255;not null" json:"api_key"`
+	APIKey           SecretKey       `gorm:"type:text;not null" json:"api_key"`
 	ModelName        string          `gorm:"size:50;not null" json:"model_name"`
 	PointsPerRequest int             `gorm:"not null;column:points_per_request" json:"points_per_request"`
+	Pricing          ModelPricing    `gorm:"embedded;embeddedPrefix:pricing_" json:"pricing"`
 	Tags             pq.StringArray  `gorm:"type:text[];column:tags" json:"tags"`
 	Config           json.RawMessage `gorm:"type:jsonb" json:"config"`
-	Preset           string          `gorm:"type:text" json:"preset"` // 模型预设描述
+	Preset           string          `gorm:"type:text" json:"preset"`                                                                                          // 模型预设描述
+	KeyStrategy      string          `gorm:"size:20;default:round_robin" json:"key_strategy" binding:"omitempty,oneof=round_robin least_used weighted random"` // API Key池选择策略
 	Status           int             `gorm:"default:1" json:"status"`
 	CreatedAt        time.Time       `json:"created_at"`
 	UpdatedAt        time.Time       `json:"updated_at"`
 	DeletedAt        gorm.DeletedAt  `gorm:"index" json:"-"`
 }
 
+// 计费方式
+const (
+	PricingModeRequest = "request" // 按次计费，每次请求扣除PointsPerRequest
+	PricingModeToken   = "token"   // 按token计费，按实际用量和单价计算
+)
+
+// ModelPricing 模型的计费方式和token单价，单价为每1000个token的积分。
+// 按token计费时，命中缓存的输入token按CachedInputPrice计费(为0时按InputPrice)，单次不足MinPoints时按MinPoints计费
+type ModelPricing struct {
+	Mode             string  `gorm:"size:20;default:request" json:"mode" binding:"omitempty,oneof=request token"`
+	InputPrice       float64 `gorm:"type:numeric(12,4);default:0" json:"input_price" binding:"gte=0"`
+	OutputPrice      float64 `gorm:"type:numeric(12,4);default:0" json:"output_price" binding:"gte=0"`
+	CachedInputPrice float64 `gorm:"type:numeric(12,4);default:0" json:"cached_input_price" binding:"gte=0"`
+	MinPoints        int     `gorm:"default:0" json:"min_points" binding:"gte=0"`
+}
+
+// TokenBased 是否按token计费
+func (p ModelPricing) TokenBased() bool {
+	return p.Mode == PricingModeToken
+}
+
+// SecretKey 上游API Key：写入数据库时加密，读取时解密，输出JSON和日志时脱敏
+type SecretKey string
+
+// Value 使用keycrypt的默认主密钥加密，没有配置主密钥时以明文保存
+func (k SecretKey) Value() (driver.Value, error) {
+	return keycrypt.Encrypt(string(k))
+}
+
+// Scan 解密数据库中的值，尚未加密的旧数据原样读取
+func (k *SecretKey) Scan(src interface{}) error {
+	var value string
+	switch v := src.(type) {
+	case nil:
+	case string:
+		value = v
+	case []byte:
+		value = string(v)
+	default:
+		return fmt.Errorf("unsupported api key type %T", src)
+	}
+	plain, err := keycrypt.Decrypt(value)
+	if err != nil {
+		return err
+	}
+	*k = SecretKey(plain)
+	return nil
+}
+
+// MarshalJSON 输出脱敏后的Key，如sk-...d04e
+func (k SecretKey) MarshalJSON() ([]byte, error) {
+	return json.Marshal(keycrypt.Mask(string(k)))
+}
+
+// String 脱敏后的Key，避免通过日志泄露
+func (k SecretKey) String() string {
+	return keycrypt.Mask(string(k))
+}
+
 // ModelConfig 表示模型配置参数
 type ModelConfig struct {
+	Version          int     `json:"version,omitempty"` // 配置的schema版本，见modelconfig.SchemaVersion
 	Temperature      float64 `json:"temperature,omitempty"`
 	MaxTokens        int     `json:"max_tokens,omitempty"`
 	TopP             float64 `json:"top_p,omitempty"`
 	FrequencyPenalty float64 `json:"frequency_penalty,omitempty"`
 	PresencePenalty  float64 `json:"presence_penalty,omitempty"`
+
+	// Transport 上游连接配置，为空时使用供应商的默认值
+	Transport *TransportConfig `json:"transport,omitempty"`
+}
+
+// TransportConfig 上游连接配置，未设置的字段使用供应商的默认值
+type TransportConfig struct {
+	ConnectTimeout        int    `json:"connect_timeout,omitempty"`         // 建立连接(含代理握手)的超时(秒)
+	ResponseHeaderTimeout int    `json:"response_header_timeout,omitempty"` // 发送请求后等待响应头的超时(秒)
+	MaxIdleConnsPerHost   int    `json:"max_idle_conns_per_host,omitempty"` // 每个上游保持的空闲连接数
+	MaxConnsPerHost       int    `json:"max_conns_per_host,omitempty"`      // 每个上游的最大连接数，0不限制
+	TLSMinVersion         string `json:"tls_min_version,omitempty"`         // TLS最低版本：1.2/1.3
+	InsecureSkipVerify    bool   `json:"insecure_skip_verify,omitempty"`    // 跳过证书校验，仅用于自签名证书的内网网关
 }
 
 // Provider 供应商模型
@@ -50,17 +130,29 @@ type Provider struct {
 	DeletedAt  gorm.DeletedAt `gorm:"index" json:"-"`
 }
 
+// API Key状态
+const (
+	KeyStatusDisabled     = 0 // 手动停用
+	KeyStatusEnabled      = 1 // 启用
+	KeyStatusAutoDisabled = 2 // 上游认证失败自动停用，探测恢复后自动启用
+)
+
 // APIKeyPool API密钥池配置
 type APIKeyPool struct {
-	ID         int64          `gorm:"primaryKey" json:"id"`
-	ModelID    int64          `gorm:"not null;index" json:"model_id"`
-	APIKey     string         `gorm:"size:255;not null" json:"api_key"`
-	Status     int            `gorm:"default:1" json:"status"`      // 状态：1-启用，0-禁用
-	UsageCount int64          `gorm:"default:0" json:"usage_count"` // 使用次数
-	LastUsedAt *time.Time     `json:"last_used_at,omitempty"`       // 最后使用时间
-	CreatedAt  time.Time      `json:"created_at"`
-	UpdatedAt  time.Time      `json:"updated_at"`
-	DeletedAt  gorm.DeletedAt `gorm:"index" json:"-"`
+	ID            int64          `gorm:"primaryKey" json:"id"`
+	ModelID       int64          `gorm:"not null;index" json:"model_id"`
+	APIKey        SecretKey      `gorm:"type:text;not null" json:"api_key"`
+	Status        int            `gorm:"default:1" json:"status"`      // 状态：1-启用，0-禁用，2-自动停用
+	Weight        int            `gorm:"default:1" json:"weight"`      // 权重，用于weighted策略
+	UsageCount    int64          `gorm:"default:0" json:"usage_count"` // 使用次数
+	ErrorCount    int64          `gorm:"default:0" json:"error_count"` // 累计错误次数
+	LastError     string         `gorm:"size:500" json:"last_error"`   // 最近一次上游错误
+	LastErrorAt   *time.Time     `json:"last_error_at,omitempty"`
+	CooldownUntil *time.Time     `json:"cooldown_until,omitempty"` // 冷却结束时间，冷却期间不会被选中
+	LastUsedAt    *time.Time     `json:"last_used_at,omitempty"`   // 最后使用时间
+	CreatedAt     time.Time      `json:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+	DeletedAt     gorm.DeletedAt `gorm:"index" json:"-"`
 }
 
 // TableName 指定表名
@@ -97,7 +189,7 @@ func DefaultModels() []Model {
 			Provider:         ProviderOpenAI,
 			APIType:          "chat/completions",
 			BaseURL:          OpenAIBaseURL,
-			APIKey:           OpenAIKey,
+			APIKey:           SecretKey(os.Getenv("OPENAI_API_KEY")),
 			ModelName:        "gpt-4",
 			PointsPerRequest: 10,
 			Config:           configJSON,
@@ -115,3 +207,74 @@ func (p *Provider) UpdateModelCount(db *gorm.DB) error {
 	p.ModelCount = int(count)
 	return db.Model(p).Update("model_count", p.ModelCount).Error
 }
+
+// ModelFallback 模型的备用路由：模型调用失败或熔断时按Priority从小到大依次尝试备用模型
+type ModelFallback struct {
+	ID              int64     `gorm:"primaryKey" json:"id"`
+	ModelID         int64     `gorm:"not null;uniqueIndex:idx_model_fallback" json:"model_id"`
+	FallbackModelID int64     `gorm:"not null;uniqueIndex:idx_model_fallback" json:"fallback_model_id"`
+	Priority        int       `gorm:"default:0" json:"priority"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// TableName 指定表名
+func (ModelFallback) TableName() string {
+	return "model_fallbacks"
+}
+
+// ModelAlias 对外公开的模型别名：用户按Name调用，请求按权重分配到多个部署(Model)，
+// 调整权重即可切换流量，用户无感知。Sticky为true时同一会话始终路由到同一个部署
+type ModelAlias struct {
+	ID          int64     `gorm:"primaryKey" json:"id"`
+	Name        string    `gorm:"size:100;not null;uniqueIndex" json:"name"` // 调用时使用的模型名，优先于Model.ModelName匹配
+	DisplayName string    `gorm:"size:100" json:"display_name"`
+	Description string    `gorm:"type:text" json:"description"`
+	Sticky      bool      `gorm:"default:false" json:"sticky"`
+	Policy      string    `gorm:"size:20;default:'weighted'" json:"policy"` // 路由策略，见AliasPolicy*
+	Status      int       `gorm:"default:1" json:"status"`                  // 状态：1-启用，0-停用
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (ModelAlias) TableName() string {
+	return "model_aliases"
+}
+
+// 模型别名的路由策略
+const (
+	AliasPolicyWeighted = "weighted" // 按权重随机分配
+	AliasPolicyScore    = "score"    // 优先选择得分最高的部署，得分由首个分片耗时、完整响应耗时、错误率和限额余量计算
+)
+
+// ModelAliasTarget 别名下的部署及其流量权重，权重为0的部署不再分配新的流量，只作为故障转移的备用路由
+type ModelAliasTarget struct {
+	ID        int64     `gorm:"primaryKey" json:"id"`
+	AliasID   int64     `gorm:"not null;uniqueIndex:idx_model_alias_target" json:"alias_id"`
+	ModelID   int64     `gorm:"not null;uniqueIndex:idx_model_alias_target" json:"model_id"`
+	Weight    int       `gorm:"not null;default:0" json:"weight"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (ModelAliasTarget) TableName() string {
+	return "model_alias_targets"
+}
+
+// ModelHealthCheck 模型连接测试的最近一次结果，每个模型及其每个API Key各保留一条，APIKeyID为0时为模型自身的Key
+type ModelHealthCheck struct {
+	ID         int64           `gorm:"primaryKey" json:"id"`
+	ModelID    int64           `gorm:"not null;uniqueIndex:idx_model_health_check" json:"model_id"`
+	APIKeyID   int64           `gorm:"not null;default:0;uniqueIndex:idx_model_health_check" json:"api_key_id"`
+	Success    bool            `json:"success"`
+	StatusCode int             `json:"status_code"`              // 上游HTTP状态码，请求未到达上游时为0
+	LatencyMs  int64           `json:"latency_ms"`               // 基础对话补全的耗时
+	Result     json.RawMessage `gorm:"type:jsonb" json:"result"` // 完整的测试结果，包含能力检测
+	CheckedAt  time.Time       `json:"checked_at"`
+}
+
+// TableName 指定表名
+func (ModelHealthCheck) TableName() string {
+	return "model_health_checks"
+}
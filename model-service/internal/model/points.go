@@ -0,0 +1,31 @@
+package model
+
+import "time"
+
+// 积分流水类型
+const (
+	PointsTypeConsume = "consume" // 模型调用扣费
+	PointsTypeRefund  = "refund"  // 调用失败退还
+	PointsTypeAdjust  = "adjust"  // 按token计费时按实际用量多退少补
+	PointsTypeAdmin   = "admin"   // 管理员调整，由admin-service写入
+)
+
+// PointsLedger 积分流水，记录每次积分变动及变动后的余额
+type PointsLedger struct {
+	ID        int64     `gorm:"primaryKey" json:"id"`
+	UserID    int64     `gorm:"not null;index" json:"user_id"`
+	Change    int       `gorm:"not null" json:"change"`  // 变动积分，扣除为负数
+	Balance   int       `gorm:"not null" json:"balance"` // 变动后余额
+	Type      string    `gorm:"size:20;not null" json:"type"`
+	ModelID   int64     `gorm:"index" json:"model_id"`
+	Source    string    `gorm:"size:50" json:"source"` // 调用来源，如chat/compare/api
+	TokenID   int64     `gorm:"index" json:"token_id"` // 通过平台API调用时使用的令牌
+	RequestID string    `gorm:"size:64;index" json:"request_id"`
+	Remark    string    `gorm:"size:255" json:"remark"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+}
+
+// TableName 指定表名
+func (PointsLedger) TableName() string {
+	return "points_ledger"
+}
@@ -0,0 +1,37 @@
+package model
+
+import "time"
+
+// 上游调用状态
+const (
+	RequestStatusFailed   = 0 // 调用失败
+	RequestStatusSuccess  = 1 // 调用成功
+	RequestStatusCanceled = 2 // 调用方取消(如用户断开连接)
+)
+
+// ModelRequest 一次上游调用的记录。切换路由时每次尝试各记录一条，RequestID相同；
+// 用量和积分记录在最后一次调用上
+type ModelRequest struct {
+	ID               int64     `gorm:"primaryKey" json:"id"`
+	RequestID        string    `gorm:"size:64;index" json:"request_id"`
+	UserID           int64     `gorm:"not null;index" json:"user_id"`
+	TokenID          int64     `gorm:"index" json:"token_id"`              // 通过平台API调用时使用的令牌
+	Source           string    `gorm:"size:50" json:"source"`              // 调用来源，如chat/compare/api
+	Endpoint         string    `gorm:"size:20" json:"endpoint"`            // chat/embeddings
+	ModelID          int64     `gorm:"not null;index" json:"model_id"`     // 实际调用的模型
+	RequestedModelID int64     `gorm:"not null" json:"requested_model_id"` // 请求选中的模型，切换路由时与ModelID不同
+	KeyID            int64     `gorm:"not null;default:0" json:"key_id"`   // 使用的API Key池条目，为0时使用模型自身的Key
+	Fallback         bool      `gorm:"not null;default:false" json:"fallback"`
+	Stream           bool      `gorm:"not null;default:false" json:"stream"`
+	PromptTokens     int       `gorm:"not null;default:0" json:"prompt_tokens"`
+	CompletionTokens int       `gorm:"not null;default:0" json:"completion_tokens"`
+	CachedTokens     int       `gorm:"not null;default:0" json:"cached_tokens"`
+	TotalTokens      int       `gorm:"not null;default:0" json:"total_tokens"`
+	Points           int       `gorm:"not null;default:0" json:"points"`
+	Latency          int64     `gorm:"not null;default:0" json:"latency"`          // 完整响应耗时(毫秒)
+	TTFT             int64     `gorm:"column:ttft;not null;default:0" json:"ttft"` // 首个分片耗时(毫秒)，非流式请求与Latency相同
+	Status           int       `gorm:"not null;default:0;index" json:"status"`
+	ErrorCode        int       `gorm:"not null;default:0" json:"error_code"`      // 失败时的错误码，如1007/1009
+	UpstreamStatus   int       `gorm:"not null;default:0" json:"upstream_status"` // 上游返回的HTTP状态码，网络错误时为0
+	CreatedAt        time.Time `gorm:"index" json:"created_at"`
+}
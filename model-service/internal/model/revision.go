@@ -0,0 +1,26 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// 模型配置变更类型
+const (
+	RevisionActionUpdate   = "update"   // 修改模型配置
+	RevisionActionStatus   = "status"   // 启用或停用模型
+	RevisionActionRollback = "rollback" // 回滚到历史版本
+)
+
+// ModelRevision 模型配置的历史版本。每次更新模型前保存更新前的完整配置，版本号按模型从1递增，
+// 第N个版本为第N次变更之前的配置
+type ModelRevision struct {
+	ID        int64           `gorm:"primaryKey" json:"id"`
+	ModelID   int64           `gorm:"not null;uniqueIndex:idx_model_revision" json:"model_id"`
+	Version   int             `gorm:"not null;uniqueIndex:idx_model_revision" json:"version"`
+	Snapshot  json.RawMessage `gorm:"type:jsonb;not null" json:"-"` // models表的行(不含id、时间字段和api_key)
+	Action    string          `gorm:"size:20;not null" json:"action"`
+	AdminID   int64           `gorm:"not null;default:0" json:"admin_id"` // 0表示不是由管理员在admin-service中修改
+	Reason    string          `gorm:"size:255" json:"reason"`
+	CreatedAt time.Time       `json:"created_at"`
+}
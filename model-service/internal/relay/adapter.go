@@ -0,0 +1,230 @@
+package relay
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"cybermind/common/modelconfig"
+	"cybermind/model-service/internal/model"
+)
+
+// 适配器名称
+const (
+	AdapterOpenAI    = modelconfig.AdapterOpenAI
+	AdapterAnthropic = modelconfig.AdapterAnthropic
+	AdapterGemini    = modelconfig.AdapterGemini
+	AdapterGrok      = modelconfig.AdapterGrok
+)
+
+// Adapter 供应商接口适配器：将OpenAI格式的请求转换为供应商的原生请求，
+// 并将供应商的响应、流式分片和错误转换回OpenAI格式
+type Adapter interface {
+	// NewChatRequest 构造对话补全的上游请求，req已使用模型配置填充
+	NewChatRequest(ctx context.Context, m *model.Model, req *ChatRequest) (*http.Request, error)
+	// ConvertResponse 将上游的非流式响应体转换为OpenAI格式
+	ConvertResponse(m *model.Model, body []byte) ([]byte, error)
+	// NewChunkReader 将上游的流式响应转换为OpenAI格式的分片
+	NewChunkReader(m *model.Model, body io.Reader) ChunkReader
+	// ConvertError 将上游的错误响应体转换为OpenAI格式，无法识别时原样返回
+	ConvertError(body []byte) []byte
+	// NewProbeRequest 构造检查Key是否可用的上游请求
+	NewProbeRequest(ctx context.Context, m *model.Model, apiKey string) (*http.Request, error)
+	// NewModelListRequest 构造获取上游模型列表的请求，pageToken为上一页返回的翻页标记，第一页为空
+	NewModelListRequest(ctx context.Context, m *model.Model, pageToken string) (*http.Request, error)
+	// ConvertModelList 解析上游的模型列表，返回可用于对话补全的模型和下一页的翻页标记，没有下一页时为空
+	ConvertModelList(body []byte) ([]UpstreamModel, string, error)
+}
+
+// UpstreamModel 上游模型列表中的模型
+type UpstreamModel struct {
+	ID          string `json:"id"`                     // 上游模型名，即Model.ModelName
+	DisplayName string `json:"display_name,omitempty"` // 上游返回的展示名称
+	OwnedBy     string `json:"owned_by,omitempty"`
+}
+
+// EmbeddingAdapter 支持文本向量化的适配器
+type EmbeddingAdapter interface {
+	// NewEmbeddingRequest 构造文本向量化的上游请求，payload为OpenAI格式的请求体
+	NewEmbeddingRequest(ctx context.Context, m *model.Model, payload []byte) (*http.Request, error)
+}
+
+// ChunkReader 按顺序读取OpenAI格式的流式分片，流正常结束时返回io.EOF
+type ChunkReader interface {
+	Next() ([]byte, error)
+}
+
+var adapters = map[string]Adapter{
+	AdapterOpenAI:    openAIAdapter{},
+	AdapterAnthropic: anthropicAdapter{},
+	AdapterGemini:    geminiAdapter{},
+	AdapterGrok:      grokAdapter{},
+}
+
+// AdapterName 选择模型使用的适配器：优先按APIType，其次按供应商代码，都无法识别时按OpenAI兼容接口处理
+func AdapterName(m *model.Model) string {
+	return modelconfig.Adapter(m.Provider, m.APIType)
+}
+
+// ValidateConfig 按模型使用的适配器校验Config，返回所有字段的错误
+func ValidateConfig(m *model.Model) []modelconfig.FieldError {
+	return modelconfig.SchemaFor(AdapterName(m)).Validate(m.Config)
+}
+
+// AdapterFor 获取模型使用的适配器
+func AdapterFor(m *model.Model) Adapter {
+	return adapters[AdapterName(m)]
+}
+
+// now 生成响应时间戳，测试时替换
+var now = time.Now
+
+// newJSONRequest 构造JSON请求体的POST请求
+func newJSONRequest(ctx context.Context, url string, body interface{}, stream bool) (*http.Request, error) {
+	payload, ok := body.([]byte)
+	if !ok {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return nil, err
+		}
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if stream {
+		httpReq.Header.Set("Accept", "text/event-stream")
+	}
+	return httpReq, nil
+}
+
+// openAIErrorBody OpenAI格式的错误响应体
+func openAIErrorBody(message, typ string) []byte {
+	body, _ := json.Marshal(map[string]interface{}{
+		"error": map[string]interface{}{"message": message, "type": typ, "param": nil, "code": nil},
+	})
+	return body
+}
+
+// invalidRequest 请求无法转换为上游格式时返回的错误，与上游返回的400一样处理，不切换路由
+func invalidRequest(format string, args ...interface{}) *APIError {
+	return &APIError{
+		StatusCode: http.StatusBadRequest,
+		Body:       string(openAIErrorBody(fmt.Sprintf(format, args...), "invalid_request_error")),
+	}
+}
+
+// sseReader 读取SSE事件的data字段
+type sseReader struct {
+	scanner *bufio.Scanner
+}
+
+func newSSEReader(body io.Reader) *sseReader {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	return &sseReader{scanner: scanner}
+}
+
+// Next 读取下一个data字段，响应体结束时返回io.EOF，由各ChunkReader判断是否已收到结束事件
+func (r *sseReader) Next() ([]byte, error) {
+	for r.scanner.Scan() {
+		line := bytes.TrimSpace(r.scanner.Bytes())
+		if !bytes.HasPrefix(line, []byte("data:")) {
+			continue
+		}
+		// scanner的缓冲区会被下一次读取覆盖
+		return append([]byte(nil), bytes.TrimSpace(line[len("data:"):])...), nil
+	}
+	if err := r.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+// openAIAdapter OpenAI兼容接口，请求和响应原样转发
+type openAIAdapter struct{}
+
+func (openAIAdapter) NewChatRequest(ctx context.Context, m *model.Model, req *ChatRequest) (*http.Request, error) {
+	httpReq, err := newJSONRequest(ctx, Endpoint(m), req, req.Stream)
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Authorization", "Bearer "+string(m.APIKey))
+	return httpReq, nil
+}
+
+func (openAIAdapter) ConvertResponse(m *model.Model, body []byte) ([]byte, error) {
+	return body, nil
+}
+
+func (openAIAdapter) NewChunkReader(m *model.Model, body io.Reader) ChunkReader {
+	return &openAIChunkReader{sse: newSSEReader(body)}
+}
+
+func (openAIAdapter) ConvertError(body []byte) []byte {
+	return body
+}
+
+func (openAIAdapter) NewProbeRequest(ctx context.Context, m *model.Model, apiKey string) (*http.Request, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL(m)+"/models", nil)
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Authorization", "Bearer "+apiKey)
+	return httpReq, nil
+}
+
+func (a openAIAdapter) NewModelListRequest(ctx context.Context, m *model.Model, pageToken string) (*http.Request, error) {
+	return a.NewProbeRequest(ctx, m, string(m.APIKey))
+}
+
+// ConvertModelList 解析{"data":[{"id":...,"owned_by":...}]}，OpenAI的模型列表不分页
+func (openAIAdapter) ConvertModelList(body []byte) ([]UpstreamModel, string, error) {
+	var resp struct {
+		Data []UpstreamModel `json:"data"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, "", fmt.Errorf("decode upstream model list: %w", err)
+	}
+	return resp.Data, "", nil
+}
+
+func (openAIAdapter) NewEmbeddingRequest(ctx context.Context, m *model.Model, payload []byte) (*http.Request, error) {
+	httpReq, err := newJSONRequest(ctx, baseURL(m)+"/embeddings", payload, false)
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Authorization", "Bearer "+string(m.APIKey))
+	return httpReq, nil
+}
+
+// openAIChunkReader 读取OpenAI格式的SSE分片，遇到[DONE]时结束
+type openAIChunkReader struct {
+	sse  *sseReader
+	done bool
+}
+
+func (r *openAIChunkReader) Next() ([]byte, error) {
+	if r.done {
+		return nil, io.EOF
+	}
+	data, err := r.sse.Next()
+	if err == io.EOF {
+		// 正常结束时一定有[DONE]，没有时视为响应被截断
+		return nil, io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, err
+	}
+	if string(data) == "[DONE]" {
+		r.done = true
+		return nil, io.EOF
+	}
+	return data, nil
+}
@@ -0,0 +1,309 @@
+package relay
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"cybermind/model-service/internal/model"
+)
+
+// conformanceTarget 适配器测试使用的模型配置和期望的上游请求
+type conformanceTarget struct {
+	model      model.Model
+	path       string // 对话补全的上游路径
+	streamPath string // 流式对话补全的上游路径，为空时与path相同
+	authHeader string
+	authValue  string
+}
+
+var conformanceTargets = map[string]conformanceTarget{
+	AdapterOpenAI: {
+		model:      model.Model{Provider: "OpenAI", APIType: "chat/completions", ModelName: "gpt-4o-mini", APIKey: "sk-test"},
+		path:       "/v1/chat/completions",
+		authHeader: "Authorization",
+		authValue:  "Bearer sk-test",
+	},
+	AdapterAnthropic: {
+		model:      model.Model{Provider: "Anthropic", APIType: "messages", ModelName: "claude-sonnet-4-5", APIKey: "sk-ant-test"},
+		path:       "/v1/messages",
+		authHeader: "x-api-key",
+		authValue:  "sk-ant-test",
+	},
+	AdapterGemini: {
+		model:      model.Model{Provider: "Google", APIType: "gemini", ModelName: "gemini-2.5-flash", APIKey: "AIza-test"},
+		path:       "/v1beta/models/gemini-2.5-flash:generateContent",
+		streamPath: "/v1beta/models/gemini-2.5-flash:streamGenerateContent",
+		authHeader: "x-goog-api-key",
+		authValue:  "AIza-test",
+	},
+	AdapterGrok: {
+		model:      model.Model{Provider: "xAI", APIType: "chat/completions", ModelName: "grok-4", APIKey: "xai-test"},
+		path:       "/v1/chat/completions",
+		authHeader: "Authorization",
+		authValue:  "Bearer xai-test",
+	},
+}
+
+// TestAdapterConformance 按testdata/adapters/{适配器}/{用例}下录制的上游请求和响应，
+// 检查各适配器的请求转换、响应转换、流式分片转换和错误转换。
+// 用例文件：request.json为OpenAI格式的请求，upstream_request.json为期望发往上游的请求体，
+// upstream_response.json/.sse为上游响应，upstream_status为上游状态码(默认200)，
+// expected.json/expected_stream.jsonl/expected_error.json为期望的OpenAI格式输出，
+// expected_status为上游返回200但适配器应返回错误(如内容被拦截)时期望的状态码，
+// expected_stream_error.txt为流式输出中途出错时错误信息应包含的内容
+func TestAdapterConformance(t *testing.T) {
+	now = func() time.Time { return time.Unix(1700000000, 0) }
+	defer func() { now = time.Now }()
+
+	dirs, err := filepath.Glob(filepath.Join("testdata", "adapters", "*", "*"))
+	if err != nil || len(dirs) == 0 {
+		t.Fatalf("no conformance fixtures: %v", err)
+	}
+	for _, dir := range dirs {
+		adapter := filepath.Base(filepath.Dir(dir))
+		target, ok := conformanceTargets[adapter]
+		if !ok {
+			t.Fatalf("no conformance target for adapter %s", adapter)
+		}
+		t.Run(adapter+"/"+filepath.Base(dir), func(t *testing.T) {
+			runConformanceCase(t, dir, target)
+		})
+	}
+}
+
+func runConformanceCase(t *testing.T, dir string, target conformanceTarget) {
+	status := http.StatusOK
+	if data, err := os.ReadFile(filepath.Join(dir, "upstream_status")); err == nil {
+		status, _ = strconv.Atoi(strings.TrimSpace(string(data)))
+	}
+
+	wantStatus := status
+	if data, err := os.ReadFile(filepath.Join(dir, "expected_status")); err == nil {
+		wantStatus, _ = strconv.Atoi(strings.TrimSpace(string(data)))
+	}
+
+	var upstreamReq *http.Request
+	var upstreamBody []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamReq = r
+		upstreamBody, _ = io.ReadAll(r.Body)
+		if body, err := os.ReadFile(filepath.Join(dir, "upstream_response.sse")); err == nil {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.WriteHeader(status)
+			w.Write(body)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write(readFixture(t, dir, "upstream_response.json"))
+	}))
+	defer server.Close()
+
+	m := target.model
+	m.BaseURL = server.URL
+	var req ChatRequest
+	if err := json.Unmarshal(readFixture(t, dir, "request.json"), &req); err != nil {
+		t.Fatalf("decode request.json: %v", err)
+	}
+
+	client := NewClient()
+	var output [][]byte
+	var callErr error
+	if req.Stream {
+		var stream *Stream
+		stream, callErr = client.ChatCompletionStream(context.Background(), &m, &req)
+		if callErr == nil {
+			for {
+				data, _, err := stream.RecvRaw()
+				if err != nil {
+					if !errors.Is(err, io.EOF) {
+						callErr = err
+					}
+					break
+				}
+				output = append(output, data)
+			}
+			stream.Close()
+		}
+	} else {
+		var body []byte
+		body, _, callErr = client.ChatCompletionRaw(context.Background(), &m, &req)
+		output = append(output, body)
+	}
+
+	if upstreamReq == nil {
+		t.Fatalf("upstream was not called: %v", callErr)
+	}
+	wantPath := target.path
+	if req.Stream && target.streamPath != "" {
+		wantPath = target.streamPath
+	}
+	if upstreamReq.URL.Path != wantPath {
+		t.Errorf("upstream path = %s, want %s", upstreamReq.URL.Path, wantPath)
+	}
+	if got := upstreamReq.Header.Get(target.authHeader); got != target.authValue {
+		t.Errorf("upstream %s = %q, want %q", target.authHeader, got, target.authValue)
+	}
+	assertJSONEqual(t, "upstream request", upstreamBody, readFixture(t, dir, "upstream_request.json"))
+
+	if wantStatus != http.StatusOK {
+		var apiErr *APIError
+		if !errors.As(callErr, &apiErr) || apiErr.StatusCode != wantStatus {
+			t.Fatalf("error = %v, want APIError with status %d", callErr, wantStatus)
+		}
+		assertJSONEqual(t, "error body", []byte(apiErr.Body), readFixture(t, dir, "expected_error.json"))
+		return
+	}
+
+	if wantErr, err := os.ReadFile(filepath.Join(dir, "expected_stream_error.txt")); err == nil {
+		if callErr == nil || !strings.Contains(callErr.Error(), strings.TrimSpace(string(wantErr))) {
+			t.Errorf("stream error = %v, want %q", callErr, strings.TrimSpace(string(wantErr)))
+		}
+	} else if callErr != nil {
+		t.Fatalf("unexpected error: %v", callErr)
+	}
+
+	if !req.Stream {
+		assertJSONEqual(t, "response", output[0], readFixture(t, dir, "expected.json"))
+		return
+	}
+	var want []string
+	if data := strings.TrimSpace(string(readFixture(t, dir, "expected_stream.jsonl"))); data != "" {
+		want = strings.Split(data, "\n")
+	}
+	if len(output) != len(want) {
+		t.Fatalf("got %d chunks, want %d:\n%s", len(output), len(want), joinChunks(output))
+	}
+	for i := range want {
+		assertJSONEqual(t, "chunk "+strconv.Itoa(i), output[i], []byte(want[i]))
+	}
+}
+
+func readFixture(t *testing.T, dir, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+	return data
+}
+
+func assertJSONEqual(t *testing.T, what string, got, want []byte) {
+	t.Helper()
+	var g, w interface{}
+	if err := json.Unmarshal(got, &g); err != nil {
+		t.Fatalf("%s is not valid JSON: %v\n%s", what, err, got)
+	}
+	if err := json.Unmarshal(want, &w); err != nil {
+		t.Fatalf("expected %s is not valid JSON: %v", what, err)
+	}
+	if !reflect.DeepEqual(g, w) {
+		t.Errorf("%s mismatch\n got: %s\nwant: %s", what, got, want)
+	}
+}
+
+func joinChunks(chunks [][]byte) string {
+	lines := make([]string, len(chunks))
+	for i, c := range chunks {
+		lines[i] = string(c)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestAdapterName(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider string
+		apiType  string
+		want     string
+	}{
+		{name: "openai api type", provider: "OpenAI", apiType: "chat/completions", want: AdapterOpenAI},
+		{name: "messages api type", provider: "Other", apiType: "messages", want: AdapterAnthropic},
+		{name: "api type overrides provider", provider: "Anthropic", apiType: "chat/completions", want: AdapterOpenAI},
+		{name: "provider code", provider: "anthropic", apiType: "", want: AdapterAnthropic},
+		{name: "custom path", provider: "DeepSeek", apiType: "v2/chat", want: AdapterOpenAI},
+		{name: "gemini api type", provider: "Google", apiType: "gemini", want: AdapterGemini},
+		{name: "gemini provider code", provider: "google", apiType: "", want: AdapterGemini},
+		{name: "openai compatible provider", provider: "xAI", apiType: "chat/completions", want: AdapterGrok},
+		{name: "grok api type", provider: "Other", apiType: "grok", want: AdapterGrok},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := AdapterName(&model.Model{Provider: tt.provider, APIType: tt.apiType})
+			if got != tt.want {
+				t.Errorf("AdapterName() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestListModels(t *testing.T) {
+	tests := []struct {
+		name  string
+		model model.Model
+		pages map[string]string // 翻页参数 -> 上游响应
+		want  []string
+	}{
+		{
+			name:  "openai",
+			model: model.Model{Provider: "OpenAI", APIType: "chat/completions"},
+			pages: map[string]string{"": `{"object":"list","data":[{"id":"gpt-4o","owned_by":"openai"},{"id":"gpt-4o-mini","owned_by":"openai"}]}`},
+			want:  []string{"gpt-4o", "gpt-4o-mini"},
+		},
+		{
+			name:  "anthropic pages",
+			model: model.Model{Provider: "Anthropic", APIType: "messages"},
+			pages: map[string]string{
+				"":                  `{"data":[{"id":"claude-sonnet-4-5","display_name":"Claude Sonnet 4.5"}],"has_more":true,"last_id":"claude-sonnet-4-5"}`,
+				"claude-sonnet-4-5": `{"data":[{"id":"claude-haiku-4-5","display_name":"Claude Haiku 4.5"}],"has_more":false,"last_id":"claude-haiku-4-5"}`,
+			},
+			want: []string{"claude-sonnet-4-5", "claude-haiku-4-5"},
+		},
+		{
+			name:  "gemini generateContent only",
+			model: model.Model{Provider: "Google", APIType: "gemini"},
+			pages: map[string]string{"": `{"models":[{"name":"models/gemini-2.5-flash","displayName":"Gemini 2.5 Flash","supportedGenerationMethods":["generateContent","countTokens"]},{"name":"models/text-embedding-004","supportedGenerationMethods":["embedContent"]}]}`},
+			want:  []string{"gemini-2.5-flash"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				token := r.URL.Query().Get("after_id") + r.URL.Query().Get("pageToken")
+				body, ok := tt.pages[token]
+				if !ok {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(body))
+			}))
+			defer server.Close()
+
+			m := tt.model
+			m.BaseURL, m.APIKey = server.URL, "test-key"
+			models, err := NewClient().ListModels(context.Background(), &m)
+			if err != nil {
+				t.Fatalf("ListModels() error = %v", err)
+			}
+			got := make([]string, len(models))
+			for i, um := range models {
+				got[i] = um.ID
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ListModels() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,561 @@
+package relay
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"cybermind/model-service/internal/model"
+)
+
+const (
+	anthropicVersion          = "2023-06-01"
+	anthropicDefaultMaxTokens = 4096 // Messages API要求max_tokens，请求和模型配置都未指定时使用
+)
+
+// anthropicStopReasons Anthropic的stop_reason对应的OpenAI finish_reason
+var anthropicStopReasons = map[string]string{
+	"end_turn":      "stop",
+	"stop_sequence": "stop",
+	"pause_turn":    "stop",
+	"max_tokens":    "length",
+	"tool_use":      "tool_calls",
+	"refusal":       "content_filter",
+}
+
+// anthropicAdapter Anthropic Messages API(/v1/messages)
+type anthropicAdapter struct{}
+
+type anthropicRequest struct {
+	Model         string               `json:"model"`
+	System        string               `json:"system,omitempty"`
+	Messages      []anthropicMessage   `json:"messages"`
+	MaxTokens     int                  `json:"max_tokens"`
+	Temperature   *float64             `json:"temperature,omitempty"`
+	TopP          *float64             `json:"top_p,omitempty"`
+	TopK          json.RawMessage      `json:"top_k,omitempty"`
+	StopSequences []string             `json:"stop_sequences,omitempty"`
+	Stream        bool                 `json:"stream,omitempty"`
+	Tools         []anthropicTool      `json:"tools,omitempty"`
+	ToolChoice    *anthropicToolChoice `json:"tool_choice,omitempty"`
+	Thinking      json.RawMessage      `json:"thinking,omitempty"`
+	Metadata      *anthropicMetadata   `json:"metadata,omitempty"`
+}
+
+type anthropicMessage struct {
+	Role    string           `json:"role"`
+	Content []anthropicBlock `json:"content"`
+}
+
+// anthropicBlock 内容块：text/image/tool_use/tool_result/thinking
+type anthropicBlock struct {
+	Type      string                `json:"type"`
+	Text      string                `json:"text,omitempty"`
+	Source    *anthropicImageSource `json:"source,omitempty"`
+	ID        string                `json:"id,omitempty"`
+	Name      string                `json:"name,omitempty"`
+	Input     json.RawMessage       `json:"input,omitempty"`
+	ToolUseID string                `json:"tool_use_id,omitempty"`
+	Content   string                `json:"content,omitempty"`
+	Thinking  string                `json:"thinking,omitempty"`
+}
+
+type anthropicImageSource struct {
+	Type      string `json:"type"` // base64/url
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	URL       string `json:"url,omitempty"`
+}
+
+type anthropicTool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"input_schema"`
+}
+
+type anthropicToolChoice struct {
+	Type                   string `json:"type"` // auto/any/tool/none
+	Name                   string `json:"name,omitempty"`
+	DisableParallelToolUse bool   `json:"disable_parallel_tool_use,omitempty"`
+}
+
+type anthropicMetadata struct {
+	UserID string `json:"user_id"`
+}
+
+type anthropicUsage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+}
+
+// promptTokens 输入token数，包含写入和命中缓存的部分
+func (u anthropicUsage) promptTokens() int {
+	return u.InputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens
+}
+
+type anthropicResponse struct {
+	ID         string           `json:"id"`
+	Model      string           `json:"model"`
+	Content    []anthropicBlock `json:"content"`
+	StopReason string           `json:"stop_reason"`
+	Usage      anthropicUsage   `json:"usage"`
+}
+
+type anthropicError struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+// anthropicEvent 流式事件：message_start/content_block_start/content_block_delta/content_block_stop/
+// message_delta/message_stop/ping/error
+type anthropicEvent struct {
+	Type         string             `json:"type"`
+	Message      *anthropicResponse `json:"message"`
+	Index        int                `json:"index"`
+	ContentBlock *anthropicBlock    `json:"content_block"`
+	Delta        struct {
+		Type        string `json:"type"`
+		Text        string `json:"text"`
+		PartialJSON string `json:"partial_json"`
+		StopReason  string `json:"stop_reason"`
+	} `json:"delta"`
+	Usage *anthropicUsage `json:"usage"`
+	Error *anthropicError `json:"error"`
+}
+
+func anthropicHeaders(httpReq *http.Request, apiKey string) {
+	httpReq.Header.Set("x-api-key", apiKey)
+	httpReq.Header.Set("anthropic-version", anthropicVersion)
+}
+
+func (a anthropicAdapter) NewChatRequest(ctx context.Context, m *model.Model, req *ChatRequest) (*http.Request, error) {
+	body, err := a.convertRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	httpReq, err := newJSONRequest(ctx, baseURL(m)+"/messages", body, req.Stream)
+	if err != nil {
+		return nil, err
+	}
+	anthropicHeaders(httpReq, string(m.APIKey))
+	return httpReq, nil
+}
+
+// convertRequest system消息合并为system参数，tool消息转换为tool_result内容块，
+// 连续的同角色消息合并为一条(Messages API要求user和assistant交替)
+func (anthropicAdapter) convertRequest(req *ChatRequest) (*anthropicRequest, error) {
+	out := &anthropicRequest{
+		Model:         req.Model,
+		MaxTokens:     anthropicDefaultMaxTokens,
+		Temperature:   req.Temperature,
+		TopP:          req.TopP,
+		StopSequences: req.Stop,
+		Stream:        req.Stream,
+		TopK:          req.Extra["top_k"],
+		Thinking:      req.Extra["thinking"],
+	}
+	if req.MaxTokens != nil {
+		out.MaxTokens = *req.MaxTokens
+	} else if raw, ok := req.Extra["max_completion_tokens"]; ok {
+		if err := json.Unmarshal(raw, &out.MaxTokens); err != nil {
+			return nil, invalidRequest("Invalid 'max_completion_tokens': expected an integer.")
+		}
+	}
+	// OpenAI的temperature范围为0~2，Anthropic为0~1
+	if out.Temperature != nil && *out.Temperature > 1 {
+		t := 1.0
+		out.Temperature = &t
+	}
+	if req.User != "" {
+		out.Metadata = &anthropicMetadata{UserID: req.User}
+	}
+
+	var system []string
+	for i, msg := range req.Messages {
+		var role string
+		var blocks []anthropicBlock
+		switch msg.Role {
+		case "system", "developer":
+			system = append(system, msg.Content.String())
+			continue
+		case "user":
+			role = "user"
+			for _, part := range contentParts(msg.Content) {
+				block, err := anthropicContentBlock(part)
+				if err != nil {
+					return nil, invalidRequest("Invalid 'messages[%d].content': %v", i, err)
+				}
+				if block != nil {
+					blocks = append(blocks, *block)
+				}
+			}
+		case "assistant":
+			role = "assistant"
+			if text := msg.Content.String(); text != "" {
+				blocks = append(blocks, anthropicBlock{Type: "text", Text: text})
+			}
+			for _, call := range msg.ToolCalls {
+				input := json.RawMessage(call.Function.Arguments)
+				if strings.TrimSpace(call.Function.Arguments) == "" {
+					input = json.RawMessage("{}")
+				} else if !json.Valid(input) {
+					return nil, invalidRequest("Invalid 'messages[%d].tool_calls': arguments must be valid JSON.", i)
+				}
+				blocks = append(blocks, anthropicBlock{Type: "tool_use", ID: call.ID, Name: call.Function.Name, Input: input})
+			}
+		case "tool":
+			role = "user"
+			blocks = append(blocks, anthropicBlock{Type: "tool_result", ToolUseID: msg.ToolCallID, Content: msg.Content.String()})
+		default:
+			return nil, invalidRequest("Invalid 'messages[%d].role': unsupported role '%s'.", i, msg.Role)
+		}
+		if len(blocks) == 0 {
+			continue
+		}
+
+		if n := len(out.Messages); n > 0 && out.Messages[n-1].Role == role {
+			out.Messages[n-1].Content = append(out.Messages[n-1].Content, blocks...)
+		} else {
+			out.Messages = append(out.Messages, anthropicMessage{Role: role, Content: blocks})
+		}
+	}
+	out.System = strings.Join(system, "\n\n")
+
+	if err := convertAnthropicTools(req, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// contentParts 将纯文本内容作为单个文本片段处理
+func contentParts(c MessageContent) []ContentPart {
+	if c.Parts != nil {
+		return c.Parts
+	}
+	return []ContentPart{{Type: "text", Text: c.Text}}
+}
+
+// anthropicContentBlock 转换用户消息的内容片段，空文本返回nil
+func anthropicContentBlock(part ContentPart) (*anthropicBlock, error) {
+	switch part.Type {
+	case "text":
+		if part.Text == "" {
+			return nil, nil
+		}
+		return &anthropicBlock{Type: "text", Text: part.Text}, nil
+	case "image_url":
+		if part.ImageURL == nil || part.ImageURL.URL == "" {
+			return nil, fmt.Errorf("image_url is required")
+		}
+		url := part.ImageURL.URL
+		if !strings.HasPrefix(url, "data:") {
+			return &anthropicBlock{Type: "image", Source: &anthropicImageSource{Type: "url", URL: url}}, nil
+		}
+		mediaType, data, ok := parseDataURL(url)
+		if !ok {
+			return nil, fmt.Errorf("only base64 data URLs are supported")
+		}
+		return &anthropicBlock{Type: "image", Source: &anthropicImageSource{Type: "base64", MediaType: mediaType, Data: data}}, nil
+	}
+	return nil, fmt.Errorf("unsupported content type '%s'", part.Type)
+}
+
+// parseDataURL 解析data:{media_type};base64,{data}格式的地址
+func parseDataURL(url string) (mediaType, data string, ok bool) {
+	meta, data, found := strings.Cut(strings.TrimPrefix(url, "data:"), ",")
+	if !found || !strings.HasSuffix(meta, ";base64") {
+		return "", "", false
+	}
+	return strings.TrimSuffix(meta, ";base64"), data, true
+}
+
+// convertAnthropicTools 转换OpenAI格式的tools、tool_choice和parallel_tool_calls
+func convertAnthropicTools(req *ChatRequest, out *anthropicRequest) error {
+	if raw, ok := req.Extra["tools"]; ok {
+		var tools []struct {
+			Type     string `json:"type"`
+			Function struct {
+				Name        string          `json:"name"`
+				Description string          `json:"description"`
+				Parameters  json.RawMessage `json:"parameters"`
+			} `json:"function"`
+		}
+		if err := json.Unmarshal(raw, &tools); err != nil {
+			return invalidRequest("Invalid 'tools': %v", err)
+		}
+		for i, t := range tools {
+			if t.Type != "function" || t.Function.Name == "" {
+				return invalidRequest("Invalid 'tools[%d]': only function tools are supported.", i)
+			}
+			schema := t.Function.Parameters
+			if len(schema) == 0 || string(schema) == "null" {
+				schema = json.RawMessage(`{"type":"object","properties":{}}`)
+			}
+			out.Tools = append(out.Tools, anthropicTool{Name: t.Function.Name, Description: t.Function.Description, InputSchema: schema})
+		}
+	}
+
+	if raw, ok := req.Extra["tool_choice"]; ok {
+		var mode string
+		if json.Unmarshal(raw, &mode) == nil {
+			switch mode {
+			case "auto":
+				out.ToolChoice = &anthropicToolChoice{Type: "auto"}
+			case "required":
+				out.ToolChoice = &anthropicToolChoice{Type: "any"}
+			case "none":
+				out.ToolChoice = &anthropicToolChoice{Type: "none"}
+			default:
+				return invalidRequest("Invalid 'tool_choice': unsupported value '%s'.", mode)
+			}
+		} else {
+			var choice struct {
+				Function struct {
+					Name string `json:"name"`
+				} `json:"function"`
+			}
+			if err := json.Unmarshal(raw, &choice); err != nil || choice.Function.Name == "" {
+				return invalidRequest("Invalid 'tool_choice': expected a string or a function object.")
+			}
+			out.ToolChoice = &anthropicToolChoice{Type: "tool", Name: choice.Function.Name}
+		}
+	}
+
+	var parallel bool
+	if raw, ok := req.Extra["parallel_tool_calls"]; ok && json.Unmarshal(raw, &parallel) == nil && !parallel && len(out.Tools) > 0 {
+		if out.ToolChoice == nil {
+			out.ToolChoice = &anthropicToolChoice{Type: "auto"}
+		}
+		out.ToolChoice.DisableParallelToolUse = true
+	}
+	return nil
+}
+
+// ConvertResponse 文本块按顺序拼接为content，tool_use块转换为tool_calls，thinking块不返回
+func (anthropicAdapter) ConvertResponse(m *model.Model, body []byte) ([]byte, error) {
+	var resp anthropicResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("decode upstream response: %w", err)
+	}
+
+	msg := ChatMessage{Role: "assistant"}
+	var text strings.Builder
+	for _, block := range resp.Content {
+		switch block.Type {
+		case "text":
+			text.WriteString(block.Text)
+		case "tool_use":
+			var args bytes.Buffer
+			if err := json.Compact(&args, block.Input); err != nil {
+				return nil, fmt.Errorf("decode upstream tool input: %w", err)
+			}
+			msg.ToolCalls = append(msg.ToolCalls, ToolCall{
+				ID:       block.ID,
+				Type:     "function",
+				Function: ToolCallFunction{Name: block.Name, Arguments: args.String()},
+			})
+		}
+	}
+	msg.Content = TextContent(text.String())
+
+	prompt := resp.Usage.promptTokens()
+	return json.Marshal(ChatResponse{
+		ID:      resp.ID,
+		Object:  "chat.completion",
+		Created: now().Unix(),
+		Model:   resp.Model,
+		Choices: []Choice{{Index: 0, Message: msg, FinishReason: anthropicStopReasons[resp.StopReason]}},
+		Usage: &Usage{
+			PromptTokens:        prompt,
+			CompletionTokens:    resp.Usage.OutputTokens,
+			TotalTokens:         prompt + resp.Usage.OutputTokens,
+			PromptTokensDetails: cachedDetails(resp.Usage.CacheReadInputTokens),
+		},
+	})
+}
+
+func (anthropicAdapter) NewChunkReader(m *model.Model, body io.Reader) ChunkReader {
+	return &anthropicChunkReader{sse: newSSEReader(body), created: now().Unix(), toolIndex: make(map[int]int)}
+}
+
+// ConvertError 将{"type":"error","error":{"type":...,"message":...}}转换为OpenAI格式
+func (anthropicAdapter) ConvertError(body []byte) []byte {
+	var resp struct {
+		Error *anthropicError `json:"error"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil || resp.Error == nil || resp.Error.Message == "" {
+		return body
+	}
+	return openAIErrorBody(resp.Error.Message, resp.Error.Type)
+}
+
+func (anthropicAdapter) NewProbeRequest(ctx context.Context, m *model.Model, apiKey string) (*http.Request, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL(m)+"/models", nil)
+	if err != nil {
+		return nil, err
+	}
+	anthropicHeaders(httpReq, apiKey)
+	return httpReq, nil
+}
+
+// NewModelListRequest 每页最多1000个，按after_id翻页
+func (anthropicAdapter) NewModelListRequest(ctx context.Context, m *model.Model, pageToken string) (*http.Request, error) {
+	query := url.Values{"limit": {"1000"}}
+	if pageToken != "" {
+		query.Set("after_id", pageToken)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL(m)+"/models?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	anthropicHeaders(httpReq, string(m.APIKey))
+	return httpReq, nil
+}
+
+// ConvertModelList 解析{"data":[{"id":...,"display_name":...}],"has_more":...,"last_id":...}
+func (anthropicAdapter) ConvertModelList(body []byte) ([]UpstreamModel, string, error) {
+	var resp struct {
+		Data    []UpstreamModel `json:"data"`
+		HasMore bool            `json:"has_more"`
+		LastID  string          `json:"last_id"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, "", fmt.Errorf("decode upstream model list: %w", err)
+	}
+	for i := range resp.Data {
+		resp.Data[i].OwnedBy = "anthropic"
+	}
+	if !resp.HasMore {
+		return resp.Data, "", nil
+	}
+	return resp.Data, resp.LastID, nil
+}
+
+// anthropicChunkReader 将Anthropic的流式事件转换为OpenAI格式的分片，用量在message_stop时作为最后一个分片返回
+type anthropicChunkReader struct {
+	sse       *sseReader
+	id        string
+	model     string
+	created   int64
+	usage     anthropicUsage
+	toolIndex map[int]int // 内容块序号 -> 工具调用序号
+	done      bool
+}
+
+func (r *anthropicChunkReader) Next() ([]byte, error) {
+	for !r.done {
+		data, err := r.sse.Next()
+		if err == io.EOF {
+			// 正常结束时一定有message_stop事件
+			return nil, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var ev anthropicEvent
+		if err := json.Unmarshal(data, &ev); err != nil {
+			return nil, fmt.Errorf("decode upstream event: %w", err)
+		}
+		chunk, err := r.convert(&ev)
+		if err != nil {
+			return nil, err
+		}
+		if chunk != nil {
+			return json.Marshal(chunk)
+		}
+	}
+	return nil, io.EOF
+}
+
+func (r *anthropicChunkReader) chunk(delta ChatMessage, finishReason *string) *ChatChunk {
+	return &ChatChunk{
+		ID:      r.id,
+		Object:  "chat.completion.chunk",
+		Created: r.created,
+		Model:   r.model,
+		Choices: []ChunkChoice{{Index: 0, Delta: delta, FinishReason: finishReason}},
+	}
+}
+
+// convert 转换单个事件，不需要输出分片的事件返回nil
+func (r *anthropicChunkReader) convert(ev *anthropicEvent) (*ChatChunk, error) {
+	switch ev.Type {
+	case "message_start":
+		if ev.Message != nil {
+			r.id, r.model, r.usage = ev.Message.ID, ev.Message.Model, ev.Message.Usage
+		}
+		return r.chunk(ChatMessage{Role: "assistant"}, nil), nil
+	case "content_block_start":
+		if ev.ContentBlock == nil {
+			return nil, nil
+		}
+		switch ev.ContentBlock.Type {
+		case "text":
+			if ev.ContentBlock.Text != "" {
+				return r.chunk(ChatMessage{Content: TextContent(ev.ContentBlock.Text)}, nil), nil
+			}
+		case "tool_use":
+			index := len(r.toolIndex)
+			r.toolIndex[ev.Index] = index
+			return r.chunk(ChatMessage{ToolCalls: []ToolCall{{
+				Index:    &index,
+				ID:       ev.ContentBlock.ID,
+				Type:     "function",
+				Function: ToolCallFunction{Name: ev.ContentBlock.Name},
+			}}}, nil), nil
+		}
+	case "content_block_delta":
+		switch ev.Delta.Type {
+		case "text_delta":
+			return r.chunk(ChatMessage{Content: TextContent(ev.Delta.Text)}, nil), nil
+		case "input_json_delta":
+			index, ok := r.toolIndex[ev.Index]
+			if !ok || ev.Delta.PartialJSON == "" {
+				return nil, nil
+			}
+			return r.chunk(ChatMessage{ToolCalls: []ToolCall{{
+				Index:    &index,
+				Function: ToolCallFunction{Arguments: ev.Delta.PartialJSON},
+			}}}, nil), nil
+		}
+	case "message_delta":
+		if ev.Usage != nil {
+			r.usage.OutputTokens = ev.Usage.OutputTokens
+		}
+		if ev.Delta.StopReason == "" {
+			return nil, nil
+		}
+		reason := anthropicStopReasons[ev.Delta.StopReason]
+		return r.chunk(ChatMessage{}, &reason), nil
+	case "message_stop":
+		r.done = true
+		prompt := r.usage.promptTokens()
+		return &ChatChunk{
+			ID:      r.id,
+			Object:  "chat.completion.chunk",
+			Created: r.created,
+			Model:   r.model,
+			Choices: []ChunkChoice{},
+			Usage: &Usage{
+				PromptTokens:        prompt,
+				CompletionTokens:    r.usage.OutputTokens,
+				TotalTokens:         prompt + r.usage.OutputTokens,
+				PromptTokensDetails: cachedDetails(r.usage.CacheReadInputTokens),
+			},
+		}, nil
+	case "error":
+		if ev.Error != nil {
+			return nil, fmt.Errorf("upstream stream error: %s: %s", ev.Error.Type, ev.Error.Message)
+		}
+		return nil, fmt.Errorf("upstream stream error")
+	}
+	return nil, nil
+}
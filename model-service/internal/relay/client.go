@@ -0,0 +1,324 @@
+package relay
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"cybermind/model-service/internal/model"
+)
+
+// ErrContentBlocked 上游因安全策略拦截了输入或输出
+var ErrContentBlocked = errors.New("content blocked by upstream safety policy")
+
+// APIError 上游接口返回的错误
+type APIError struct {
+	StatusCode int
+	Body       string
+	RetryAfter time.Duration // 上游通过Retry-After要求的等待时间，未返回时为0
+	Err        error         // 错误类型，如ErrContentBlocked
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("upstream returned status %d: %s", e.StatusCode, e.Body)
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+// contentBlocked 上游拦截内容时返回的错误，按400处理，不切换路由
+func contentBlocked(reason string) *APIError {
+	body, _ := json.Marshal(map[string]interface{}{
+		"error": map[string]interface{}{
+			"message": fmt.Sprintf("The request was blocked by the upstream safety policy (%s).", reason),
+			"type":    "invalid_request_error",
+			"param":   nil,
+			"code":    "content_filter",
+		},
+	})
+	return &APIError{StatusCode: http.StatusBadRequest, Body: string(body), Err: ErrContentBlocked}
+}
+
+// Client 上游模型接口客户端
+type Client struct {
+	clients  *httpClients
+	observer func(Observation)
+}
+
+// NewClient 创建上游模型接口客户端
+func NewClient() *Client {
+	return &Client{clients: newHTTPClients()}
+}
+
+// baseURL 上游接口的根地址，BaseURL可带或不带/v1后缀
+func baseURL(m *model.Model) string {
+	base := strings.TrimRight(m.BaseURL, "/")
+	if !strings.HasSuffix(base, "/v1") {
+		base += "/v1"
+	}
+	return base
+}
+
+// Endpoint 根据BaseURL和APIType拼接上游接口地址
+func Endpoint(m *model.Model) string {
+	base := baseURL(m)
+	apiType := strings.Trim(m.APIType, "/")
+	if apiType == "" || apiType == AdapterOpenAI {
+		apiType = "chat/completions"
+	}
+	return base + "/" + apiType
+}
+
+// Prepare 使用模型配置填充请求：替换上游模型名、补全默认参数，并在没有system消息时加入模型预设
+func Prepare(m *model.Model, req *ChatRequest) {
+	req.Model = m.ModelName
+
+	var config model.ModelConfig
+	if len(m.Config) > 0 {
+		_ = json.Unmarshal(m.Config, &config)
+	}
+	if req.Temperature == nil && config.Temperature != 0 {
+		req.Temperature = &config.Temperature
+	}
+	if req.TopP == nil && config.TopP != 0 {
+		req.TopP = &config.TopP
+	}
+	if req.MaxTokens == nil && config.MaxTokens != 0 {
+		req.MaxTokens = &config.MaxTokens
+	}
+	if req.FrequencyPenalty == nil && config.FrequencyPenalty != 0 {
+		req.FrequencyPenalty = &config.FrequencyPenalty
+	}
+	if req.PresencePenalty == nil && config.PresencePenalty != 0 {
+		req.PresencePenalty = &config.PresencePenalty
+	}
+
+	if m.Preset != "" && (len(req.Messages) == 0 || req.Messages[0].Role != "system") {
+		req.Messages = append([]ChatMessage{{Role: "system", Content: TextContent(m.Preset)}}, req.Messages...)
+	}
+
+	// 流式请求要求上游在最后返回用量，用于计费和统计
+	if req.Stream {
+		req.StreamOptions = &StreamOptions{IncludeUsage: true}
+	}
+}
+
+// ChatCompletion 非流式对话补全
+func (c *Client) ChatCompletion(ctx context.Context, m *model.Model, req *ChatRequest) (*ChatResponse, error) {
+	body, _, err := c.ChatCompletionRaw(ctx, m, req)
+	if err != nil {
+		return nil, err
+	}
+
+	var result ChatResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("decode upstream response: %w", err)
+	}
+	return &result, nil
+}
+
+// ChatCompletionStream 流式对话补全，调用方需要关闭返回的Stream
+func (c *Client) ChatCompletionStream(ctx context.Context, m *model.Model, req *ChatRequest) (*Stream, error) {
+	req.Stream = true
+	adapter := AdapterFor(m)
+	start := time.Now()
+	resp, err := c.chat(ctx, adapter, m, req)
+	if err != nil {
+		c.observe(Observation{ModelID: m.ID, Stream: true, Err: err})
+		return nil, err
+	}
+	stream := newStream(resp.Body, adapter.NewChunkReader(m, resp.Body))
+	rateLimit := parseRateLimit(resp.Header)
+	stream.onDone = func(ttft time.Duration, err error) {
+		o := Observation{ModelID: m.ID, Stream: true, RateLimit: rateLimit, Err: err}
+		switch {
+		case err == nil:
+			o.TTFT, o.Latency = ttft, time.Since(start)
+		case errors.Is(err, errStreamClosed) || errors.Is(err, context.Canceled):
+			// 调用方提前关闭或断开连接，上游没有出错，只有首个分片耗时有效
+			o.TTFT, o.Err, o.Abandoned = ttft, nil, true
+		}
+		c.observe(o)
+	}
+	stream.start = start
+	return stream, nil
+}
+
+// ChatCompletionRaw 非流式对话补全，返回OpenAI格式的响应体和解析出的用量，OpenAI兼容接口的响应体原样返回
+func (c *Client) ChatCompletionRaw(ctx context.Context, m *model.Model, req *ChatRequest) ([]byte, *Usage, error) {
+	req.Stream = false
+	start := time.Now()
+	body, usage, header, err := c.chatRaw(ctx, m, req)
+	o := Observation{ModelID: m.ID, Err: err}
+	if header != nil {
+		o.RateLimit = parseRateLimit(header)
+	}
+	if err == nil {
+		o.Latency = time.Since(start)
+		o.TTFT = o.Latency
+	}
+	c.observe(o)
+	return body, usage, err
+}
+
+// chatRaw 发送非流式对话补全，同时返回上游的响应头，请求未到达上游时响应头为nil
+func (c *Client) chatRaw(ctx context.Context, m *model.Model, req *ChatRequest) ([]byte, *Usage, http.Header, error) {
+	adapter := AdapterFor(m)
+	resp, err := c.chat(ctx, adapter, m, req)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, resp.Header, fmt.Errorf("read upstream response: %w", err)
+	}
+	if body, err = adapter.ConvertResponse(m, body); err != nil {
+		return nil, nil, resp.Header, err
+	}
+	var result struct {
+		Usage *Usage `json:"usage"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, nil, resp.Header, fmt.Errorf("decode upstream response: %w", err)
+	}
+	return body, result.Usage, resp.Header, nil
+}
+
+// Embeddings 文本向量化，请求体中的model替换为上游模型名后原样转发，返回上游的原始响应体
+func (c *Client) Embeddings(ctx context.Context, m *model.Model, body map[string]json.RawMessage) ([]byte, error) {
+	adapter := AdapterFor(m)
+	embedder, ok := adapter.(EmbeddingAdapter)
+	if !ok {
+		return nil, invalidRequest("The model `%s` does not support embeddings.", m.ModelName)
+	}
+
+	name, _ := json.Marshal(m.ModelName)
+	body["model"] = name
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	httpReq, err := embedder.NewEmbeddingRequest(ctx, m, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.send(m, adapter, httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read upstream response: %w", err)
+	}
+	return data, nil
+}
+
+func (c *Client) chat(ctx context.Context, adapter Adapter, m *model.Model, req *ChatRequest) (*http.Response, error) {
+	Prepare(m, req)
+	httpReq, err := adapter.NewChatRequest(ctx, m, req)
+	if err != nil {
+		return nil, err
+	}
+	return c.send(m, adapter, httpReq)
+}
+
+// send 使用模型的代理和连接配置发送上游请求，非200响应转换为APIError，错误响应体由适配器转换为OpenAI格式
+func (c *Client) send(m *model.Model, adapter Adapter, httpReq *http.Request) (*http.Response, error) {
+	httpClient, err := c.clients.get(m)
+	if err != nil {
+		return nil, fmt.Errorf("build upstream client for model %d: %w", m.ID, err)
+	}
+	start := time.Now()
+	resp, err := httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("request upstream after %s: %w", time.Since(start), err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, &APIError{
+			StatusCode: resp.StatusCode,
+			Body:       string(adapter.ConvertError(body)),
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		}
+	}
+	return resp, nil
+}
+
+// Probe 使用指定的Key请求上游的模型列表接口，检查Key是否可用
+func (c *Client) Probe(ctx context.Context, m *model.Model, apiKey string) error {
+	adapter := AdapterFor(m)
+	httpReq, err := adapter.NewProbeRequest(ctx, m, apiKey)
+	if err != nil {
+		return err
+	}
+	resp, err := c.send(m, adapter, httpReq)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// maxModelListPages 获取上游模型列表时最多翻页的次数
+const maxModelListPages = 20
+
+// ListModels 使用模型的BaseURL和Key获取上游的模型列表，按上游返回的翻页标记依次获取所有页
+func (c *Client) ListModels(ctx context.Context, m *model.Model) ([]UpstreamModel, error) {
+	adapter := AdapterFor(m)
+	var models []UpstreamModel
+	pageToken := ""
+	for page := 0; page < maxModelListPages; page++ {
+		httpReq, err := adapter.NewModelListRequest(ctx, m, pageToken)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := c.send(m, adapter, httpReq)
+		if err != nil {
+			return nil, err
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("read upstream response: %w", err)
+		}
+		items, next, err := adapter.ConvertModelList(body)
+		if err != nil {
+			return nil, err
+		}
+		models = append(models, items...)
+		if next == "" {
+			break
+		}
+		pageToken = next
+	}
+	return models, nil
+}
+
+// parseRetryAfter 解析Retry-After，支持秒数和HTTP日期两种格式
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
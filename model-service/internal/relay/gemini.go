@@ -0,0 +1,668 @@
+package relay
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"cybermind/model-service/internal/model"
+)
+
+// geminiFinishReasons Gemini的finishReason对应的OpenAI finish_reason，未列出的按stop处理
+var geminiFinishReasons = map[string]string{
+	"STOP":               "stop",
+	"MAX_TOKENS":         "length",
+	"SAFETY":             "content_filter",
+	"RECITATION":         "content_filter",
+	"BLOCKLIST":          "content_filter",
+	"PROHIBITED_CONTENT": "content_filter",
+	"SPII":               "content_filter",
+	"IMAGE_SAFETY":       "content_filter",
+}
+
+// geminiErrorTypes Gemini错误的status对应的OpenAI错误类型
+var geminiErrorTypes = map[string]string{
+	"INVALID_ARGUMENT":    "invalid_request_error",
+	"FAILED_PRECONDITION": "invalid_request_error",
+	"NOT_FOUND":           "invalid_request_error",
+	"UNAUTHENTICATED":     "authentication_error",
+	"PERMISSION_DENIED":   "permission_error",
+	"RESOURCE_EXHAUSTED":  "rate_limit_error",
+}
+
+// geminiAdapter Google Gemini API(generateContent/streamGenerateContent)
+type geminiAdapter struct{}
+
+type geminiRequest struct {
+	Contents          []geminiContent         `json:"contents"`
+	SystemInstruction *geminiContent          `json:"systemInstruction,omitempty"`
+	GenerationConfig  *geminiGenerationConfig `json:"generationConfig,omitempty"`
+	Tools             []geminiTool            `json:"tools,omitempty"`
+	ToolConfig        *geminiToolConfig       `json:"toolConfig,omitempty"`
+	SafetySettings    json.RawMessage         `json:"safetySettings,omitempty"`
+}
+
+type geminiContent struct {
+	Role  string       `json:"role,omitempty"` // user/model
+	Parts []geminiPart `json:"parts"`
+}
+
+type geminiPart struct {
+	Text             string                  `json:"text,omitempty"`
+	Thought          bool                    `json:"thought,omitempty"`
+	InlineData       *geminiBlob             `json:"inlineData,omitempty"`
+	FileData         *geminiFileData         `json:"fileData,omitempty"`
+	FunctionCall     *geminiFunctionCall     `json:"functionCall,omitempty"`
+	FunctionResponse *geminiFunctionResponse `json:"functionResponse,omitempty"`
+}
+
+type geminiBlob struct {
+	MimeType string `json:"mimeType"`
+	Data     string `json:"data"`
+}
+
+type geminiFileData struct {
+	MimeType string `json:"mimeType,omitempty"`
+	FileURI  string `json:"fileUri"`
+}
+
+type geminiFunctionCall struct {
+	ID   string          `json:"id,omitempty"`
+	Name string          `json:"name"`
+	Args json.RawMessage `json:"args,omitempty"`
+}
+
+type geminiFunctionResponse struct {
+	ID       string          `json:"id,omitempty"`
+	Name     string          `json:"name"`
+	Response json.RawMessage `json:"response"`
+}
+
+type geminiGenerationConfig struct {
+	Temperature        *float64        `json:"temperature,omitempty"`
+	TopP               *float64        `json:"topP,omitempty"`
+	TopK               json.RawMessage `json:"topK,omitempty"`
+	MaxOutputTokens    *int            `json:"maxOutputTokens,omitempty"`
+	StopSequences      []string        `json:"stopSequences,omitempty"`
+	PresencePenalty    *float64        `json:"presencePenalty,omitempty"`
+	FrequencyPenalty   *float64        `json:"frequencyPenalty,omitempty"`
+	CandidateCount     json.RawMessage `json:"candidateCount,omitempty"`
+	Seed               json.RawMessage `json:"seed,omitempty"`
+	ResponseMimeType   string          `json:"responseMimeType,omitempty"`
+	ResponseJSONSchema json.RawMessage `json:"responseJsonSchema,omitempty"`
+}
+
+type geminiTool struct {
+	FunctionDeclarations []geminiFunctionDeclaration `json:"functionDeclarations"`
+}
+
+type geminiFunctionDeclaration struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters,omitempty"`
+}
+
+type geminiToolConfig struct {
+	FunctionCallingConfig struct {
+		Mode                 string   `json:"mode"` // AUTO/ANY/NONE
+		AllowedFunctionNames []string `json:"allowedFunctionNames,omitempty"`
+	} `json:"functionCallingConfig"`
+}
+
+type geminiResponse struct {
+	Candidates []struct {
+		Content      *geminiContent `json:"content"`
+		FinishReason string         `json:"finishReason"`
+		Index        int            `json:"index"`
+	} `json:"candidates"`
+	PromptFeedback *struct {
+		BlockReason string `json:"blockReason"`
+	} `json:"promptFeedback"`
+	UsageMetadata *struct {
+		PromptTokenCount        int `json:"promptTokenCount"`
+		CandidatesTokenCount    int `json:"candidatesTokenCount"`
+		ThoughtsTokenCount      int `json:"thoughtsTokenCount"`
+		TotalTokenCount         int `json:"totalTokenCount"`
+		CachedContentTokenCount int `json:"cachedContentTokenCount"`
+	} `json:"usageMetadata"`
+	ModelVersion string       `json:"modelVersion"`
+	ResponseID   string       `json:"responseId"`
+	Error        *geminiError `json:"error"`
+}
+
+type geminiError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Status  string `json:"status"`
+}
+
+// usage 输出token数包含思考过程
+func (r *geminiResponse) usage() *Usage {
+	if r.UsageMetadata == nil {
+		return nil
+	}
+	u := r.UsageMetadata
+	return &Usage{
+		PromptTokens:        u.PromptTokenCount,
+		CompletionTokens:    u.CandidatesTokenCount + u.ThoughtsTokenCount,
+		TotalTokens:         u.TotalTokenCount,
+		PromptTokensDetails: cachedDetails(u.CachedContentTokenCount),
+	}
+}
+
+// geminiBaseURL Gemini接口的根地址，BaseURL未带版本时使用v1beta
+func geminiBaseURL(m *model.Model) string {
+	base := strings.TrimRight(m.BaseURL, "/")
+	if !strings.HasSuffix(base, "/v1") && !strings.HasSuffix(base, "/v1beta") {
+		base += "/v1beta"
+	}
+	return base
+}
+
+func (a geminiAdapter) NewChatRequest(ctx context.Context, m *model.Model, req *ChatRequest) (*http.Request, error) {
+	body, err := a.convertRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	url := geminiBaseURL(m) + "/models/" + req.Model + ":generateContent"
+	if req.Stream {
+		url = geminiBaseURL(m) + "/models/" + req.Model + ":streamGenerateContent?alt=sse"
+	}
+	httpReq, err := newJSONRequest(ctx, url, body, req.Stream)
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("x-goog-api-key", string(m.APIKey))
+	return httpReq, nil
+}
+
+// convertRequest system消息合并为systemInstruction，assistant角色转换为model，
+// tool消息转换为functionResponse，连续的同角色消息合并为一条
+func (geminiAdapter) convertRequest(req *ChatRequest) (*geminiRequest, error) {
+	out := &geminiRequest{SafetySettings: req.Extra["safety_settings"]}
+
+	config := &geminiGenerationConfig{
+		Temperature:      req.Temperature,
+		TopP:             req.TopP,
+		TopK:             req.Extra["top_k"],
+		MaxOutputTokens:  req.MaxTokens,
+		StopSequences:    req.Stop,
+		PresencePenalty:  req.PresencePenalty,
+		FrequencyPenalty: req.FrequencyPenalty,
+		CandidateCount:   req.Extra["n"],
+		Seed:             req.Extra["seed"],
+	}
+	if config.MaxOutputTokens == nil {
+		if raw, ok := req.Extra["max_completion_tokens"]; ok {
+			var n int
+			if err := json.Unmarshal(raw, &n); err != nil {
+				return nil, invalidRequest("Invalid 'max_completion_tokens': expected an integer.")
+			}
+			config.MaxOutputTokens = &n
+		}
+	}
+	if raw, ok := req.Extra["response_format"]; ok {
+		var format struct {
+			Type       string `json:"type"`
+			JSONSchema struct {
+				Schema json.RawMessage `json:"schema"`
+			} `json:"json_schema"`
+		}
+		if err := json.Unmarshal(raw, &format); err != nil {
+			return nil, invalidRequest("Invalid 'response_format': %v", err)
+		}
+		switch format.Type {
+		case "json_object":
+			config.ResponseMimeType = "application/json"
+		case "json_schema":
+			config.ResponseMimeType = "application/json"
+			config.ResponseJSONSchema = format.JSONSchema.Schema
+		}
+	}
+	if data, _ := json.Marshal(config); string(data) != "{}" {
+		out.GenerationConfig = config
+	}
+
+	var system []geminiPart
+	// tool消息只有tool_call_id，需要按ID找到对应的函数名
+	callNames := make(map[string]string)
+	for i, msg := range req.Messages {
+		var role string
+		var parts []geminiPart
+		switch msg.Role {
+		case "system", "developer":
+			if text := msg.Content.String(); text != "" {
+				system = append(system, geminiPart{Text: text})
+			}
+			continue
+		case "user":
+			role = "user"
+			for _, p := range contentParts(msg.Content) {
+				part, err := geminiContentPart(p)
+				if err != nil {
+					return nil, invalidRequest("Invalid 'messages[%d].content': %v", i, err)
+				}
+				if part != nil {
+					parts = append(parts, *part)
+				}
+			}
+		case "assistant":
+			role = "model"
+			if text := msg.Content.String(); text != "" {
+				parts = append(parts, geminiPart{Text: text})
+			}
+			for _, call := range msg.ToolCalls {
+				args := json.RawMessage(call.Function.Arguments)
+				if strings.TrimSpace(call.Function.Arguments) == "" {
+					args = json.RawMessage("{}")
+				} else if !json.Valid(args) {
+					return nil, invalidRequest("Invalid 'messages[%d].tool_calls': arguments must be valid JSON.", i)
+				}
+				callNames[call.ID] = call.Function.Name
+				parts = append(parts, geminiPart{FunctionCall: &geminiFunctionCall{Name: call.Function.Name, Args: args}})
+			}
+		case "tool":
+			role = "user"
+			name, ok := callNames[msg.ToolCallID]
+			if !ok {
+				return nil, invalidRequest("Invalid 'messages[%d].tool_call_id': no matching tool call.", i)
+			}
+			// response需要是JSON对象，其他内容包装为{"content": ...}
+			response := json.RawMessage(msg.Content.String())
+			var obj map[string]json.RawMessage
+			if json.Unmarshal(response, &obj) != nil {
+				response, _ = json.Marshal(map[string]string{"content": msg.Content.String()})
+			}
+			parts = append(parts, geminiPart{FunctionResponse: &geminiFunctionResponse{Name: name, Response: response}})
+		default:
+			return nil, invalidRequest("Invalid 'messages[%d].role': unsupported role '%s'.", i, msg.Role)
+		}
+		if len(parts) == 0 {
+			continue
+		}
+
+		if n := len(out.Contents); n > 0 && out.Contents[n-1].Role == role {
+			out.Contents[n-1].Parts = append(out.Contents[n-1].Parts, parts...)
+		} else {
+			out.Contents = append(out.Contents, geminiContent{Role: role, Parts: parts})
+		}
+	}
+	if len(system) > 0 {
+		out.SystemInstruction = &geminiContent{Parts: system}
+	}
+
+	if err := convertGeminiTools(req, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// geminiContentPart 转换用户消息的内容片段，空文本返回nil
+func geminiContentPart(part ContentPart) (*geminiPart, error) {
+	switch part.Type {
+	case "text":
+		if part.Text == "" {
+			return nil, nil
+		}
+		return &geminiPart{Text: part.Text}, nil
+	case "image_url":
+		if part.ImageURL == nil || part.ImageURL.URL == "" {
+			return nil, fmt.Errorf("image_url is required")
+		}
+		return geminiMediaPart(part.ImageURL.URL)
+	case "input_audio":
+		if part.InputAudio == nil || part.InputAudio.Data == "" {
+			return nil, fmt.Errorf("input_audio is required")
+		}
+		return &geminiPart{InlineData: &geminiBlob{MimeType: "audio/" + part.InputAudio.Format, Data: part.InputAudio.Data}}, nil
+	case "file":
+		if part.File == nil || part.File.FileData == "" {
+			return nil, fmt.Errorf("file.file_data is required")
+		}
+		return geminiMediaPart(part.File.FileData)
+	}
+	return nil, fmt.Errorf("unsupported content type '%s'", part.Type)
+}
+
+// geminiMediaPart data:URL转换为inlineData，其他地址转换为fileData，媒体类型按扩展名推断
+func geminiMediaPart(url string) (*geminiPart, error) {
+	if strings.HasPrefix(url, "data:") {
+		mediaType, data, ok := parseDataURL(url)
+		if !ok {
+			return nil, fmt.Errorf("only base64 data URLs are supported")
+		}
+		return &geminiPart{InlineData: &geminiBlob{MimeType: mediaType, Data: data}}, nil
+	}
+	mediaType := mime.TypeByExtension(path.Ext(strings.SplitN(url, "?", 2)[0]))
+	return &geminiPart{FileData: &geminiFileData{MimeType: mediaType, FileURI: url}}, nil
+}
+
+// convertGeminiTools 转换OpenAI格式的tools和tool_choice
+func convertGeminiTools(req *ChatRequest, out *geminiRequest) error {
+	if raw, ok := req.Extra["tools"]; ok {
+		var tools []struct {
+			Type     string `json:"type"`
+			Function struct {
+				Name        string          `json:"name"`
+				Description string          `json:"description"`
+				Parameters  json.RawMessage `json:"parameters"`
+			} `json:"function"`
+		}
+		if err := json.Unmarshal(raw, &tools); err != nil {
+			return invalidRequest("Invalid 'tools': %v", err)
+		}
+		var declarations []geminiFunctionDeclaration
+		for i, t := range tools {
+			if t.Type != "function" || t.Function.Name == "" {
+				return invalidRequest("Invalid 'tools[%d]': only function tools are supported.", i)
+			}
+			declarations = append(declarations, geminiFunctionDeclaration{
+				Name:        t.Function.Name,
+				Description: t.Function.Description,
+				Parameters:  t.Function.Parameters,
+			})
+		}
+		if len(declarations) > 0 {
+			out.Tools = []geminiTool{{FunctionDeclarations: declarations}}
+		}
+	}
+
+	if raw, ok := req.Extra["tool_choice"]; ok {
+		config := &geminiToolConfig{}
+		var mode string
+		if json.Unmarshal(raw, &mode) == nil {
+			switch mode {
+			case "auto":
+				config.FunctionCallingConfig.Mode = "AUTO"
+			case "required":
+				config.FunctionCallingConfig.Mode = "ANY"
+			case "none":
+				config.FunctionCallingConfig.Mode = "NONE"
+			default:
+				return invalidRequest("Invalid 'tool_choice': unsupported value '%s'.", mode)
+			}
+		} else {
+			var choice struct {
+				Function struct {
+					Name string `json:"name"`
+				} `json:"function"`
+			}
+			if err := json.Unmarshal(raw, &choice); err != nil || choice.Function.Name == "" {
+				return invalidRequest("Invalid 'tool_choice': expected a string or a function object.")
+			}
+			config.FunctionCallingConfig.Mode = "ANY"
+			config.FunctionCallingConfig.AllowedFunctionNames = []string{choice.Function.Name}
+		}
+		out.ToolConfig = config
+	}
+	return nil
+}
+
+// geminiDelta 转换候选结果的内容，思考过程不返回。toolIndex为已输出的工具调用数，用于生成调用ID和流式分片的序号
+func geminiDelta(content *geminiContent, toolIndex int) (string, []ToolCall) {
+	if content == nil {
+		return "", nil
+	}
+	var text strings.Builder
+	var calls []ToolCall
+	for _, part := range content.Parts {
+		switch {
+		case part.FunctionCall != nil:
+			index := toolIndex + len(calls)
+			id := part.FunctionCall.ID
+			if id == "" {
+				id = fmt.Sprintf("call_%d", index)
+			}
+			args := "{}"
+			var compact bytes.Buffer
+			if json.Compact(&compact, part.FunctionCall.Args) == nil {
+				args = compact.String()
+			}
+			calls = append(calls, ToolCall{
+				Index:    &index,
+				ID:       id,
+				Type:     "function",
+				Function: ToolCallFunction{Name: part.FunctionCall.Name, Arguments: args},
+			})
+		case part.Text != "" && !part.Thought:
+			text.WriteString(part.Text)
+		}
+	}
+	return text.String(), calls
+}
+
+// geminiFinishReason 有工具调用时返回tool_calls
+func geminiFinishReason(reason string, hasToolCalls bool) string {
+	if hasToolCalls && (reason == "STOP" || reason == "") {
+		return "tool_calls"
+	}
+	if r, ok := geminiFinishReasons[reason]; ok {
+		return r
+	}
+	return "stop"
+}
+
+// ConvertResponse 输入被拦截(promptFeedback.blockReason)或输出因安全策略中止且没有任何内容时返回ErrContentBlocked
+func (geminiAdapter) ConvertResponse(m *model.Model, body []byte) ([]byte, error) {
+	var resp geminiResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("decode upstream response: %w", err)
+	}
+	if resp.PromptFeedback != nil && resp.PromptFeedback.BlockReason != "" {
+		return nil, contentBlocked(resp.PromptFeedback.BlockReason)
+	}
+	if len(resp.Candidates) == 0 {
+		return nil, fmt.Errorf("upstream returned no candidates")
+	}
+
+	out := ChatResponse{
+		ID:      resp.ResponseID,
+		Object:  "chat.completion",
+		Created: now().Unix(),
+		Model:   resp.ModelVersion,
+		Usage:   resp.usage(),
+	}
+	if out.Model == "" {
+		out.Model = m.ModelName
+	}
+	for i, c := range resp.Candidates {
+		text, calls := geminiDelta(c.Content, 0)
+		reason := geminiFinishReason(c.FinishReason, len(calls) > 0)
+		if reason == "content_filter" && text == "" && len(calls) == 0 && len(resp.Candidates) == 1 {
+			return nil, contentBlocked(c.FinishReason)
+		}
+		// 非流式响应的工具调用不需要序号
+		for j := range calls {
+			calls[j].Index = nil
+		}
+		out.Choices = append(out.Choices, Choice{
+			Index:        i,
+			Message:      ChatMessage{Role: "assistant", Content: TextContent(text), ToolCalls: calls},
+			FinishReason: reason,
+		})
+	}
+	return json.Marshal(out)
+}
+
+func (geminiAdapter) NewChunkReader(m *model.Model, body io.Reader) ChunkReader {
+	return &geminiChunkReader{sse: newSSEReader(body), model: m.ModelName, created: now().Unix()}
+}
+
+// ConvertError 将{"error":{"code":...,"message":...,"status":...}}转换为OpenAI格式，
+// Gemini的错误响应可能是数组
+func (geminiAdapter) ConvertError(body []byte) []byte {
+	var resp geminiResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		var list []geminiResponse
+		if json.Unmarshal(body, &list) != nil || len(list) == 0 {
+			return body
+		}
+		resp = list[0]
+	}
+	if resp.Error == nil || resp.Error.Message == "" {
+		return body
+	}
+	typ, ok := geminiErrorTypes[resp.Error.Status]
+	if !ok {
+		typ = "server_error"
+	}
+	return openAIErrorBody(resp.Error.Message, typ)
+}
+
+func (geminiAdapter) NewProbeRequest(ctx context.Context, m *model.Model, apiKey string) (*http.Request, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, geminiBaseURL(m)+"/models", nil)
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("x-goog-api-key", apiKey)
+	return httpReq, nil
+}
+
+// NewModelListRequest 每页最多1000个，按pageToken翻页
+func (geminiAdapter) NewModelListRequest(ctx context.Context, m *model.Model, pageToken string) (*http.Request, error) {
+	query := url.Values{"pageSize": {"1000"}}
+	if pageToken != "" {
+		query.Set("pageToken", pageToken)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, geminiBaseURL(m)+"/models?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("x-goog-api-key", string(m.APIKey))
+	return httpReq, nil
+}
+
+// ConvertModelList 解析{"models":[{"name":"models/...","displayName":...,"supportedGenerationMethods":[...]}]}，
+// 只返回支持generateContent的模型，模型名去掉models/前缀
+func (geminiAdapter) ConvertModelList(body []byte) ([]UpstreamModel, string, error) {
+	var resp struct {
+		Models []struct {
+			Name                       string   `json:"name"`
+			DisplayName                string   `json:"displayName"`
+			SupportedGenerationMethods []string `json:"supportedGenerationMethods"`
+		} `json:"models"`
+		NextPageToken string `json:"nextPageToken"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, "", fmt.Errorf("decode upstream model list: %w", err)
+	}
+	var models []UpstreamModel
+	for _, m := range resp.Models {
+		for _, method := range m.SupportedGenerationMethods {
+			if method == "generateContent" {
+				models = append(models, UpstreamModel{
+					ID:          strings.TrimPrefix(m.Name, "models/"),
+					DisplayName: m.DisplayName,
+					OwnedBy:     "google",
+				})
+				break
+			}
+		}
+	}
+	return models, resp.NextPageToken, nil
+}
+
+// geminiChunkReader 将Gemini的流式响应转换为OpenAI格式的分片。
+// Gemini每个事件都是完整的GenerateContentResponse，用量在流结束后作为最后一个分片返回
+type geminiChunkReader struct {
+	sse       *sseReader
+	id        string
+	model     string
+	created   int64
+	started   bool
+	finished  bool
+	toolIndex int
+	usage     *Usage
+	done      bool
+}
+
+func (r *geminiChunkReader) Next() ([]byte, error) {
+	for !r.done {
+		data, err := r.sse.Next()
+		if err == io.EOF {
+			if !r.finished {
+				return nil, io.ErrUnexpectedEOF
+			}
+			r.done = true
+			return json.Marshal(&ChatChunk{
+				ID:      r.id,
+				Object:  "chat.completion.chunk",
+				Created: r.created,
+				Model:   r.model,
+				Choices: []ChunkChoice{},
+				Usage:   r.usage,
+			})
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var resp geminiResponse
+		if err := json.Unmarshal(data, &resp); err != nil {
+			return nil, fmt.Errorf("decode upstream event: %w", err)
+		}
+		chunk, err := r.convert(&resp)
+		if err != nil {
+			return nil, err
+		}
+		if chunk != nil {
+			return json.Marshal(chunk)
+		}
+	}
+	return nil, io.EOF
+}
+
+// convert 转换单个事件，不需要输出分片的事件返回nil
+func (r *geminiChunkReader) convert(resp *geminiResponse) (*ChatChunk, error) {
+	if resp.Error != nil {
+		return nil, fmt.Errorf("upstream stream error: %s: %s", resp.Error.Status, resp.Error.Message)
+	}
+	if resp.PromptFeedback != nil && resp.PromptFeedback.BlockReason != "" {
+		return nil, contentBlocked(resp.PromptFeedback.BlockReason)
+	}
+	if resp.ResponseID != "" {
+		r.id = resp.ResponseID
+	}
+	if resp.ModelVersion != "" {
+		r.model = resp.ModelVersion
+	}
+	if usage := resp.usage(); usage != nil {
+		r.usage = usage
+	}
+	if len(resp.Candidates) == 0 {
+		return nil, nil
+	}
+
+	c := resp.Candidates[0]
+	text, calls := geminiDelta(c.Content, r.toolIndex)
+	r.toolIndex += len(calls)
+
+	delta := ChatMessage{Content: TextContent(text), ToolCalls: calls}
+	if !r.started {
+		delta.Role = "assistant"
+		r.started = true
+	}
+	var finishReason *string
+	if c.FinishReason != "" {
+		reason := geminiFinishReason(c.FinishReason, r.toolIndex > 0)
+		finishReason = &reason
+		r.finished = true
+	}
+	if delta.Role == "" && text == "" && len(calls) == 0 && finishReason == nil {
+		return nil, nil
+	}
+	return &ChatChunk{
+		ID:      r.id,
+		Object:  "chat.completion.chunk",
+		Created: r.created,
+		Model:   r.model,
+		Choices: []ChunkChoice{{Index: 0, Delta: delta, FinishReason: finishReason}},
+	}, nil
+}
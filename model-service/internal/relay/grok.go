@@ -0,0 +1,94 @@
+package relay
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"cybermind/model-service/internal/model"
+)
+
+// grokAdapter xAI Grok API，接口与OpenAI兼容，转换前去掉推理模型不支持的参数，
+// 并将因安全策略没有返回任何内容的响应作为拦截处理
+type grokAdapter struct {
+	openai openAIAdapter
+}
+
+// grokReasoningModel 推理模型不支持presence_penalty、frequency_penalty和stop
+func grokReasoningModel(name string) bool {
+	name = strings.ToLower(name)
+	return strings.HasPrefix(name, "grok-3-mini") || strings.HasPrefix(name, "grok-4")
+}
+
+// NewChatRequest developer角色转换为system，请求在副本上修改，不影响其他路由
+func (a grokAdapter) NewChatRequest(ctx context.Context, m *model.Model, req *ChatRequest) (*http.Request, error) {
+	out := *req
+	out.Messages = make([]ChatMessage, len(req.Messages))
+	for i, msg := range req.Messages {
+		if msg.Role == "developer" {
+			msg.Role = "system"
+		}
+		out.Messages[i] = msg
+	}
+	if grokReasoningModel(req.Model) {
+		out.PresencePenalty, out.FrequencyPenalty, out.Stop = nil, nil, nil
+		// grok-4不支持reasoning_effort
+		if strings.HasPrefix(strings.ToLower(req.Model), "grok-4") && out.Extra != nil {
+			out.Extra = make(map[string]json.RawMessage, len(req.Extra))
+			for k, v := range req.Extra {
+				if k != "reasoning_effort" {
+					out.Extra[k] = v
+				}
+			}
+		}
+	}
+
+	httpReq, err := newJSONRequest(ctx, baseURL(m)+"/chat/completions", &out, out.Stream)
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Authorization", "Bearer "+string(m.APIKey))
+	return httpReq, nil
+}
+
+// ConvertResponse 所有候选结果都因content_filter结束且没有内容时返回ErrContentBlocked
+func (a grokAdapter) ConvertResponse(m *model.Model, body []byte) ([]byte, error) {
+	var resp ChatResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("decode upstream response: %w", err)
+	}
+	blocked := len(resp.Choices) > 0
+	for _, c := range resp.Choices {
+		if c.FinishReason != "content_filter" || c.Message.Content.String() != "" || len(c.Message.ToolCalls) > 0 {
+			blocked = false
+			break
+		}
+	}
+	if blocked {
+		return nil, contentBlocked("content_filter")
+	}
+	return body, nil
+}
+
+func (a grokAdapter) NewChunkReader(m *model.Model, body io.Reader) ChunkReader {
+	return a.openai.NewChunkReader(m, body)
+}
+
+func (a grokAdapter) ConvertError(body []byte) []byte {
+	return a.openai.ConvertError(body)
+}
+
+func (a grokAdapter) NewProbeRequest(ctx context.Context, m *model.Model, apiKey string) (*http.Request, error) {
+	return a.openai.NewProbeRequest(ctx, m, apiKey)
+}
+
+func (a grokAdapter) NewModelListRequest(ctx context.Context, m *model.Model, pageToken string) (*http.Request, error) {
+	return a.openai.NewModelListRequest(ctx, m, pageToken)
+}
+
+func (a grokAdapter) ConvertModelList(body []byte) ([]UpstreamModel, string, error) {
+	return a.openai.ConvertModelList(body)
+}
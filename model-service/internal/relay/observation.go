@@ -0,0 +1,76 @@
+package relay
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Observation 一次对话补全上游调用的观测结果，用于按部署统计延迟、错误率和限额余量
+type Observation struct {
+	ModelID   int64
+	Stream    bool
+	TTFT      time.Duration // 收到第一个分片的耗时，非流式请求为收到完整响应的耗时；调用失败时为0
+	Latency   time.Duration // 收到完整响应的耗时；调用失败时为0
+	RateLimit *RateLimit    // 上游返回的限额余量，未返回时为nil
+	Err       error
+	Abandoned bool // 流式请求在结束前被调用方关闭或取消，只有TTFT有效(未收到分片时为0)
+}
+
+// RateLimit 上游限额余量，多个维度(请求数、token数)时取余量占比最小的一个
+type RateLimit struct {
+	Remaining int64
+	Limit     int64
+}
+
+// Headroom 余量占比，0到1之间
+func (r *RateLimit) Headroom() float64 {
+	if r.Limit <= 0 {
+		return 1
+	}
+	if r.Remaining <= 0 {
+		return 0
+	}
+	return float64(r.Remaining) / float64(r.Limit)
+}
+
+// rateLimitHeaders 上游返回的限额响应头：余量、上限。Gemini不返回限额响应头
+var rateLimitHeaders = [][2]string{
+	{"x-ratelimit-remaining-requests", "x-ratelimit-limit-requests"},
+	{"x-ratelimit-remaining-tokens", "x-ratelimit-limit-tokens"},
+	{"anthropic-ratelimit-requests-remaining", "anthropic-ratelimit-requests-limit"},
+	{"anthropic-ratelimit-tokens-remaining", "anthropic-ratelimit-tokens-limit"},
+	{"anthropic-ratelimit-input-tokens-remaining", "anthropic-ratelimit-input-tokens-limit"},
+	{"anthropic-ratelimit-output-tokens-remaining", "anthropic-ratelimit-output-tokens-limit"},
+}
+
+// parseRateLimit 解析限额响应头，返回余量占比最小的维度，没有限额响应头时返回nil
+func parseRateLimit(header http.Header) *RateLimit {
+	var tightest *RateLimit
+	for _, h := range rateLimitHeaders {
+		remaining, err1 := strconv.ParseInt(header.Get(h[0]), 10, 64)
+		limit, err2 := strconv.ParseInt(header.Get(h[1]), 10, 64)
+		if err1 != nil || err2 != nil || limit <= 0 {
+			continue
+		}
+		rl := &RateLimit{Remaining: remaining, Limit: limit}
+		if tightest == nil || rl.Headroom() < tightest.Headroom() {
+			tightest = rl
+		}
+	}
+	return tightest
+}
+
+// WithObserver 返回设置了观测回调的客户端，与原客户端共用连接池，原客户端不回调。
+// 流式请求在流结束、出错或调用方提前关闭时回调一次
+func (c *Client) WithObserver(observer func(Observation)) *Client {
+	observed := *c
+	observed.observer = observer
+	return &observed
+}
+
+func (c *Client) observe(o Observation) {
+	if c.observer != nil {
+		c.observer(o)
+	}
+}
@@ -0,0 +1,128 @@
+package relay
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"cybermind/model-service/internal/model"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	tests := []struct {
+		name   string
+		header map[string]string
+		want   *RateLimit
+	}{
+		{name: "no headers", header: map[string]string{}, want: nil},
+		{
+			name: "openai tightest dimension",
+			header: map[string]string{
+				"x-ratelimit-remaining-requests": "9000",
+				"x-ratelimit-limit-requests":     "10000",
+				"x-ratelimit-remaining-tokens":   "1000",
+				"x-ratelimit-limit-tokens":       "100000",
+			},
+			want: &RateLimit{Remaining: 1000, Limit: 100000},
+		},
+		{
+			name: "anthropic",
+			header: map[string]string{
+				"anthropic-ratelimit-requests-remaining": "40",
+				"anthropic-ratelimit-requests-limit":     "50",
+			},
+			want: &RateLimit{Remaining: 40, Limit: 50},
+		},
+		{
+			name:   "invalid limit",
+			header: map[string]string{"x-ratelimit-remaining-requests": "1", "x-ratelimit-limit-requests": "0"},
+			want:   nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{}
+			for k, v := range tt.header {
+				h.Set(k, v)
+			}
+			got := parseRateLimit(h)
+			if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+				t.Errorf("parseRateLimit() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestObserver(t *testing.T) {
+	fail := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("x-ratelimit-remaining-requests", "5")
+		w.Header().Set("x-ratelimit-limit-requests", "10")
+		if fail {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"hi\"}}]}\n\ndata: [DONE]\n\n"))
+	}))
+	defer server.Close()
+
+	var observed []Observation
+	plain := NewClient()
+	client := plain.WithObserver(func(o Observation) { observed = append(observed, o) })
+
+	m := &model.Model{ID: 7, Provider: "OpenAI", APIType: "chat/completions", BaseURL: server.URL, ModelName: "gpt-4o-mini", APIKey: "sk-test"}
+	req := &ChatRequest{Messages: []ChatMessage{{Role: "user", Content: TextContent("hi")}}}
+	stream, err := client.ChatCompletionStream(context.Background(), m, req)
+	if err != nil {
+		t.Fatalf("ChatCompletionStream() error = %v", err)
+	}
+	for {
+		if _, _, err := stream.RecvRaw(); err != nil {
+			if !errors.Is(err, io.EOF) {
+				t.Fatalf("RecvRaw() error = %v", err)
+			}
+			break
+		}
+	}
+	stream.Close()
+
+	// 调用方读到第一个分片后关闭
+	stream, err = client.ChatCompletionStream(context.Background(), m, req)
+	if err != nil {
+		t.Fatalf("ChatCompletionStream() error = %v", err)
+	}
+	if _, _, err := stream.RecvRaw(); err != nil {
+		t.Fatalf("RecvRaw() error = %v", err)
+	}
+	stream.Close()
+
+	// 未设置观测回调的客户端不回调
+	stream, err = plain.ChatCompletionStream(context.Background(), m, req)
+	if err != nil {
+		t.Fatalf("ChatCompletionStream() error = %v", err)
+	}
+	stream.Close()
+
+	fail = true
+	if _, _, err := client.ChatCompletionRaw(context.Background(), m, req); err == nil {
+		t.Fatal("ChatCompletionRaw() error = nil, want upstream error")
+	}
+
+	if len(observed) != 3 {
+		t.Fatalf("got %d observations, want 3", len(observed))
+	}
+	if o := observed[0]; o.ModelID != 7 || !o.Stream || o.Err != nil || o.Latency < o.TTFT || o.RateLimit == nil || o.RateLimit.Headroom() != 0.5 {
+		t.Errorf("stream observation = %+v", o)
+	}
+	if o := observed[1]; !o.Abandoned || o.Err != nil || o.TTFT <= 0 || o.Latency != 0 {
+		t.Errorf("abandoned stream observation = %+v", o)
+	}
+	var apiErr *APIError
+	if o := observed[2]; o.Stream || !errors.As(o.Err, &apiErr) || apiErr.StatusCode != http.StatusServiceUnavailable || o.Latency != 0 {
+		t.Errorf("failed observation = %+v", o)
+	}
+}
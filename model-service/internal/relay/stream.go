@@ -0,0 +1,69 @@
+package relay
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Stream 上游流式响应读取器，分片已由适配器转换为OpenAI格式
+type Stream struct {
+	body   io.ReadCloser
+	reader ChunkReader
+
+	start  time.Time
+	ttft   time.Duration
+	onDone func(ttft time.Duration, err error) // 流正常结束、出错或提前关闭时调用一次
+}
+
+// errStreamClosed 流未读完时被调用方关闭
+var errStreamClosed = errors.New("stream closed before completion")
+
+func newStream(body io.ReadCloser, reader ChunkReader) *Stream {
+	return &Stream{body: body, reader: reader}
+}
+
+// Recv 读取下一个分片，流结束时返回io.EOF
+func (s *Stream) Recv() (*ChatChunk, error) {
+	_, chunk, err := s.RecvRaw()
+	return chunk, err
+}
+
+// RecvRaw 读取下一个分片，同时返回分片的原始JSON，用于原样转发
+func (s *Stream) RecvRaw() ([]byte, *ChatChunk, error) {
+	data, err := s.reader.Next()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			s.done(nil)
+		} else {
+			s.done(err)
+		}
+		return nil, nil, err
+	}
+
+	var chunk ChatChunk
+	if err := json.Unmarshal(data, &chunk); err != nil {
+		err = fmt.Errorf("decode upstream chunk: %w", err)
+		s.done(err)
+		return nil, nil, err
+	}
+	if s.ttft == 0 && !s.start.IsZero() {
+		s.ttft = time.Since(s.start)
+	}
+	return data, &chunk, nil
+}
+
+func (s *Stream) done(err error) {
+	if s.onDone != nil {
+		s.onDone(s.ttft, err)
+		s.onDone = nil
+	}
+}
+
+// Close 关闭上游连接
+func (s *Stream) Close() error {
+	s.done(errStreamClosed)
+	return s.body.Close()
+}
@@ -0,0 +1,231 @@
+package relay
+
+import "encoding/json"
+
+// ChatMessage OpenAI格式的对话消息
+type ChatMessage struct {
+	Role       string         `json:"role,omitempty"`
+	Content    MessageContent `json:"content"`
+	Name       string         `json:"name,omitempty"`
+	ToolCalls  []ToolCall     `json:"tool_calls,omitempty"`
+	ToolCallID string         `json:"tool_call_id,omitempty"` // role为tool时对应的工具调用ID
+}
+
+// MessageContent 消息内容，可以是字符串或内容片段数组(多模态输入)
+type MessageContent struct {
+	Text  string
+	Parts []ContentPart
+}
+
+// ContentPart 内容片段
+type ContentPart struct {
+	Type       string      `json:"type"` // text/image_url/input_audio/file
+	Text       string      `json:"text,omitempty"`
+	ImageURL   *ImageURL   `json:"image_url,omitempty"`
+	InputAudio *InputAudio `json:"input_audio,omitempty"`
+	File       *FileData   `json:"file,omitempty"`
+}
+
+// ImageURL 图片地址，可以是http(s)地址或data:URL
+type ImageURL struct {
+	URL    string `json:"url"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// InputAudio base64编码的音频
+type InputAudio struct {
+	Data   string `json:"data"`
+	Format string `json:"format"` // wav/mp3
+}
+
+// FileData 文件内容，FileData为data:URL
+type FileData struct {
+	FileData string `json:"file_data,omitempty"`
+	FileID   string `json:"file_id,omitempty"`
+	Filename string `json:"filename,omitempty"`
+}
+
+// TextContent 纯文本内容
+func TextContent(text string) MessageContent {
+	return MessageContent{Text: text}
+}
+
+// String 返回内容中的文本，多个文本片段按顺序拼接
+func (c MessageContent) String() string {
+	if c.Parts == nil {
+		return c.Text
+	}
+	var text string
+	for _, p := range c.Parts {
+		if p.Type == "text" {
+			text += p.Text
+		}
+	}
+	return text
+}
+
+// MarshalJSON 有内容片段时输出数组，否则输出字符串
+func (c MessageContent) MarshalJSON() ([]byte, error) {
+	if c.Parts != nil {
+		return json.Marshal(c.Parts)
+	}
+	return json.Marshal(c.Text)
+}
+
+// UnmarshalJSON 解析字符串、内容片段数组或null
+func (c *MessageContent) UnmarshalJSON(data []byte) error {
+	*c = MessageContent{}
+	switch {
+	case string(data) == "null":
+		return nil
+	case len(data) > 0 && data[0] == '[':
+		return json.Unmarshal(data, &c.Parts)
+	}
+	return json.Unmarshal(data, &c.Text)
+}
+
+// ToolCall 模型发起的工具调用，流式分片中通过Index合并同一调用的增量
+type ToolCall struct {
+	Index    *int             `json:"index,omitempty"`
+	ID       string           `json:"id,omitempty"`
+	Type     string           `json:"type,omitempty"`
+	Function ToolCallFunction `json:"function"`
+}
+
+// ToolCallFunction 工具调用的函数名和JSON参数
+type ToolCallFunction struct {
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments"`
+}
+
+// StreamOptions 流式输出选项
+type StreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+// ChatRequest OpenAI格式的对话补全请求，作为各供应商请求转换的统一格式
+type ChatRequest struct {
+	Model            string         `json:"model"`
+	Messages         []ChatMessage  `json:"messages"`
+	Stream           bool           `json:"stream,omitempty"`
+	StreamOptions    *StreamOptions `json:"stream_options,omitempty"`
+	Temperature      *float64       `json:"temperature,omitempty"`
+	TopP             *float64       `json:"top_p,omitempty"`
+	MaxTokens        *int           `json:"max_tokens,omitempty"`
+	FrequencyPenalty *float64       `json:"frequency_penalty,omitempty"`
+	PresencePenalty  *float64       `json:"presence_penalty,omitempty"`
+	Stop             []string       `json:"stop,omitempty"`
+	User             string         `json:"user,omitempty"`
+
+	// Extra 未显式定义的字段(如tools、response_format、seed)，原样转发给上游
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// chatRequestFields ChatRequest显式定义的字段
+var chatRequestFields = []string{
+	"model", "messages", "stream", "stream_options", "temperature", "top_p",
+	"max_tokens", "frequency_penalty", "presence_penalty", "stop", "user",
+}
+
+type chatRequestAlias ChatRequest
+
+// UnmarshalJSON 解析已定义的字段，其余字段保存到Extra
+func (r *ChatRequest) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, (*chatRequestAlias)(r)); err != nil {
+		return err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	for _, name := range chatRequestFields {
+		delete(fields, name)
+	}
+	if len(fields) > 0 {
+		r.Extra = fields
+	} else {
+		r.Extra = nil
+	}
+	return nil
+}
+
+// MarshalJSON 输出已定义的字段并合并Extra
+func (r ChatRequest) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(chatRequestAlias(r))
+	if err != nil || len(r.Extra) == 0 {
+		return data, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	for k, v := range r.Extra {
+		if _, ok := fields[k]; !ok {
+			fields[k] = v
+		}
+	}
+	return json.Marshal(fields)
+}
+
+// Usage token用量
+type Usage struct {
+	PromptTokens        int                  `json:"prompt_tokens"`
+	CompletionTokens    int                  `json:"completion_tokens"`
+	TotalTokens         int                  `json:"total_tokens"`
+	PromptTokensDetails *PromptTokensDetails `json:"prompt_tokens_details,omitempty"`
+}
+
+// PromptTokensDetails 输入token明细，CachedTokens为命中缓存的输入token数，包含在PromptTokens中
+type PromptTokensDetails struct {
+	CachedTokens int `json:"cached_tokens"`
+}
+
+// CachedTokens 命中缓存的输入token数
+func (u *Usage) CachedTokens() int {
+	if u == nil || u.PromptTokensDetails == nil {
+		return 0
+	}
+	return u.PromptTokensDetails.CachedTokens
+}
+
+// cachedDetails 命中缓存的token数大于0时返回输入token明细
+func cachedDetails(cached int) *PromptTokensDetails {
+	if cached <= 0 {
+		return nil
+	}
+	return &PromptTokensDetails{CachedTokens: cached}
+}
+
+// Choice 非流式响应的候选结果
+type Choice struct {
+	Index        int         `json:"index"`
+	Message      ChatMessage `json:"message"`
+	FinishReason string      `json:"finish_reason"`
+}
+
+// ChatResponse OpenAI格式的对话补全响应
+type ChatResponse struct {
+	ID      string   `json:"id"`
+	Object  string   `json:"object"`
+	Created int64    `json:"created"`
+	Model   string   `json:"model"`
+	Choices []Choice `json:"choices"`
+	Usage   *Usage   `json:"usage,omitempty"`
+}
+
+// ChunkChoice 流式响应的增量结果
+type ChunkChoice struct {
+	Index        int         `json:"index"`
+	Delta        ChatMessage `json:"delta"`
+	FinishReason *string     `json:"finish_reason"`
+}
+
+// ChatChunk OpenAI格式的流式响应分片
+type ChatChunk struct {
+	ID      string        `json:"id"`
+	Object  string        `json:"object"`
+	Created int64         `json:"created"`
+	Model   string        `json:"model"`
+	Choices []ChunkChoice `json:"choices"`
+	Usage   *Usage        `json:"usage,omitempty"`
+}
@@ -0,0 +1,251 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"log"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+
+	"gorm.io/gorm"
+
+	"cybermind/model-service/internal/model"
+)
+
+// ErrAliasNotFound 名称不是启用的模型别名，或别名下没有可调用的部署
+var ErrAliasNotFound = errors.New("model alias not found")
+
+// AliasDeployment 别名下可调用的部署
+type AliasDeployment struct {
+	Model  model.Model
+	Weight int
+}
+
+// ResolvedAlias 启用的别名及其可调用的部署，部署按权重从大到小排序
+type ResolvedAlias struct {
+	Alias       model.ModelAlias
+	Deployments []AliasDeployment
+}
+
+// AliasService 模型别名解析：查找别名下已启用且所属供应商未停用的部署，并按别名的路由策略选择部署
+type AliasService struct {
+	db     *gorm.DB
+	models *ModelService
+	scorer *RouteScorer
+}
+
+func NewAliasService(db *gorm.DB, models *ModelService, scorer *RouteScorer) *AliasService {
+	return &AliasService{db: db, models: models, scorer: scorer}
+}
+
+// Resolve 按名称查找启用的别名，name不是别名或别名下没有可调用的部署时返回ErrAliasNotFound
+func (s *AliasService) Resolve(name string) (*ResolvedAlias, error) {
+	var alias model.ModelAlias
+	err := s.db.Where("name = ? AND status = 1", name).First(&alias).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrAliasNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	resolved, err := s.resolve([]model.ModelAlias{alias})
+	if err != nil {
+		return nil, err
+	}
+	if len(resolved) == 0 {
+		return nil, ErrAliasNotFound
+	}
+	return &resolved[0], nil
+}
+
+// ListAvailable 获取启用且有可调用部署的别名
+func (s *AliasService) ListAvailable() ([]ResolvedAlias, error) {
+	var aliases []model.ModelAlias
+	if err := s.db.Where("status = 1").Order("id ASC").Find(&aliases).Error; err != nil {
+		return nil, err
+	}
+	return s.resolve(aliases)
+}
+
+func (s *AliasService) resolve(aliases []model.ModelAlias) ([]ResolvedAlias, error) {
+	if len(aliases) == 0 {
+		return nil, nil
+	}
+	aliasIDs := make([]int64, len(aliases))
+	for i, a := range aliases {
+		aliasIDs[i] = a.ID
+	}
+	var targets []model.ModelAliasTarget
+	if err := s.db.Where("alias_id IN ?", aliasIDs).Order("weight DESC, id ASC").Find(&targets).Error; err != nil {
+		return nil, err
+	}
+	if len(targets) == 0 {
+		return nil, nil
+	}
+
+	modelIDs := make([]int64, len(targets))
+	for i, t := range targets {
+		modelIDs[i] = t.ModelID
+	}
+	var available []model.Model
+	if err := s.models.availableModels().Where("id IN ?", modelIDs).Find(&available).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[int64]model.Model, len(available))
+	for _, m := range available {
+		byID[m.ID] = m
+	}
+
+	deployments := make(map[int64][]AliasDeployment, len(aliases))
+	for _, t := range targets {
+		if m, ok := byID[t.ModelID]; ok {
+			deployments[t.AliasID] = append(deployments[t.AliasID], AliasDeployment{Model: m, Weight: t.Weight})
+		}
+	}
+	resolved := make([]ResolvedAlias, 0, len(aliases))
+	for _, a := range aliases {
+		if len(deployments[a.ID]) > 0 {
+			resolved = append(resolved, ResolvedAlias{Alias: a, Deployments: deployments[a.ID]})
+		}
+	}
+	return resolved, nil
+}
+
+// Filter 只保留allow允许的部署，用于按API令牌的模型范围过滤
+func (a *ResolvedAlias) Filter(allow func(modelID int64) bool) *ResolvedAlias {
+	filtered := &ResolvedAlias{Alias: a.Alias}
+	for _, d := range a.Deployments {
+		if allow(d.Model.ID) {
+			filtered.Deployments = append(filtered.Deployments, d)
+		}
+	}
+	return filtered
+}
+
+// Route 按别名的路由策略选择本次请求使用的部署，返回的第一个为选中的部署，其余作为故障转移的备用路由。
+// 开启Sticky且sessionKey不为空时始终按会话固定选择
+func (s *AliasService) Route(ctx context.Context, a *ResolvedAlias, sessionKey string) []model.Model {
+	if a.Alias.Policy != model.AliasPolicyScore || (a.Alias.Sticky && sessionKey != "") {
+		return a.Route(sessionKey)
+	}
+	ids := make([]int64, len(a.Deployments))
+	for i, d := range a.Deployments {
+		ids[i] = d.Model.ID
+	}
+	stats, err := s.scorer.Stats(ctx, ids)
+	if err != nil {
+		log.Printf("读取部署得分失败，改为按权重选择: alias=%s err=%v", a.Alias.Name, err)
+		return a.Route(sessionKey)
+	}
+	return a.RouteByScore(stats)
+}
+
+// Route 选择本次请求使用的部署，返回的第一个为选中的部署，其余按权重排序作为故障转移的备用路由。
+// 别名开启Sticky且sessionKey不为空时按会话固定选择，否则按权重随机选择；权重全部为0时按顺序使用
+func (a *ResolvedAlias) Route(sessionKey string) []model.Model {
+	var chosen int
+	if a.Alias.Sticky && sessionKey != "" {
+		chosen = stickyPick(a.Deployments, sessionKey)
+	} else {
+		chosen = weightedPick(a.Deployments)
+	}
+	if chosen < 0 {
+		chosen = 0
+	}
+
+	models := make([]model.Model, 0, len(a.Deployments))
+	models = append(models, a.Deployments[chosen].Model)
+	for i, d := range a.Deployments {
+		if i != chosen {
+			models = append(models, d.Model)
+		}
+	}
+	return models
+}
+
+// RouteByScore 按得分从高到低排列权重大于0的部署，少量流量仍按权重随机选择第一个部署；
+// 权重为0的部署排在最后，只作为故障转移的备用路由
+func (a *ResolvedAlias) RouteByScore(stats map[int64]RouteStats) []model.Model {
+	order := make([]int, 0, len(a.Deployments))
+	var drained []int
+	for i, d := range a.Deployments {
+		if d.Weight > 0 {
+			order = append(order, i)
+		} else {
+			drained = append(drained, i)
+		}
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return stats[a.Deployments[order[i]].Model.ID].Score > stats[a.Deployments[order[j]].Model.ID].Score
+	})
+	if len(order) > 1 && rand.Float64() < scoreExploreRate {
+		if chosen := weightedPick(a.Deployments); chosen >= 0 {
+			for i, idx := range order {
+				if idx == chosen {
+					copy(order[1:i+1], order[:i])
+					order[0] = chosen
+					break
+				}
+			}
+		}
+	}
+
+	models := make([]model.Model, 0, len(a.Deployments))
+	for _, i := range append(order, drained...) {
+		models = append(models, a.Deployments[i].Model)
+	}
+	return models
+}
+
+// weightedPick 按权重随机选择，没有权重大于0的部署时返回-1
+func weightedPick(deployments []AliasDeployment) int {
+	total := 0
+	for _, d := range deployments {
+		if d.Weight > 0 {
+			total += d.Weight
+		}
+	}
+	if total == 0 {
+		return -1
+	}
+	r := rand.Intn(total)
+	for i, d := range deployments {
+		if d.Weight <= 0 {
+			continue
+		}
+		r -= d.Weight
+		if r < 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+// stickyPick 按加权的最高随机权重哈希(rendezvous hashing)选择部署：同一会话在权重不变时始终选中同一个部署，
+// 调整权重或增删部署时只有按新权重应当迁移的那部分会话会换到其他部署。没有权重大于0的部署时返回-1
+func stickyPick(deployments []AliasDeployment, sessionKey string) int {
+	chosen, best := -1, math.Inf(-1)
+	for i, d := range deployments {
+		if d.Weight <= 0 {
+			continue
+		}
+		h := fnv.New64a()
+		h.Write([]byte(sessionKey))
+		h.Write([]byte{0})
+		h.Write([]byte(strconv.FormatInt(d.Model.ID, 10)))
+		// FNV的高位分布不够均匀，混淆后取高53位映射到(0,1)
+		x := h.Sum64()
+		x ^= x >> 33
+		x *= 0xff51afd7ed558ccd
+		x ^= x >> 33
+		u := (float64(x>>11) + 0.5) / (1 << 53)
+		if score := float64(d.Weight) / -math.Log(u); score > best {
+			chosen, best = i, score
+		}
+	}
+	return chosen
+}
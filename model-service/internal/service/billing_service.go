@@ -0,0 +1,134 @@
+package service
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+
+	"cybermind/model-service/internal/model"
+)
+
+var (
+	// ErrInsufficientPoints 用户积分不足
+	ErrInsufficientPoints = errors.New("insufficient points")
+	// ErrTokenQuotaExceeded 超出API令牌的积分额度
+	ErrTokenQuotaExceeded = errors.New("token points quota exceeded")
+)
+
+// Charge 一次扣费信息
+type Charge struct {
+	UserID    int64
+	ModelID   int64
+	Points    int
+	Source    string
+	RequestID string
+	TokenID   int64 // 通过平台API调用时扣减令牌的积分额度
+}
+
+type BillingService struct {
+	db *gorm.DB
+}
+
+func NewBillingService(db *gorm.DB) *BillingService {
+	return &BillingService{db: db}
+}
+
+// Consume 扣除积分并记录流水，余额不足时返回ErrInsufficientPoints，超出令牌额度时返回ErrTokenQuotaExceeded
+func (s *BillingService) Consume(charge *Charge) error {
+	if charge.Points <= 0 {
+		return nil
+	}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if charge.TokenID > 0 {
+			result := tx.Table("api_tokens").
+				Where("id = ? AND (points_quota = 0 OR points_used + ? <= points_quota)", charge.TokenID, charge.Points).
+				Update("points_used", gorm.Expr("points_used + ?", charge.Points))
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return ErrTokenQuotaExceeded
+			}
+		}
+
+		result := tx.Table("users").
+			Where("id = ? AND points >= ?", charge.UserID, charge.Points).
+			Update("points", gorm.Expr("points - ?", charge.Points))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInsufficientPoints
+		}
+		return s.record(tx, charge, -charge.Points, model.PointsTypeConsume)
+	})
+}
+
+// Refund 调用失败时退还已扣除的积分
+func (s *BillingService) Refund(charge *Charge) error {
+	if charge.Points <= 0 {
+		return nil
+	}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Table("users").
+			Where("id = ?", charge.UserID).
+			Update("points", gorm.Expr("points + ?", charge.Points)).Error; err != nil {
+			return err
+		}
+		if charge.TokenID > 0 {
+			if err := tx.Table("api_tokens").
+				Where("id = ?", charge.TokenID).
+				Update("points_used", gorm.Expr("GREATEST(points_used - ?, 0)", charge.Points)).Error; err != nil {
+				return err
+			}
+		}
+		return s.record(tx, charge, charge.Points, model.PointsTypeRefund)
+	})
+}
+
+// Settle 按实际用量结算：与已扣除的积分比较多退少补，并将charge.Points更新为实际扣除的积分。
+// 发送时已按最高价格预扣并检查了余额和令牌额度，补扣只发生在估算偏低时；用量已经发生，补扣部分全额扣除：
+// 余额不足时记为欠费(余额为负)，令牌已用额度可以超过points_quota，此后的请求由Consume拒绝，直到充值或调整额度
+func (s *BillingService) Settle(charge *Charge, points int) error {
+	if points == charge.Points {
+		return nil
+	}
+	delta := points - charge.Points
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Table("users").
+			Where("id = ?", charge.UserID).
+			Update("points", gorm.Expr("points - ?", delta)).Error; err != nil {
+			return err
+		}
+		if charge.TokenID > 0 {
+			if err := tx.Table("api_tokens").
+				Where("id = ?", charge.TokenID).
+				Update("points_used", gorm.Expr("GREATEST(points_used + ?, 0)", delta)).Error; err != nil {
+				return err
+			}
+		}
+		return s.record(tx, charge, -delta, model.PointsTypeAdjust)
+	})
+	if err != nil {
+		return err
+	}
+	charge.Points = points
+	return nil
+}
+
+func (s *BillingService) record(tx *gorm.DB, charge *Charge, change int, typ string) error {
+	var balance int
+	if err := tx.Table("users").Select("points").Where("id = ?", charge.UserID).Scan(&balance).Error; err != nil {
+		return err
+	}
+	return tx.Create(&model.PointsLedger{
+		UserID:    charge.UserID,
+		Change:    change,
+		Balance:   balance,
+		Type:      typ,
+		ModelID:   charge.ModelID,
+		Source:    charge.Source,
+		RequestID: charge.RequestID,
+		TokenID:   charge.TokenID,
+	}).Error
+}
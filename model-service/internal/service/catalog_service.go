@@ -0,0 +1,296 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+	"unicode/utf8"
+
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+
+	"cybermind/common/keycrypt"
+	"cybermind/common/modelconfig"
+	"cybermind/model-service/internal/model"
+	"cybermind/model-service/internal/relay"
+)
+
+const (
+	catalogTimeout   = 30 * time.Second // 获取上游模型列表的超时时间
+	maxModelNameSize = 50               // models.name和models.model_name的长度
+)
+
+// ErrNoCatalogSource 供应商下没有模型可作为连接配置模板，且没有提供base_url和api_key
+var ErrNoCatalogSource = errors.New("no model to use as catalog source, base_url and api_key are required")
+
+// ErrCatalogUpstream 获取上游模型列表失败，包装了上游返回的错误
+var ErrCatalogUpstream = errors.New("list upstream models failed")
+
+// CatalogSource 获取上游模型列表使用的连接配置：默认使用供应商下ID最小的模型，
+// 指定的字段覆盖模板模型的配置；供应商下还没有模型时必须提供base_url和api_key
+type CatalogSource struct {
+	TemplateModelID int64  `json:"template_model_id"`
+	APIType         string `json:"api_type"`
+	BaseURL         string `json:"base_url"`
+	ProxyURL        string `json:"proxy_url"`
+	APIKey          string `json:"api_key"`
+}
+
+// CatalogMatch 本地已有的模型
+type CatalogMatch struct {
+	ModelID   int64  `json:"model_id"`
+	Name      string `json:"name"`
+	ModelName string `json:"model_name"`
+	Status    int    `json:"status"`
+}
+
+// CatalogDiff 上游模型列表与本地模型的差异，按上游模型名对比
+type CatalogDiff struct {
+	ProviderID      int64                 `json:"provider_id"`
+	Provider        string                `json:"provider"`
+	TemplateModelID int64                 `json:"template_model_id"` // 为0时使用请求中的连接配置
+	New             []relay.UpstreamModel `json:"new"`               // 上游有、本地没有，可导入
+	Existing        []CatalogMatch        `json:"existing"`          // 两边都有
+	Missing         []CatalogMatch        `json:"missing"`           // 本地有、上游没有，可能已下线
+}
+
+// CatalogImportRequest 批量导入上游模型，导入的模型使用模板模型的连接配置
+type CatalogImportRequest struct {
+	CatalogSource
+	ModelNames       []string        `json:"model_names" binding:"required,min=1,max=200"` // 要导入的上游模型名
+	PointsPerRequest int             `json:"points_per_request" binding:"required,min=1"`
+	Tags             []string        `json:"tags"`                       // 为空时使用模板模型的标签
+	Config           json.RawMessage `json:"config"`                     // 为空时使用模板模型的配置
+	Status           int             `json:"status" binding:"oneof=0 1"` // 导入后的状态，默认0停用，测试通过后再启用
+}
+
+// CatalogSkip 未导入的模型及原因
+type CatalogSkip struct {
+	ModelName string `json:"model_name"`
+	Reason    string `json:"reason"`
+}
+
+// CatalogImportResult 导入结果
+type CatalogImportResult struct {
+	Created    []model.Model `json:"created"`
+	Skipped    []CatalogSkip `json:"skipped"`
+	ModelCount int           `json:"model_count"` // 导入后供应商的模型数量
+}
+
+// CatalogService 从供应商的模型列表接口同步模型目录
+type CatalogService struct {
+	db     *gorm.DB
+	client *relay.Client
+}
+
+func NewCatalogService(db *gorm.DB, client *relay.Client) *CatalogService {
+	return &CatalogService{db: db, client: client}
+}
+
+// Diff 获取上游模型列表并与供应商下已有的模型对比，供应商不存在时返回gorm.ErrRecordNotFound
+func (s *CatalogService) Diff(ctx context.Context, providerID int64, src CatalogSource) (*CatalogDiff, error) {
+	provider, template, err := s.source(providerID, src)
+	if err != nil {
+		return nil, err
+	}
+	upstream, err := s.listUpstream(ctx, template)
+	if err != nil {
+		return nil, err
+	}
+	var models []model.Model
+	if err := s.db.Where("provider = ?", provider.Code).Order("id").Find(&models).Error; err != nil {
+		return nil, err
+	}
+
+	diff := &CatalogDiff{
+		ProviderID:      provider.ID,
+		Provider:        provider.Code,
+		TemplateModelID: template.ID,
+		New:             []relay.UpstreamModel{},
+		Existing:        []CatalogMatch{},
+		Missing:         []CatalogMatch{},
+	}
+	local := make(map[string]bool, len(models))
+	for _, m := range models {
+		local[m.ModelName] = true
+		match := CatalogMatch{ModelID: m.ID, Name: m.Name, ModelName: m.ModelName, Status: m.Status}
+		if _, ok := upstream[m.ModelName]; ok {
+			diff.Existing = append(diff.Existing, match)
+		} else {
+			diff.Missing = append(diff.Missing, match)
+		}
+	}
+	for id, um := range upstream {
+		if !local[id] {
+			diff.New = append(diff.New, um)
+		}
+	}
+	sort.Slice(diff.New, func(i, j int) bool { return diff.New[i].ID < diff.New[j].ID })
+	return diff, nil
+}
+
+// Import 批量创建选中的上游模型并更新供应商的模型数量。上游不存在、本地已存在或名称过长的模型跳过；
+// Config校验失败时返回modelconfig.FieldError列表
+func (s *CatalogService) Import(ctx context.Context, providerID int64, req *CatalogImportRequest) (*CatalogImportResult, []modelconfig.FieldError, error) {
+	provider, template, err := s.source(providerID, req.CatalogSource)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	config := template.Config
+	if len(req.Config) > 0 {
+		config = req.Config
+	}
+	if errs := modelconfig.SchemaFor(relay.AdapterName(template)).Validate(config); len(errs) > 0 {
+		return nil, errs, nil
+	}
+	tags := template.Tags
+	if req.Tags != nil {
+		tags = pq.StringArray(req.Tags)
+	}
+
+	upstream, err := s.listUpstream(ctx, template)
+	if err != nil {
+		return nil, nil, err
+	}
+	var models []model.Model
+	if err := s.db.Select("name, model_name").Where("provider = ?", provider.Code).Find(&models).Error; err != nil {
+		return nil, nil, err
+	}
+	var names []string
+	if err := s.db.Model(&model.Model{}).Pluck("name", &names).Error; err != nil {
+		return nil, nil, err
+	}
+	existing := make(map[string]bool, len(models))
+	for _, m := range models {
+		existing[m.ModelName] = true
+	}
+	usedNames := make(map[string]bool, len(names))
+	for _, name := range names {
+		usedNames[name] = true
+	}
+
+	result := &CatalogImportResult{Created: []model.Model{}, Skipped: []CatalogSkip{}}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		for _, modelName := range req.ModelNames {
+			um, ok := upstream[modelName]
+			switch {
+			case !ok:
+				result.Skipped = append(result.Skipped, CatalogSkip{ModelName: modelName, Reason: "上游不存在该模型"})
+				continue
+			case existing[modelName]:
+				result.Skipped = append(result.Skipped, CatalogSkip{ModelName: modelName, Reason: "模型已存在"})
+				continue
+			case utf8.RuneCountInString(modelName) > maxModelNameSize:
+				result.Skipped = append(result.Skipped, CatalogSkip{ModelName: modelName, Reason: "模型名超过50个字符"})
+				continue
+			}
+
+			// 优先使用上游的展示名称，过长或重名时使用模型名
+			name := um.DisplayName
+			if name == "" || utf8.RuneCountInString(name) > maxModelNameSize || usedNames[name] {
+				name = modelName
+			}
+			if usedNames[name] {
+				result.Skipped = append(result.Skipped, CatalogSkip{ModelName: modelName, Reason: "模型名称已存在"})
+				continue
+			}
+
+			m := model.Model{
+				Name:             name,
+				Provider:         provider.Code,
+				APIType:          template.APIType,
+				BaseURL:          template.BaseURL,
+				ProxyURL:         template.ProxyURL,
+				APIKey:           template.APIKey,
+				ModelName:        modelName,
+				PointsPerRequest: req.PointsPerRequest,
+				Tags:             tags,
+				Config:           config,
+				KeyStrategy:      template.KeyStrategy,
+				Status:           req.Status,
+			}
+			if m.KeyStrategy == "" {
+				m.KeyStrategy = model.KeyStrategyRoundRobin
+			}
+			// 状态为0时gorm会使用默认值1，单独更新
+			if err := tx.Create(&m).Error; err != nil {
+				return err
+			}
+			if req.Status == 0 {
+				if err := tx.Model(&m).Update("status", 0).Error; err != nil {
+					return err
+				}
+			}
+			existing[modelName] = true
+			usedNames[name] = true
+			result.Created = append(result.Created, m)
+		}
+		if err := provider.UpdateModelCount(tx); err != nil {
+			return err
+		}
+		result.ModelCount = provider.ModelCount
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return result, nil, nil
+}
+
+// source 获取供应商和用于连接上游的模板模型
+func (s *CatalogService) source(providerID int64, src CatalogSource) (*model.Provider, *model.Model, error) {
+	var provider model.Provider
+	if err := s.db.First(&provider, providerID).Error; err != nil {
+		return nil, nil, err
+	}
+
+	template := &model.Model{Provider: provider.Code}
+	query := s.db.Where("provider = ?", provider.Code)
+	if src.TemplateModelID > 0 {
+		query = query.Where("id = ?", src.TemplateModelID)
+	}
+	err := query.Order("id").First(template).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound) && src.TemplateModelID > 0:
+		return nil, nil, err
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		if src.BaseURL == "" || src.APIKey == "" {
+			return nil, nil, ErrNoCatalogSource
+		}
+	case err != nil:
+		return nil, nil, err
+	}
+
+	if src.APIType != "" {
+		template.APIType = src.APIType
+	}
+	if src.BaseURL != "" {
+		template.BaseURL = src.BaseURL
+	}
+	if src.ProxyURL != "" {
+		template.ProxyURL = src.ProxyURL
+	}
+	if src.APIKey != "" && !keycrypt.IsMasked(src.APIKey) {
+		template.APIKey = model.SecretKey(src.APIKey)
+	}
+	return &provider, template, nil
+}
+
+// listUpstream 获取上游模型列表，按模型名索引
+func (s *CatalogService) listUpstream(ctx context.Context, template *model.Model) (map[string]relay.UpstreamModel, error) {
+	ctx, cancel := context.WithTimeout(ctx, catalogTimeout)
+	defer cancel()
+	list, err := s.client.ListModels(ctx, template)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrCatalogUpstream, err)
+	}
+	models := make(map[string]relay.UpstreamModel, len(list))
+	for _, um := range list {
+		models[um.ID] = um
+	}
+	return models, nil
+}
@@ -0,0 +1,192 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 熔断器状态
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half_open"
+)
+
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// BreakerConfig 熔断器配置
+type BreakerConfig struct {
+	FailureThreshold int           // 连续失败达到该次数时熔断
+	OpenTimeout      time.Duration // 熔断持续时间，结束后进入半开状态
+	HalfOpenRequests int           // 半开状态允许的试探请求数
+}
+
+// BreakerConfigFromEnv 从环境变量CIRCUIT_FAILURE_THRESHOLD、CIRCUIT_OPEN_TIMEOUT(秒)、
+// CIRCUIT_HALF_OPEN_REQUESTS读取熔断器配置，未配置时使用默认值
+func BreakerConfigFromEnv() BreakerConfig {
+	return BreakerConfig{
+		FailureThreshold: envInt("CIRCUIT_FAILURE_THRESHOLD", 5),
+		OpenTimeout:      time.Duration(envInt("CIRCUIT_OPEN_TIMEOUT", 30)) * time.Second,
+		HalfOpenRequests: envInt("CIRCUIT_HALF_OPEN_REQUESTS", 1),
+	}
+}
+
+func envInt(name string, def int) int {
+	if v, err := strconv.Atoi(os.Getenv(name)); err == nil && v > 0 {
+		return v
+	}
+	return def
+}
+
+// breakerAllowScript 判断是否放行：熔断超时后转为半开，半开状态只放行有限的试探请求。
+// 返回0拒绝，1放行，2作为试探请求放行
+var breakerAllowScript = redis.NewScript(`
+local key = KEYS[1]
+local open_ms = tonumber(ARGV[1])
+local half_max = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+local state = redis.call('HGET', key, 'state')
+if state == 'open' then
+  local opened = tonumber(redis.call('HGET', key, 'opened_at') or '0')
+  if now - opened < open_ms then
+    return 0
+  end
+  redis.call('HSET', key, 'state', 'half_open', 'trials', 0)
+  state = 'half_open'
+end
+if state == 'half_open' then
+  local trials = redis.call('HINCRBY', key, 'trials', 1)
+  if trials > half_max then
+    return 0
+  end
+  return 2
+end
+return 1
+`)
+
+// breakerRecordScript 记录调用结果：成功时恢复为关闭状态；
+// 失败时半开状态直接重新熔断，关闭状态连续失败达到阈值时熔断
+var breakerRecordScript = redis.NewScript(`
+local key = KEYS[1]
+local success = tonumber(ARGV[1])
+local threshold = tonumber(ARGV[2])
+local ttl_ms = tonumber(ARGV[3])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+local state = redis.call('HGET', key, 'state')
+if success == 1 then
+  if state ~= 'open' then
+    redis.call('DEL', key)
+  end
+  return 0
+end
+
+if state == 'half_open' then
+  redis.call('HSET', key, 'state', 'open', 'opened_at', now, 'failures', 0)
+  redis.call('PEXPIRE', key, ttl_ms)
+  return 1
+end
+if state == 'open' then
+  return 1
+end
+local failures = redis.call('HINCRBY', key, 'failures', 1)
+if failures >= threshold then
+  redis.call('HSET', key, 'state', 'open', 'opened_at', now, 'failures', 0)
+  redis.call('PEXPIRE', key, ttl_ms)
+  return 1
+end
+redis.call('PEXPIRE', key, ttl_ms)
+return 0
+`)
+
+// breakerReleaseScript 释放半开状态的试探名额，不计成功或失败，用于请求本身的错误和调用方取消
+var breakerReleaseScript = redis.NewScript(`
+local key = KEYS[1]
+if redis.call('HGET', key, 'state') ~= 'half_open' then
+  return 0
+end
+local trials = tonumber(redis.call('HGET', key, 'trials') or '0')
+if trials > 0 then
+  redis.call('HINCRBY', key, 'trials', -1)
+end
+return 1
+`)
+
+// CircuitBreaker 基于Redis的熔断器，按模型(供应商接入点)统计，多个实例共享状态。
+// Redis不可用时放行所有请求
+type CircuitBreaker struct {
+	rdb    *redis.Client
+	config BreakerConfig
+}
+
+func NewCircuitBreaker(rdb *redis.Client, config BreakerConfig) *CircuitBreaker {
+	return &CircuitBreaker{rdb: rdb, config: config}
+}
+
+func breakerKey(modelID int64) string {
+	return fmt.Sprintf("circuit:model:%d", modelID)
+}
+
+// Allow 判断是否可以调用模型，trial表示作为半开状态的试探请求放行，
+// 调用方必须通过Record记录结果或通过Release释放名额
+func (b *CircuitBreaker) Allow(ctx context.Context, modelID int64) (allowed, trial bool) {
+	n, err := breakerAllowScript.Run(ctx, b.rdb, []string{breakerKey(modelID)},
+		b.config.OpenTimeout.Milliseconds(), b.config.HalfOpenRequests).Int()
+	if err != nil {
+		log.Printf("circuit breaker check failed: %v", err)
+		return true, false
+	}
+	return n != 0, n == 2
+}
+
+// Record 记录调用结果
+func (b *CircuitBreaker) Record(modelID int64, success bool) {
+	flag := 0
+	if success {
+		flag = 1
+	}
+	// 状态在熔断结束后保留一段时间，用于半开状态的判断
+	ttl := (b.config.OpenTimeout * 10).Milliseconds()
+	opened, err := breakerRecordScript.Run(context.Background(), b.rdb, []string{breakerKey(modelID)},
+		flag, b.config.FailureThreshold, ttl).Int()
+	if err != nil {
+		log.Printf("circuit breaker record failed: %v", err)
+		return
+	}
+	if opened == 1 && !success {
+		log.Printf("模型熔断: model=%d timeout=%s", modelID, b.config.OpenTimeout)
+	}
+}
+
+// Release 释放试探名额，不计成功或失败
+func (b *CircuitBreaker) Release(modelID int64) {
+	if err := breakerReleaseScript.Run(context.Background(), b.rdb, []string{breakerKey(modelID)}).Err(); err != nil {
+		log.Printf("circuit breaker release failed: %v", err)
+	}
+}
+
+// State 获取模型的熔断状态
+func (b *CircuitBreaker) State(ctx context.Context, modelID int64) string {
+	values, err := b.rdb.HMGet(ctx, breakerKey(modelID), "state", "opened_at").Result()
+	if err != nil || values[0] == nil {
+		return CircuitClosed
+	}
+	state, _ := values[0].(string)
+	if state == CircuitOpen {
+		openedAt, _ := strconv.ParseInt(fmt.Sprint(values[1]), 10, 64)
+		if time.Since(time.UnixMilli(openedAt)) >= b.config.OpenTimeout {
+			return CircuitHalfOpen
+		}
+	}
+	return state
+}
@@ -0,0 +1,335 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+
+	"cybermind/model-service/internal/model"
+	"cybermind/model-service/internal/relay"
+)
+
+const (
+	healthWindow          = 10                // 统计错误率的时间窗口(分钟)
+	defaultCooldown       = time.Minute       // 429未返回Retry-After时的冷却时间
+	maxCooldown           = 30 * time.Minute  // 冷却时间上限
+	errorRateCooldown     = time.Minute       // 错误率过高时的冷却时间
+	errorRateMinErrors    = 5                 // 窗口内错误数达到该值才按错误率冷却
+	errorRateThreshold    = 0.5               // 触发冷却的错误率
+	probeTimeout          = 10 * time.Second  // 单次探测的超时时间
+	maxLastErrorLength    = 500               // LastError的最大长度
+	keyHealthStatsKeyTmpl = "keyhealth:%d:%d" // keyhealth:{key_id}:{unix分钟}
+	keyHealthQueueSize    = 10000             // 调用结果队列长度，处理跟不上时丢弃新结果
+	keyHealthWorkers      = 4                 // 处理调用结果的协程数
+	keyHealthProbeLockKey = "keyhealth:probe:lock"
+)
+
+// releaseLockScript 只删除自己持有的锁，避免锁过期后删除其他实例的锁
+var releaseLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// KeyHealthStats 时间窗口内的调用统计
+type KeyHealthStats struct {
+	Requests  int64   `json:"requests"`
+	Errors    int64   `json:"errors"`
+	ErrorRate float64 `json:"error_rate"`
+}
+
+// KeyHealth API Key健康状态
+type KeyHealth struct {
+	State string `json:"state"` // healthy/degraded/cooldown/disabled/auto_disabled
+	KeyHealthStats
+}
+
+// KeyHealthService 跟踪API Key的调用结果：429时按Retry-After冷却，认证失败时自动停用，
+// 错误率过高时短暂冷却，并定期探测自动停用的Key，恢复后重新启用。
+// 调用结果先放入内存队列，由后台协程写入Redis和数据库，不阻塞请求
+type KeyHealthService struct {
+	db      *gorm.DB
+	rdb     *redis.Client
+	client  *relay.Client
+	reports chan keyReport
+	wg      sync.WaitGroup
+}
+
+// keyReport 一次上游调用结果
+type keyReport struct {
+	keyID int64
+	err   error
+	at    time.Time
+}
+
+func NewKeyHealthService(db *gorm.DB, rdb *redis.Client, client *relay.Client) *KeyHealthService {
+	return &KeyHealthService{db: db, rdb: rdb, client: client, reports: make(chan keyReport, keyHealthQueueSize)}
+}
+
+// Start 启动处理调用结果的后台协程，ctx取消时处理完队列中剩余的结果后退出
+func (s *KeyHealthService) Start(ctx context.Context) {
+	for i := 0; i < keyHealthWorkers; i++ {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.run(ctx)
+		}()
+	}
+}
+
+// Wait 等待Start的ctx取消后剩余结果处理完成
+func (s *KeyHealthService) Wait() {
+	s.wg.Wait()
+}
+
+func (s *KeyHealthService) run(ctx context.Context) {
+	for {
+		select {
+		case r := <-s.reports:
+			s.record(r)
+		case <-ctx.Done():
+			for {
+				select {
+				case r := <-s.reports:
+					s.record(r)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func statsKey(keyID int64, minute int64) string {
+	return fmt.Sprintf(keyHealthStatsKeyTmpl, keyID, minute)
+}
+
+// Report 记录一次上游调用结果，放入队列后立即返回，队列已满时丢弃。keyID为0(使用模型自身的Key)、调用方主动取消、
+// 或上游因请求本身返回的4xx错误(401/403/429除外)与Key无关，不记录
+func (s *KeyHealthService) Report(keyID int64, err error) {
+	if keyID == 0 || errors.Is(err, context.Canceled) {
+		return
+	}
+	var apiErr *relay.APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode >= 400 && apiErr.StatusCode < 500 &&
+		apiErr.StatusCode != http.StatusUnauthorized && apiErr.StatusCode != http.StatusForbidden &&
+		apiErr.StatusCode != http.StatusTooManyRequests {
+		return
+	}
+	select {
+	case s.reports <- keyReport{keyID: keyID, err: err, at: time.Now()}:
+	default:
+		log.Printf("Key调用结果队列已满，丢弃结果: key=%d", keyID)
+	}
+}
+
+// record 写入一次调用结果：计入错误率统计，失败时更新Key的错误信息，并按错误类型冷却或自动停用
+func (s *KeyHealthService) record(r keyReport) {
+	ctx := context.Background()
+	keyID, err := r.keyID, r.err
+
+	field := "ok"
+	if err != nil {
+		field = "err"
+	}
+	key := statsKey(keyID, r.at.Unix()/60)
+	pipe := s.rdb.TxPipeline()
+	pipe.HIncrBy(ctx, key, field, 1)
+	pipe.Expire(ctx, key, (healthWindow+1)*time.Minute)
+	if _, pipeErr := pipe.Exec(ctx); pipeErr != nil {
+		log.Printf("记录Key调用结果失败: key=%d err=%v", keyID, pipeErr)
+	}
+	if err == nil {
+		return
+	}
+
+	now := r.at
+	var apiErr *relay.APIError
+	updates := map[string]interface{}{
+		"error_count":   gorm.Expr("error_count + 1"),
+		"last_error":    truncate(err.Error(), maxLastErrorLength),
+		"last_error_at": now,
+	}
+
+	switch {
+	case errors.As(err, &apiErr) && (apiErr.StatusCode == http.StatusUnauthorized || apiErr.StatusCode == http.StatusForbidden):
+		updates["status"] = model.KeyStatusAutoDisabled
+		log.Printf("上游认证失败，自动停用Key: key=%d status=%d", keyID, apiErr.StatusCode)
+	case errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusTooManyRequests:
+		cooldown := apiErr.RetryAfter
+		if cooldown <= 0 {
+			cooldown = defaultCooldown
+		}
+		if cooldown > maxCooldown {
+			cooldown = maxCooldown
+		}
+		updates["cooldown_until"] = now.Add(cooldown)
+		log.Printf("上游限流，Key进入冷却: key=%d cooldown=%s", keyID, cooldown)
+	default:
+		if stats, statsErr := s.Stats(ctx, keyID); statsErr == nil &&
+			stats.Errors >= errorRateMinErrors && stats.ErrorRate >= errorRateThreshold {
+			updates["cooldown_until"] = now.Add(errorRateCooldown)
+			log.Printf("Key错误率过高，进入冷却: key=%d errors=%d rate=%.2f", keyID, stats.Errors, stats.ErrorRate)
+		}
+	}
+
+	// 只更新启用中的Key，避免覆盖手动停用
+	if err := s.db.Model(&model.APIKeyPool{}).
+		Where("id = ? AND status = ?", keyID, model.KeyStatusEnabled).
+		UpdateColumns(updates).Error; err != nil {
+		log.Printf("更新Key健康状态失败: key=%d err=%v", keyID, err)
+	}
+}
+
+// Stats 获取Key在时间窗口内的调用统计
+func (s *KeyHealthService) Stats(ctx context.Context, keyID int64) (*KeyHealthStats, error) {
+	all, err := s.StatsBatch(ctx, []int64{keyID})
+	if err != nil {
+		return nil, err
+	}
+	return all[keyID], nil
+}
+
+// StatsBatch 批量获取Key在时间窗口内的调用统计
+func (s *KeyHealthService) StatsBatch(ctx context.Context, keyIDs []int64) (map[int64]*KeyHealthStats, error) {
+	current := time.Now().Unix() / 60
+	pipe := s.rdb.Pipeline()
+	cmds := make(map[int64][]*redis.SliceCmd, len(keyIDs))
+	for _, id := range keyIDs {
+		for i := int64(0); i < healthWindow; i++ {
+			cmds[id] = append(cmds[id], pipe.HMGet(ctx, statsKey(id, current-i), "ok", "err"))
+		}
+	}
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+
+	result := make(map[int64]*KeyHealthStats, len(keyIDs))
+	for id, list := range cmds {
+		stats := &KeyHealthStats{}
+		for _, cmd := range list {
+			values := cmd.Val()
+			ok, errs := parseCount(values, 0), parseCount(values, 1)
+			stats.Requests += ok + errs
+			stats.Errors += errs
+		}
+		if stats.Requests > 0 {
+			stats.ErrorRate = float64(stats.Errors) / float64(stats.Requests)
+		}
+		result[id] = stats
+	}
+	return result, nil
+}
+
+func parseCount(values []interface{}, i int) int64 {
+	if i >= len(values) {
+		return 0
+	}
+	s, _ := values[i].(string)
+	n, _ := strconv.ParseInt(s, 10, 64)
+	return n
+}
+
+// Health 根据Key的状态和调用统计判断健康状态
+func Health(k *model.APIKeyPool, stats *KeyHealthStats) KeyHealth {
+	health := KeyHealth{State: "healthy"}
+	if stats != nil {
+		health.KeyHealthStats = *stats
+	}
+	switch {
+	case k.Status == model.KeyStatusDisabled:
+		health.State = "disabled"
+	case k.Status == model.KeyStatusAutoDisabled:
+		health.State = "auto_disabled"
+	case k.CooldownUntil != nil && k.CooldownUntil.After(time.Now()):
+		health.State = "cooldown"
+	case health.Errors > 0 && health.ErrorRate >= errorRateThreshold:
+		health.State = "degraded"
+	}
+	return health
+}
+
+// StartProbe 定期探测自动停用的Key，探测成功后重新启用。多个实例通过Redis锁保证每轮只有一个实例探测
+func (s *KeyHealthService) StartProbe(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.probeLocked(ctx, interval)
+			}
+		}
+	}()
+}
+
+// probeLocked 获取探测锁后探测，锁的过期时间为探测间隔，其他实例持有锁时跳过本轮
+func (s *KeyHealthService) probeLocked(ctx context.Context, ttl time.Duration) {
+	token := strconv.FormatInt(time.Now().UnixNano(), 36)
+	ok, err := s.rdb.SetNX(ctx, keyHealthProbeLockKey, token, ttl).Result()
+	if err != nil {
+		log.Printf("获取Key探测锁失败: %v", err)
+		return
+	}
+	if !ok {
+		return
+	}
+	defer func() {
+		if err := releaseLockScript.Run(context.Background(), s.rdb, []string{keyHealthProbeLockKey}, token).Err(); err != nil {
+			log.Printf("释放Key探测锁失败: %v", err)
+		}
+	}()
+	s.probe(ctx)
+}
+
+func (s *KeyHealthService) probe(ctx context.Context) {
+	var keys []model.APIKeyPool
+	if err := s.db.WithContext(ctx).Where("status = ?", model.KeyStatusAutoDisabled).Find(&keys).Error; err != nil {
+		log.Printf("查询自动停用的Key失败: %v", err)
+		return
+	}
+
+	for _, k := range keys {
+		var m model.Model
+		if err := s.db.WithContext(ctx).First(&m, k.ModelID).Error; err != nil {
+			continue
+		}
+
+		probeCtx, cancel := context.WithTimeout(ctx, probeTimeout)
+		err := s.client.Probe(probeCtx, &m, string(k.APIKey))
+		cancel()
+		if err != nil {
+			s.db.Model(&model.APIKeyPool{}).Where("id = ?", k.ID).
+				UpdateColumns(map[string]interface{}{"last_error": truncate(err.Error(), maxLastErrorLength)})
+			continue
+		}
+
+		if err := s.db.Model(&model.APIKeyPool{}).
+			Where("id = ? AND status = ?", k.ID, model.KeyStatusAutoDisabled).
+			UpdateColumns(map[string]interface{}{"status": model.KeyStatusEnabled, "cooldown_until": nil}).Error; err != nil {
+			log.Printf("重新启用Key失败: key=%d err=%v", k.ID, err)
+			continue
+		}
+		log.Printf("Key探测成功，已重新启用: key=%d", k.ID)
+	}
+}
+
+// truncate 按字符截断，避免截断多字节字符
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) > n {
+		return string(runes[:n])
+	}
+	return s
+}
@@ -0,0 +1,187 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+
+	"cybermind/model-service/internal/model"
+)
+
+// selectAttempts 选中的Key在更新前被停用时重新选择的次数
+const selectAttempts = 3
+
+// ErrNoAvailableKey 密钥池中的Key全部停用或处于冷却中
+var ErrNoAvailableKey = errors.New("no available api key")
+
+// KeySelection 选中的上游API Key，KeyID为0表示密钥池为空，使用模型自身的APIKey
+type KeySelection struct {
+	KeyID  int64
+	APIKey model.SecretKey
+}
+
+// KeySelector 按模型的KeyStrategy从API Key池中选择Key，并记录使用次数和最后使用时间
+type KeySelector struct {
+	db  *gorm.DB
+	rdb *redis.Client
+}
+
+func NewKeySelector(db *gorm.DB, rdb *redis.Client) *KeySelector {
+	return &KeySelector{db: db, rdb: rdb}
+}
+
+type poolKey struct {
+	ID     int64
+	APIKey model.SecretKey
+	Weight int
+}
+
+// Select 选择一个启用且不在冷却中的Key；密钥池中没有任何Key时使用Model.APIKey，
+// 有Key但全部停用或冷却时返回ErrNoAvailableKey
+func (s *KeySelector) Select(ctx context.Context, m *model.Model) (*KeySelection, error) {
+	for i := 0; i < selectAttempts; i++ {
+		selection, err := s.selectByStrategy(ctx, m)
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return s.fallback(ctx, m)
+		case err != nil:
+			return nil, err
+		case selection != nil:
+			return selection, nil
+		}
+		// 选中的Key在更新前被停用或删除，重新选择
+	}
+	return nil, ErrNoAvailableKey
+}
+
+func (s *KeySelector) selectByStrategy(ctx context.Context, m *model.Model) (*KeySelection, error) {
+	switch m.KeyStrategy {
+	case model.KeyStrategyLeastUsed:
+		return s.leastUsed(ctx, m.ID)
+	case model.KeyStrategyWeighted:
+		return s.pick(ctx, m.ID, true)
+	case model.KeyStrategyRandom:
+		return s.pick(ctx, m.ID, false)
+	default:
+		return s.roundRobin(ctx, m.ID)
+	}
+}
+
+// fallback 没有启用的Key时，只有密钥池为空才使用Model.APIKey
+func (s *KeySelector) fallback(ctx context.Context, m *model.Model) (*KeySelection, error) {
+	var total int64
+	if err := s.db.WithContext(ctx).Model(&model.APIKeyPool{}).Where("model_id = ?", m.ID).Count(&total).Error; err != nil {
+		return nil, err
+	}
+	if total > 0 {
+		return nil, ErrNoAvailableKey
+	}
+	return &KeySelection{APIKey: m.APIKey}, nil
+}
+
+// leastUsed 选择使用次数最少的Key，选择和计数在同一条语句中完成
+func (s *KeySelector) leastUsed(ctx context.Context, modelID int64) (*KeySelection, error) {
+	var selection KeySelection
+	result := s.db.WithContext(ctx).Raw(`
+UPDATE api_key_pools SET usage_count = usage_count + 1, last_used_at = ?
+WHERE id = (
+	SELECT id FROM api_key_pools
+	WHERE model_id = ? AND status = 1 AND deleted_at IS NULL AND (cooldown_until IS NULL OR cooldown_until <= ?)
+	ORDER BY usage_count ASC, id ASC
+	LIMIT 1
+	FOR UPDATE SKIP LOCKED
+)
+RETURNING id AS key_id, api_key`, time.Now(), modelID, time.Now()).Scan(&selection)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &selection, nil
+}
+
+// roundRobin 按Redis中的计数器轮询启用的Key，Redis不可用时退化为leastUsed
+func (s *KeySelector) roundRobin(ctx context.Context, modelID int64) (*KeySelection, error) {
+	keys, err := s.enabledKeys(ctx, modelID)
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := s.rdb.Incr(ctx, fmt.Sprintf("keypool:%d:cursor", modelID)).Result()
+	if err != nil {
+		log.Printf("读取Key轮询计数失败，改为选择使用次数最少的Key: model=%d err=%v", modelID, err)
+		return s.leastUsed(ctx, modelID)
+	}
+	return s.use(ctx, keys[int((n-1)%int64(len(keys)))])
+}
+
+// pick 随机选择启用的Key，weighted为true时按权重选择
+func (s *KeySelector) pick(ctx context.Context, modelID int64, weighted bool) (*KeySelection, error) {
+	keys, err := s.enabledKeys(ctx, modelID)
+	if err != nil {
+		return nil, err
+	}
+	if !weighted {
+		return s.use(ctx, keys[rand.Intn(len(keys))])
+	}
+
+	total := 0
+	for _, k := range keys {
+		total += keyWeight(k)
+	}
+	r := rand.Intn(total)
+	for _, k := range keys {
+		r -= keyWeight(k)
+		if r < 0 {
+			return s.use(ctx, k)
+		}
+	}
+	return s.use(ctx, keys[len(keys)-1])
+}
+
+func keyWeight(k poolKey) int {
+	if k.Weight <= 0 {
+		return 1
+	}
+	return k.Weight
+}
+
+func (s *KeySelector) enabledKeys(ctx context.Context, modelID int64) ([]poolKey, error) {
+	var keys []poolKey
+	if err := s.db.WithContext(ctx).Model(&model.APIKeyPool{}).
+		Select("id, api_key, weight").
+		Where("model_id = ? AND status = 1", modelID).
+		Where("cooldown_until IS NULL OR cooldown_until <= ?", time.Now()).
+		Order("id ASC").
+		Find(&keys).Error; err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return keys, nil
+}
+
+// use 记录Key的使用，Key在选择后被停用时返回nil
+func (s *KeySelector) use(ctx context.Context, k poolKey) (*KeySelection, error) {
+	result := s.db.WithContext(ctx).Model(&model.APIKeyPool{}).
+		Where("id = ? AND status = 1", k.ID).
+		UpdateColumns(map[string]interface{}{
+			"usage_count":  gorm.Expr("usage_count + 1"),
+			"last_used_at": time.Now(),
+		})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil
+	}
+	return &KeySelection{KeyID: k.ID, APIKey: k.APIKey}, nil
+}
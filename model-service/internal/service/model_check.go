@@ -0,0 +1,254 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"cybermind/model-service/internal/model"
+	"cybermind/model-service/internal/relay"
+)
+
+const (
+	checkTimeout = 30 * time.Second // 单项测试的超时时间
+	checkPrompt  = "Reply with OK."
+	// checkImage 1x1像素的PNG图片，用于检测视觉能力
+	checkImage = "data:image/png;base64,iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAYAAAAfFcSJAAAADUlEQVR42mP8z8BQDwAEhQGAhKmMIQAAAABJRU5ErkJggg=="
+)
+
+// checkTool 检测工具调用能力时提供的工具
+var checkTool = json.RawMessage(`[{"type":"function","function":{"name":"get_current_time","description":"Get the current time.","parameters":{"type":"object","properties":{}}}}]`)
+
+// ProbeResult 单项测试的结果
+type ProbeResult struct {
+	Success    bool   `json:"success"`
+	StatusCode int    `json:"status_code"`     // 上游HTTP状态码，请求未到达上游时为0
+	LatencyMs  int64  `json:"latency_ms"`      // 流式请求为收到第一个分片的耗时
+	Error      string `json:"error,omitempty"` // 上游错误响应体或网络错误
+}
+
+// Capabilities 能力检测结果，Success表示支持该能力
+type Capabilities struct {
+	Streaming ProbeResult `json:"streaming"`
+	Tools     ProbeResult `json:"tools"`
+	Vision    ProbeResult `json:"vision"`
+}
+
+// ModelCheckResult 连接测试结果，内嵌的ProbeResult为基础对话补全的结果
+type ModelCheckResult struct {
+	ModelID  int64  `json:"model_id"`
+	APIKeyID int64  `json:"api_key_id"` // 为0时使用模型自身的Key
+	Adapter  string `json:"adapter"`
+	ProbeResult
+	Capabilities *Capabilities `json:"capabilities,omitempty"` // 基础对话补全失败或未要求检测时为空
+	CheckedAt    time.Time     `json:"checked_at"`
+}
+
+// ModelCheckService 使用模型配置的BaseURL和Key向上游发送最小的对话补全请求，
+// 检查模型是否可用并检测流式输出、工具调用和视觉能力
+type ModelCheckService struct {
+	db     *gorm.DB
+	client *relay.Client
+}
+
+func NewModelCheckService(db *gorm.DB, client *relay.Client) *ModelCheckService {
+	return &ModelCheckService{db: db, client: client}
+}
+
+// CheckModel 使用模型自身的Key测试模型，模型不存在时返回gorm.ErrRecordNotFound
+func (s *ModelCheckService) CheckModel(ctx context.Context, modelID int64, capabilities bool) (*ModelCheckResult, error) {
+	var m model.Model
+	if err := s.db.First(&m, modelID).Error; err != nil {
+		return nil, err
+	}
+	return s.check(ctx, &m, 0, capabilities), nil
+}
+
+// CheckAPIKey 使用Key池中的Key测试其所属模型，Key或模型不存在时返回gorm.ErrRecordNotFound
+func (s *ModelCheckService) CheckAPIKey(ctx context.Context, keyID int64, capabilities bool) (*ModelCheckResult, error) {
+	var key model.APIKeyPool
+	if err := s.db.First(&key, keyID).Error; err != nil {
+		return nil, err
+	}
+	var m model.Model
+	if err := s.db.First(&m, key.ModelID).Error; err != nil {
+		return nil, err
+	}
+	m.APIKey = key.APIKey
+	return s.check(ctx, &m, key.ID, capabilities), nil
+}
+
+// Save 保存为模型或Key最近一次的健康检查结果
+func (s *ModelCheckService) Save(result *ModelCheckResult) error {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	check := model.ModelHealthCheck{
+		ModelID:    result.ModelID,
+		APIKeyID:   result.APIKeyID,
+		Success:    result.Success,
+		StatusCode: result.StatusCode,
+		LatencyMs:  result.LatencyMs,
+		Result:     data,
+		CheckedAt:  result.CheckedAt,
+	}
+	return s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "model_id"}, {Name: "api_key_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"success", "status_code", "latency_ms", "result", "checked_at"}),
+	}).Create(&check).Error
+}
+
+// ListHealthChecks 获取模型及其Key最近一次的健康检查结果
+func (s *ModelCheckService) ListHealthChecks(modelID int64) ([]model.ModelHealthCheck, error) {
+	var checks []model.ModelHealthCheck
+	err := s.db.Where("model_id = ?", modelID).Order("api_key_id").Find(&checks).Error
+	return checks, err
+}
+
+func (s *ModelCheckService) check(ctx context.Context, m *model.Model, keyID int64, capabilities bool) *ModelCheckResult {
+	result := &ModelCheckResult{
+		ModelID:   m.ID,
+		APIKeyID:  keyID,
+		Adapter:   relay.AdapterName(m),
+		CheckedAt: time.Now(),
+	}
+	result.ProbeResult = s.probeChat(ctx, m)
+	if !result.Success || !capabilities {
+		return result
+	}
+
+	// 各项能力互不影响，并发检测
+	result.Capabilities = &Capabilities{}
+	var wg sync.WaitGroup
+	probes := []struct {
+		run func(context.Context, *model.Model) ProbeResult
+		out *ProbeResult
+	}{
+		{s.probeStream, &result.Capabilities.Streaming},
+		{s.probeTools, &result.Capabilities.Tools},
+		{s.probeVision, &result.Capabilities.Vision},
+	}
+	for _, p := range probes {
+		wg.Add(1)
+		go func(run func(context.Context, *model.Model) ProbeResult, out *ProbeResult) {
+			defer wg.Done()
+			*out = run(ctx, m)
+		}(p.run, p.out)
+	}
+	wg.Wait()
+	return result
+}
+
+// probeChat 基础的非流式对话补全
+func (s *ModelCheckService) probeChat(ctx context.Context, m *model.Model) ProbeResult {
+	req := &relay.ChatRequest{Messages: []relay.ChatMessage{{Role: "user", Content: relay.TextContent(checkPrompt)}}}
+	return s.probe(ctx, func(ctx context.Context) error {
+		_, _, err := s.client.ChatCompletionRaw(ctx, m, req)
+		return err
+	})
+}
+
+// probeStream 流式输出，收到第一个分片即计算耗时，流需要正常结束
+func (s *ModelCheckService) probeStream(ctx context.Context, m *model.Model) ProbeResult {
+	req := &relay.ChatRequest{Messages: []relay.ChatMessage{{Role: "user", Content: relay.TextContent(checkPrompt)}}}
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	start := time.Now()
+	stream, err := s.client.ChatCompletionStream(ctx, m, req)
+	if err != nil {
+		return probeFailure(start, err)
+	}
+	defer stream.Close()
+
+	var latency time.Duration
+	chunks := 0
+	for {
+		_, _, err := stream.RecvRaw()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return probeFailure(start, err)
+		}
+		if chunks == 0 {
+			latency = time.Since(start)
+		}
+		chunks++
+	}
+	if chunks == 0 {
+		return ProbeResult{StatusCode: http.StatusOK, LatencyMs: time.Since(start).Milliseconds(), Error: "上游没有返回任何分片"}
+	}
+	return ProbeResult{Success: true, StatusCode: http.StatusOK, LatencyMs: latency.Milliseconds()}
+}
+
+// probeTools 要求模型必须调用工具，上游接受请求但没有发起工具调用时视为不支持
+func (s *ModelCheckService) probeTools(ctx context.Context, m *model.Model) ProbeResult {
+	req := &relay.ChatRequest{
+		Messages: []relay.ChatMessage{{Role: "user", Content: relay.TextContent("What time is it now? Use the tool.")}},
+		Extra: map[string]json.RawMessage{
+			"tools":       checkTool,
+			"tool_choice": json.RawMessage(`"required"`),
+		},
+	}
+	return s.probe(ctx, func(ctx context.Context) error {
+		resp, err := s.client.ChatCompletion(ctx, m, req)
+		if err != nil {
+			return err
+		}
+		for _, c := range resp.Choices {
+			if len(c.Message.ToolCalls) > 0 {
+				return nil
+			}
+		}
+		return errNoToolCall
+	})
+}
+
+// probeVision 发送一张图片，上游接受请求即视为支持
+func (s *ModelCheckService) probeVision(ctx context.Context, m *model.Model) ProbeResult {
+	req := &relay.ChatRequest{Messages: []relay.ChatMessage{{Role: "user", Content: relay.MessageContent{Parts: []relay.ContentPart{
+		{Type: "text", Text: "What color is this image? " + checkPrompt},
+		{Type: "image_url", ImageURL: &relay.ImageURL{URL: checkImage}},
+	}}}}}
+	return s.probe(ctx, func(ctx context.Context) error {
+		_, _, err := s.client.ChatCompletionRaw(ctx, m, req)
+		return err
+	})
+}
+
+// errNoToolCall 上游返回成功但没有发起工具调用
+var errNoToolCall = errors.New("模型没有发起工具调用")
+
+// probe 执行一次非流式测试并记录耗时和状态码
+func (s *ModelCheckService) probe(ctx context.Context, call func(context.Context) error) ProbeResult {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	start := time.Now()
+	if err := call(ctx); err != nil {
+		return probeFailure(start, err)
+	}
+	return ProbeResult{Success: true, StatusCode: http.StatusOK, LatencyMs: time.Since(start).Milliseconds()}
+}
+
+// probeFailure 上游返回错误时记录状态码和错误响应体，网络错误时状态码为0
+func probeFailure(start time.Time, err error) ProbeResult {
+	result := ProbeResult{LatencyMs: time.Since(start).Milliseconds(), Error: err.Error()}
+	var apiErr *relay.APIError
+	if errors.As(err, &apiErr) {
+		result.StatusCode = apiErr.StatusCode
+		result.Error = apiErr.Body
+	} else if errors.Is(err, errNoToolCall) {
+		result.StatusCode = http.StatusOK
+	}
+	return result
+}
@@ -0,0 +1,36 @@
+package service
+
+import (
+	"gorm.io/gorm"
+
+	"cybermind/model-service/internal/model"
+)
+
+// ModelChange 模型配置变更的操作人和原因
+type ModelChange struct {
+	AdminID int64
+	Reason  string
+}
+
+// saveRevision 锁定模型并保存当前的完整配置(不含api_key)作为新版本，需在同一事务中更新模型之前调用
+func saveRevision(tx *gorm.DB, modelID int64, action string, change ModelChange) error {
+	var snapshot []byte
+	row := tx.Raw(`SELECT to_jsonb(m) - 'id' - 'created_at' - 'updated_at' - 'deleted_at' - 'api_key' FROM models m WHERE id = ? FOR UPDATE`, modelID).Row()
+	if err := row.Scan(&snapshot); err != nil {
+		return err
+	}
+
+	var version int
+	if err := tx.Model(&model.ModelRevision{}).Where("model_id = ?", modelID).
+		Select("COALESCE(MAX(version), 0)").Scan(&version).Error; err != nil {
+		return err
+	}
+	return tx.Create(&model.ModelRevision{
+		ModelID:  modelID,
+		Version:  version + 1,
+		Snapshot: snapshot,
+		Action:   action,
+		AdminID:  change.AdminID,
+		Reason:   change.Reason,
+	}).Error
+}
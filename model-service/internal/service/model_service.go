@@ -6,6 +6,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 	"cybermind/model-service/internal/model"
+	"cybermind/common/keycrypt"
 )
 
 type ModelService struct {
@@ -42,10 +43,24 @@ func (s *ModelService) GetModel(id int64) (*model.Model, error) {
 	return &m, nil
 }
 
-// UpdateModel 更新模型配置
-func (s *ModelService) UpdateModel(m *model.Model) error {
+// UpdateModel 更新模型配置，更新前保存当前配置的历史版本
+func (s *ModelService) UpdateModel(m *model.Model, change ModelChange) error {
 	log.Printf("Updating model: %+v", m)
-	err := s.db.Save(m).Error
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := saveRevision(tx, m.ID, model.RevisionActionUpdate, change); err != nil {
+			return err
+		}
+		// 列表接口只返回脱敏后的Key，未提交Key或提交的是脱敏后的Key时保持原Key不变
+		if m.APIKey == "" || keycrypt.IsMasked(string(m.APIKey)) {
+			var existing model.Model
+			if err := tx.Select("api_key").First(&existing, m.ID).Error; err != nil {
+				log.Printf("Error loading model %d: %v", m.ID, err)
+				return err
+			}
+			m.APIKey = existing.APIKey
+		}
+		return tx.Save(m).Error
+	})
 	if err != nil {
 		log.Printf("Error updating model: %v", err)
 	}
@@ -79,11 +94,46 @@ func (s *ModelService) DeleteModel(id int64) error {
 }
 
 // UpdateModelStatus 更新模型状态
-func (s *ModelService) UpdateModelStatus(id int64, status int) error {
+func (s *ModelService) UpdateModelStatus(id int64, status int, change ModelChange) error {
 	log.Printf("Updating model status: ID=%d, status=%d", id, status)
-	err := s.db.Model(&model.Model{}).Where("id = ?", id).Update("status", status).Error
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := saveRevision(tx, id, model.RevisionActionStatus, change); err != nil {
+			return err
+		}
+		return tx.Model(&model.Model{}).Where("id = ?", id).Update("status", status).Error
+	})
 	if err != nil {
 		log.Printf("Error updating model status: %v", err)
 	}
 	return err
-} 
\ No newline at end of file
+} 
+
+// availableModels 已启用且所属供应商未停用的模型
+func (s *ModelService) availableModels() *gorm.DB {
+	return s.db.Model(&model.Model{}).
+		Where("status = 1").
+		Where("provider NOT IN (?)", s.db.Model(&model.Provider{}).Select("code").Where("status = 0"))
+}
+
+// ListAvailableModels 获取可调用的模型列表
+func (s *ModelService) ListAvailableModels() ([]model.Model, error) {
+	var models []model.Model
+	err := s.availableModels().Order("id ASC").Find(&models).Error
+	return models, err
+}
+
+// FindAvailableModel 按名称查找可调用的模型，优先匹配上游模型名，其次匹配模型显示名称
+func (s *ModelService) FindAvailableModel(name string) (*model.Model, error) {
+	var m model.Model
+	err := s.availableModels().Where("model_name = ?", name).Order("id ASC").First(&m).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		err = s.availableModels().Where("name = ?", name).Order("id ASC").First(&m).Error
+	}
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("model not found")
+		}
+		return nil, err
+	}
+	return &m, nil
+}
@@ -0,0 +1,175 @@
+package service
+
+import (
+	"math"
+
+	"cybermind/model-service/internal/model"
+	"cybermind/model-service/internal/relay"
+)
+
+const (
+	messageOverheadTokens = 4    // 每条消息的角色和分隔符占用的token数
+	estimateImageTokens   = 765  // 每张图片按高清晰度估算的token数
+	defaultEstimateOutput = 1024 // 请求和模型配置都没有max_tokens时估算最高价格使用的输出token数
+)
+
+// PriceEstimate 发送前的价格预估，按token计费时输入token数为估算值，实际按上游返回的用量结算
+type PriceEstimate struct {
+	Mode         string              `json:"mode"`
+	Pricing      *model.ModelPricing `json:"pricing,omitempty"` // 按token计费时的单价
+	PromptTokens int                 `json:"prompt_tokens"`     // 估算的输入token数，包含模型预设
+	MaxTokens    int                 `json:"max_tokens"`        // 估算最高价格使用的输出token数
+	MinPoints    int                 `json:"min_points"`        // 输出为空时的积分
+	MaxPoints    int                 `json:"max_points"`        // 输出达到MaxTokens时的积分，即发送时预扣的积分
+}
+
+// TokenPoints 按token单价计算积分，不足一个积分的部分向上取整，低于单次最低积分时按最低积分
+func TokenPoints(p model.ModelPricing, promptTokens, cachedTokens, completionTokens int) int {
+	cachedPrice := p.CachedInputPrice
+	if cachedPrice == 0 {
+		cachedPrice = p.InputPrice
+	}
+	if cachedTokens > promptTokens {
+		cachedTokens = promptTokens
+	}
+	cost := (float64(promptTokens-cachedTokens)*p.InputPrice +
+		float64(cachedTokens)*cachedPrice +
+		float64(completionTokens)*p.OutputPrice) / 1000
+	// 避免浮点误差导致整数积分被向上取整
+	points := int(math.Ceil(cost - 1e-9))
+	if points < p.MinPoints {
+		points = p.MinPoints
+	}
+	return points
+}
+
+// UsagePoints 按实际用量计算的积分。按次计费或上游没有返回用量时返回false，保持发送时扣除的积分
+func UsagePoints(m *model.Model, usage *relay.Usage) (int, bool) {
+	if !m.Pricing.TokenBased() || usage == nil {
+		return 0, false
+	}
+	return TokenPoints(m.Pricing, usage.PromptTokens, usage.CachedTokens(), usage.CompletionTokens), true
+}
+
+// RoutePoints 按实际使用的路由(可能是计费方式不同的备用路由)结算的积分：按次计费时为PointsPerRequest，
+// 按token计费时按用量计算，上游没有返回用量时返回false，保持发送时扣除的积分
+func RoutePoints(m *model.Model, usage *relay.Usage) (int, bool) {
+	if !m.Pricing.TokenBased() {
+		return m.PointsPerRequest, true
+	}
+	return UsagePoints(m, usage)
+}
+
+// EstimatePrice 估算请求的价格：按次计费时为PointsPerRequest；按token计费时按消息长度估算输入token数
+func EstimatePrice(m *model.Model, req *relay.ChatRequest) *PriceEstimate {
+	if !m.Pricing.TokenBased() {
+		return &PriceEstimate{
+			Mode:      model.PricingModeRequest,
+			MinPoints: m.PointsPerRequest,
+			MaxPoints: m.PointsPerRequest,
+		}
+	}
+
+	prompt, maxTokens := estimateRequest(m, req)
+	pricing := m.Pricing
+	return &PriceEstimate{
+		Mode:         model.PricingModeToken,
+		Pricing:      &pricing,
+		PromptTokens: prompt,
+		MaxTokens:    maxTokens,
+		MinPoints:    TokenPoints(m.Pricing, prompt, 0, 0),
+		MaxPoints:    TokenPoints(m.Pricing, prompt, 0, maxTokens),
+	}
+}
+
+// InitialPoints 发送时预扣的积分：按次计费时为PointsPerRequest，按token计费时为输入加max_tokens的最高价格
+// (请求和模型配置都没有max_tokens时按defaultEstimateOutput)，完成后按实际用量退还差额
+func InitialPoints(m *model.Model, req *relay.ChatRequest) int {
+	return EstimatePrice(m, req).MaxPoints
+}
+
+// SettleUsage 结算使用的用量：上游返回了用量时为实际用量，否则(如流式输出中断或调用方取消)
+// 按估算的输入token数和已输出的completionTokens估算
+func SettleUsage(m *model.Model, req *relay.ChatRequest, usage *relay.Usage, completionTokens int) *relay.Usage {
+	if usage != nil || !m.Pricing.TokenBased() {
+		return usage
+	}
+	prompt, _ := estimateRequest(m, req)
+	return &relay.Usage{PromptTokens: prompt, CompletionTokens: completionTokens, TotalTokens: prompt + completionTokens}
+}
+
+// ChunkTokens 估算流式分片中输出内容的token数
+func ChunkTokens(chunk *relay.ChatChunk) int {
+	tokens := 0
+	for _, choice := range chunk.Choices {
+		tokens += outputTokens(&choice.Delta)
+	}
+	return tokens
+}
+
+// ResponseTokens 估算非流式响应中输出内容的token数
+func ResponseTokens(resp *relay.ChatResponse) int {
+	tokens := 0
+	for _, choice := range resp.Choices {
+		tokens += outputTokens(&choice.Message)
+	}
+	return tokens
+}
+
+// outputTokens 估算消息文本和工具调用的token数
+func outputTokens(msg *relay.ChatMessage) int {
+	tokens := estimateTextTokens(msg.Content.String())
+	for _, call := range msg.ToolCalls {
+		tokens += estimateTextTokens(call.Function.Name) + estimateTextTokens(call.Function.Arguments)
+	}
+	return tokens
+}
+
+// estimateRequest 估算请求的输入token数和最高输出token数，在副本上填充模型配置，计入模型预设和默认max_tokens
+func estimateRequest(m *model.Model, req *relay.ChatRequest) (prompt, maxTokens int) {
+	prepared := *req
+	relay.Prepare(m, &prepared)
+	prompt = EstimateTokens(prepared.Messages)
+	if tools, ok := prepared.Extra["tools"]; ok {
+		prompt += estimateTextTokens(string(tools))
+	}
+	maxTokens = defaultEstimateOutput
+	if prepared.MaxTokens != nil && *prepared.MaxTokens > 0 {
+		maxTokens = *prepared.MaxTokens
+	}
+	return prompt, maxTokens
+}
+
+// InitialEmbeddingPoints 向量化请求发送时预扣的积分，按token计费时按input的长度估算输入token数
+func InitialEmbeddingPoints(m *model.Model, input []byte) int {
+	if !m.Pricing.TokenBased() {
+		return m.PointsPerRequest
+	}
+	return TokenPoints(m.Pricing, estimateTextTokens(string(input)), 0, 0)
+}
+
+// EstimateTokens 按字符数粗略估算消息的token数：ASCII字符每4个约1个token，其他字符(如中文)每个约1个token
+func EstimateTokens(messages []relay.ChatMessage) int {
+	tokens := 0
+	for _, msg := range messages {
+		tokens += messageOverheadTokens + outputTokens(&msg)
+		for _, part := range msg.Content.Parts {
+			if part.Type == "image_url" {
+				tokens += estimateImageTokens
+			}
+		}
+	}
+	return tokens
+}
+
+func estimateTextTokens(text string) int {
+	ascii, other := 0, 0
+	for _, r := range text {
+		if r < 0x80 {
+			ascii++
+		} else {
+			other++
+		}
+	}
+	return (ascii+3)/4 + other
+}
@@ -0,0 +1,163 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+
+	"cybermind/model-service/internal/model"
+	"cybermind/model-service/internal/relay"
+)
+
+const (
+	requestLogQueueSize = 10000           // 内存队列长度，写入跟不上时丢弃新记录
+	requestLogBatchSize = 200             // 每批写入的记录数
+	requestLogInterval  = 2 * time.Second // 不足一批时的写入间隔
+)
+
+// RequestLogger 异步批量写入上游调用记录(model_requests)。记录先放入内存队列，
+// 攒够一批或每隔requestLogInterval写入一次；队列已满时丢弃记录，不阻塞请求
+type RequestLogger struct {
+	db    *gorm.DB
+	queue chan *model.ModelRequest
+	done  chan struct{}
+}
+
+func NewRequestLogger(db *gorm.DB) *RequestLogger {
+	return &RequestLogger{db: db, queue: make(chan *model.ModelRequest, requestLogQueueSize), done: make(chan struct{})}
+}
+
+// Start 启动后台写入，ctx取消时写入队列中剩余的记录后退出
+func (l *RequestLogger) Start(ctx context.Context) {
+	go func() {
+		defer close(l.done)
+		l.run(ctx)
+	}()
+}
+
+// Wait 等待Start的ctx取消后剩余记录写入完成
+func (l *RequestLogger) Wait() {
+	<-l.done
+}
+
+// Log 记录一次上游调用
+func (l *RequestLogger) Log(r *model.ModelRequest) {
+	if r.CreatedAt.IsZero() {
+		r.CreatedAt = time.Now()
+	}
+	select {
+	case l.queue <- r:
+	default:
+		log.Printf("调用记录队列已满，丢弃记录: request=%s model=%d", r.RequestID, r.ModelID)
+	}
+}
+
+func (l *RequestLogger) run(ctx context.Context) {
+	ticker := time.NewTicker(requestLogInterval)
+	defer ticker.Stop()
+
+	batch := make([]*model.ModelRequest, 0, requestLogBatchSize)
+	for {
+		select {
+		case r := <-l.queue:
+			batch = append(batch, r)
+			if len(batch) >= requestLogBatchSize {
+				batch = l.flush(batch)
+			}
+		case <-ticker.C:
+			batch = l.flush(batch)
+		case <-ctx.Done():
+			for {
+				select {
+				case r := <-l.queue:
+					batch = append(batch, r)
+				default:
+					l.flush(batch)
+					return
+				}
+			}
+		}
+	}
+}
+
+// flush 写入一批记录，返回清空后的batch供复用
+func (l *RequestLogger) flush(batch []*model.ModelRequest) []*model.ModelRequest {
+	if len(batch) == 0 {
+		return batch
+	}
+	if err := l.db.CreateInBatches(batch, requestLogBatchSize).Error; err != nil {
+		log.Printf("写入调用记录失败，丢弃 %d 条: %v", len(batch), err)
+	}
+	return batch[:0]
+}
+
+// RequestTrace 跟踪一个请求的上游调用，每次调用结束时写入一条记录
+type RequestTrace struct {
+	logger *RequestLogger
+	base   model.ModelRequest
+	start  time.Time
+	ttft   time.Duration
+}
+
+// Trace 开始跟踪请求，base为各次调用相同的字段(用户、令牌、来源、请求ID、请求选中的模型等)
+func (l *RequestLogger) Trace(base model.ModelRequest) *RequestTrace {
+	return &RequestTrace{logger: l, base: base}
+}
+
+// Begin 开始一次上游调用
+func (t *RequestTrace) Begin() {
+	t.start = time.Now()
+	t.ttft = 0
+}
+
+// FirstChunk 收到流式输出的一个分片，只记录第一次
+func (t *RequestTrace) FirstChunk() {
+	if t.ttft == 0 {
+		t.ttft = time.Since(t.start)
+	}
+}
+
+// End 结束一次上游调用并写入记录，usage和points为本次调用的用量和最终扣除的积分
+func (t *RequestTrace) End(route *Route, usage *relay.Usage, points int, err error) {
+	latency := time.Since(t.start)
+	ttft := t.ttft
+	if ttft == 0 {
+		ttft = latency
+	}
+
+	r := t.base
+	r.ModelID = route.Model.ID
+	r.KeyID = route.KeyID
+	r.Fallback = route.Fallback
+	r.Points = points
+	r.Latency = latency.Milliseconds()
+	r.TTFT = ttft.Milliseconds()
+	if usage != nil {
+		r.PromptTokens = usage.PromptTokens
+		r.CompletionTokens = usage.CompletionTokens
+		r.CachedTokens = usage.CachedTokens()
+		r.TotalTokens = usage.TotalTokens
+		if r.TotalTokens == 0 {
+			r.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+		}
+	}
+
+	var apiErr *relay.APIError
+	switch {
+	case err == nil:
+		r.Status = model.RequestStatusSuccess
+	case errors.Is(err, context.Canceled):
+		r.Status = model.RequestStatusCanceled
+	case errors.Is(err, relay.ErrContentBlocked):
+		r.Status, r.ErrorCode = model.RequestStatusFailed, 1007
+	default:
+		r.Status, r.ErrorCode = model.RequestStatusFailed, 1009
+	}
+	if errors.As(err, &apiErr) {
+		r.UpstreamStatus = apiErr.StatusCode
+	}
+	t.logger.Log(&r)
+}
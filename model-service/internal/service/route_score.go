@@ -0,0 +1,228 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"cybermind/model-service/internal/relay"
+)
+
+const (
+	scoreAlpha       = 0.2              // 滚动平均中新观测值的权重
+	scoreTTL         = 10 * time.Minute // 部署超过该时间没有调用时清空统计，重新按未知部署处理
+	scoreTTFTRef     = time.Second      // 首个分片耗时为该值时延迟得分为0.5
+	scoreLatencyRef  = 10 * time.Second // 完整响应耗时为该值时延迟得分为0.5
+	scoreTTFTWeight  = 0.7              // 首个分片耗时在延迟得分中的占比，其余为完整响应耗时
+	scoreHeadroomLow = 0.2              // 限额余量低于该占比时按比例降低得分
+	scoreExploreRate = 0.05             // 按得分选择时仍按权重随机分配的流量占比，使各部署的统计保持有效
+	scoreKeyTmpl     = "routescore:model:%d"
+	scoreQueueSize   = 10000 // 观测结果队列长度，处理跟不上时丢弃新结果
+	scoreWorkers     = 4     // 写入观测结果的协程数
+)
+
+// RouteStats 部署(模型)的滚动统计和得分，各项为按调用次数指数加权的滚动平均
+type RouteStats struct {
+	ModelID   int64      `json:"model_id"`
+	Samples   int64      `json:"samples"` // 统计有效期内的观测次数，为0时各项均为空，得分按1处理
+	TTFTMs    *float64   `json:"ttft_ms"`
+	LatencyMs *float64   `json:"latency_ms"`
+	ErrorRate float64    `json:"error_rate"`
+	Headroom  *float64   `json:"headroom"` // 最近一次上游返回的限额余量占比，上游不返回限额时为空
+	Score     float64    `json:"score"`    // 0到1，越大越好
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+}
+
+// routeScoreScript 更新部署的滚动统计：ttft/latency/err按指数加权滚动平均，headroom保存最近一次的值。
+// 参数小于0表示本次没有观测到该项
+var routeScoreScript = redis.NewScript(`
+local key = KEYS[1]
+local alpha = tonumber(ARGV[5])
+local function ewma(field, v)
+  if v < 0 then return end
+  local old = redis.call('HGET', key, field)
+  if old then v = tonumber(old) + alpha * (v - tonumber(old)) end
+  redis.call('HSET', key, field, tostring(v))
+end
+ewma('ttft', tonumber(ARGV[1]))
+ewma('latency', tonumber(ARGV[2]))
+ewma('err', tonumber(ARGV[3]))
+if tonumber(ARGV[4]) >= 0 then
+  redis.call('HSET', key, 'headroom', ARGV[4])
+end
+redis.call('HINCRBY', key, 'samples', 1)
+local t = redis.call('TIME')
+redis.call('HSET', key, 'updated_at', t[1])
+redis.call('PEXPIRE', key, tonumber(ARGV[6]))
+return 0
+`)
+
+// RouteScorer 根据上游调用的观测结果(首个分片耗时、完整响应耗时、错误率、限额余量)维护每个部署的滚动得分，
+// 统计保存在Redis中，多个实例共享。Redis不可用时所有部署得分相同。
+// 观测结果先放入内存队列，由后台协程写入Redis，不阻塞请求
+type RouteScorer struct {
+	rdb          *redis.Client
+	observations chan relay.Observation
+	wg           sync.WaitGroup
+}
+
+func NewRouteScorer(rdb *redis.Client) *RouteScorer {
+	return &RouteScorer{rdb: rdb, observations: make(chan relay.Observation, scoreQueueSize)}
+}
+
+// Start 启动写入观测结果的后台协程，ctx取消时写入队列中剩余的结果后退出
+func (s *RouteScorer) Start(ctx context.Context) {
+	for i := 0; i < scoreWorkers; i++ {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.run(ctx)
+		}()
+	}
+}
+
+// Wait 等待Start的ctx取消后剩余结果写入完成
+func (s *RouteScorer) Wait() {
+	s.wg.Wait()
+}
+
+func (s *RouteScorer) run(ctx context.Context) {
+	for {
+		select {
+		case o := <-s.observations:
+			s.record(o)
+		case <-ctx.Done():
+			for {
+				select {
+				case o := <-s.observations:
+					s.record(o)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func routeScoreKey(modelID int64) string {
+	return fmt.Sprintf(scoreKeyTmpl, modelID)
+}
+
+// Observe 记录一次对话补全的观测结果，放入队列后立即返回，队列已满时丢弃。调用方取消和请求本身导致的错误(如400)
+// 与部署无关，不记录；调用方提前关闭的流只记录首个分片耗时，未收到分片时不记录
+func (s *RouteScorer) Observe(o relay.Observation) {
+	if errors.Is(o.Err, context.Canceled) || (o.Err != nil && !ShouldFailover(o.Err)) || (o.Abandoned && o.TTFT == 0) {
+		return
+	}
+	select {
+	case s.observations <- o:
+	default:
+		log.Printf("部署观测结果队列已满，丢弃结果: model=%d", o.ModelID)
+	}
+}
+
+// record 写入一次观测结果：需要切换路由的错误计入错误率，429同时将限额余量记为0
+func (s *RouteScorer) record(o relay.Observation) {
+	ttft, latency, failed, headroom := -1.0, -1.0, 0, -1.0
+	if o.Abandoned {
+		ttft = float64(o.TTFT.Milliseconds())
+	} else if o.Err == nil {
+		ttft, latency = float64(o.TTFT.Milliseconds()), float64(o.Latency.Milliseconds())
+	} else {
+		failed = 1
+	}
+	if o.RateLimit != nil {
+		headroom = o.RateLimit.Headroom()
+	}
+	var apiErr *relay.APIError
+	if errors.As(o.Err, &apiErr) && apiErr.StatusCode == http.StatusTooManyRequests {
+		headroom = 0
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := routeScoreScript.Run(ctx, s.rdb, []string{routeScoreKey(o.ModelID)},
+		ttft, latency, failed, headroom, scoreAlpha, scoreTTL.Milliseconds()).Err(); err != nil {
+		log.Printf("记录部署得分失败: model=%d err=%v", o.ModelID, err)
+	}
+}
+
+// Stats 批量获取部署的滚动统计和得分，读取失败时返回的统计均为空(得分为1)
+func (s *RouteScorer) Stats(ctx context.Context, modelIDs []int64) (map[int64]RouteStats, error) {
+	pipe := s.rdb.Pipeline()
+	cmds := make([]*redis.MapStringStringCmd, len(modelIDs))
+	for i, id := range modelIDs {
+		cmds[i] = pipe.HGetAll(ctx, routeScoreKey(id))
+	}
+	_, err := pipe.Exec(ctx)
+
+	stats := make(map[int64]RouteStats, len(modelIDs))
+	for i, id := range modelIDs {
+		values, _ := cmds[i].Result()
+		stats[id] = parseRouteStats(id, values)
+	}
+	return stats, err
+}
+
+func parseRouteStats(modelID int64, values map[string]string) RouteStats {
+	st := RouteStats{ModelID: modelID}
+	st.Samples, _ = strconv.ParseInt(values["samples"], 10, 64)
+	if st.Samples > 0 {
+		st.TTFTMs = parseStat(values["ttft"])
+		st.LatencyMs = parseStat(values["latency"])
+		st.Headroom = parseStat(values["headroom"])
+		if v := parseStat(values["err"]); v != nil {
+			st.ErrorRate = *v
+		}
+		if sec, err := strconv.ParseInt(values["updated_at"], 10, 64); err == nil {
+			t := time.Unix(sec, 0)
+			st.UpdatedAt = &t
+		}
+	}
+	st.Score = st.score()
+	return st
+}
+
+func parseStat(v string) *float64 {
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return nil
+	}
+	return &f
+}
+
+// score 得分 = (1-错误率)² × 限额系数 × 延迟得分。没有观测到的项按满分处理，
+// 使新部署和长时间未调用的部署能分到试探流量
+func (st RouteStats) score() float64 {
+	latencyScore := 1.0
+	if st.TTFTMs != nil || st.LatencyMs != nil {
+		ttft, total := 1.0, 1.0
+		if st.TTFTMs != nil {
+			ttft = refScore(*st.TTFTMs, scoreTTFTRef)
+		}
+		if st.LatencyMs != nil {
+			total = refScore(*st.LatencyMs, scoreLatencyRef)
+		}
+		latencyScore = scoreTTFTWeight*ttft + (1-scoreTTFTWeight)*total
+	}
+	headroom := 1.0
+	if st.Headroom != nil && *st.Headroom < scoreHeadroomLow {
+		headroom = math.Max(*st.Headroom, 0) / scoreHeadroomLow
+	}
+	success := 1 - math.Min(math.Max(st.ErrorRate, 0), 1)
+	return success * success * headroom * latencyScore
+}
+
+// refScore 耗时为ref时为0.5，耗时越短越接近1
+func refScore(ms float64, ref time.Duration) float64 {
+	r := float64(ref.Milliseconds())
+	return r / (r + math.Max(ms, 0))
+}
@@ -0,0 +1,168 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+
+	"gorm.io/gorm"
+
+	"cybermind/model-service/internal/model"
+	"cybermind/model-service/internal/relay"
+)
+
+// Route 一次上游调用使用的路由
+type Route struct {
+	Model    *model.Model // 实际调用的模型，APIKey已替换为选中的Key
+	KeyID    int64
+	Fallback bool // 是否为备用路由
+
+	trial bool // 作为熔断器半开状态的试探请求放行，记录结果前占用试探名额
+}
+
+// RouteService 模型调用路由：依次尝试请求的模型和其备用路由，跳过已熔断的模型，
+// 调用失败时转到下一条路由，并记录Key健康状态和熔断器结果
+type RouteService struct {
+	db          *gorm.DB
+	models      *ModelService
+	keySelector *KeySelector
+	keyHealth   *KeyHealthService
+	breaker     *CircuitBreaker
+}
+
+func NewRouteService(db *gorm.DB, models *ModelService, keySelector *KeySelector, keyHealth *KeyHealthService, breaker *CircuitBreaker) *RouteService {
+	return &RouteService{db: db, models: models, keySelector: keySelector, keyHealth: keyHealth, breaker: breaker}
+}
+
+// Fallbacks 获取模型可用的备用模型，按优先级排序
+func (s *RouteService) Fallbacks(modelID int64) ([]model.Model, error) {
+	var fallbacks []model.ModelFallback
+	if err := s.db.Where("model_id = ?", modelID).Order("priority ASC, id ASC").Find(&fallbacks).Error; err != nil {
+		return nil, err
+	}
+	if len(fallbacks) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]int64, len(fallbacks))
+	for i, f := range fallbacks {
+		ids[i] = f.FallbackModelID
+	}
+	var available []model.Model
+	if err := s.models.availableModels().Where("id IN ?", ids).Find(&available).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[int64]model.Model, len(available))
+	for _, m := range available {
+		byID[m.ID] = m
+	}
+
+	models := make([]model.Model, 0, len(fallbacks))
+	for _, f := range fallbacks {
+		if m, ok := byID[f.FallbackModelID]; ok && m.ID != modelID {
+			models = append(models, m)
+		}
+	}
+	return models, nil
+}
+
+// Do 按路由依次调用call，直到成功或遇到不需要切换路由的错误，返回最后使用的路由。
+// 所有路由都已熔断时返回ErrCircuitOpen
+func (s *RouteService) Do(ctx context.Context, primary *model.Model, call func(route *Route) error) (*Route, error) {
+	return s.DoModels(ctx, []model.Model{*primary}, nil, call)
+}
+
+// DoModels 与Do相同，models为按顺序尝试的部署(如别名选出的部署)，之后再尝试第一个部署配置的备用路由。
+// allow不为nil时跳过不允许调用的备用路由(如API令牌限制了可调用的模型)
+func (s *RouteService) DoModels(ctx context.Context, models []model.Model, allow func(modelID int64) bool, call func(route *Route) error) (*Route, error) {
+	candidates := append([]model.Model(nil), models...)
+	fallbacks, err := s.Fallbacks(models[0].ID)
+	if err != nil {
+		log.Printf("查询备用路由失败: model=%d err=%v", models[0].ID, err)
+	}
+	seen := make(map[int64]bool, len(models))
+	for _, m := range models {
+		seen[m.ID] = true
+	}
+	for _, m := range fallbacks {
+		if !seen[m.ID] && (allow == nil || allow(m.ID)) {
+			candidates = append(candidates, m)
+		}
+	}
+
+	lastErr := ErrCircuitOpen
+	var lastRoute *Route
+	for i := range candidates {
+		m := &candidates[i]
+		allowed, trial := s.breaker.Allow(ctx, m.ID)
+		if !allowed {
+			continue
+		}
+
+		key, err := s.keySelector.Select(ctx, m)
+		if err != nil {
+			// 选择Key失败不计入熔断，释放试探名额；没有可用的Key时直接尝试下一条路由
+			if trial {
+				s.breaker.Release(m.ID)
+			}
+			lastErr = err
+			if !errors.Is(err, ErrNoAvailableKey) {
+				return nil, err
+			}
+			continue
+		}
+		m.APIKey = key.APIKey
+
+		route := &Route{Model: m, KeyID: key.KeyID, Fallback: i > 0, trial: trial}
+		err = call(route)
+		s.Report(route, err)
+		if err == nil {
+			return route, nil
+		}
+		lastErr, lastRoute = err, route
+		if !ShouldFailover(err) {
+			return route, err
+		}
+		if i < len(candidates)-1 {
+			log.Printf("模型调用失败，切换备用路由: model=%d err=%v", m.ID, err)
+		}
+	}
+	return lastRoute, lastErr
+}
+
+// Report 记录路由的调用结果，用于Key健康跟踪和熔断，流式输出中途出错时由调用方单独记录。
+// 请求本身的错误和调用方取消不计入熔断，作为试探请求时释放试探名额
+func (s *RouteService) Report(route *Route, err error) {
+	s.keyHealth.Report(route.KeyID, err)
+	switch {
+	case err == nil:
+		s.breaker.Record(route.Model.ID, true)
+	case ShouldFailover(err):
+		s.breaker.Record(route.Model.ID, false)
+	case route.trial:
+		s.breaker.Release(route.Model.ID)
+	}
+	route.trial = false
+}
+
+// ShouldFailover 判断错误是否由上游不可用导致，需要切换路由；
+// 请求本身的错误(如400)和调用方取消不切换
+func ShouldFailover(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, ErrNoAvailableKey) || errors.Is(err, ErrCircuitOpen) {
+		return true
+	}
+	var apiErr *relay.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.StatusCode {
+		case http.StatusUnauthorized, http.StatusForbidden, http.StatusRequestTimeout, http.StatusTooManyRequests:
+			return true
+		}
+		return apiErr.StatusCode >= 500
+	}
+	// 网络错误、超时等
+	return true
+}
@@ -0,0 +1,35 @@
+package service
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+
+	"cybermind/common/apitoken"
+	"cybermind/model-service/internal/model"
+)
+
+var (
+	ErrInvalidToken = apitoken.ErrInvalid
+	ErrTokenExpired = apitoken.ErrExpired
+	ErrIPNotAllowed = apitoken.ErrIPNotAllowed
+	ErrUserDisabled = apitoken.ErrUserDisabled
+)
+
+type TokenService struct {
+	db *gorm.DB
+}
+
+func NewTokenService(db *gorm.DB) *TokenService {
+	return &TokenService{db: db}
+}
+
+// Verify 在本地校验令牌(与auth-service共用common/apitoken的校验规则)：令牌需启用、未过期，来源IP在白名单内，
+// 所属用户需为正常状态。权限范围和模型由调用方按具体请求检查
+func (s *TokenService) Verify(ctx context.Context, token, ip string) (*model.APIToken, error) {
+	var t model.APIToken
+	if err := apitoken.Verify(ctx, s.db, token, ip, &t); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
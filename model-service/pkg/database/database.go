@@ -1,12 +1,15 @@
 package database
 
 import (
+	"fmt"
 	"log"
 	"time"
 
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 
+	"cybermind/common/keycrypt"
+	"cybermind/common/moderation"
 	"cybermind/model-service/internal/model"
 )
 
@@ -38,8 +41,16 @@ func InitDB() (*gorm.DB, error) {
 func AutoMigrate(db *gorm.DB) error {
 	log.Println("开始数据库迁移...")
 
-	// 迁移模型表、供应商表和API Key池表
-	if err := db.AutoMigrate(&model.Model{}, &model.Provider{}, &model.APIKeyPool{}); err != nil {
+	// 迁移模型表、供应商表、API Key池表、备用路由表、健康检查表、积分流水表、调用记录表和模型历史版本表，API令牌表由auth-service维护
+	if err := db.AutoMigrate(&model.Model{}, &model.Provider{}, &model.APIKeyPool{}, &model.ModelFallback{}, &model.ModelAlias{}, &model.ModelAliasTarget{}, &model.ModelHealthCheck{}, &model.PointsLedger{}, &model.ModelRequest{}, &model.ModelRevision{}); err != nil {
+		return err
+	}
+	// 审核词库、规则和命中记录表与chat-service共用，两个服务都迁移，任一服务先启动都能正常加载审核规则
+	if err := db.AutoMigrate(&moderation.Keyword{}, &moderation.Rule{}, &moderation.Event{}); err != nil {
+		return err
+	}
+	// 历史版本不保存api_key，清除早期版本中按旧主密钥加密的Key
+	if err := db.Exec(`UPDATE model_revisions SET snapshot = snapshot - 'api_key' WHERE snapshot ->> 'api_key' IS NOT NULL`).Error; err != nil {
 		return err
 	}
 	log.Println("数据库迁移完成")
@@ -113,3 +124,42 @@ func AutoMigrate(db *gorm.DB) error {
 
 	return nil
 }
+
+// apiKeyTables 保存上游API Key的表
+var apiKeyTables = []string{"models", "api_key_pools"}
+
+// EncryptAPIKeys 使用当前主密钥加密明文保存的上游API Key，rotate为true时同时重新加密
+// 使用旧主密钥加密的Key，返回更新的行数。直接读写api_key列，包含已软删除的行
+func EncryptAPIKeys(db *gorm.DB, ring *keycrypt.Keyring, rotate bool) (int, error) {
+	updated := 0
+	for _, table := range apiKeyTables {
+		var rows []struct {
+			ID     int64
+			APIKey string
+		}
+		if err := db.Table(table).Select("id, api_key").Where("api_key <> ''").Find(&rows).Error; err != nil {
+			return updated, err
+		}
+		for _, row := range rows {
+			keyID := keycrypt.KeyID(row.APIKey)
+			if keyID == ring.PrimaryID() || (keyID != "" && !rotate) {
+				continue
+			}
+			plain, err := ring.Decrypt(row.APIKey)
+			if err != nil {
+				return updated, fmt.Errorf("decrypt %s.api_key id=%d: %w", table, row.ID, err)
+			}
+			encrypted, err := ring.Encrypt(plain)
+			if err != nil {
+				return updated, err
+			}
+			// 按原值更新，避免覆盖期间被修改的Key
+			result := db.Table(table).Where("id = ? AND api_key = ?", row.ID, row.APIKey).UpdateColumn("api_key", encrypted)
+			if result.Error != nil {
+				return updated, result.Error
+			}
+			updated += int(result.RowsAffected)
+		}
+	}
+	return updated, nil
+}
@@ -0,0 +1,24 @@
+package database
+
+import (
+	"context"
+	"log"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// InitRedis 初始化Redis连接
+func InitRedis() (*redis.Client, error) {
+	rdb := redis.NewClient(&redis.Options{
+		Addr:     "cybermind-redis-redis.ns-han88ija.svc:6379",
+		Password: "mqjfcd8x",
+		DB:       0,
+	})
+
+	if err := rdb.Ping(context.Background()).Err(); err != nil {
+		return nil, err
+	}
+	log.Println("Redis连接成功")
+
+	return rdb, nil
+}